@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/hostinger/hbl/pkg/config"
+	"github.com/spf13/cobra"
+	"go.uber.org/multierr"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the server configuration.",
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Args:  cobra.NoArgs,
+	Short: "Validate the configuration file and environment.",
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			fmt.Printf("Error: %s\n", err)
+			os.Exit(1)
+		}
+		if err := cfg.Validate(); err != nil {
+			for _, e := range multierr.Errors(err) {
+				fmt.Printf("Error: %s\n", e)
+			}
+			os.Exit(1)
+		}
+		fmt.Println("Configuration is valid")
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configValidateCmd)
+	rootCmd.AddCommand(configCmd)
+}
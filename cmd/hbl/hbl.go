@@ -2,84 +2,191 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
-	"github.com/hostinger/hbl/pkg/alerters"
-	"github.com/hostinger/hbl/pkg/checkers"
+	"github.com/hostinger/hbl/pkg/config"
 	"github.com/hostinger/hbl/pkg/database"
-	"github.com/hostinger/hbl/pkg/endpoints"
 	"github.com/hostinger/hbl/pkg/hbl"
 	"github.com/hostinger/hbl/pkg/logger"
+	"github.com/spf13/cobra"
+	"go.uber.org/multierr"
 	"go.uber.org/zap"
 )
 
+var cfgFile string
+
+var rootCmd = &cobra.Command{
+	Use:   "hbl",
+	Short: "Hostinger Block List API",
+	Long:  "HTTP service for managing IP address block lists.",
+	Run: func(cmd *cobra.Command, args []string) {
+		serve()
+	},
+}
+
 // @title Hostinger Block List API
 // @version 1.0
 // @description Hostinger HTTP service for managing IP address block lists.
 // @host localhost:8080
 // @BasePath /api/v1
 func main() {
-	l := logger.NewLoggerFromEnv()
+	if err := rootCmd.Execute(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(
+		&cfgFile, "config", os.Getenv("HBL_CONFIG"), "Path to the configuration file. (HBL_CONFIG)")
+}
+
+func serve() {
+	cfg, err := config.Load(cfgFile)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	l := logger.NewLogger(cfg.Log.Channel)
+
+	if err := cfg.Validate(); err != nil {
+		for _, e := range multierr.Errors(err) {
+			l.Error("Invalid configuration", zap.Error(e))
+		}
+		l.Fatal("Failed to validate configuration", zap.String("config", cfgFile))
+	}
+	if err := l.SetLevel(cfg.Log.Level); err != nil {
+		l.Fatal("Failed to set log level", zap.Error(err))
+	}
+
+	protected, err := hbl.NewProtectedRanges(cfg.ProtectedRanges)
+	if err != nil {
+		l.Fatal("Failed to parse protected ranges", zap.Error(err))
+	}
+
+	prefixes, err := hbl.NewPrefixes(cfg.PrefixFile)
+	if err != nil {
+		l.Fatal("Failed to load prefix file", zap.Error(err))
+	}
+
+	health, err := hbl.NewHealthPolicy(cfg.Health.Critical)
+	if err != nil {
+		l.Fatal("Failed to parse health policy", zap.Error(err))
+	}
+
+	policy, err := hbl.NewPolicy(&cfg.Policy)
+	if err != nil {
+		l.Fatal("Failed to compile policy", zap.Error(err))
+	}
+
+	escalation := hbl.NewEscalationPolicy(&cfg.Escalation)
+
+	slack := hbl.NewSlackPolicy(&cfg.Slack)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 	defer cancel()
 
 	db, err := database.Init(ctx,
-		os.Getenv("HBL_MYSQL_USERNAME"),
-		os.Getenv("HBL_MYSQL_PASSWORD"),
-		os.Getenv("HBL_MYSQL_HOST"),
-		os.Getenv("HBL_MYSQL_PORT"),
-		os.Getenv("HBL_MYSQL_DATABASE"),
+		cfg.Database.Username,
+		cfg.Database.Password,
+		cfg.Database.Host,
+		cfg.Database.Port,
+		cfg.Database.Name,
 	)
 	if err != nil {
 		l.Fatal(
 			"Failed to initialize database",
-			zap.String("host", os.Getenv("HBL_MYSQL_HOST")),
-			zap.String("port", os.Getenv("HBL_MYSQL_PORT")),
+			zap.String("host", cfg.Database.Host),
+			zap.String("port", cfg.Database.Port),
 			zap.Error(err),
 		)
 	}
 
+	reg := newRegistries()
+	reg.alerters.SetRoutes(cfg.Alerters.Routes)
+	reg.alerters.Start(l, &cfg.Alerters.Queue)
+	incidents := hbl.NewIncidents(l, reg.alerters, &cfg.Incidents)
+
 	r := hbl.NewMySQLRepository(l, db)
-	s := hbl.NewDefaultService(l, r)
-	h := hbl.NewDefaultHandler(l, s)
+	webhooks := hbl.NewWebhooks(l, r, &cfg.Webhooks)
+	stream := hbl.NewStream(l, r, &cfg.Stream)
+	changes := hbl.NewChangeLog(l, r, &cfg.Changes)
+
+	rl := &reloader{
+		l:          l,
+		db:         db,
+		path:       cfgFile,
+		cfg:        cfg,
+		protected:  protected,
+		prefixes:   prefixes,
+		health:     health,
+		policy:     policy,
+		escalation: escalation,
+		slack:      slack,
+		incidents:  incidents,
+		webhooks:   webhooks,
+		stream:     stream,
+		changes:    changes,
+		plugins:    reg,
+	}
+
+	s := hbl.NewDefaultService(&hbl.ServiceConfig{
+		Logger:     l,
+		Repository: r,
+		Protected:  protected,
+		Prefixes:   prefixes,
+		Health:     health,
+		Policy:     policy,
+		Escalation: escalation,
+		Incidents:  incidents,
+		Webhooks:   webhooks,
+		Stream:     stream,
+		Endpoints:  reg.endpoints,
+		Checkers:   reg.checkers,
+		Alerters:   reg.alerters,
+	})
+	h := hbl.NewDefaultHandler(l, s, slack, rl.Reload)
 
 	api := hbl.NewAPI(
 		&hbl.Config{
 			Handler: h,
 			Logger:  l,
-			Host:    os.Getenv("HBL_LISTEN_ADDRESS"),
-			Port:    os.Getenv("HBL_LISTEN_PORT"),
+			Host:    cfg.Listen.Host,
+			Port:    cfg.Listen.Port,
 		},
 	)
 
 	api.Initialize(ctx)
 
-	switch os.Getenv("ENVIRONMENT") {
-	case "PRODUCTION":
-		// Endpoints
-		endpoints.Register(endpoints.NewCloudflareEndpoint(l))
-		endpoints.Register(endpoints.NewPDNSEndpoint(l))
-		// Checkers
-		checkers.Register(checkers.NewAbuseIPDBChecker(l, db))
-		// Alerters
-		alerters.Register(alerters.NewSlackAlerter(l))
-	case "STAGING":
-		// Endpoints
-		endpoints.Register(endpoints.NewPDNSEndpoint(l))
-		// Checkers
-		checkers.Register(checkers.NewAbuseIPDBChecker(l, db))
-		// Alerters
-		alerters.Register(alerters.NewSlackAlerter(l))
-	default:
-		// Endpoints
-		endpoints.Register(endpoints.NewPDNSEndpoint(l))
-		// Checkers
-		checkers.Register(checkers.NewAbuseIPDBChecker(l, db))
+	p, err := buildPlugins(l, db, cfg)
+	if err != nil {
+		for _, e := range multierr.Errors(err) {
+			l.Error("Failed to initialize plugin", zap.Error(e))
+		}
+		l.Fatal("Failed to initialize plugins", zap.String("config", cfgFile))
 	}
+	p.register(reg)
+
+	refresher := hbl.NewRefresher(l, r, reg.checkers, cfg.Checkers.RefreshInterval)
+	refresher.Start()
+
+	escalator := hbl.NewEscalator(l, s, reg.alerters, escalation)
+	escalator.Start()
+
+	expirer := hbl.NewExpirer(l, s, time.Minute)
+	expirer.Start()
+
+	incidents.Start()
+
+	webhooks.Start()
+
+	changes.Start()
+	stream.Start()
 
 	go func() {
 		api.Start()
@@ -90,9 +197,33 @@ func main() {
 
 	go func() {
 		<-signals
+		refresher.Stop()
+		escalator.Stop()
+		expirer.Stop()
+		incidents.Stop()
+		stream.Stop()
 		api.Stop()
+		webhooks.Stop()
+		changes.Stop()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		reg.alerters.Stop(ctx)
+		cancel()
+		if err := reg.close(); err != nil {
+			for _, e := range multierr.Errors(err) {
+				l.Error("Failed to close plugin", zap.Error(e))
+			}
+		}
 		os.Exit(0)
 	}()
 
+	reloads := make(chan os.Signal, 1)
+	signal.Notify(reloads, syscall.SIGHUP)
+
+	go func() {
+		for range reloads {
+			rl.Reload(context.Background()) // nolint
+		}
+	}()
+
 	select {}
 }
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"database/sql"
+	"io"
+
+	"github.com/hostinger/hbl/pkg/alerters"
+	"github.com/hostinger/hbl/pkg/checkers"
+	"github.com/hostinger/hbl/pkg/config"
+	"github.com/hostinger/hbl/pkg/endpoints"
+	"github.com/hostinger/hbl/pkg/logger"
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+)
+
+type plugins struct {
+	endpoints []endpoints.Endpoint
+	checkers  []checkers.Checker
+	alerters  []alerters.Alerter
+}
+
+// buildPlugins creates every endpoint, checker and alerter enabled in cfg.
+// All failures are collected and returned together.
+func buildPlugins(l logger.Logger, db *sql.DB, cfg *config.Config) (*plugins, error) {
+	var errs error
+	p := &plugins{}
+
+	// Endpoints
+	if cfg.Endpoints.PowerDNS.Enabled {
+		endpoint, err := endpoints.NewPDNSEndpoint(l, &cfg.Endpoints.PowerDNS)
+		if err != nil {
+			errs = multierr.Append(errs, errors.Wrap(err, "endpoints.powerdns"))
+		} else {
+			p.endpoints = append(p.endpoints, endpoint)
+		}
+	}
+	if cfg.Endpoints.Cloudflare.Enabled {
+		endpoint, err := endpoints.NewCloudflareEndpoint(l, &cfg.Endpoints.Cloudflare)
+		if err != nil {
+			errs = multierr.Append(errs, errors.Wrap(err, "endpoints.cloudflare"))
+		} else {
+			p.endpoints = append(p.endpoints, endpoint)
+		}
+	}
+
+	// Checkers
+	if cfg.Checkers.AbuseIPDB.Enabled {
+		checker, err := checkers.NewAbuseIPDBChecker(l, db, &cfg.Checkers.AbuseIPDB)
+		if err != nil {
+			errs = multierr.Append(errs, errors.Wrap(err, "checkers.abuseipdb"))
+		} else {
+			p.checkers = append(p.checkers, checker)
+		}
+	}
+	if cfg.Checkers.DNSBL.Enabled {
+		checker, err := checkers.NewDNSBLChecker(l, &cfg.Checkers.DNSBL)
+		if err != nil {
+			errs = multierr.Append(errs, errors.Wrap(err, "checkers.dnsbl"))
+		} else {
+			p.checkers = append(p.checkers, checker)
+		}
+	}
+	if cfg.Checkers.GeoIP.Enabled {
+		checker, err := checkers.NewGeoIPChecker(l, &cfg.Checkers.GeoIP)
+		if err != nil {
+			errs = multierr.Append(errs, errors.Wrap(err, "checkers.geoip"))
+		} else {
+			p.checkers = append(p.checkers, checker)
+		}
+	}
+
+	// Alerters
+	if cfg.Alerters.Slack.Enabled {
+		alerter, err := alerters.NewSlackAlerter(l, &cfg.Alerters.Slack)
+		if err != nil {
+			errs = multierr.Append(errs, errors.Wrap(err, "alerters.slack"))
+		} else {
+			p.alerters = append(p.alerters, alerter)
+		}
+	}
+	if cfg.Alerters.Email.Enabled {
+		alerter, err := alerters.NewEmailAlerter(l, &cfg.Alerters.Email)
+		if err != nil {
+			errs = multierr.Append(errs, errors.Wrap(err, "alerters.email"))
+		} else {
+			p.alerters = append(p.alerters, alerter)
+		}
+	}
+	if cfg.Alerters.Teams.Enabled {
+		alerter, err := alerters.NewTeamsAlerter(l, &cfg.Alerters.Teams)
+		if err != nil {
+			errs = multierr.Append(errs, errors.Wrap(err, "alerters.teams"))
+		} else {
+			p.alerters = append(p.alerters, alerter)
+		}
+	}
+	if cfg.Alerters.Mattermost.Enabled {
+		alerter, err := alerters.NewMattermostAlerter(l, &cfg.Alerters.Mattermost)
+		if err != nil {
+			errs = multierr.Append(errs, errors.Wrap(err, "alerters.mattermost"))
+		} else {
+			p.alerters = append(p.alerters, alerter)
+		}
+	}
+	if cfg.Alerters.Telegram.Enabled {
+		alerter, err := alerters.NewTelegramAlerter(l, &cfg.Alerters.Telegram)
+		if err != nil {
+			errs = multierr.Append(errs, errors.Wrap(err, "alerters.telegram"))
+		} else {
+			p.alerters = append(p.alerters, alerter)
+		}
+	}
+	if cfg.Alerters.PagerDuty.Enabled {
+		alerter, err := alerters.NewPagerDutyAlerter(l, &cfg.Alerters.PagerDuty)
+		if err != nil {
+			errs = multierr.Append(errs, errors.Wrap(err, "alerters.pagerduty"))
+		} else {
+			p.alerters = append(p.alerters, alerter)
+		}
+	}
+	if cfg.Alerters.Opsgenie.Enabled {
+		alerter, err := alerters.NewOpsgenieAlerter(l, &cfg.Alerters.Opsgenie)
+		if err != nil {
+			errs = multierr.Append(errs, errors.Wrap(err, "alerters.opsgenie"))
+		} else {
+			p.alerters = append(p.alerters, alerter)
+		}
+	}
+
+	if errs != nil {
+		p.close()
+		return nil, errs
+	}
+	return p, nil
+}
+
+// close closes the plugins which hold resources, for plugins which won't be
+// registered.
+func (p *plugins) close() {
+	var list []interface{}
+	for _, endpoint := range p.endpoints {
+		list = append(list, endpoint)
+	}
+	for _, checker := range p.checkers {
+		list = append(list, checker)
+	}
+	for _, alerter := range p.alerters {
+		list = append(list, alerter)
+	}
+	for _, plugin := range list {
+		if closer, ok := plugin.(io.Closer); ok {
+			closer.Close() // nolint
+		}
+	}
+}
+
+type registries struct {
+	endpoints *endpoints.Registry
+	checkers  *checkers.Registry
+	alerters  *alerters.Registry
+}
+
+func newRegistries() *registries {
+	return &registries{
+		endpoints: endpoints.NewRegistry(),
+		checkers:  checkers.NewRegistry(),
+		alerters:  alerters.NewRegistry(),
+	}
+}
+
+// register swaps the plugins currently in r for p.
+func (p *plugins) register(r *registries) {
+	r.endpoints.Replace(p.endpoints...)
+	r.checkers.Replace(p.checkers...)
+	r.alerters.Replace(p.alerters...)
+}
+
+// close closes the plugins registered in r, once nothing uses them anymore.
+func (r *registries) close() error {
+	return multierr.Combine(r.endpoints.Close(), r.checkers.Close(), r.alerters.Close())
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+
+	"github.com/hostinger/hbl/pkg/config"
+	"github.com/hostinger/hbl/pkg/hbl"
+	"github.com/hostinger/hbl/pkg/logger"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+// reloader re-reads the configuration file and applies everything which can
+// change without a restart: plugins, protected ranges, the prefix file,
+// policy rules, escalation, incident, webhook, stream, change log and Slack
+// settings, alert routes and the log level.
+type reloader struct {
+	mu         sync.Mutex
+	l          logger.Logger
+	db         *sql.DB
+	path       string
+	cfg        *config.Config
+	protected  *hbl.ProtectedRanges
+	prefixes   *hbl.Prefixes
+	health     *hbl.HealthPolicy
+	policy     *hbl.Policy
+	escalation *hbl.EscalationPolicy
+	slack      *hbl.SlackPolicy
+	incidents  *hbl.Incidents
+	webhooks   *hbl.Webhooks
+	stream     *hbl.Stream
+	changes    *hbl.ChangeLog
+	plugins    *registries
+}
+
+func (r *reloader) Reload(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.l.Info("Reloading configuration", zap.String("config", r.path))
+
+	cfg, err := config.Load(r.path)
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		r.logFailure(err)
+		return err
+	}
+
+	// Everything is built before anything is applied, so a failure leaves
+	// the running configuration untouched.
+	p, err := buildPlugins(r.l, r.db, cfg)
+	if err != nil {
+		r.logFailure(err)
+		return err
+	}
+	protected, e := hbl.NewProtectedRanges(cfg.ProtectedRanges)
+	err = multierr.Append(err, e)
+	prefixes, e := hbl.NewPrefixes(cfg.PrefixFile)
+	err = multierr.Append(err, e)
+	health, e := hbl.NewHealthPolicy(cfg.Health.Critical)
+	err = multierr.Append(err, e)
+	policy, e := hbl.NewPolicy(&cfg.Policy)
+	err = multierr.Append(err, e)
+	if err != nil {
+		p.close()
+		r.logFailure(err)
+		return err
+	}
+
+	// Validate checked the level, so setting it can't fail.
+	r.l.SetLevel(cfg.Log.Level) // nolint
+	r.protected.Replace(protected)
+	r.prefixes.Replace(prefixes)
+	r.health.Replace(health)
+	r.policy.Replace(policy)
+	r.escalation.Set(&cfg.Escalation)
+	r.slack.Set(&cfg.Slack)
+	r.incidents.Set(&cfg.Incidents)
+	r.webhooks.Set(&cfg.Webhooks)
+	r.stream.Set(&cfg.Stream)
+	r.changes.Set(&cfg.Changes)
+	r.plugins.alerters.SetQueue(&cfg.Alerters.Queue)
+	r.plugins.alerters.SetRoutes(cfg.Alerters.Routes)
+	p.register(r.plugins)
+
+	if cfg.Listen != r.cfg.Listen {
+		r.l.Info("Changes to 'listen' require a restart", zap.String("config", r.path))
+	}
+	if cfg.Database != r.cfg.Database {
+		r.l.Info("Changes to 'database' require a restart", zap.String("config", r.path))
+	}
+	if cfg.Checkers.RefreshInterval != r.cfg.Checkers.RefreshInterval {
+		r.l.Info("Changes to 'checkers.refresh_interval' require a restart", zap.String("config", r.path))
+	}
+	if cfg.Escalation.Enabled != r.cfg.Escalation.Enabled || cfg.Escalation.Interval != r.cfg.Escalation.Interval {
+		r.l.Info("Changes to 'escalation.enabled' and 'escalation.interval' require a restart", zap.String("config", r.path))
+	}
+	if cfg.Alerters.Queue.Size != r.cfg.Alerters.Queue.Size {
+		r.l.Info("Changes to 'alerters.queue.size' require a restart", zap.String("config", r.path))
+	}
+	if cfg.Incidents.Interval != r.cfg.Incidents.Interval {
+		r.l.Info("Changes to 'incidents.interval' require a restart", zap.String("config", r.path))
+	}
+	if cfg.Webhooks.QueueSize != r.cfg.Webhooks.QueueSize || cfg.Webhooks.Workers != r.cfg.Webhooks.Workers {
+		r.l.Info("Changes to 'webhooks.queue_size' and 'webhooks.workers' require a restart", zap.String("config", r.path))
+	}
+	if cfg.Log.Channel != r.cfg.Log.Channel {
+		r.l.Info("Changes to 'log.channel' require a restart", zap.String("config", r.path))
+	}
+	r.cfg = cfg
+
+	r.l.Info(
+		"Reloaded configuration",
+		zap.String("config", r.path),
+		zap.Int("endpoints", len(p.endpoints)),
+		zap.Int("checkers", len(p.checkers)),
+		zap.Int("alerters", len(p.alerters)),
+	)
+	return nil
+}
+
+func (r *reloader) logFailure(err error) {
+	for _, e := range multierr.Errors(err) {
+		r.l.Error("Failed to reload configuration", zap.String("config", r.path), zap.Error(e))
+	}
+}
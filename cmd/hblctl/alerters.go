@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/hostinger/hbl/sdk"
+	"github.com/spf13/cobra"
+)
+
+var alertersCmd = &cobra.Command{
+	Use:   "alerters",
+	Args:  cobra.NoArgs,
+	Short: "List alerters registered on the server.",
+	Run: func(cmd *cobra.Command, args []string) {
+		plugins, err := client.GetAlerters(cmd.Context())
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 3, '\t', tabwriter.AlignRight)
+		writePluginsHeader(w)
+		writePluginsTable(w, plugins...)
+		w.Flush()
+		writeQueues(plugins)
+	},
+}
+
+// writeQueues lists what happened to the alerts of every alerter which was
+// sent any.
+func writeQueues(plugins []*sdk.Plugin) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 3, '\t', tabwriter.AlignRight)
+	header := false
+	for _, plugin := range plugins {
+		if plugin.Queue == nil {
+			continue
+		}
+		if !header {
+			fmt.Fprint(w, "\nNAME\tQUEUED\tDELIVERED\tRETRIED\tFAILED\tDROPPED\tDIGESTS\n")
+			header = true
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%d\n",
+			plugin.Name, plugin.Queue.Queued, plugin.Queue.Delivered, plugin.Queue.Retried,
+			plugin.Queue.Failed, plugin.Queue.Dropped, plugin.Queue.Digests)
+	}
+	w.Flush()
+}
+
+func init() {
+	rootCmd.AddCommand(alertersCmd)
+}
@@ -1,31 +1,43 @@
 package main
 
 import (
-	"errors"
 	"log"
-	"net"
 
+	"github.com/hostinger/hbl/sdk"
 	"github.com/spf13/cobra"
 )
 
 var blockCmd = &cobra.Command{
-	Use:  "block <ip> <author> <comment>",
+	Use:  "block <ip|asn|country|network> <author> <comment>",
 	Args: cobra.ExactArgs(3),
 	PreRunE: func(cmd *cobra.Command, args []string) error {
-		if net.ParseIP(args[0]) == nil {
-			return errors.New("Argument 'IP' must be a valid IP address")
-		}
-		return nil
+		_, err := sdk.ParseKey(args[0])
+		return err
 	},
-	Short: "Block an IP address on Endpoints.",
+	Short: "Block an IP address, a whole ASN such as AS64496, a country such as RU or a network such as 192.0.2.0/24 on Endpoints.",
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := client.Block(cmd.Context(), args[0], args[1], args[2]); err != nil {
+		address, err := sdk.ParseKey(args[0])
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		address.Author = args[1]
+		address.Comment = args[2]
+		address.Source = blockSource
+		address.Categories = blockCategories
+		if err := client.BlockAddress(cmd.Context(), address); err != nil {
 			log.Fatalf("Error: %s", err)
 		}
 		log.Print("Action executed successfully")
 	},
 }
 
+var (
+	blockSource     string
+	blockCategories []string
+)
+
 func init() {
+	blockCmd.Flags().StringVar(&blockSource, "source", "", "What produced the block, e.g. 'fail2ban'.")
+	blockCmd.Flags().StringSliceVar(&blockCategories, "category", nil, "Why the address is blocked, e.g. 'ssh'. Can be repeated.")
 	rootCmd.AddCommand(blockCmd)
 }
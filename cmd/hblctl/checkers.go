@@ -0,0 +1,29 @@
+package main
+
+import (
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+var checkersCmd = &cobra.Command{
+	Use:   "checkers",
+	Args:  cobra.NoArgs,
+	Short: "List checkers registered on the server.",
+	Run: func(cmd *cobra.Command, args []string) {
+		plugins, err := client.GetCheckers(cmd.Context())
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 3, '\t', tabwriter.AlignRight)
+		writePluginsHeader(w)
+		writePluginsTable(w, plugins...)
+		w.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(checkersCmd)
+}
@@ -1,23 +1,20 @@
 package main
 
 import (
-	"errors"
 	"log"
-	"net"
 
+	"github.com/hostinger/hbl/sdk"
 	"github.com/spf13/cobra"
 )
 
 var deleteCmd = &cobra.Command{
-	Use:  "delete <ip>",
+	Use:  "delete <ip|asn|country|network>",
 	Args: cobra.ExactArgs(1),
 	PreRunE: func(cmd *cobra.Command, args []string) error {
-		if net.ParseIP(args[0]) == nil {
-			return errors.New("Argument 'IP' must be a valid IP address")
-		}
-		return nil
+		_, err := sdk.ParseKey(args[0])
+		return err
 	},
-	Short: "Delete an IP address on Endpoints.",
+	Short: "Delete an IP address, ASN, country or network on Endpoints.",
 	Run: func(cmd *cobra.Command, args []string) {
 		if err := client.Delete(cmd.Context(), args[0]); err != nil {
 			log.Fatalf("Error: %s", err)
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/hostinger/hbl/sdk"
+	"github.com/spf13/cobra"
+)
+
+var endpointsCmd = &cobra.Command{
+	Use:   "endpoints",
+	Args:  cobra.NoArgs,
+	Short: "List endpoints registered on the server.",
+	Run: func(cmd *cobra.Command, args []string) {
+		plugins, err := client.GetEndpoints(cmd.Context())
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 3, '\t', tabwriter.AlignRight)
+		writePluginsHeader(w)
+		writePluginsTable(w, plugins...)
+		w.Flush()
+		writeAggregations(plugins)
+	},
+}
+
+var endpointsPauseCmd = &cobra.Command{
+	Use:   "pause <name>",
+	Args:  cobra.ExactArgs(1),
+	Short: "Pause an endpoint, queueing its operations until it is resumed.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if _, err := client.PauseEndpoint(cmd.Context(), args[0]); err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		log.Print("Action executed successfully")
+	},
+}
+
+var endpointsResumeCmd = &cobra.Command{
+	Use:   "resume <name>",
+	Args:  cobra.ExactArgs(1),
+	Short: "Resume an endpoint, replaying its queued operations.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if _, err := client.ResumeEndpoint(cmd.Context(), args[0]); err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		log.Print("Action executed successfully")
+	},
+}
+
+func writePluginsHeader(w io.Writer) {
+	fmt.Fprint(w, "NAME\tENABLED\tSTATE\tQUEUED\tLAST_OPERATION\tLAST_HEALTH\tCONFIG\n")
+}
+
+func writePluginsTable(w io.Writer, args ...*sdk.Plugin) {
+	for _, plugin := range args {
+		fmt.Fprintf(w, "%s\t%t\t%s\t%d\t%s\t%s\t%s\n",
+			plugin.Name, plugin.Enabled, plugin.State, plugin.Queued,
+			formatPluginResult(plugin.LastOperation), formatPluginResult(plugin.LastHealth),
+			formatPluginConfig(plugin.Config))
+	}
+}
+
+// writeAggregations lists the endpoints holding aggregated networks, if
+// any, with how many networks were truncated on their last sync.
+func writeAggregations(plugins []*sdk.Plugin) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 3, '\t', tabwriter.AlignRight)
+	header := false
+	for _, plugin := range plugins {
+		if plugin.Aggregation == nil {
+			continue
+		}
+		if !header {
+			fmt.Fprint(w, "\nNAME\tENTRIES\tNETWORKS\tTRUNCATED\tSYNCED_AT\n")
+			header = true
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\n",
+			plugin.Name, plugin.Aggregation.Entries, plugin.Aggregation.Networks,
+			plugin.Aggregation.Truncated, plugin.Aggregation.At.Format("2006-01-02 15:04:05"))
+	}
+	w.Flush()
+}
+
+func formatPluginResult(result *sdk.PluginResult) string {
+	if result == nil {
+		return "-"
+	}
+	status := "OK"
+	if result.Error != "" {
+		status = result.Error
+	}
+	return fmt.Sprintf("%s %s (%s)", result.Operation, status, result.At.Format("2006-01-02 15:04:05"))
+}
+
+func formatPluginConfig(config map[string]string) string {
+	keys := make([]string, 0, len(config))
+	for key := range config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", key, config[key]))
+	}
+	return strings.Join(pairs, " ")
+}
+
+func init() {
+	endpointsCmd.AddCommand(endpointsPauseCmd)
+	endpointsCmd.AddCommand(endpointsResumeCmd)
+	rootCmd.AddCommand(endpointsCmd)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"text/tabwriter"
+
+	"github.com/hostinger/hbl/sdk"
+	"github.com/spf13/cobra"
+)
+
+var escalationsCmd = &cobra.Command{
+	Use:   "escalations",
+	Args:  cobra.NoArgs,
+	Short: "List networks holding enough blocked addresses to be blocked as a whole.",
+	Run: func(cmd *cobra.Command, args []string) {
+		escalations, err := client.GetEscalations(cmd.Context())
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 3, '\t', tabwriter.AlignRight)
+		writeEscalationsHeader(w)
+		writeEscalationsTable(w, escalations...)
+		w.Flush()
+	},
+}
+
+var escalationsApplyCmd = &cobra.Command{
+	Use:  "apply <network> <author> <comment>",
+	Args: cobra.ExactArgs(3),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		_, _, err := net.ParseCIDR(args[0])
+		return err
+	},
+	Short: "Block a suggested network and delete the blocked addresses it covers.",
+	Run: func(cmd *cobra.Command, args []string) {
+		escalation, err := client.Escalate(cmd.Context(), args[0], args[1], args[2])
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		log.Printf("Action executed successfully, %d addresses retired", escalation.Retired)
+	},
+}
+
+func writeEscalationsHeader(w io.Writer) {
+	fmt.Fprint(w, "NETWORK\tCOUNT\tFIRST_BLOCKED_AT\tLAST_BLOCKED_AT\tSKIPPED\n")
+}
+
+func writeEscalationsTable(w io.Writer, args ...*sdk.Escalation) {
+	for _, escalation := range args {
+		skipped := escalation.Skipped
+		if skipped == "" {
+			skipped = "-"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n",
+			escalation.Network, escalation.Count,
+			escalation.FirstBlockedAt, escalation.LastBlockedAt, skipped)
+	}
+}
+
+func init() {
+	escalationsCmd.AddCommand(escalationsApplyCmd)
+	rootCmd.AddCommand(escalationsCmd)
+}
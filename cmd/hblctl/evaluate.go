@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"text/tabwriter"
+
+	"github.com/hostinger/hbl/sdk"
+	"github.com/spf13/cobra"
+)
+
+var evaluateAddress sdk.Address
+
+var evaluateCmd = &cobra.Command{
+	Use:  "evaluate <ip>",
+	Args: cobra.ExactArgs(1),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if net.ParseIP(args[0]) == nil {
+			return errors.New("Argument 'IP' must be a valid IP address")
+		}
+		return nil
+	},
+	Short: "Show what the policy decides for an IP address.",
+	Run: func(cmd *cobra.Command, args []string) {
+		decision, err := client.Evaluate(cmd.Context(), args[0], &evaluateAddress)
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		fmt.Printf("Action: %s\n", decision.Action)
+		if decision.Rule != "" {
+			fmt.Printf("Rule: %s\n", decision.Rule)
+		}
+		if decision.Duration != "" {
+			fmt.Printf("Duration: %s\n", decision.Duration)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 3, '\t', tabwriter.AlignRight)
+		fmt.Fprint(w, "RULE\tMATCHED\tWHEN\tERROR\n")
+		for _, rule := range decision.Rules {
+			fmt.Fprintf(w, "%s\t%t\t%s\t%s\n", rule.Name, rule.Matched, rule.When, rule.Error)
+		}
+		w.Flush()
+	},
+}
+
+func init() {
+	evaluateCmd.Flags().StringVar(&evaluateAddress.Source, "source", "", "What would produce the block, e.g. 'fail2ban'.")
+	evaluateCmd.Flags().StringSliceVar(&evaluateAddress.Categories, "category", nil, "Why the address would be blocked, e.g. 'ssh'. Can be repeated.")
+	rootCmd.AddCommand(evaluateCmd)
+}
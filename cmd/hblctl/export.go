@@ -0,0 +1,31 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/hostinger/hbl/sdk"
+	"github.com/spf13/cobra"
+)
+
+var exportFilter sdk.AddressFilter
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Args:  cobra.NoArgs,
+	Short: "Export addresses from database as CSV.",
+	Run: func(cmd *cobra.Command, args []string) {
+		data, err := client.Export(cmd.Context(), &exportFilter)
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		if _, err := os.Stdout.Write(data); err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+	},
+}
+
+func init() {
+	addFilterFlags(exportCmd, &exportFilter)
+	rootCmd.AddCommand(exportCmd)
+}
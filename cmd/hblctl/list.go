@@ -1,11 +1,9 @@
 package main
 
 import (
-	"errors"
 	"fmt"
 	"io"
 	"log"
-	"net"
 	"os"
 	"text/tabwriter"
 
@@ -14,11 +12,12 @@ import (
 )
 
 var listCmd = &cobra.Command{
-	Use:  "list [<ip>]",
+	Use:  "list [<ip|asn|country|network>]",
 	Args: cobra.MaximumNArgs(1),
 	PreRunE: func(cmd *cobra.Command, args []string) error {
-		if len(args) > 0 && net.ParseIP(args[0]) == nil {
-			return errors.New("Argument 'IP' must be a valid IP address")
+		if len(args) > 0 {
+			_, err := sdk.ParseKey(args[0])
+			return err
 		}
 		return nil
 	},
@@ -35,7 +34,7 @@ var listCmd = &cobra.Command{
 			w.Flush()
 			return
 		}
-		addresses, err := client.GetAll(cmd.Context())
+		addresses, err := client.List(cmd.Context(), &listFilter)
 		if err != nil {
 			log.Fatalf("Error: %s", err)
 		}
@@ -48,16 +47,41 @@ var listCmd = &cobra.Command{
 }
 
 func writeAddressesHeader(w io.Writer) {
-	fmt.Fprint(w, "IP\tACTION\tAUTHOR\tCOMMENT\tCREATED_AT\n")
+	fmt.Fprint(w, "IP\tTARGET\tACTION\tAUTHOR\tCOMMENT\tCOUNTRY\tASN\tCREATED_AT\n")
 }
 
 func writeAddressesTable(w io.Writer, args ...*sdk.Address) {
 	for _, address := range args {
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
-			address.IP, address.Action, address.Author, address.Comment, address.CreatedAt)
+		asn := ""
+		if address.ASN != 0 {
+			asn = fmt.Sprintf("AS%d", address.ASN)
+		}
+		target := address.Target
+		if target == "" {
+			target = sdk.TargetIP
+		}
+		ip := address.IP
+		if target == sdk.TargetNetwork {
+			ip = address.Network
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			ip, target, address.Action, address.Author, address.Comment,
+			address.Country, asn, address.CreatedAt)
 	}
 }
 
+var listFilter sdk.AddressFilter
+
+// addFilterFlags registers the flags which narrow down a listing of
+// addresses on cmd.
+func addFilterFlags(cmd *cobra.Command, filter *sdk.AddressFilter) {
+	cmd.Flags().StringVar(&filter.Target, "target", "", "Only entries for this target, 'ip', 'asn', 'country' or 'network'.")
+	cmd.Flags().StringVar(&filter.Action, "action", "", "Only addresses with this action, 'Block' or 'Allow'.")
+	cmd.Flags().StringVar(&filter.Country, "country", "", "Only addresses from this ISO country code.")
+	cmd.Flags().UintVar(&filter.ASN, "asn", 0, "Only addresses from this autonomous system.")
+}
+
 func init() {
+	addFilterFlags(listCmd, &listFilter)
 	rootCmd.AddCommand(listCmd)
 }
@@ -1,19 +1,19 @@
 package main
 
 import (
-	"errors"
 	"log"
-	"net"
 
+	"github.com/hostinger/hbl/sdk"
 	"github.com/spf13/cobra"
 )
 
 var syncCmd = &cobra.Command{
-	Use:  "sync [<ip>]",
+	Use:  "sync [<ip|asn|country|network>]",
 	Args: cobra.MaximumNArgs(1),
 	PreRunE: func(cmd *cobra.Command, args []string) error {
-		if len(args) > 0 && net.ParseIP(args[0]) == nil {
-			return errors.New("Argument 'IP' must be a valid IP address")
+		if len(args) > 0 {
+			_, err := sdk.ParseKey(args[0])
+			return err
 		}
 		return nil
 	},
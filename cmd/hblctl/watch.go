@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/hostinger/hbl/sdk"
+	"github.com/spf13/cobra"
+)
+
+var watchSince int64
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Args:  cobra.NoArgs,
+	Short: "Print changes of the list as they happen.",
+	Run: func(cmd *cobra.Command, args []string) {
+		w := tabwriter.NewWriter(os.Stdout, 12, 8, 3, '\t', tabwriter.AlignRight)
+		writeChangesHeader(w)
+		w.Flush()
+		err := client.Watch(cmd.Context(), watchSince, func(change *sdk.Change) error {
+			writeChangesTable(w, change)
+			return w.Flush()
+		})
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+	},
+}
+
+func writeChangesHeader(w io.Writer) {
+	fmt.Fprint(w, "SEQUENCE\tTYPE\tKEY\tACTION\tAUTHOR\tCOMMENT\tAT\n")
+}
+
+func writeChangesTable(w io.Writer, args ...*sdk.Change) {
+	for _, change := range args {
+		if change.Address == nil {
+			fmt.Fprintf(w, "%d\t%s\t-\t-\t-\t-\t%s\n", change.Sequence, change.Type, change.At)
+			continue
+		}
+		address := change.Address
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			change.Sequence, change.Type, address.Key(), address.Action,
+			address.Author, address.Comment, change.At)
+	}
+}
+
+func init() {
+	watchCmd.Flags().Int64Var(&watchSince, "since", 0, "Sequence of the last change seen, to print the changes following it first")
+	rootCmd.AddCommand(watchCmd)
+}
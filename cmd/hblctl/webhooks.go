@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/hostinger/hbl/sdk"
+	"github.com/spf13/cobra"
+)
+
+var webhooksCmd = &cobra.Command{
+	Use:   "webhooks",
+	Args:  cobra.NoArgs,
+	Short: "List webhooks subscribed to address changes.",
+	Run: func(cmd *cobra.Command, args []string) {
+		webhooks, err := client.GetWebhooks(cmd.Context())
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 3, '\t', tabwriter.AlignRight)
+		writeWebhooksHeader(w)
+		writeWebhooksTable(w, webhooks...)
+		w.Flush()
+	},
+}
+
+var webhookCreate sdk.Webhook
+
+var webhooksCreateCmd = &cobra.Command{
+	Use:   "create <url>",
+	Args:  cobra.ExactArgs(1),
+	Short: "Subscribe a webhook and print its secret, which is never shown again.",
+	Run: func(cmd *cobra.Command, args []string) {
+		webhookCreate.URL = args[0]
+		webhook, err := client.CreateWebhook(cmd.Context(), &webhookCreate)
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		log.Printf("Action executed successfully, webhook %d signs deliveries with secret %s", webhook.ID, webhook.Secret)
+	},
+}
+
+var webhooksDeleteCmd = &cobra.Command{
+	Use:   "delete <id>",
+	Args:  cobra.ExactArgs(1),
+	Short: "Unsubscribe a webhook and delete its deliveries.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := client.DeleteWebhook(cmd.Context(), parseID(args[0])); err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		log.Print("Action executed successfully")
+	},
+}
+
+var (
+	deliveriesStatus string
+	deliveriesLimit  int
+)
+
+var webhooksDeliveriesCmd = &cobra.Command{
+	Use:   "deliveries <id>",
+	Args:  cobra.ExactArgs(1),
+	Short: "List the latest deliveries of a webhook.",
+	Run: func(cmd *cobra.Command, args []string) {
+		deliveries, err := client.GetDeliveries(cmd.Context(), parseID(args[0]), deliveriesStatus, deliveriesLimit)
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 3, '\t', tabwriter.AlignRight)
+		writeDeliveriesHeader(w)
+		writeDeliveriesTable(w, deliveries...)
+		w.Flush()
+	},
+}
+
+var webhooksRedeliverCmd = &cobra.Command{
+	Use:   "redeliver <id> <delivery>",
+	Args:  cobra.ExactArgs(2),
+	Short: "Send the event of a past delivery again.",
+	Run: func(cmd *cobra.Command, args []string) {
+		delivery, err := client.Redeliver(cmd.Context(), parseID(args[0]), parseID(args[1]))
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		log.Printf("Action executed successfully, queued as delivery %d", delivery.ID)
+	},
+}
+
+func parseID(arg string) int64 {
+	id, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || id <= 0 {
+		log.Fatalf("Error: Argument '%s' must be a positive number", arg)
+	}
+	return id
+}
+
+func writeWebhooksHeader(w io.Writer) {
+	fmt.Fprint(w, "ID\tURL\tEVENTS\tCREATED_AT\n")
+}
+
+func writeWebhooksTable(w io.Writer, args ...*sdk.Webhook) {
+	for _, webhook := range args {
+		events := strings.Join(webhook.Events, ",")
+		if events == "" {
+			events = "*"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", webhook.ID, webhook.URL, events, webhook.CreatedAt)
+	}
+}
+
+func writeDeliveriesHeader(w io.Writer) {
+	fmt.Fprint(w, "ID\tEVENT\tEVENT_ID\tSTATUS\tATTEMPTS\tSTATUS_CODE\tERROR\tUPDATED_AT\n")
+}
+
+func writeDeliveriesTable(w io.Writer, args ...*sdk.WebhookDelivery) {
+	for _, delivery := range args {
+		code, e := "-", "-"
+		if delivery.StatusCode != 0 {
+			code = strconv.Itoa(delivery.StatusCode)
+		}
+		if delivery.Error != "" {
+			e = delivery.Error
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n",
+			delivery.ID, delivery.Event, delivery.EventID, delivery.Status,
+			delivery.Attempts, code, e, delivery.UpdatedAt)
+	}
+}
+
+func init() {
+	webhooksCreateCmd.Flags().StringSliceVar(&webhookCreate.Events, "events", nil, "Event types or patterns to subscribe to, e.g. 'address.blocked,address.deleted', every event by default")
+	webhooksCreateCmd.Flags().StringVar(&webhookCreate.Secret, "secret", "", "Secret signing deliveries, generated by default")
+	webhooksDeliveriesCmd.Flags().StringVar(&deliveriesStatus, "status", "", "Only list deliveries with this status: pending, delivered or failed")
+	webhooksDeliveriesCmd.Flags().IntVar(&deliveriesLimit, "limit", 50, "Maximum number of deliveries")
+	webhooksCmd.AddCommand(webhooksCreateCmd, webhooksDeleteCmd, webhooksDeliveriesCmd, webhooksRedeliverCmd)
+	rootCmd.AddCommand(webhooksCmd)
+}
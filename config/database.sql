@@ -7,11 +7,41 @@ CREATE TABLE IF NOT EXISTS `addresses` (
   `author` VARCHAR(100) NOT NULL,
   `action` VARCHAR(100) NOT NULL,
   `comment` VARCHAR(100) NOT NULL,
+  `source` VARCHAR(100) NOT NULL DEFAULT '',
+  `categories` VARCHAR(255) NOT NULL DEFAULT '',
+  `country` CHAR(2) NOT NULL DEFAULT '',
+  `asn` INT UNSIGNED NOT NULL DEFAULT 0,
+  `organization` VARCHAR(255) NOT NULL DEFAULT '',
   `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `expires_at` TIMESTAMP NULL DEFAULT NULL,
   UNIQUE INDEX `idx_ip` (`ip`),
+  INDEX `idx_country` (`country`),
+  INDEX `idx_asn` (`asn`),
+  INDEX `idx_expires_at` (`expires_at`),
   PRIMARY KEY (`ip`)
 );
 
+CREATE TABLE IF NOT EXISTS `address_reports` (
+  `ip` VARBINARY(16) NOT NULL,
+  `reporter` VARCHAR(50) NOT NULL,
+  `status` VARCHAR(20) NOT NULL,
+  `message` VARCHAR(255) NOT NULL DEFAULT '',
+  `reported_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`ip`, `reporter`)
+);
+
+CREATE TABLE IF NOT EXISTS `targets` (
+  `target` VARCHAR(10) NOT NULL,
+  `value` VARCHAR(50) NOT NULL,
+  `author` VARCHAR(100) NOT NULL,
+  `action` VARCHAR(100) NOT NULL,
+  `comment` VARCHAR(100) NOT NULL,
+  `source` VARCHAR(100) NOT NULL DEFAULT '',
+  `categories` VARCHAR(255) NOT NULL DEFAULT '',
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`target`, `value`)
+);
+
 CREATE TABLE IF NOT EXISTS `abuseipdb_metadata` (
   `ip` VARBINARY(16),
   `country_code` VARCHAR(50),
@@ -20,7 +50,83 @@ CREATE TABLE IF NOT EXISTS `abuseipdb_metadata` (
   `abuse_confidence_score` INT,
   `num_distinct_users` INT,
   `total_reports` INT,
-  `last_reported_at` TIMESTAMP,
+  `last_reported_at` TIMESTAMP NULL,
+  `fetched_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
   UNIQUE INDEX `idx_ip` (`ip`),
   PRIMARY KEY (`ip`)
 );
+
+CREATE TABLE IF NOT EXISTS `abuseipdb_history` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `ip` VARBINARY(16) NOT NULL,
+  `country_code` VARCHAR(50),
+  `usage_type` VARCHAR(50),
+  `isp` VARCHAR(50),
+  `abuse_confidence_score` INT,
+  `num_distinct_users` INT,
+  `total_reports` INT,
+  `last_reported_at` TIMESTAMP NULL,
+  `fetched_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  INDEX `idx_ip_fetched_at` (`ip`, `fetched_at`),
+  PRIMARY KEY (`id`)
+);
+
+CREATE TABLE IF NOT EXISTS `abuseipdb_quota` (
+  `endpoint` VARCHAR(50) NOT NULL,
+  `quota_limit` INT NOT NULL,
+  `remaining` INT NOT NULL,
+  `reset_at` TIMESTAMP NULL,
+  `updated_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`endpoint`)
+);
+
+CREATE TABLE IF NOT EXISTS `webhooks` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `url` VARCHAR(2048) NOT NULL,
+  `events` VARCHAR(255) NOT NULL DEFAULT '',
+  `secret` VARCHAR(255) NOT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`)
+);
+
+CREATE TABLE IF NOT EXISTS `webhook_deliveries` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `webhook_id` BIGINT NOT NULL,
+  `event_id` CHAR(32) NOT NULL,
+  `event` VARCHAR(50) NOT NULL,
+  `payload` TEXT NOT NULL,
+  `status` VARCHAR(20) NOT NULL,
+  `attempts` INT NOT NULL DEFAULT 0,
+  `status_code` INT NOT NULL DEFAULT 0,
+  `error` VARCHAR(255) NOT NULL DEFAULT '',
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  INDEX `idx_webhook_id` (`webhook_id`, `id`),
+  INDEX `idx_status` (`status`),
+  INDEX `idx_created_at` (`created_at`),
+  PRIMARY KEY (`id`)
+);
+
+CREATE TABLE IF NOT EXISTS `address_changes` (
+  `id` BIGINT NOT NULL,
+  `type` VARCHAR(10) NOT NULL,
+  `entry` VARCHAR(64) NOT NULL,
+  `address` TEXT NOT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  INDEX `idx_created_at` (`created_at`),
+  PRIMARY KEY (`id`)
+);
+
+CREATE TABLE IF NOT EXISTS `address_changes_sequence` (
+  `id` BIGINT NOT NULL
+);
+
+INSERT INTO `address_changes_sequence` (`id`)
+  SELECT 1 FROM DUAL WHERE NOT EXISTS (SELECT * FROM `address_changes_sequence`);
+
+CREATE TABLE IF NOT EXISTS `webhook_cursor` (
+  `id` BIGINT NOT NULL
+);
+
+INSERT INTO `webhook_cursor` (`id`)
+  SELECT `id` FROM `address_changes_sequence` WHERE NOT EXISTS (SELECT * FROM `webhook_cursor`);
@@ -87,19 +87,3 @@ CREATE TABLE tsigkeys (
 ) Engine=InnoDB CHARACTER SET 'latin1';
 
 CREATE UNIQUE INDEX namealgoindex ON tsigkeys(name, algorithm);
-
-INSERT INTO `domainmetadata` (`id`, `domain_id`, `kind`, `content`)
-VALUES
-(2, 1, 'SOA-EDIT-API', 'INCEPTION-INCREMENT'),
-(3, 1, 'SOA-EDIT', 'INCEPTION-INCREMENT');
-
-
-INSERT INTO `domains` (`id`, `name`, `master`, `last_check`, `type`, `notified_serial`, `account`)
-VALUES
-(1, 'hostinger.rbl', '', NULL, 'NATIVE', NULL, '');
-
-INSERT INTO `records` (`id`, `domain_id`, `name`, `type`, `content`, `ttl`, `prio`, `disabled`, `ordername`, `auth`)
-VALUES
-(1, 1, 'hostinger.rbl', 'NS', 'ns1.hostinger.rbl', 3600, 0, 0, NULL, 1),
-(2, 1, 'hostinger.rbl', 'NS', 'ns2.hostinger.rbl', 3600, 0, 0, NULL, 1),
-(3, 1, 'hostinger.rbl', 'SOA', 'ns1.hostinger.rbl dns.hostinger.com 2020012301 10000 2400 604800 3600', 3600, 0, 0, NULL, 1);
\ No newline at end of file
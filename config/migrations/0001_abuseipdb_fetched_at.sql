@@ -0,0 +1,7 @@
+-- Records when each AbuseIPDB report was fetched, so results can report
+-- their age. Existing rows are treated as fetched at migration time.
+USE `hbl`;
+
+ALTER TABLE `abuseipdb_metadata`
+  MODIFY `last_reported_at` TIMESTAMP NULL,
+  ADD COLUMN `fetched_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
@@ -0,0 +1,18 @@
+-- Keeps every AbuseIPDB report fetched, so the evolution of an address'
+-- score can be inspected.
+USE `hbl`;
+
+CREATE TABLE IF NOT EXISTS `abuseipdb_history` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `ip` VARBINARY(16) NOT NULL,
+  `country_code` VARCHAR(50),
+  `usage_type` VARCHAR(50),
+  `isp` VARCHAR(50),
+  `abuse_confidence_score` INT,
+  `num_distinct_users` INT,
+  `total_reports` INT,
+  `last_reported_at` TIMESTAMP NULL,
+  `fetched_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  INDEX `idx_ip_fetched_at` (`ip`, `fetched_at`),
+  PRIMARY KEY (`id`)
+);
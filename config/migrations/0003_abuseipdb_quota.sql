@@ -0,0 +1,12 @@
+-- Persists the AbuseIPDB rate limit, so an exhausted quota is respected
+-- across restarts.
+USE `hbl`;
+
+CREATE TABLE IF NOT EXISTS `abuseipdb_quota` (
+  `endpoint` VARCHAR(50) NOT NULL,
+  `quota_limit` INT NOT NULL,
+  `remaining` INT NOT NULL,
+  `reset_at` TIMESTAMP NULL,
+  `updated_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`endpoint`)
+);
@@ -0,0 +1,16 @@
+-- Records what produced each block and why, and the outcome of reporting
+-- blocked addresses to checkers such as AbuseIPDB.
+USE `hbl`;
+
+ALTER TABLE `addresses`
+  ADD COLUMN `source` VARCHAR(100) NOT NULL DEFAULT '' AFTER `comment`,
+  ADD COLUMN `categories` VARCHAR(255) NOT NULL DEFAULT '' AFTER `source`;
+
+CREATE TABLE IF NOT EXISTS `address_reports` (
+  `ip` VARBINARY(16) NOT NULL,
+  `reporter` VARCHAR(50) NOT NULL,
+  `status` VARCHAR(20) NOT NULL,
+  `message` VARCHAR(255) NOT NULL DEFAULT '',
+  `reported_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`ip`, `reporter`)
+);
@@ -0,0 +1,10 @@
+-- Stores the country and autonomous system of each address, looked up
+-- from MaxMind databases when the address is created.
+USE `hbl`;
+
+ALTER TABLE `addresses`
+  ADD COLUMN `country` CHAR(2) NOT NULL DEFAULT '' AFTER `categories`,
+  ADD COLUMN `asn` INT UNSIGNED NOT NULL DEFAULT 0 AFTER `country`,
+  ADD COLUMN `organization` VARCHAR(255) NOT NULL DEFAULT '' AFTER `asn`,
+  ADD INDEX `idx_country` (`country`),
+  ADD INDEX `idx_asn` (`asn`);
@@ -0,0 +1,15 @@
+-- Stores blocks and allows of whole autonomous systems and countries. Value
+-- is the AS number, e.g. 'AS64496', or the country code, e.g. 'RU'.
+USE `hbl`;
+
+CREATE TABLE IF NOT EXISTS `targets` (
+  `target` VARCHAR(10) NOT NULL,
+  `value` VARCHAR(20) NOT NULL,
+  `author` VARCHAR(100) NOT NULL,
+  `action` VARCHAR(100) NOT NULL,
+  `comment` VARCHAR(100) NOT NULL,
+  `source` VARCHAR(100) NOT NULL DEFAULT '',
+  `categories` VARCHAR(255) NOT NULL DEFAULT '',
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`target`, `value`)
+);
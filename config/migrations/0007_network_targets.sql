@@ -0,0 +1,4 @@
+-- Widens targets.value so it fits networks, e.g. '2001:db8:1234:5678::/64'.
+USE `hbl`;
+
+ALTER TABLE `targets` MODIFY `value` VARCHAR(50) NOT NULL;
@@ -0,0 +1,29 @@
+-- Webhook subscriptions and the log of events delivered to them.
+USE `hbl`;
+
+CREATE TABLE IF NOT EXISTS `webhooks` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `url` VARCHAR(2048) NOT NULL,
+  `events` VARCHAR(255) NOT NULL DEFAULT '',
+  `secret` VARCHAR(255) NOT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`)
+);
+
+CREATE TABLE IF NOT EXISTS `webhook_deliveries` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `webhook_id` BIGINT NOT NULL,
+  `event_id` CHAR(32) NOT NULL,
+  `event` VARCHAR(50) NOT NULL,
+  `payload` TEXT NOT NULL,
+  `status` VARCHAR(20) NOT NULL,
+  `attempts` INT NOT NULL DEFAULT 0,
+  `status_code` INT NOT NULL DEFAULT 0,
+  `error` VARCHAR(255) NOT NULL DEFAULT '',
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  INDEX `idx_webhook_id` (`webhook_id`, `id`),
+  INDEX `idx_status` (`status`),
+  INDEX `idx_created_at` (`created_at`),
+  PRIMARY KEY (`id`)
+);
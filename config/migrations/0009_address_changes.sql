@@ -0,0 +1,21 @@
+-- Log of changes of the list, read through /api/v1/changes. Every change is
+-- numbered from the single row of address_changes_sequence, which starts at
+-- 1 so that sequence 0 never names a change.
+USE `hbl`;
+
+CREATE TABLE IF NOT EXISTS `address_changes` (
+  `id` BIGINT NOT NULL,
+  `type` VARCHAR(10) NOT NULL,
+  `entry` VARCHAR(64) NOT NULL,
+  `address` TEXT NOT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  INDEX `idx_created_at` (`created_at`),
+  PRIMARY KEY (`id`)
+);
+
+CREATE TABLE IF NOT EXISTS `address_changes_sequence` (
+  `id` BIGINT NOT NULL
+);
+
+INSERT INTO `address_changes_sequence` (`id`)
+  SELECT 1 FROM DUAL WHERE NOT EXISTS (SELECT * FROM `address_changes_sequence`);
@@ -0,0 +1,8 @@
+-- Stores when the block of an address expires, as decided by the duration
+-- of the policy rule it matched. Expired addresses are unblocked and
+-- deleted. NULL never expires.
+USE `hbl`;
+
+ALTER TABLE `addresses`
+  ADD COLUMN `expires_at` TIMESTAMP NULL DEFAULT NULL AFTER `created_at`,
+  ADD INDEX `idx_expires_at` (`expires_at`);
@@ -0,0 +1,11 @@
+-- Sequence of the last change of the list published to webhooks, moved in
+-- the transaction recording the deliveries of the changes. It starts at the
+-- head of the change log, so changes made before are not published.
+USE `hbl`;
+
+CREATE TABLE IF NOT EXISTS `webhook_cursor` (
+  `id` BIGINT NOT NULL
+);
+
+INSERT INTO `webhook_cursor` (`id`)
+  SELECT `id` FROM `address_changes_sequence` WHERE NOT EXISTS (SELECT * FROM `webhook_cursor`);
@@ -0,0 +1,12 @@
+-- Stores addresses in the binary form of INET6_ATON, 4 bytes for IPv4 and
+-- 16 for IPv6, instead of the IPv4 only number of INET_ATON. Run it once:
+-- rows already converted would be mangled. IPv6 addresses could not be
+-- stored before, except as NULL in abuseipdb_metadata, which is dropped.
+USE `hbl`;
+
+UPDATE `addresses` SET `ip` = INET6_ATON(INET_NTOA(`ip`));
+UPDATE `address_reports` SET `ip` = INET6_ATON(INET_NTOA(`ip`));
+
+DELETE FROM `abuseipdb_metadata` WHERE `ip` IS NULL;
+UPDATE `abuseipdb_metadata` SET `ip` = INET6_ATON(INET_NTOA(`ip`));
+UPDATE `abuseipdb_history` SET `ip` = INET6_ATON(INET_NTOA(`ip`));
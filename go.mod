@@ -3,10 +3,12 @@ module github.com/hostinger/hbl
 go 1.15
 
 require (
+	github.com/antonmedv/expr v1.8.9
 	github.com/cloudflare/cloudflare-go v0.14.0
 	github.com/go-sql-driver/mysql v1.5.0
 	github.com/labstack/echo/v4 v4.2.0
 	github.com/mitchellh/go-homedir v1.1.0
+	github.com/oschwald/geoip2-golang v1.5.0
 	github.com/pkg/errors v0.9.1
 	github.com/slack-go/slack v0.8.1
 	github.com/spf13/cobra v1.1.3
@@ -14,6 +16,7 @@ require (
 	github.com/stretchr/testify v1.7.0
 	github.com/swaggo/echo-swagger v1.1.0
 	github.com/swaggo/swag v1.7.0
-	go.uber.org/multierr v1.6.0 // indirect
+	go.uber.org/multierr v1.6.0
 	go.uber.org/zap v1.16.0
+	golang.org/x/net v0.0.0-20210220033124-5f55cee0dc0d
 )
@@ -1,43 +1,530 @@
 package alerters
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/hostinger/hbl/pkg/checkers"
+	"github.com/hostinger/hbl/pkg/logger"
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+)
+
+// Severities of alerts, from the least to the most urgent. They match the
+// ones of PagerDuty.
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityError    = "error"
+	SeverityCritical = "critical"
 )
 
+// Severities lists every severity, from the least to the most urgent.
+var Severities = []string{SeverityInfo, SeverityWarning, SeverityError, SeverityCritical}
+
+func isSeverity(severity string) bool {
+	for _, s := range Severities {
+		if s == severity {
+			return true
+		}
+	}
+	return false
+}
+
 type Alert struct {
 	IP      string
 	Action  string
 	Author  string
 	Comment string
+
+	// Target is what the entry applies to: ip, asn, country or network.
+	Target string
+
+	// List is the list the entry is on, Block or Allow. Alerts about
+	// conditions and suggestions have none.
+	List string
+
+	// ExpiresAt is when a block is lifted, nil when it never is.
+	ExpiresAt *time.Time
+
+	// Endpoints lists the endpoints the action ran on, and Outcome tells
+	// how it went: 'Applied', queued on paused endpoints or failed.
+	Endpoints []string
+	Outcome   string
+
+	Source     string
+	Categories []string
+
+	// Country, ASN and Organization describe where the address comes from,
+	// when it's known.
+	Country      string
+	ASN          uint
+	Organization string
+
+	// Checks is what checkers know about the address. It's only set for
+	// blocked addresses, see WithChecks.
+	Checks *checkers.Aggregate
+
+	// Severity is one of the Severity constants. Actions on addresses are
+	// SeverityInfo, which is also assumed when it's empty.
+	Severity string
+
+	// Incident is set on alerts about a condition rather than an address,
+	// e.g. a failed sync. Every alert about the condition carries the same
+	// incident, and the last one is Resolved once the condition clears.
+	Incident string
+	Resolved bool
+
+	// Channel overrides where alerters posting to channels, such as Slack
+	// and Mattermost, post the alert. It's set by the route it matched.
+	Channel string
+
+	// Batch holds the alerts a digest stands for. The IP of a digest lists
+	// their addresses, and its comment is the one they share, if any.
+	Batch []*Alert
+
+	checks *lazyChecks
+}
+
+// lazyChecks loads the checks of an alert once, for every alerter sending
+// it.
+type lazyChecks struct {
+	once   sync.Once
+	load   func(ctx context.Context) *checkers.Aggregate
+	checks *checkers.Aggregate
+}
+
+func (l *lazyChecks) get(ctx context.Context) *checkers.Aggregate {
+	l.once.Do(func() {
+		l.checks = l.load(ctx)
+	})
+	return l.checks
+}
+
+// WithChecks sets Checks from load when the alert is first sent rather than
+// now, so looking the address up never delays the action alerted about. It
+// returns the alert.
+func (a *Alert) WithChecks(load func(ctx context.Context) *checkers.Aggregate) *Alert {
+	a.checks = &lazyChecks{load: load}
+	return a
+}
+
+// loaded returns the alert with its checks loaded, a copy when they had to
+// be.
+func (a *Alert) loaded(ctx context.Context) *Alert {
+	if a.checks == nil || a.Checks != nil {
+		return a
+	}
+	loaded := *a
+	loaded.Checks = a.checks.get(ctx)
+	return &loaded
+}
+
+// severity returns the severity of the alert, SeverityInfo when unset.
+func (a *Alert) severity() string {
+	if a.Severity == "" {
+		return SeverityInfo
+	}
+	return a.Severity
+}
+
+// Title summarises the alert in a single line.
+func (a *Alert) Title() string {
+	if len(a.Batch) > 0 {
+		return fmt.Sprintf("Received %d %s actions by %s", len(a.Batch), strings.ToUpper(a.Action), a.Author)
+	}
+	if a.Incident == "" {
+		return fmt.Sprintf("Received a new %s action for %s", strings.ToUpper(a.Action), a.IP)
+	}
+	state := "triggered"
+	if a.Resolved {
+		state = "resolved"
+	}
+	return fmt.Sprintf("[%s] %s incident %s", strings.ToUpper(a.severity()), a.Incident, state)
+}
+
+// DedupKey identifies what the alert is about, so that incident management
+// tools group repeated alerts and resolve them together.
+func (a *Alert) DedupKey() string {
+	if a.Incident != "" {
+		return "hbl/" + a.Incident
+	}
+	return fmt.Sprintf("hbl/%s/%s", a.Action, a.IP)
+}
+
+// templateFuncs are available to user-supplied templates: 'json' quotes a
+// value as JSON, e.g. to embed the comment in Block Kit, 'join' joins a
+// list such as the categories and 'upper' upper-cases a string.
+var templateFuncs = map[string]interface{}{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+}
+
+// Field is a labelled value of an Alert, for alerters which lay alerts out
+// as a list of facts.
+type Field struct {
+	Title string
+	Value string
+}
+
+// Fields returns the non-empty details of the alert in a stable order.
+func (a *Alert) Fields() []Field {
+	fields := []Field{
+		{"IP", a.IP},
+		{"Action", a.Action},
+		{"Author", a.Author},
+		{"Comment", a.Comment},
+		{"Source", a.Source},
+		{"Categories", strings.Join(a.Categories, ", ")},
+		{"Country", a.Country},
+		{"Endpoints", strings.Join(a.Endpoints, ", ")},
+		{"Outcome", a.Outcome},
+	}
+	if a.ExpiresAt != nil {
+		fields = append(fields, Field{"Expires", a.ExpiresAt.UTC().Format(time.RFC3339)})
+	}
+	if a.Incident != "" {
+		fields = append(fields, Field{"Severity", a.severity()})
+	}
+	if a.ASN != 0 {
+		fields = append(fields, Field{"ASN", strings.TrimSpace(fmt.Sprintf("AS%d %s", a.ASN, a.Organization))})
+	}
+	if a.Checks != nil {
+		fields = append(fields, Field{"Checks", fmt.Sprintf("score %d, %s", a.Checks.Score, a.Checks.Verdict)})
+		for _, result := range a.Checks.Results {
+			fields = append(fields, Field{result.Checker, fmt.Sprintf("score %d, %s", result.Score, result.Verdict)})
+		}
+	}
+	result := fields[:0]
+	for _, field := range fields {
+		if field.Value != "" {
+			result = append(result, field)
+		}
+	}
+	return result
 }
 
 type Alerter interface {
 	Name() string
-	Alert(ctx context.Context, alert *Alert)
+	Alert(ctx context.Context, alert *Alert) error
 }
 
-var (
-	alertersMu = new(sync.Mutex)
-	alerters   = map[string]Alerter{}
-)
+// SeverityFilter is implemented by alerters which only receive alerts of
+// some severities, e.g. the ones paging on-call.
+type SeverityFilter interface {
+	Severities() []string
+}
 
-func AlertOnAll(ctx context.Context, alert *Alert) {
-	for _, alerter := range alerters {
-		alerter.Alert(ctx, alert)
+// HealthChecker is implemented by alerters which are able to report whether
+// their backend is usable.
+type HealthChecker interface {
+	HealthCheck(ctx context.Context) error
+}
+
+// Describer is implemented by alerters which can summarize their
+// configuration. Secrets must be redacted.
+type Describer interface {
+	Describe() map[string]string
+}
+
+// Result is the outcome of the last operation run on an alerter.
+type Result struct {
+	Operation string
+	IP        string `json:",omitempty"`
+	Error     string `json:",omitempty"`
+	At        time.Time
+}
+
+// Info describes a registered alerter and its runtime state.
+type Info struct {
+	Name          string
+	Enabled       bool
+	Config        map[string]string
+	LastOperation *Result
+	LastHealth    *Result
+	Queue         *QueueStats `json:",omitempty"`
+}
+
+// Registry holds a set of alerters keyed by name. It is safe for concurrent
+// use; alerts are sent through the alerters registered when they started,
+// so Replace never interrupts work already in flight.
+type Registry struct {
+	mu       sync.RWMutex
+	alerters map[string]Alerter
+	routes   []Route
+	last     map[string]*Result
+	health   map[string]*Result
+
+	// The queues of Start.
+	l       logger.Logger
+	queue   QueueConfig
+	ctx     context.Context
+	cancel  context.CancelFunc
+	workers map[string]*worker
+	started bool
+	wg      sync.WaitGroup
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		alerters: map[string]Alerter{},
+		last:     map[string]*Result{},
+		health:   map[string]*Result{},
 	}
 }
 
-func AlertOnOne(ctx context.Context, alert *Alert, name string) {
-	if _, ok := alerters[name]; ok {
-		alerters[name].Alert(ctx, alert)
+func (r *Registry) snapshot() map[string]Alerter {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.alerters
+}
+
+func (r *Registry) Register(alerter Alerter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.alerters[alerter.Name()]; !ok {
+		registered := make(map[string]Alerter, len(r.alerters)+1)
+		for name, a := range r.alerters {
+			registered[name] = a
+		}
+		registered[alerter.Name()] = alerter
+		r.alerters = registered
 	}
 }
 
-func Register(alerter Alerter) {
-	alertersMu.Lock()
-	defer alertersMu.Unlock()
-	if _, ok := alerters[alerter.Name()]; !ok {
-		alerters[alerter.Name()] = alerter
+// Replace atomically swaps all registered alerters for the given ones.
+// Alerters dropped by the swap are closed when they implement io.Closer, and
+// the queues of names no longer registered are stopped.
+func (r *Registry) Replace(list ...Alerter) {
+	registered := make(map[string]Alerter, len(list))
+	for _, alerter := range list {
+		if _, ok := registered[alerter.Name()]; !ok {
+			registered[alerter.Name()] = alerter
+		}
+	}
+	r.mu.Lock()
+	previous := r.alerters
+	r.alerters = registered
+	if r.started {
+		for name, w := range r.workers {
+			if _, ok := registered[name]; !ok {
+				close(w.alerts)
+				delete(r.workers, name)
+			}
+		}
+	}
+	r.mu.Unlock()
+
+	for name, alerter := range previous {
+		if registered[name] == alerter {
+			continue
+		}
+		if closer, ok := alerter.(io.Closer); ok {
+			closer.Close() // nolint
+		}
+	}
+}
+
+// Close closes the registered alerters which implement io.Closer. Queued
+// alerts should be sent with Stop first.
+func (r *Registry) Close() error {
+	var err error
+	for _, alerter := range r.List() {
+		if closer, ok := alerter.(io.Closer); ok {
+			err = multierr.Append(err, errors.Wrapf(closer.Close(), "Failed to close alerter '%s'", alerter.Name()))
+		}
+	}
+	return err
+}
+
+func (r *Registry) Get(name string) (Alerter, bool) {
+	alerter, ok := r.snapshot()[name]
+	return alerter, ok
+}
+
+// List returns the registered alerters ordered by name.
+func (r *Registry) List() []Alerter {
+	registered := r.snapshot()
+	list := make([]Alerter, 0, len(registered))
+	for _, alerter := range registered {
+		list = append(list, alerter)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name() < list[j].Name()
+	})
+	return list
+}
+
+// AlertOnAll sends alert to the alerters its routes pick, every alerter when
+// none matches, as long as they accept its severity. Once the registry is
+// started it only queues the alert and returns.
+func (r *Registry) AlertOnAll(ctx context.Context, alert *Alert) {
+	for _, alerter := range r.List() {
+		if routed := r.route(alerter, alert); routed != nil {
+			r.alert(ctx, alerter, routed)
+		}
+	}
+}
+
+func (r *Registry) AlertOnOne(ctx context.Context, alert *Alert, name string) {
+	if alerter, ok := r.Get(name); ok {
+		r.alert(ctx, alerter, alert)
+	}
+}
+
+func (r *Registry) alert(ctx context.Context, alerter Alerter, alert *Alert) {
+	if !accepts(alerter, alert) || r.enqueue(alerter, alert) {
+		return
+	}
+	r.record(alerter.Name(), alert.IP, alerter.Alert(ctx, alert.loaded(ctx)))
+}
+
+// accepts tells whether alert is of a severity alerter receives.
+func accepts(alerter Alerter, alert *Alert) bool {
+	f, ok := alerter.(SeverityFilter)
+	if !ok {
+		return true
+	}
+	for _, severity := range f.Severities() {
+		if severity == alert.severity() {
+			return true
+		}
+	}
+	return false
+}
+
+// Info returns the description and runtime state of every registered
+// alerter, ordered by name.
+func (r *Registry) Info() []*Info {
+	list := r.List()
+	infos := make([]*Info, 0, len(list))
+	for _, alerter := range list {
+		info := &Info{
+			Name:    alerter.Name(),
+			Enabled: true,
+		}
+		if d, ok := alerter.(Describer); ok {
+			info.Config = d.Describe()
+		}
+		r.mu.RLock()
+		info.LastHealth = r.health[alerter.Name()]
+		info.LastOperation = r.last[alerter.Name()]
+		w := r.workers[alerter.Name()]
+		r.mu.RUnlock()
+		if w != nil {
+			info.Queue = w.snapshot()
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// HealthCheck runs the health check of the named alerter. It reports false
+// when the alerter doesn't exist or doesn't support health checks.
+func (r *Registry) HealthCheck(ctx context.Context, name string) (bool, error) {
+	alerter, ok := r.Get(name)
+	if !ok {
+		return false, nil
+	}
+	hc, ok := alerter.(HealthChecker)
+	if !ok {
+		return false, nil
+	}
+	err := hc.HealthCheck(ctx)
+	result := newResult("HealthCheck", "", err)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.health[name] = result
+	return true, err
+}
+
+func (r *Registry) record(name, ip string, err error) {
+	result := newResult("Alert", ip, err)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.last[name] = result
+}
+
+func newResult(operation, ip string, err error) *Result {
+	result := &Result{
+		Operation: operation,
+		IP:        ip,
+		At:        time.Now(),
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// postJSON sends body as JSON to url with the extra header and fails on any
+// status but 2xx. The response is decoded into response when it's set.
+func postJSON(ctx context.Context, client *http.Client, url string, header http.Header, body, response interface{}) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return errors.Wrap(err, "Failed to marshal request into JSON")
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(b))
+	if err != nil {
+		return errors.Wrap(err, "Failed to create request")
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "Failed to execute request")
+	}
+	defer resp.Body.Close()
+	result, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return errors.Wrap(err, "Failed to read response")
 	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.Errorf("Received status code %d: %s", resp.StatusCode, strings.TrimSpace(string(result)))
+	}
+	if response != nil {
+		if err := json.Unmarshal(result, response); err != nil {
+			return errors.Wrap(err, "Failed to unmarshal response from JSON")
+		}
+	}
+	return nil
+}
+
+var defaultRegistry = NewRegistry()
+
+// Default returns the process-wide registry used by the package functions.
+func Default() *Registry {
+	return defaultRegistry
+}
+
+func AlertOnAll(ctx context.Context, alert *Alert) {
+	defaultRegistry.AlertOnAll(ctx, alert)
+}
+
+func AlertOnOne(ctx context.Context, alert *Alert, name string) {
+	defaultRegistry.AlertOnOne(ctx, alert, name)
+}
+
+func Register(alerter Alerter) {
+	defaultRegistry.Register(alerter)
+}
+
+// Replace atomically swaps all alerters of the default registry.
+func Replace(list ...Alerter) {
+	defaultRegistry.Replace(list...)
 }
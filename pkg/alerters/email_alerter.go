@@ -0,0 +1,426 @@
+package alerters
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	htmltemplate "html/template"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/hostinger/hbl/pkg/logger"
+	"github.com/hostinger/hbl/pkg/utils"
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+// Ways of securing the connection to the SMTP server.
+const (
+	EmailSecurityStartTLS = "starttls"
+	EmailSecurityTLS      = "tls"
+	EmailSecurityNone     = "none"
+)
+
+type EmailConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Host    string `mapstructure:"host"`
+	Port    int    `mapstructure:"port"`
+
+	// Security is 'starttls' to upgrade a plain connection, 'tls' for
+	// implicit TLS, usually on port 465, or 'none'.
+	Security string `mapstructure:"security"`
+
+	// Username and Password authenticate with PLAIN when set, which needs
+	// TLS unless the server is on localhost.
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+
+	From string   `mapstructure:"from"`
+	To   []string `mapstructure:"to"`
+
+	// Subject is a text/template rendered with the alert. TextTemplate and
+	// HTMLTemplate are paths to templates replacing the built-in bodies.
+	Subject      string `mapstructure:"subject"`
+	TextTemplate string `mapstructure:"text_template"`
+	HTMLTemplate string `mapstructure:"html_template"`
+
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+func (c *EmailConfig) Validate() error {
+	var err error
+	if strings.TrimSpace(c.Host) == "" {
+		err = multierr.Append(err, errors.New("Field 'host' must not be empty"))
+	}
+	if c.Port <= 0 || c.Port > 65535 {
+		err = multierr.Append(err, errors.New("Field 'port' must be a valid port"))
+	}
+	switch c.Security {
+	case EmailSecurityStartTLS, EmailSecurityTLS, EmailSecurityNone:
+	default:
+		err = multierr.Append(err, errors.New("Field 'security' must be one of 'starttls', 'tls' or 'none'"))
+	}
+	if c.Username != "" && c.Password == "" {
+		err = multierr.Append(err, errors.New("Field 'password' must not be empty when 'username' is set"))
+	}
+	if _, e := mail.ParseAddress(c.From); e != nil {
+		err = multierr.Append(err, errors.New("Field 'from' must be a valid email address"))
+	}
+	if len(c.To) == 0 {
+		err = multierr.Append(err, errors.New("Field 'to' must not be empty"))
+	}
+	for _, to := range c.To {
+		if _, e := mail.ParseAddress(to); e != nil {
+			err = multierr.Append(err, fmt.Errorf("Field 'to' must only hold valid email addresses, got '%s'", to))
+		}
+	}
+	if c.Timeout < 0 {
+		err = multierr.Append(err, errors.New("Field 'timeout' must not be negative"))
+	}
+	if _, _, _, e := c.templates(); e != nil {
+		err = multierr.Append(err, e)
+	}
+	return err
+}
+
+// templates parses the subject and the configured or built-in bodies.
+func (c *EmailConfig) templates() (*template.Template, *template.Template, *htmltemplate.Template, error) {
+	subject, err := template.New("subject").Funcs(templateFuncs).Parse(c.Subject)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("Field 'subject' must be a valid template: %s", err)
+	}
+	text, html := emailTextTemplate, emailHTMLTemplate
+	if c.TextTemplate != "" {
+		b, err := ioutil.ReadFile(c.TextTemplate)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("Field 'text_template' must be a readable file: %s", err)
+		}
+		text = string(b)
+	}
+	if c.HTMLTemplate != "" {
+		b, err := ioutil.ReadFile(c.HTMLTemplate)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("Field 'html_template' must be a readable file: %s", err)
+		}
+		html = string(b)
+	}
+	textBody, err := template.New("text").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("Field 'text_template' must be a valid template: %s", err)
+	}
+	htmlBody, err := htmltemplate.New("html").Funcs(templateFuncs).Parse(html)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("Field 'html_template' must be a valid template: %s", err)
+	}
+	return subject, textBody, htmlBody, nil
+}
+
+const emailTextTemplate = `{{.Title}}.
+
+IP:       {{.IP}}
+Action:   {{.Action}}
+Author:   {{.Author}}
+Comment:  {{.Comment}}
+{{- if .Source}}
+Source:   {{.Source}}
+{{- end}}
+{{- if .Categories}}
+Category: {{range $i, $c := .Categories}}{{if $i}}, {{end}}{{$c}}{{end}}
+{{- end}}
+{{- if .Country}}
+Country:  {{.Country}}
+{{- end}}
+{{- if .ASN}}
+ASN:      AS{{.ASN}} {{.Organization}}
+{{- end}}
+{{- if .Endpoints}}
+Endpoints: {{join .Endpoints ", "}}
+{{- end}}
+{{- if .Outcome}}
+Outcome:  {{.Outcome}}
+{{- end}}
+{{- with .ExpiresAt}}
+Expires:  {{.UTC.Format "2006-01-02T15:04:05Z07:00"}}
+{{- end}}
+{{- with .Checks}}
+
+Checks: score {{.Score}}, {{.Verdict}}
+{{- range .Results}}
+  {{.Checker}}: score {{.Score}}, {{.Verdict}}
+{{- end}}
+{{- range $name, $err := .Errors}}
+  {{$name}}: {{$err}}
+{{- end}}
+{{- end}}
+`
+
+const emailHTMLTemplate = `<p><strong>{{.Title}}</strong></p>
+<table>
+<tr><th align="left">IP</th><td>{{.IP}}</td></tr>
+<tr><th align="left">Action</th><td>{{.Action}}</td></tr>
+<tr><th align="left">Author</th><td>{{.Author}}</td></tr>
+<tr><th align="left">Comment</th><td>{{.Comment}}</td></tr>
+{{- if .Source}}
+<tr><th align="left">Source</th><td>{{.Source}}</td></tr>
+{{- end}}
+{{- if .Categories}}
+<tr><th align="left">Category</th><td>{{range $i, $c := .Categories}}{{if $i}}, {{end}}{{$c}}{{end}}</td></tr>
+{{- end}}
+{{- if .Country}}
+<tr><th align="left">Country</th><td>{{.Country}}</td></tr>
+{{- end}}
+{{- if .ASN}}
+<tr><th align="left">ASN</th><td>AS{{.ASN}} {{.Organization}}</td></tr>
+{{- end}}
+{{- if .Endpoints}}
+<tr><th align="left">Endpoints</th><td>{{join .Endpoints ", "}}</td></tr>
+{{- end}}
+{{- if .Outcome}}
+<tr><th align="left">Outcome</th><td>{{.Outcome}}</td></tr>
+{{- end}}
+{{- with .ExpiresAt}}
+<tr><th align="left">Expires</th><td>{{.UTC.Format "2006-01-02T15:04:05Z07:00"}}</td></tr>
+{{- end}}
+</table>
+{{- with .Checks}}
+<p>Checks: score <strong>{{.Score}}</strong>, {{.Verdict}}</p>
+<ul>
+{{- range .Results}}
+<li>{{.Checker}}: score {{.Score}}, {{.Verdict}}</li>
+{{- end}}
+{{- range $name, $err := .Errors}}
+<li>{{$name}}: {{$err}}</li>
+{{- end}}
+</ul>
+{{- end}}
+`
+
+type emailAlerter struct {
+	l        logger.Logger
+	host     string
+	port     int
+	security string
+	username string
+	password string
+	from     string
+	to       []string
+	timeout  time.Duration
+
+	subject *template.Template
+	text    *template.Template
+	html    *htmltemplate.Template
+
+	// tlsConfig is used for TLS connections, nil meaning the defaults for
+	// host.
+	tlsConfig *tls.Config
+}
+
+func NewEmailAlerter(l logger.Logger, cfg *EmailConfig) (Alerter, error) {
+	l.Info("Starting execution of NewEmailAlerter", zap.String("alerter", "Email"))
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	subject, text, html, err := cfg.templates()
+	if err != nil {
+		return nil, err
+	}
+	e := &emailAlerter{
+		l:        l,
+		host:     cfg.Host,
+		port:     cfg.Port,
+		security: cfg.Security,
+		username: cfg.Username,
+		password: cfg.Password,
+		from:     cfg.From,
+		to:       cfg.To,
+		timeout:  cfg.Timeout,
+		subject:  subject,
+		text:     text,
+		html:     html,
+	}
+	l.Info("Finished execution of NewEmailAlerter", zap.String("alerter", "Email"))
+	return e, nil
+}
+
+func (e *emailAlerter) Name() string {
+	return "Email"
+}
+
+func (e *emailAlerter) Describe() map[string]string {
+	return map[string]string{
+		"host":     e.host,
+		"port":     strconv.Itoa(e.port),
+		"security": e.security,
+		"username": e.username,
+		"password": utils.Redact(e.password),
+		"from":     e.from,
+		"to":       strings.Join(e.to, ","),
+	}
+}
+
+func (e *emailAlerter) Alert(ctx context.Context, alert *Alert) error {
+	message, err := e.message(alert)
+	if err != nil {
+		return errors.Wrap(err, "Failed to render email")
+	}
+	return errors.Wrap(e.send(ctx, message), "Failed to send email")
+}
+
+// HealthCheck connects and authenticates to the SMTP server without
+// sending anything.
+func (e *emailAlerter) HealthCheck(ctx context.Context) error {
+	c, err := e.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return c.Quit()
+}
+
+// message renders alert into a multipart message with a plain-text and an
+// HTML body.
+func (e *emailAlerter) message(alert *Alert) ([]byte, error) {
+	var subject, text, html bytes.Buffer
+	if err := e.subject.Execute(&subject, alert); err != nil {
+		return nil, err
+	}
+	if err := e.text.Execute(&text, alert); err != nil {
+		return nil, err
+	}
+	if err := e.html.Execute(&html, alert); err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     []byte
+	}{
+		{"text/plain; charset=utf-8", text.Bytes()},
+		{"text/html; charset=utf-8", html.Bytes()},
+	} {
+		pw, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(pw)
+		if _, err := qp.Write(part.content); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", e.from)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(e.to, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", strings.TrimSpace(subject.String())))
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&message, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&message, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", w.Boundary())
+	message.Write(body.Bytes())
+	return message.Bytes(), nil
+}
+
+func (e *emailAlerter) send(ctx context.Context, message []byte) error {
+	c, err := e.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	from, err := mail.ParseAddress(e.from)
+	if err != nil {
+		return err
+	}
+	if err := c.Mail(from.Address); err != nil {
+		return err
+	}
+	for _, to := range e.to {
+		address, err := mail.ParseAddress(to)
+		if err != nil {
+			return err
+		}
+		if err := c.Rcpt(address.Address); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(message); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// dial connects to the SMTP server, secures the connection as configured
+// and authenticates if credentials are set.
+func (e *emailAlerter) dial(ctx context.Context) (*smtp.Client, error) {
+	if e.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.timeout)
+		defer cancel()
+	}
+	addr := net.JoinHostPort(e.host, strconv.Itoa(e.port))
+	tlsConfig := e.tlsConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{ServerName: e.host}
+	}
+
+	var conn net.Conn
+	var err error
+	if e.security == EmailSecurityTLS {
+		conn, err = (&tls.Dialer{Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline) // nolint
+	}
+
+	c, err := smtp.NewClient(conn, e.host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if e.security == EmailSecurityStartTLS {
+		if err := c.StartTLS(tlsConfig); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	if e.username != "" {
+		if err := c.Auth(smtp.PlainAuth("", e.username, e.password, e.host)); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
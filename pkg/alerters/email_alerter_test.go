@@ -0,0 +1,156 @@
+package alerters
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/hostinger/hbl/pkg/checkers"
+	"github.com/hostinger/hbl/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+// smtpStandIn accepts a single message over plain SMTP and sends what it
+// received on messages.
+type smtpStandIn struct {
+	listener   net.Listener
+	recipients []string
+	messages   chan string
+}
+
+func newSMTPStandIn(t *testing.T) *smtpStandIn {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpStandIn{listener: listener, messages: make(chan string, 1)}
+	go s.serve()
+	return s
+}
+
+func (s *smtpStandIn) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpStandIn) serve() {
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { fmt.Fprintf(conn, "%s\r\n", line) }
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(command, "EHLO"):
+			reply("250 localhost")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			s.recipients = append(s.recipients, strings.TrimSpace(line)[len("RCPT TO:"):])
+			reply("250 OK")
+		case strings.HasPrefix(command, "DATA"):
+			reply("354 Go ahead")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(line, "."))
+			}
+			s.messages <- data.String()
+			reply("250 OK")
+		case strings.HasPrefix(command, "QUIT"):
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestEmailAlerter_Alert(t *testing.T) {
+	server := newSMTPStandIn(t)
+	defer server.listener.Close()
+
+	alerter, err := NewEmailAlerter(logger.NewLogger("test"), &EmailConfig{
+		Host:     "127.0.0.1",
+		Port:     server.port(),
+		Security: EmailSecurityNone,
+		From:     "HBL <hbl@example.com>",
+		To:       []string{"abuse@example.com"},
+		Subject:  "[HBL] {{.Action}} {{.IP}}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	alerter.Alert(context.Background(), &Alert{
+		IP:      "192.0.2.1",
+		Action:  "Block",
+		Author:  "fail2ban",
+		Comment: "SSH <brute force>",
+		Checks: &checkers.Aggregate{
+			Score:   80,
+			Verdict: checkers.VerdictMalicious,
+			Results: []*checkers.CheckResult{{Checker: "AbuseIPDB", Score: 80, Verdict: checkers.VerdictMalicious}},
+		},
+	})
+
+	message, err := mail.ReadMessage(strings.NewReader(<-server.messages))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"<abuse@example.com>"}, server.recipients)
+	assert.Equal(t, "[HBL] Block 192.0.2.1", message.Header.Get("Subject"))
+
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	assert.NoError(t, err)
+	assert.Equal(t, "multipart/alternative", mediaType)
+
+	bodies := map[string]string{}
+	r := multipart.NewReader(message.Body, params["boundary"])
+	for {
+		part, err := r.NextPart()
+		if err != nil {
+			break
+		}
+		b, _ := ioutil.ReadAll(part)
+		bodies[strings.Split(part.Header.Get("Content-Type"), ";")[0]] = string(b)
+	}
+	assert.Contains(t, bodies["text/plain"], "Author:   fail2ban")
+	assert.Contains(t, bodies["text/plain"], "Comment:  SSH <brute force>")
+	assert.Contains(t, bodies["text/plain"], "AbuseIPDB: score 80, malicious")
+	assert.Contains(t, bodies["text/html"], "<td>SSH &lt;brute force&gt;</td>")
+}
+
+func TestEmailConfig_Validate(t *testing.T) {
+	cfg := &EmailConfig{
+		Host:     "localhost",
+		Port:     25,
+		Security: "ssl",
+		Username: "hbl",
+		From:     "hbl",
+		Subject:  "{{.IP",
+	}
+	err := cfg.Validate()
+	for _, field := range []string{"security", "password", "from", "to", "subject"} {
+		assert.Contains(t, err.Error(), "Field '"+field+"'", field)
+	}
+	cfg = &EmailConfig{Host: "localhost", Port: 587, Security: EmailSecurityStartTLS, From: "hbl@example.com", To: []string{"abuse@example.com"}}
+	assert.NoError(t, cfg.Validate())
+}
@@ -0,0 +1,150 @@
+package alerters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/hostinger/hbl/pkg/logger"
+	"github.com/hostinger/hbl/pkg/utils"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+type MattermostConfig struct {
+	Enabled    bool   `mapstructure:"enabled"`
+	WebhookURL string `mapstructure:"webhook_url"`
+
+	// Channel, Username and IconURL override the defaults of the webhook
+	// when set.
+	Channel  string `mapstructure:"channel"`
+	Username string `mapstructure:"username"`
+	IconURL  string `mapstructure:"icon_url"`
+}
+
+func (c *MattermostConfig) Validate() error {
+	var err error
+	if _, e := url.ParseRequestURI(c.WebhookURL); e != nil {
+		err = multierr.Append(err, errors.New("Field 'webhook_url' must be a valid URL"))
+	}
+	if c.IconURL != "" {
+		if _, e := url.ParseRequestURI(c.IconURL); e != nil {
+			err = multierr.Append(err, errors.New("Field 'icon_url' must be a valid URL"))
+		}
+	}
+	return err
+}
+
+type mattermostAlerter struct {
+	l        logger.Logger
+	client   *http.Client
+	url      string
+	channel  string
+	username string
+	iconURL  string
+}
+
+func NewMattermostAlerter(l logger.Logger, cfg *MattermostConfig) (Alerter, error) {
+	l.Info("Starting execution of NewMattermostAlerter", zap.String("alerter", "Mattermost"))
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	m := &mattermostAlerter{
+		l:        l,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		url:      cfg.WebhookURL,
+		channel:  cfg.Channel,
+		username: cfg.Username,
+		iconURL:  cfg.IconURL,
+	}
+	l.Info("Finished execution of NewMattermostAlerter", zap.String("alerter", "Mattermost"))
+	return m, nil
+}
+
+func (m *mattermostAlerter) Name() string {
+	return "Mattermost"
+}
+
+func (m *mattermostAlerter) Describe() map[string]string {
+	return map[string]string{
+		"channel":     m.channel,
+		"username":    m.username,
+		"webhook_url": utils.Redact(m.url),
+	}
+}
+
+type mattermostMessage struct {
+	Channel     string                 `json:"channel,omitempty"`
+	Username    string                 `json:"username,omitempty"`
+	IconURL     string                 `json:"icon_url,omitempty"`
+	Attachments []mattermostAttachment `json:"attachments"`
+}
+
+type mattermostAttachment struct {
+	Fallback string            `json:"fallback"`
+	Color    string            `json:"color"`
+	Title    string            `json:"title"`
+	Text     string            `json:"text,omitempty"`
+	Fields   []mattermostField `json:"fields"`
+}
+
+type mattermostField struct {
+	Short bool   `json:"short"`
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+// mattermostColor is the sidebar color of the attachment.
+func mattermostColor(alert *Alert) string {
+	if alert.Incident != "" {
+		if alert.Resolved {
+			return "#5cb85c"
+		}
+		return "#d9534f"
+	}
+	switch alert.Action {
+	case "Block":
+		return "#d9534f"
+	case "Allow":
+		return "#5cb85c"
+	}
+	return "#777777"
+}
+
+// message lays the alert out as an attachment, the comment as its text and
+// the other fields side by side.
+func (m *mattermostAlerter) message(alert *Alert) *mattermostMessage {
+	title := alert.Title()
+	fields := []mattermostField{}
+	for _, field := range alert.Fields() {
+		if field.Title == "Comment" {
+			continue
+		}
+		fields = append(fields, mattermostField{Short: true, Title: field.Title, Value: field.Value})
+	}
+	channel := m.channel
+	if alert.Channel != "" {
+		channel = alert.Channel
+	}
+	return &mattermostMessage{
+		Channel:  channel,
+		Username: m.username,
+		IconURL:  m.iconURL,
+		Attachments: []mattermostAttachment{
+			{
+				Fallback: fmt.Sprintf("%s: %s", title, alert.Comment),
+				Color:    mattermostColor(alert),
+				Title:    title,
+				Text:     alert.Comment,
+				Fields:   fields,
+			},
+		},
+	}
+}
+
+func (m *mattermostAlerter) Alert(ctx context.Context, alert *Alert) error {
+	return postJSON(ctx, m.client, m.url, nil, m.message(alert), nil)
+}
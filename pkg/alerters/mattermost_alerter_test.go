@@ -0,0 +1,38 @@
+package alerters
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hostinger/hbl/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMattermostAlerter_Alert(t *testing.T) {
+	var message mattermostMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&message))
+	}))
+	defer server.Close()
+
+	alerter, err := NewMattermostAlerter(logger.NewLogger("test"), &MattermostConfig{
+		WebhookURL: server.URL,
+		Channel:    "hbl",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	alerter.Alert(context.Background(), &Alert{IP: "192.0.2.1", Action: "Allow", Author: "ops", Comment: "Customer", ASN: 64496})
+
+	assert.Equal(t, "hbl", message.Channel)
+	if assert.Len(t, message.Attachments, 1) {
+		attachment := message.Attachments[0]
+		assert.Equal(t, "#5cb85c", attachment.Color)
+		assert.Equal(t, "Customer", attachment.Text)
+		assert.Contains(t, attachment.Fields, mattermostField{Short: true, Title: "ASN", Value: "AS64496"})
+		assert.NotContains(t, attachment.Fields, mattermostField{Short: true, Title: "Comment", Value: "Customer"})
+	}
+}
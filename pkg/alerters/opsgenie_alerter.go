@@ -0,0 +1,139 @@
+package alerters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hostinger/hbl/pkg/logger"
+	"github.com/hostinger/hbl/pkg/utils"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+type OpsgenieConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	// APIURL is https://api.opsgenie.com, or https://api.eu.opsgenie.com
+	// for accounts hosted in the EU.
+	APIURL string `mapstructure:"api_url"`
+
+	// APIKey is the key of an API integration allowed to create and close
+	// alerts.
+	APIKey string `mapstructure:"api_key"`
+
+	// Severities are the only alerts sent to Opsgenie.
+	Severities []string `mapstructure:"severities"`
+}
+
+func (c *OpsgenieConfig) Validate() error {
+	var err error
+	if _, e := url.ParseRequestURI(c.APIURL); e != nil {
+		err = multierr.Append(err, errors.New("Field 'api_url' must be a valid URL"))
+	}
+	if strings.TrimSpace(c.APIKey) == "" {
+		err = multierr.Append(err, errors.New("Field 'api_key' must not be empty"))
+	}
+	return multierr.Append(err, validateSeverities(c.Severities))
+}
+
+type opsgenieAlerter struct {
+	l          logger.Logger
+	client     *http.Client
+	apiURL     string
+	apiKey     string
+	severities []string
+	source     string
+}
+
+func NewOpsgenieAlerter(l logger.Logger, cfg *OpsgenieConfig) (Alerter, error) {
+	l.Info("Starting execution of NewOpsgenieAlerter", zap.String("alerter", "Opsgenie"))
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	o := &opsgenieAlerter{
+		l:          l,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		apiURL:     strings.TrimRight(cfg.APIURL, "/"),
+		apiKey:     cfg.APIKey,
+		severities: cfg.Severities,
+		source:     alertSource(),
+	}
+	l.Info("Finished execution of NewOpsgenieAlerter", zap.String("alerter", "Opsgenie"))
+	return o, nil
+}
+
+func (o *opsgenieAlerter) Name() string {
+	return "Opsgenie"
+}
+
+func (o *opsgenieAlerter) Severities() []string {
+	return o.severities
+}
+
+func (o *opsgenieAlerter) Describe() map[string]string {
+	return map[string]string{
+		"api_key":    utils.Redact(o.apiKey),
+		"api_url":    o.apiURL,
+		"severities": strings.Join(o.severities, ", "),
+	}
+}
+
+type opsgenieAlert struct {
+	Message     string            `json:"message"`
+	Alias       string            `json:"alias"`
+	Description string            `json:"description,omitempty"`
+	Details     map[string]string `json:"details"`
+	Tags        []string          `json:"tags"`
+	Priority    string            `json:"priority"`
+	Source      string            `json:"source"`
+}
+
+type opsgenieClose struct {
+	Source string `json:"source"`
+	Note   string `json:"note,omitempty"`
+}
+
+// opsgeniePriority maps severities to the priorities of Opsgenie.
+func opsgeniePriority(severity string) string {
+	switch severity {
+	case SeverityCritical:
+		return "P1"
+	case SeverityError:
+		return "P2"
+	case SeverityWarning:
+		return "P3"
+	}
+	return "P5"
+}
+
+func (o *opsgenieAlerter) alert(alert *Alert) *opsgenieAlert {
+	details := map[string]string{}
+	for _, field := range alert.Fields() {
+		details[field.Title] = field.Value
+	}
+	return &opsgenieAlert{
+		Message:     truncate(alert.Title(), 130),
+		Alias:       alert.DedupKey(),
+		Description: alert.Comment,
+		Details:     details,
+		Tags:        []string{"hbl", alert.Action},
+		Priority:    opsgeniePriority(alert.severity()),
+		Source:      o.source,
+	}
+}
+
+// Alert creates an alert, or closes the one with the same alias once the
+// alert is resolved. Opsgenie deduplicates open alerts by alias.
+func (o *opsgenieAlerter) Alert(ctx context.Context, alert *Alert) error {
+	header := http.Header{"Authorization": []string{"GenieKey " + o.apiKey}}
+	if alert.Resolved {
+		u := fmt.Sprintf("%s/v2/alerts/%s/close?identifierType=alias", o.apiURL, url.PathEscape(alert.DedupKey()))
+		return postJSON(ctx, o.client, u, header, &opsgenieClose{Source: o.source, Note: alert.Comment}, nil)
+	}
+	return postJSON(ctx, o.client, o.apiURL+"/v2/alerts", header, o.alert(alert), nil)
+}
@@ -0,0 +1,44 @@
+package alerters
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hostinger/hbl/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpsgenieAlerter_Alert(t *testing.T) {
+	var requests []string
+	var created opsgenieAlert
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "GenieKey secret", r.Header.Get("Authorization"))
+		requests = append(requests, r.URL.RequestURI())
+		if r.URL.Path == "/v2/alerts" {
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&created))
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	alerter, err := NewOpsgenieAlerter(logger.NewLogger("test"), &OpsgenieConfig{
+		APIURL:     server.URL,
+		APIKey:     "secret",
+		Severities: []string{SeverityCritical, SeverityWarning},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	alert := &Alert{Action: "MassBlock", Comment: "100 addresses were blocked within 5m0s", Severity: SeverityCritical, Incident: "MassBlock"}
+	alerter.Alert(context.Background(), alert)
+	alert.Resolved = true
+	alerter.Alert(context.Background(), alert)
+
+	assert.Equal(t, []string{"/v2/alerts", "/v2/alerts/hbl%2FMassBlock/close?identifierType=alias"}, requests)
+	assert.Equal(t, "hbl/MassBlock", created.Alias)
+	assert.Equal(t, "P1", created.Priority)
+	assert.Equal(t, "[CRITICAL] MassBlock incident triggered", created.Message)
+}
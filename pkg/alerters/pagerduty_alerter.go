@@ -0,0 +1,167 @@
+package alerters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hostinger/hbl/pkg/logger"
+	"github.com/hostinger/hbl/pkg/utils"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+type PagerDutyConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	// APIURL is the Events API server, https://events.pagerduty.com unless
+	// a proxy is used.
+	APIURL string `mapstructure:"api_url"`
+
+	// RoutingKey is the integration key of the Events API v2 integration of
+	// the service to page.
+	RoutingKey string `mapstructure:"routing_key"`
+
+	// Severities are the only alerts sent to PagerDuty.
+	Severities []string `mapstructure:"severities"`
+}
+
+func (c *PagerDutyConfig) Validate() error {
+	var err error
+	if _, e := url.ParseRequestURI(c.APIURL); e != nil {
+		err = multierr.Append(err, errors.New("Field 'api_url' must be a valid URL"))
+	}
+	if strings.TrimSpace(c.RoutingKey) == "" {
+		err = multierr.Append(err, errors.New("Field 'routing_key' must not be empty"))
+	}
+	return multierr.Append(err, validateSeverities(c.Severities))
+}
+
+// validateSeverities checks the severities an alerter is configured with.
+func validateSeverities(severities []string) error {
+	if len(severities) == 0 {
+		return errors.New("Field 'severities' must not be empty")
+	}
+	var err error
+	for _, severity := range severities {
+		if !isSeverity(severity) {
+			err = multierr.Append(err, fmt.Errorf("Field 'severities' must only hold %s, got '%s'", strings.Join(Severities, ", "), severity))
+		}
+	}
+	return err
+}
+
+type pagerDutyAlerter struct {
+	l          logger.Logger
+	client     *http.Client
+	apiURL     string
+	routingKey string
+	severities []string
+	source     string
+}
+
+func NewPagerDutyAlerter(l logger.Logger, cfg *PagerDutyConfig) (Alerter, error) {
+	l.Info("Starting execution of NewPagerDutyAlerter", zap.String("alerter", "PagerDuty"))
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	p := &pagerDutyAlerter{
+		l:          l,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		apiURL:     strings.TrimRight(cfg.APIURL, "/"),
+		routingKey: cfg.RoutingKey,
+		severities: cfg.Severities,
+		source:     alertSource(),
+	}
+	l.Info("Finished execution of NewPagerDutyAlerter", zap.String("alerter", "PagerDuty"))
+	return p, nil
+}
+
+// alertSource names the machine alerts come from.
+func alertSource() string {
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		return hostname
+	}
+	return "hbl"
+}
+
+func (p *pagerDutyAlerter) Name() string {
+	return "PagerDuty"
+}
+
+func (p *pagerDutyAlerter) Severities() []string {
+	return p.severities
+}
+
+func (p *pagerDutyAlerter) Describe() map[string]string {
+	return map[string]string{
+		"api_url":     p.apiURL,
+		"routing_key": utils.Redact(p.routingKey),
+		"severities":  strings.Join(p.severities, ", "),
+	}
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Component     string            `json:"component"`
+	Class         string            `json:"class"`
+	CustomDetails map[string]string `json:"custom_details"`
+}
+
+// event triggers an incident for the alert, or resolves it once the alert
+// is resolved.
+func (p *pagerDutyAlerter) event(alert *Alert) *pagerDutyEvent {
+	event := &pagerDutyEvent{
+		RoutingKey:  p.routingKey,
+		EventAction: "trigger",
+		DedupKey:    alert.DedupKey(),
+	}
+	if alert.Resolved {
+		event.EventAction = "resolve"
+		return event
+	}
+	details := map[string]string{}
+	for _, field := range alert.Fields() {
+		details[field.Title] = field.Value
+	}
+	summary := alert.Title()
+	if alert.Comment != "" {
+		summary = fmt.Sprintf("%s: %s", summary, alert.Comment)
+	}
+	event.Payload = &pagerDutyPayload{
+		Summary:       truncate(summary, 1024),
+		Source:        p.source,
+		Severity:      alert.severity(),
+		Component:     "hbl",
+		Class:         alert.Action,
+		CustomDetails: details,
+	}
+	return event
+}
+
+func (p *pagerDutyAlerter) Alert(ctx context.Context, alert *Alert) error {
+	return postJSON(ctx, p.client, p.apiURL+"/v2/enqueue", nil, p.event(alert), nil)
+}
+
+// truncate cuts s to at most n bytes, as incident management tools refuse
+// longer summaries.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-3] + "..."
+}
@@ -0,0 +1,65 @@
+package alerters
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hostinger/hbl/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPagerDutyAlerter_Alert(t *testing.T) {
+	var events []pagerDutyEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v2/enqueue", r.URL.Path)
+		var event pagerDutyEvent
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		events = append(events, event)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	alerter, err := NewPagerDutyAlerter(logger.NewLogger("test"), &PagerDutyConfig{
+		APIURL:     server.URL,
+		RoutingKey: "routing",
+		Severities: []string{SeverityCritical},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := NewRegistry()
+	registry.Register(alerter)
+
+	registry.AlertOnAll(context.Background(), &Alert{IP: "192.0.2.1", Action: "Block", Comment: "SSH"})
+	registry.AlertOnAll(context.Background(), &Alert{
+		Action:   "SyncAll",
+		Comment:  "Cloudflare is unreachable",
+		Severity: SeverityCritical,
+		Incident: "SyncAll",
+	})
+	registry.AlertOnAll(context.Background(), &Alert{Action: "SyncAll", Severity: SeverityCritical, Incident: "SyncAll", Resolved: true})
+
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, "trigger", events[0].EventAction)
+		assert.Equal(t, "routing", events[0].RoutingKey)
+		assert.Equal(t, "hbl/SyncAll", events[0].DedupKey)
+		assert.Equal(t, "[CRITICAL] SyncAll incident triggered: Cloudflare is unreachable", events[0].Payload.Summary)
+		assert.Equal(t, SeverityCritical, events[0].Payload.Severity)
+		assert.Equal(t, "resolve", events[1].EventAction)
+		assert.Equal(t, "hbl/SyncAll", events[1].DedupKey)
+		assert.Nil(t, events[1].Payload)
+	}
+}
+
+func TestPagerDutyConfig_Validate(t *testing.T) {
+	cfg := &PagerDutyConfig{APIURL: "events", Severities: []string{"fatal"}}
+	err := cfg.Validate()
+	for _, field := range []string{"api_url", "routing_key", "severities"} {
+		assert.Contains(t, err.Error(), "Field '"+field+"'", field)
+	}
+	cfg = &PagerDutyConfig{APIURL: "https://events.pagerduty.com", RoutingKey: "routing", Severities: []string{SeverityError}}
+	assert.NoError(t, cfg.Validate())
+}
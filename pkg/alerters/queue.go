@@ -0,0 +1,334 @@
+package alerters
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hostinger/hbl/pkg/logger"
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+// QueueConfig tunes the delivery of alerts once the registry is started.
+type QueueConfig struct {
+	// Size is how many alerts may wait for each alerter. Alerts beyond it
+	// are dropped.
+	Size int `mapstructure:"size"`
+
+	// Retries is how many times a failed alert is sent again, waiting
+	// Backoff before the first retry and twice as long before each next one,
+	// up to MaxBackoff.
+	Retries    int           `mapstructure:"retries"`
+	Backoff    time.Duration `mapstructure:"backoff"`
+	MaxBackoff time.Duration `mapstructure:"max_backoff"`
+
+	Digest DigestConfig `mapstructure:"digest"`
+}
+
+// DigestConfig batches alerts about addresses into digests, grouped by
+// author and action. A digest is sent once it holds Size alerts or Interval
+// after its first alert, whichever comes first. Incidents are never batched.
+type DigestConfig struct {
+	Enabled  bool          `mapstructure:"enabled"`
+	Size     int           `mapstructure:"size"`
+	Interval time.Duration `mapstructure:"interval"`
+}
+
+func (c *QueueConfig) Validate() error {
+	var err error
+	if c.Size <= 0 {
+		err = multierr.Append(err, errors.New("Field 'size' must be positive"))
+	}
+	if c.Retries < 0 {
+		err = multierr.Append(err, errors.New("Field 'retries' must not be negative"))
+	}
+	if c.Backoff <= 0 {
+		err = multierr.Append(err, errors.New("Field 'backoff' must be positive"))
+	}
+	if c.MaxBackoff < c.Backoff {
+		err = multierr.Append(err, errors.New("Field 'max_backoff' must not be less than 'backoff'"))
+	}
+	if c.Digest.Enabled && c.Digest.Size < 2 {
+		err = multierr.Append(err, errors.New("Field 'digest.size' must be at least 2"))
+	}
+	if c.Digest.Enabled && c.Digest.Interval <= 0 {
+		err = multierr.Append(err, errors.New("Field 'digest.interval' must be positive"))
+	}
+	return err
+}
+
+// QueueStats counts what happened to the alerts of an alerter since the
+// registry was started.
+type QueueStats struct {
+	// Queued is how many alerts wait to be sent, in the queue or in a
+	// digest.
+	Queued    int
+	Delivered int
+	Retried   int
+
+	// Failed alerts were given up on after every retry, and Dropped ones
+	// never made it into the full queue.
+	Failed  int
+	Dropped int
+
+	// Digests is how many digests were sent in place of single alerts.
+	Digests int
+}
+
+// worker sends the alerts of one alerter in order. Workers are keyed by the
+// alerter name and outlive Replace; alerts go to whichever alerter holds
+// the name when they are sent.
+type worker struct {
+	name    string
+	alerts  chan *Alert
+	mu      sync.Mutex
+	stats   QueueStats
+	pending int
+}
+
+func (w *worker) update(f func(stats *QueueStats)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	f(&w.stats)
+}
+
+func (w *worker) snapshot() *QueueStats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	stats := w.stats
+	stats.Queued = len(w.alerts) + w.pending
+	return &stats
+}
+
+// Start sends alerts in the background from now on: every alerter gets its
+// own queue, so a slow or failing one never holds back the others nor the
+// caller. Until Start is called alerts are sent synchronously.
+func (r *Registry) Start(l logger.Logger, cfg *QueueConfig) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.l = l
+	r.queue = *cfg
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+	r.workers = map[string]*worker{}
+	r.started = true
+}
+
+// SetQueue replaces the retry and digest settings. The size only applies to
+// queues of alerters which weren't sent anything yet.
+func (r *Registry) SetQueue(cfg *QueueConfig) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.queue = *cfg
+}
+
+func (r *Registry) queueConfig() QueueConfig {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.queue
+}
+
+// Stop stops accepting alerts and sends the queued ones, digests included,
+// until ctx is done. Whatever is left then is dropped.
+func (r *Registry) Stop(ctx context.Context) {
+	r.mu.Lock()
+	if !r.started {
+		r.mu.Unlock()
+		return
+	}
+	r.started = false
+	for _, w := range r.workers {
+		close(w.alerts)
+	}
+	r.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		r.cancel()
+		<-done
+	}
+	r.cancel()
+}
+
+// enqueue hands alert to the worker of alerter, starting it if needed. It
+// reports false when alerts are sent synchronously.
+func (r *Registry) enqueue(alerter Alerter, alert *Alert) bool {
+	r.mu.Lock()
+	if !r.started {
+		r.mu.Unlock()
+		return false
+	}
+	if _, ok := r.alerters[alerter.Name()]; !ok {
+		// The alerter was dropped by Replace since the alert was routed.
+		r.mu.Unlock()
+		return true
+	}
+	w, ok := r.workers[alerter.Name()]
+	if !ok {
+		w = &worker{name: alerter.Name(), alerts: make(chan *Alert, r.queue.Size)}
+		r.workers[w.name] = w
+		r.wg.Add(1)
+		go r.run(w)
+	}
+	// Sending while holding the lock keeps Stop from closing the channel
+	// underneath.
+	select {
+	case w.alerts <- alert:
+	default:
+		w.update(func(stats *QueueStats) { stats.Dropped++ })
+		r.l.Error("Alert queue is full, dropped alert", zap.String("alerter", w.name), zap.String("address", alert.IP))
+	}
+	r.mu.Unlock()
+	return true
+}
+
+// run sends the alerts of w until its queue is closed, batching them into
+// digests when enabled.
+func (r *Registry) run(w *worker) {
+	defer r.wg.Done()
+	var batch []*Alert
+	var timer *time.Timer
+	var expired <-chan time.Time
+	flush := func() {
+		if timer != nil {
+			timer.Stop()
+			timer, expired = nil, nil
+		}
+		alerts := digest(batch)
+		batch = nil
+		w.mu.Lock()
+		w.pending = 0
+		w.mu.Unlock()
+		for _, alert := range alerts {
+			r.deliver(w, alert)
+		}
+	}
+	for {
+		select {
+		case alert, ok := <-w.alerts:
+			if !ok {
+				flush()
+				return
+			}
+			cfg := r.queueConfig()
+			if !cfg.Digest.Enabled || alert.Incident != "" {
+				r.deliver(w, alert)
+				continue
+			}
+			batch = append(batch, alert)
+			w.mu.Lock()
+			w.pending = len(batch)
+			w.mu.Unlock()
+			if len(batch) >= cfg.Digest.Size {
+				flush()
+			} else if timer == nil {
+				timer = time.NewTimer(cfg.Digest.Interval)
+				expired = timer.C
+			}
+		case <-expired:
+			flush()
+		}
+	}
+}
+
+// deliver sends alert, retrying with backoff.
+func (r *Registry) deliver(w *worker, alert *Alert) {
+	cfg := r.queueConfig()
+	backoff := cfg.Backoff
+	alert = alert.loaded(r.ctx)
+	for attempt := 0; ; attempt++ {
+		alerter, ok := r.Get(w.name)
+		if !ok || r.ctx.Err() != nil {
+			w.update(func(stats *QueueStats) { stats.Dropped++ })
+			return
+		}
+		err := alerter.Alert(r.ctx, alert)
+		r.record(w.name, alert.IP, err)
+		if err == nil {
+			w.update(func(stats *QueueStats) {
+				stats.Delivered++
+				if len(alert.Batch) > 0 {
+					stats.Digests++
+				}
+			})
+			return
+		}
+		if attempt >= cfg.Retries || r.ctx.Err() != nil {
+			w.update(func(stats *QueueStats) { stats.Failed++ })
+			r.l.Error(
+				"Failed to deliver alert",
+				zap.String("alerter", w.name),
+				zap.String("address", alert.IP),
+				zap.Int("attempts", attempt+1),
+				zap.Error(err),
+			)
+			return
+		}
+		w.update(func(stats *QueueStats) { stats.Retried++ })
+		select {
+		case <-time.After(backoff):
+		case <-r.ctx.Done():
+		}
+		if backoff *= 2; backoff > cfg.MaxBackoff {
+			backoff = cfg.MaxBackoff
+		}
+	}
+}
+
+// digest groups alerts by author, action and channel, in the order the
+// groups first appear. Groups of a single alert are kept as is, the others
+// become a digest listing their addresses.
+func digest(alerts []*Alert) []*Alert {
+	var keys []string
+	groups := map[string][]*Alert{}
+	for _, alert := range alerts {
+		key := alert.Author + "\x00" + alert.Action + "\x00" + alert.Channel
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], alert)
+	}
+	result := make([]*Alert, 0, len(keys))
+	for _, key := range keys {
+		group := groups[key]
+		if len(group) == 1 {
+			result = append(result, group[0])
+			continue
+		}
+		ips := make([]string, 0, len(group))
+		comment := group[0].Comment
+		for _, alert := range group {
+			ips = append(ips, alert.IP)
+			if alert.Comment != comment {
+				comment = ""
+			}
+		}
+		result = append(result, &Alert{
+			IP:       summarize(ips, 10),
+			Action:   group[0].Action,
+			Author:   group[0].Author,
+			Comment:  comment,
+			Severity: SeverityInfo,
+			Channel:  group[0].Channel,
+			Batch:    group,
+		})
+	}
+	return result
+}
+
+// summarize lists the first n of ips and how many more there are.
+func summarize(ips []string, n int) string {
+	if len(ips) <= n {
+		return strings.Join(ips, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(ips[:n], ", "), len(ips)-n)
+}
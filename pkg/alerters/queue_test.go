@@ -0,0 +1,141 @@
+package alerters
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hostinger/hbl/pkg/checkers"
+	"github.com/hostinger/hbl/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyAlerter fails the first failures alerts it's sent.
+type flakyAlerter struct {
+	mu       sync.Mutex
+	failures int
+	alerts   []*Alert
+}
+
+func (f *flakyAlerter) Name() string {
+	return "Flaky"
+}
+
+func (f *flakyAlerter) Alert(ctx context.Context, alert *Alert) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failures > 0 {
+		f.failures--
+		return errors.New("Webhook is unavailable")
+	}
+	f.alerts = append(f.alerts, alert)
+	return nil
+}
+
+func TestRegistry_Start(t *testing.T) {
+	alerter := &flakyAlerter{failures: 2}
+	registry := NewRegistry()
+	registry.Register(alerter)
+	registry.Start(logger.NewLogger("test"), &QueueConfig{
+		Size:       10,
+		Retries:    2,
+		Backoff:    time.Millisecond,
+		MaxBackoff: time.Millisecond,
+		Digest:     DigestConfig{Enabled: true, Size: 3, Interval: time.Hour},
+	})
+
+	for _, ip := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3", "192.0.2.4"} {
+		registry.AlertOnAll(context.Background(), &Alert{IP: ip, Action: "Block", Author: "importer", Comment: "Feed"})
+	}
+	registry.AlertOnAll(context.Background(), &Alert{Action: "SyncAll", Incident: "SyncAll", Severity: SeverityError})
+	registry.Stop(context.Background())
+
+	if assert.Len(t, alerter.alerts, 3) {
+		assert.Equal(t, "192.0.2.1, 192.0.2.2, 192.0.2.3", alerter.alerts[0].IP)
+		assert.Equal(t, "Received 3 BLOCK actions by importer", alerter.alerts[0].Title())
+		assert.Equal(t, "Feed", alerter.alerts[0].Comment)
+		assert.Equal(t, "SyncAll", alerter.alerts[1].Incident)
+		assert.Equal(t, "192.0.2.4", alerter.alerts[2].IP)
+	}
+	stats := registry.Info()[0].Queue
+	assert.Equal(t, &QueueStats{Delivered: 3, Retried: 2, Digests: 1}, stats)
+}
+
+func TestRegistry_WithChecks(t *testing.T) {
+	alerter := &flakyAlerter{}
+	registry := NewRegistry()
+	registry.Register(alerter)
+	registry.Register(&channelAlerter{name: "Other"})
+	registry.Start(logger.NewLogger("test"), &QueueConfig{Size: 10, Backoff: time.Millisecond, MaxBackoff: time.Millisecond})
+
+	loaded := make(chan struct{})
+	var loads int
+	alert := (&Alert{IP: "192.0.2.1", Action: "Block"}).WithChecks(func(ctx context.Context) *checkers.Aggregate {
+		<-loaded
+		loads++
+		return &checkers.Aggregate{IP: "192.0.2.1", Score: 90, Verdict: checkers.VerdictMalicious}
+	})
+	// Checks are loaded by the queue, so alerting doesn't wait for them.
+	registry.AlertOnAll(context.Background(), alert)
+	close(loaded)
+	registry.Stop(context.Background())
+
+	assert.Equal(t, 1, loads)
+	assert.Nil(t, alert.Checks)
+	if assert.Len(t, alerter.alerts, 1) && assert.NotNil(t, alerter.alerts[0].Checks) {
+		assert.Equal(t, 90, alerter.alerts[0].Checks.Score)
+	}
+}
+
+func Test_digest(t *testing.T) {
+	alerts := digest([]*Alert{
+		{IP: "192.0.2.1", Action: "Block", Author: "importer", Comment: "Feed"},
+		{IP: "192.0.2.2", Action: "Allow", Author: "ops"},
+		{IP: "192.0.2.3", Action: "Block", Author: "importer", Comment: "Scan"},
+	})
+	if assert.Len(t, alerts, 2) {
+		assert.Len(t, alerts[0].Batch, 2)
+		assert.Equal(t, "192.0.2.1, 192.0.2.3", alerts[0].IP)
+		assert.Empty(t, alerts[0].Comment)
+		assert.Equal(t, "192.0.2.2", alerts[1].IP)
+		assert.Nil(t, alerts[1].Batch)
+	}
+	assert.Equal(t, "a, b and 1 more", summarize([]string{"a", "b", "c"}, 2))
+}
+
+type closingAlerter struct {
+	flakyAlerter
+	closed int
+}
+
+func (c *closingAlerter) Close() error {
+	c.closed++
+	return nil
+}
+
+func TestRegistry_Replace(t *testing.T) {
+	dropped := &closingAlerter{}
+	kept := &channelAlerter{name: "Slack"}
+	registry := NewRegistry()
+	registry.Register(dropped)
+	registry.Register(kept)
+	registry.Start(logger.NewLogger("test"), &QueueConfig{Size: 10, Backoff: time.Millisecond, MaxBackoff: time.Millisecond})
+	registry.AlertOnAll(context.Background(), &Alert{IP: "192.0.2.1", Action: "Block"})
+
+	// The queue of the dropped alerter is stopped, the other one is kept.
+	registry.Replace(kept)
+	assert.Equal(t, 1, dropped.closed)
+	registry.mu.RLock()
+	assert.Len(t, registry.workers, 1)
+	assert.NotNil(t, registry.workers["Slack"])
+	registry.mu.RUnlock()
+
+	registry.AlertOnOne(context.Background(), &Alert{IP: "192.0.2.2", Action: "Block"}, "Flaky")
+	registry.AlertOnAll(context.Background(), &Alert{IP: "192.0.2.3", Action: "Block"})
+	registry.Stop(context.Background())
+	assert.Len(t, kept.channels, 2)
+	assert.NoError(t, registry.Close())
+	assert.Equal(t, 1, dropped.closed)
+}
@@ -0,0 +1,142 @@
+package alerters
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+)
+
+// Route sends the alerts it matches to some alerters only, e.g. allows to
+// the '#security-approvals' channel. Routes are tried in order and the
+// first matching one wins, unless it continues to the next ones. Alerts no
+// route matches go to every alerter.
+type Route struct {
+	// Actions, Authors, Sources, Targets, Lists and Severities match
+	// alerts with any of their values; empty ones match every alert.
+	// Authors and sources may hold patterns such as 'importer-*'. Matching
+	// ignores case.
+	Actions    []string `mapstructure:"actions"`
+	Authors    []string `mapstructure:"authors"`
+	Sources    []string `mapstructure:"sources"`
+	Targets    []string `mapstructure:"targets"`
+	Lists      []string `mapstructure:"lists"`
+	Severities []string `mapstructure:"severities"`
+
+	// Alerters are the names of the alerters receiving matching alerts,
+	// such as 'Slack', every alerter when empty.
+	Alerters []string `mapstructure:"alerters"`
+
+	// Channel overrides the channel Slack and Mattermost post matching
+	// alerts to.
+	Channel string `mapstructure:"channel"`
+
+	// Continue also sends matching alerts through the next routes.
+	Continue bool `mapstructure:"continue"`
+}
+
+func (r *Route) Validate() error {
+	var err error
+	for _, pattern := range append(append([]string{}, r.Authors...), r.Sources...) {
+		if _, e := path.Match(pattern, ""); e != nil {
+			err = multierr.Append(err, fmt.Errorf("Field 'authors' and 'sources' must hold valid patterns, got '%s'", pattern))
+		}
+	}
+	for _, target := range r.Targets {
+		switch strings.ToLower(target) {
+		case "ip", "asn", "country", "network":
+		default:
+			err = multierr.Append(err, fmt.Errorf("Field 'targets' must only hold ip, asn, country or network, got '%s'", target))
+		}
+	}
+	for _, list := range r.Lists {
+		switch strings.ToLower(list) {
+		case "block", "allow":
+		default:
+			err = multierr.Append(err, fmt.Errorf("Field 'lists' must only hold block or allow, got '%s'", list))
+		}
+	}
+	for _, severity := range r.Severities {
+		if !isSeverity(severity) {
+			err = multierr.Append(err, fmt.Errorf("Field 'severities' must only hold %s, got '%s'", strings.Join(Severities, ", "), severity))
+		}
+	}
+	for _, name := range r.Alerters {
+		if strings.TrimSpace(name) == "" {
+			err = multierr.Append(err, errors.New("Field 'alerters' must not hold empty names"))
+		}
+	}
+	return err
+}
+
+// Matches tells whether alert matches every non-empty field of the route.
+func (r *Route) Matches(alert *Alert) bool {
+	return matchAny(r.Actions, alert.Action, false) &&
+		matchAny(r.Authors, alert.Author, true) &&
+		matchAny(r.Sources, alert.Source, true) &&
+		matchAny(r.Targets, alert.Target, false) &&
+		matchAny(r.Lists, alert.List, false) &&
+		matchAny(r.Severities, alert.severity(), false)
+}
+
+// selects tells whether the route sends alerts to the alerter called name.
+func (r *Route) selects(name string) bool {
+	return matchAny(r.Alerters, name, false)
+}
+
+func matchAny(values []string, value string, patterns bool) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if patterns {
+			if ok, _ := path.Match(strings.ToLower(v), strings.ToLower(value)); ok {
+				return true
+			}
+		} else if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetRoutes replaces the routes alerts are sent through.
+func (r *Registry) SetRoutes(routes []Route) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.routes = append([]Route{}, routes...)
+}
+
+// route returns alert as alerter should receive it, with the channel of the
+// first matching route which picked alerter, or nil when the matching routes
+// didn't pick it.
+func (r *Registry) route(alerter Alerter, alert *Alert) *Alert {
+	r.mu.RLock()
+	routes := r.routes
+	r.mu.RUnlock()
+	matched := false
+	for i := range routes {
+		route := &routes[i]
+		if !route.Matches(alert) {
+			continue
+		}
+		matched = true
+		if route.selects(alerter.Name()) {
+			if route.Channel == "" {
+				return alert
+			}
+			routed := *alert
+			routed.Channel = route.Channel
+			return &routed
+		}
+		if !route.Continue {
+			break
+		}
+	}
+	if matched {
+		return nil
+	}
+	return alert
+}
@@ -0,0 +1,53 @@
+package alerters
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type channelAlerter struct {
+	name     string
+	channels []string
+}
+
+func (c *channelAlerter) Name() string {
+	return c.name
+}
+
+func (c *channelAlerter) Alert(ctx context.Context, alert *Alert) error {
+	c.channels = append(c.channels, alert.Channel)
+	return nil
+}
+
+func TestRegistry_SetRoutes(t *testing.T) {
+	slack, email := &channelAlerter{name: "Slack"}, &channelAlerter{name: "Email"}
+	registry := NewRegistry()
+	registry.Register(slack)
+	registry.Register(email)
+	registry.SetRoutes([]Route{
+		{Actions: []string{"allow"}, Alerters: []string{"slack"}, Channel: "#security-approvals"},
+		{Authors: []string{"importer-*"}, Alerters: []string{"Email"}, Continue: true},
+		{Targets: []string{"asn", "country"}, Alerters: []string{"Slack"}},
+		{Lists: []string{"allow"}, Alerters: []string{"Email"}},
+	})
+
+	registry.AlertOnAll(context.Background(), &Alert{IP: "192.0.2.1", Target: "ip", Action: "Allow", Author: "ops"})
+	registry.AlertOnAll(context.Background(), &Alert{IP: "AS64496", Target: "asn", Action: "Block", Author: "importer-feed"})
+	registry.AlertOnAll(context.Background(), &Alert{IP: "192.0.2.2", Target: "ip", Action: "Block", Author: "importer-feed"})
+	registry.AlertOnAll(context.Background(), &Alert{IP: "192.0.2.3", Target: "ip", Action: "Block", Author: "ops"})
+	registry.AlertOnAll(context.Background(), &Alert{IP: "192.0.2.4", Target: "ip", List: "Allow", Action: "Unblock", Author: "ops"})
+
+	assert.Equal(t, []string{"#security-approvals", "", ""}, slack.channels)
+	assert.Equal(t, []string{"", "", "", ""}, email.channels)
+}
+
+func TestRoute_Validate(t *testing.T) {
+	route := &Route{Authors: []string{"["}, Targets: []string{"host"}, Lists: []string{"grey"}, Severities: []string{"fatal"}, Alerters: []string{" "}}
+	err := route.Validate()
+	for _, field := range []string{"authors", "targets", "lists", "severities", "alerters"} {
+		assert.Contains(t, err.Error(), "Field '"+field+"'", field)
+	}
+	assert.NoError(t, (&Route{Actions: []string{"Allow"}, Alerters: []string{"Slack"}}).Validate())
+}
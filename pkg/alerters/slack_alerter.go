@@ -1,70 +1,185 @@
 package alerters
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
-	"os"
+	"io/ioutil"
+	"net/url"
+	"strconv"
 	"strings"
+	"text/template"
 
 	"github.com/hostinger/hbl/pkg/logger"
+	"github.com/hostinger/hbl/pkg/utils"
+	"github.com/pkg/errors"
 	"github.com/slack-go/slack"
+	"go.uber.org/multierr"
 	"go.uber.org/zap"
 )
 
+type SlackConfig struct {
+	Enabled    bool   `mapstructure:"enabled"`
+	WebhookURL string `mapstructure:"webhook_url"`
+	Channel    string `mapstructure:"channel"`
+	Username   string `mapstructure:"username"`
+
+	// Template is a Go template file rendering the alert into a JSON array
+	// of Block Kit blocks, replacing the built-in layout.
+	Template string `mapstructure:"template"`
+
+	// Interactive adds an Unblock button to alerts about blocked addresses.
+	// It needs the Slack integration of the server to be enabled and set as
+	// the interactivity request URL of the Slack app.
+	Interactive bool `mapstructure:"interactive"`
+}
+
+// slackSectionFields is the most fields a section block may hold.
+const slackSectionFields = 10
+
+// SlackUnblockAction is the action ID of the Unblock button. Its value is
+// the key of the address to unblock. Templates can add the button too.
+const SlackUnblockAction = "hbl_unblock"
+
+func (c *SlackConfig) Validate() error {
+	var err error
+	if _, e := url.ParseRequestURI(c.WebhookURL); e != nil {
+		err = multierr.Append(err, errors.New("Field 'webhook_url' must be a valid URL"))
+	}
+	if strings.TrimSpace(c.Channel) == "" {
+		err = multierr.Append(err, errors.New("Field 'channel' must not be empty"))
+	}
+	if _, e := c.template(); e != nil {
+		err = multierr.Append(err, e)
+	}
+	return err
+}
+
+// template parses the template file, if any.
+func (c *SlackConfig) template() (*template.Template, error) {
+	if c.Template == "" {
+		return nil, nil
+	}
+	b, err := ioutil.ReadFile(c.Template)
+	if err != nil {
+		return nil, fmt.Errorf("Field 'template' must be a readable file: %s", err)
+	}
+	t, err := template.New("slack").Funcs(templateFuncs).Parse(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("Field 'template' must be a valid template: %s", err)
+	}
+	return t, nil
+}
+
 type slackAlerter struct {
-	l        logger.Logger
-	url      string
-	username string
-	channel  string
+	l           logger.Logger
+	url         string
+	username    string
+	channel     string
+	template    *template.Template
+	interactive bool
 }
 
-func NewSlackAlerter(l logger.Logger) Alerter {
+func NewSlackAlerter(l logger.Logger, cfg *SlackConfig) (Alerter, error) {
 	l.Info("Starting execution of NewSlackAlerter", zap.String("alerter", "Slack"))
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	t, err := cfg.template()
+	if err != nil {
+		return nil, err
+	}
 	c := &slackAlerter{
-		l:        l,
-		url:      os.Getenv("SLACK_WEBHOOK_URL"),
-		channel:  os.Getenv("SLACK_WEBHOOK_CHANNEL"),
-		username: os.Getenv("SLACK_WEBHOOK_USERNAME"),
+		l:           l,
+		url:         cfg.WebhookURL,
+		channel:     cfg.Channel,
+		username:    cfg.Username,
+		template:    t,
+		interactive: cfg.Interactive,
 	}
 	l.Info("Finished execution of NewSlackAlerter", zap.String("alerter", "Slack"))
-	return c
+	return c, nil
 }
 
 func (s *slackAlerter) Name() string {
 	return "Slack"
 }
 
-func (s *slackAlerter) Alert(ctx context.Context, alert *Alert) {
+func (s *slackAlerter) Describe() map[string]string {
+	return map[string]string{
+		"channel":     s.channel,
+		"interactive": strconv.FormatBool(s.interactive),
+		"template":    s.templateName(),
+		"username":    s.username,
+		"webhook_url": utils.Redact(s.url),
+	}
+}
+
+func (s *slackAlerter) templateName() string {
+	if s.template == nil {
+		return "built-in"
+	}
+	return "custom"
+}
+
+// blocks renders the alert with the template, or the built-in layout.
+func (s *slackAlerter) blocks(alert *Alert) (*slack.Blocks, error) {
+	if s.template != nil {
+		var b bytes.Buffer
+		if err := s.template.Execute(&b, alert); err != nil {
+			return nil, errors.Wrap(err, "Failed to render template")
+		}
+		var blocks slack.Blocks
+		if err := json.Unmarshal(b.Bytes(), &blocks); err != nil {
+			return nil, errors.Wrap(err, "Failed to unmarshal template output into blocks")
+		}
+		return &blocks, nil
+	}
+	text := fmt.Sprintf("Received a new *%s* action for the following address.", strings.ToTitle(alert.Action))
+	if alert.Incident != "" || len(alert.Batch) > 0 {
+		text = fmt.Sprintf("*%s*", alert.Title())
+	}
+	section := slack.SectionBlock{
+		Type: "section",
+		Text: &slack.TextBlockObject{Type: "mrkdwn", Text: text},
+	}
+	blocks := &slack.Blocks{}
+	for _, field := range alert.Fields() {
+		// Slack allows up to 10 fields per section, the others follow in
+		// sections of their own.
+		if len(section.Fields) == slackSectionFields {
+			blocks.BlockSet = append(blocks.BlockSet, section)
+			section = slack.SectionBlock{Type: "section"}
+		}
+		section.Fields = append(section.Fields, &slack.TextBlockObject{
+			Type: "mrkdwn",
+			Text: fmt.Sprintf("*%s*\n%s", field.Title, field.Value),
+		})
+	}
+	blocks.BlockSet = append(blocks.BlockSet, section)
+	if s.interactive && alert.Action == "Block" && alert.Incident == "" && len(alert.Batch) == 0 {
+		button := slack.NewButtonBlockElement(SlackUnblockAction, alert.IP,
+			slack.NewTextBlockObject(slack.PlainTextType, "Unblock", false, false))
+		blocks.BlockSet = append(blocks.BlockSet, slack.NewActionBlock("hbl_actions", button))
+	}
+	return blocks, nil
+}
+
+func (s *slackAlerter) Alert(ctx context.Context, alert *Alert) error {
+	blocks, err := s.blocks(alert)
+	if err != nil {
+		return err
+	}
+	channel := s.channel
+	if alert.Channel != "" {
+		channel = alert.Channel
+	}
 	message := &slack.WebhookMessage{
 		Username: s.username,
-		Channel:  s.channel,
-		Blocks: &slack.Blocks{
-			BlockSet: []slack.Block{
-				slack.SectionBlock{
-					Type: "section",
-					Text: &slack.TextBlockObject{
-						Type: "mrkdwn",
-						Text: fmt.Sprintf("Received a new *%s* action for the following address.", strings.ToTitle(alert.Action)),
-					},
-					Fields: []*slack.TextBlockObject{
-						{
-							Type: "mrkdwn",
-							Text: fmt.Sprintf("*IP*\n%s", alert.IP),
-						},
-						{
-							Type: "mrkdwn",
-							Text: fmt.Sprintf("*Reason*\n%s", alert.Comment),
-						},
-					},
-				},
-			},
-		},
-	}
-	if err := slack.PostWebhookContext(ctx, s.url, message); err != nil {
-		s.l.Error(
-			"Failed to execute PostWebhookContext",
-			zap.String("alerter", "Slack"),
-			zap.Error(err),
-		)
+		Channel:  channel,
+		Text:     alert.Title(),
+		Blocks:   blocks,
 	}
+	return slack.PostWebhookContext(ctx, s.url, message)
 }
@@ -0,0 +1,101 @@
+package alerters
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hostinger/hbl/pkg/checkers"
+	"github.com/hostinger/hbl/pkg/logger"
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlackAlerter_Alert(t *testing.T) {
+	var message map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&message))
+	}))
+	defer server.Close()
+
+	file, err := ioutil.TempFile("", "slack-*.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString(`[{"type": "section", "text": {"type": "mrkdwn", "text": {{printf "*%s* by %s: %s" (upper .Action) .Author .Comment | json}}}}]`) // nolint
+	file.Close()
+
+	alerter, err := NewSlackAlerter(logger.NewLogger("test"), &SlackConfig{
+		WebhookURL: server.URL,
+		Channel:    "#hbl",
+		Template:   file.Name(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = alerter.Alert(context.Background(), &Alert{IP: "192.0.2.1", Action: "Allow", Author: "ops", Comment: `"Partner"`, Channel: "#security-approvals"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "#security-approvals", message["channel"])
+	blocks := message["blocks"].([]interface{})
+	text := blocks[0].(map[string]interface{})["text"].(map[string]interface{})["text"]
+	assert.Equal(t, `*ALLOW* by ops: "Partner"`, text)
+}
+
+func TestSlackAlerter_blocks(t *testing.T) {
+	alerter := &slackAlerter{interactive: true}
+
+	blocks, err := alerter.blocks(&Alert{IP: "192.0.2.1", Action: "Block", Comment: "Test"})
+	if assert.NoError(t, err) && assert.Len(t, blocks.BlockSet, 2) {
+		b, _ := json.Marshal(blocks.BlockSet[1])
+		assert.Contains(t, string(b), `"action_id":"hbl_unblock","value":"192.0.2.1"`)
+	}
+
+	blocks, err = alerter.blocks(&Alert{IP: "192.0.2.1", Action: "Allow", Comment: "Test"})
+	if assert.NoError(t, err) {
+		assert.Len(t, blocks.BlockSet, 1)
+	}
+
+	// Every field is shown, in sections of at most 10.
+	expires := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	alert := &Alert{
+		IP:        "192.0.2.1",
+		Action:    "Block",
+		Author:    "ops",
+		Comment:   "Test",
+		Source:    "fail2ban",
+		Endpoints: []string{"PowerDNS"},
+		Outcome:   "Applied",
+		ExpiresAt: &expires,
+		Checks: &checkers.Aggregate{Score: 90, Verdict: "malicious", Results: []*checkers.CheckResult{
+			{Checker: "AbuseIPDB", Score: 90, Verdict: "malicious"},
+			{Checker: "DNSBL", Score: 50, Verdict: "suspicious"},
+		}},
+	}
+	blocks, err = (&slackAlerter{}).blocks(alert)
+	if assert.NoError(t, err) && assert.Len(t, blocks.BlockSet, 2) {
+		var texts []string
+		for _, block := range blocks.BlockSet {
+			for _, field := range block.(slack.SectionBlock).Fields {
+				texts = append(texts, field.Text)
+			}
+		}
+		assert.Len(t, blocks.BlockSet[0].(slack.SectionBlock).Fields, 10)
+		assert.Contains(t, texts, "*Author*\nops")
+		assert.Contains(t, texts, "*Endpoints*\nPowerDNS")
+		assert.Contains(t, texts, "*Expires*\n2026-01-02T03:04:05Z")
+		assert.Contains(t, texts, "*Checks*\nscore 90, malicious")
+		assert.Contains(t, texts, "*DNSBL*\nscore 50, suspicious")
+	}
+}
+
+func TestSlackConfig_Validate(t *testing.T) {
+	cfg := &SlackConfig{WebhookURL: "https://hooks.slack.com/services/x", Channel: "#hbl", Template: "/nonexistent.tmpl"}
+	assert.Contains(t, cfg.Validate().Error(), "Field 'template'")
+}
@@ -0,0 +1,147 @@
+package alerters
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/hostinger/hbl/pkg/logger"
+	"github.com/hostinger/hbl/pkg/utils"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+type TeamsConfig struct {
+	Enabled    bool   `mapstructure:"enabled"`
+	WebhookURL string `mapstructure:"webhook_url"`
+}
+
+func (c *TeamsConfig) Validate() error {
+	var err error
+	if _, e := url.ParseRequestURI(c.WebhookURL); e != nil {
+		err = multierr.Append(err, errors.New("Field 'webhook_url' must be a valid URL"))
+	}
+	return err
+}
+
+type teamsAlerter struct {
+	l      logger.Logger
+	client *http.Client
+	url    string
+}
+
+func NewTeamsAlerter(l logger.Logger, cfg *TeamsConfig) (Alerter, error) {
+	l.Info("Starting execution of NewTeamsAlerter", zap.String("alerter", "Teams"))
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	t := &teamsAlerter{
+		l:      l,
+		client: &http.Client{Timeout: 10 * time.Second},
+		url:    cfg.WebhookURL,
+	}
+	l.Info("Finished execution of NewTeamsAlerter", zap.String("alerter", "Teams"))
+	return t, nil
+}
+
+func (t *teamsAlerter) Name() string {
+	return "Teams"
+}
+
+func (t *teamsAlerter) Describe() map[string]string {
+	return map[string]string{
+		"webhook_url": utils.Redact(t.url),
+	}
+}
+
+type teamsMessage struct {
+	Type        string            `json:"type"`
+	Attachments []teamsAttachment `json:"attachments"`
+}
+
+type teamsAttachment struct {
+	ContentType string    `json:"contentType"`
+	Content     teamsCard `json:"content"`
+}
+
+type teamsCard struct {
+	Schema  string             `json:"$schema"`
+	Type    string             `json:"type"`
+	Version string             `json:"version"`
+	Body    []teamsCardElement `json:"body"`
+}
+
+type teamsCardElement struct {
+	Type   string      `json:"type"`
+	Text   string      `json:"text,omitempty"`
+	Weight string      `json:"weight,omitempty"`
+	Size   string      `json:"size,omitempty"`
+	Color  string      `json:"color,omitempty"`
+	Wrap   bool        `json:"wrap,omitempty"`
+	Facts  []teamsFact `json:"facts,omitempty"`
+}
+
+type teamsFact struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+// teamsColor highlights blocks and incidents as attention, and allows and
+// resolved incidents as good.
+func teamsColor(alert *Alert) string {
+	if alert.Incident != "" {
+		if alert.Resolved {
+			return "Good"
+		}
+		return "Attention"
+	}
+	switch alert.Action {
+	case "Block":
+		return "Attention"
+	case "Allow":
+		return "Good"
+	}
+	return "Default"
+}
+
+// message lays the alert out as an adaptive card: a heading followed by a
+// fact set of its fields.
+func (t *teamsAlerter) message(alert *Alert) *teamsMessage {
+	facts := []teamsFact{}
+	for _, field := range alert.Fields() {
+		facts = append(facts, teamsFact{Title: field.Title, Value: field.Value})
+	}
+	return &teamsMessage{
+		Type: "message",
+		Attachments: []teamsAttachment{
+			{
+				ContentType: "application/vnd.microsoft.card.adaptive",
+				Content: teamsCard{
+					Schema:  "http://adaptivecards.io/schemas/adaptive-card.json",
+					Type:    "AdaptiveCard",
+					Version: "1.4",
+					Body: []teamsCardElement{
+						{
+							Type:   "TextBlock",
+							Text:   alert.Title(),
+							Weight: "Bolder",
+							Size:   "Medium",
+							Color:  teamsColor(alert),
+							Wrap:   true,
+						},
+						{
+							Type:  "FactSet",
+							Facts: facts,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func (t *teamsAlerter) Alert(ctx context.Context, alert *Alert) error {
+	return postJSON(ctx, t.client, t.url, nil, t.message(alert), nil)
+}
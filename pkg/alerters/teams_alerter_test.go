@@ -0,0 +1,39 @@
+package alerters
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hostinger/hbl/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTeamsAlerter_Alert(t *testing.T) {
+	var message teamsMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&message))
+	}))
+	defer server.Close()
+
+	alerter, err := NewTeamsAlerter(logger.NewLogger("test"), &TeamsConfig{WebhookURL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	alerter.Alert(context.Background(), &Alert{IP: "192.0.2.1", Action: "Block", Author: "fail2ban", Comment: "SSH"})
+
+	if assert.Len(t, message.Attachments, 1) {
+		card := message.Attachments[0].Content
+		assert.Equal(t, "AdaptiveCard", card.Type)
+		assert.Equal(t, "Attention", card.Body[0].Color)
+		assert.Equal(t, []teamsFact{
+			{Title: "IP", Value: "192.0.2.1"},
+			{Title: "Action", Value: "Block"},
+			{Title: "Author", Value: "fail2ban"},
+			{Title: "Comment", Value: "SSH"},
+		}, card.Body[1].Facts)
+	}
+}
@@ -0,0 +1,125 @@
+package alerters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hostinger/hbl/pkg/logger"
+	"github.com/hostinger/hbl/pkg/utils"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+type TelegramConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	// APIURL is the Bot API server, https://api.telegram.org unless a
+	// local one is used.
+	APIURL string `mapstructure:"api_url"`
+	Token  string `mapstructure:"token"`
+
+	// ChatID is the numeric ID of the chat or the '@username' of the
+	// channel to post to.
+	ChatID string `mapstructure:"chat_id"`
+}
+
+func (c *TelegramConfig) Validate() error {
+	var err error
+	if _, e := url.ParseRequestURI(c.APIURL); e != nil {
+		err = multierr.Append(err, errors.New("Field 'api_url' must be a valid URL"))
+	}
+	if strings.TrimSpace(c.Token) == "" {
+		err = multierr.Append(err, errors.New("Field 'token' must not be empty"))
+	}
+	if strings.TrimSpace(c.ChatID) == "" {
+		err = multierr.Append(err, errors.New("Field 'chat_id' must not be empty"))
+	}
+	return err
+}
+
+type telegramAlerter struct {
+	l      logger.Logger
+	client *http.Client
+	apiURL string
+	token  string
+	chatID string
+}
+
+func NewTelegramAlerter(l logger.Logger, cfg *TelegramConfig) (Alerter, error) {
+	l.Info("Starting execution of NewTelegramAlerter", zap.String("alerter", "Telegram"))
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	t := &telegramAlerter{
+		l:      l,
+		client: &http.Client{Timeout: 10 * time.Second},
+		apiURL: strings.TrimRight(cfg.APIURL, "/"),
+		token:  cfg.Token,
+		chatID: cfg.ChatID,
+	}
+	l.Info("Finished execution of NewTelegramAlerter", zap.String("alerter", "Telegram"))
+	return t, nil
+}
+
+func (t *telegramAlerter) Name() string {
+	return "Telegram"
+}
+
+func (t *telegramAlerter) Describe() map[string]string {
+	return map[string]string{
+		"api_url": t.apiURL,
+		"chat_id": t.chatID,
+		"token":   utils.Redact(t.token),
+	}
+}
+
+type telegramMessage struct {
+	ChatID                string `json:"chat_id"`
+	Text                  string `json:"text"`
+	ParseMode             string `json:"parse_mode"`
+	DisableWebPagePreview bool   `json:"disable_web_page_preview"`
+}
+
+type telegramResponse struct {
+	OK          bool   `json:"ok"`
+	Description string `json:"description"`
+}
+
+// message lays the alert out as HTML, one bold label per line.
+func (t *telegramAlerter) message(alert *Alert) *telegramMessage {
+	var text strings.Builder
+	if alert.Incident != "" {
+		fmt.Fprintf(&text, "<b>%s</b>\n", html.EscapeString(alert.Title()))
+	} else {
+		fmt.Fprintf(&text, "Received a new <b>%s</b> action for the following address.\n", html.EscapeString(strings.ToUpper(alert.Action)))
+	}
+	for _, field := range alert.Fields() {
+		fmt.Fprintf(&text, "\n<b>%s</b>: %s", html.EscapeString(field.Title), html.EscapeString(field.Value))
+	}
+	return &telegramMessage{
+		ChatID:                t.chatID,
+		Text:                  text.String(),
+		ParseMode:             "HTML",
+		DisableWebPagePreview: true,
+	}
+}
+
+// Alert sends the alert. The token is part of the URL, so it's redacted from
+// errors.
+func (t *telegramAlerter) Alert(ctx context.Context, alert *Alert) error {
+	var response telegramResponse
+	err := postJSON(ctx, t.client, fmt.Sprintf("%s/bot%s/sendMessage", t.apiURL, t.token), nil, t.message(alert), &response)
+	if err == nil && !response.OK {
+		err = fmt.Errorf("Telegram refused the message: %s", response.Description)
+	}
+	if err != nil {
+		return errors.New(strings.Replace(err.Error(), t.token, utils.Redact(t.token), -1))
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package alerters
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hostinger/hbl/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTelegramAlerter_Alert(t *testing.T) {
+	var message telegramMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/bot123:secret/sendMessage", r.URL.Path)
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&message))
+		w.Write([]byte(`{"ok":true}`)) // nolint
+	}))
+	defer server.Close()
+
+	alerter, err := NewTelegramAlerter(logger.NewLogger("test"), &TelegramConfig{
+		APIURL: server.URL + "/",
+		Token:  "123:secret",
+		ChatID: "-100123",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	alerter.Alert(context.Background(), &Alert{IP: "192.0.2.1", Action: "Block", Author: "ops", Comment: "<script>"})
+
+	assert.Equal(t, "-100123", message.ChatID)
+	assert.Equal(t, "HTML", message.ParseMode)
+	assert.Contains(t, message.Text, "<b>IP</b>: 192.0.2.1")
+	assert.Contains(t, message.Text, "<b>Comment</b>: &lt;script&gt;")
+}
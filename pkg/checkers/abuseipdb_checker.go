@@ -7,14 +7,57 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"os"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/hostinger/hbl/pkg/logger"
+	"github.com/hostinger/hbl/pkg/utils"
 	"github.com/pkg/errors"
+	"go.uber.org/multierr"
 	"go.uber.org/zap"
 )
 
+type AbuseIPDBConfig struct {
+	Enabled bool    `mapstructure:"enabled"`
+	BaseURL string  `mapstructure:"base_url"`
+	Key     string  `mapstructure:"key"`
+	Weight  float64 `mapstructure:"weight"`
+
+	// MaxAge is how long a cached report is served before AbuseIPDB is
+	// queried again. Zero keeps reports forever.
+	MaxAge time.Duration `mapstructure:"max_age"`
+
+	// QuotaReserve is how many checks of the daily quota are kept for
+	// lookups; background refreshes are queued in memory once only this many
+	// remain.
+	QuotaReserve int `mapstructure:"quota_reserve"`
+
+	Report AbuseIPDBReportConfig `mapstructure:"report"`
+}
+
+func (c *AbuseIPDBConfig) Validate() error {
+	var err error
+	if _, e := url.ParseRequestURI(c.BaseURL); e != nil {
+		err = multierr.Append(err, errors.New("Field 'base_url' must be a valid URL"))
+	}
+	if strings.TrimSpace(c.Key) == "" {
+		err = multierr.Append(err, errors.New("Field 'key' must not be empty"))
+	}
+	if c.Weight < 0 {
+		err = multierr.Append(err, errors.New("Field 'weight' must not be negative"))
+	}
+	if c.MaxAge < 0 {
+		err = multierr.Append(err, errors.New("Field 'max_age' must not be negative"))
+	}
+	if c.QuotaReserve < 0 {
+		err = multierr.Append(err, errors.New("Field 'quota_reserve' must not be negative"))
+	}
+	err = multierr.Append(err, c.Report.Validate())
+	return err
+}
+
 type AbuseIPDBReport struct {
 	IP                   string
 	CountryCode          string
@@ -24,6 +67,17 @@ type AbuseIPDBReport struct {
 	NumDistinctUsers     int
 	TotalReports         int
 	LastReportedAt       *time.Time
+	FetchedAt            time.Time
+}
+
+func (r *AbuseIPDBReport) Fields() map[string]interface{} {
+	return map[string]interface{}{
+		"country_code":       r.CountryCode,
+		"usage_type":         r.UsageType,
+		"isp":                r.ISP,
+		"total_reports":      r.TotalReports,
+		"num_distinct_users": r.NumDistinctUsers,
+	}
 }
 
 type abuseipdbChecker struct {
@@ -32,27 +86,92 @@ type abuseipdbChecker struct {
 	client  *http.Client
 	baseURL string
 	key     string
+	weight  float64
+	maxAge  time.Duration
+	reserve int
+	quota   abuseipdbQuota
+
+	pendingMu  sync.Mutex
+	pending    map[string]struct{}
+	drainTimer *time.Timer
+	closed     bool
+
+	reportedMu sync.Mutex
+	reporter   abuseipdbReporter
 }
 
-func NewAbuseIPDBChecker(l logger.Logger, db *sql.DB) Checker {
+func NewAbuseIPDBChecker(l logger.Logger, db *sql.DB, cfg *AbuseIPDBConfig) (Checker, error) {
 	l.Info("Starting execution of NewAbuseIPDBChecker", zap.String("checker", "AbuseIPDB"))
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
 	c := &abuseipdbChecker{
 		client: &http.Client{
 			Timeout: 5 * time.Second,
 		},
-		baseURL: "https://api.abuseipdb.com/api/v2",
-		key:     os.Getenv("ABUSEIPDB_API_KEY"),
-		DB:      db,
-		l:       l,
+		baseURL: strings.TrimSuffix(cfg.BaseURL, "/"),
+		key:     cfg.Key,
+		weight:  cfg.Weight,
+		maxAge:  cfg.MaxAge,
+		reserve: cfg.QuotaReserve,
+		pending: map[string]struct{}{},
+
+		reporter: newAbuseIPDBReporter(&cfg.Report),
+		DB:       db,
+		l:        l,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	quota, err := c.GetQuota(ctx)
+	if err != nil && err != sql.ErrNoRows {
+		l.Error(
+			"Failed to execute GetQuota",
+			zap.String("checker", "AbuseIPDB"),
+			zap.Error(err),
+		)
+	}
+	if quota != nil {
+		c.quota.set(quota)
 	}
 	l.Info("Finished execution of NewAbuseIPDBChecker", zap.String("checker", "AbuseIPDB"))
-	return c
+	return c, nil
 }
 
 func (c *abuseipdbChecker) Name() string {
 	return "AbuseIPDB"
 }
 
+func (c *abuseipdbChecker) Weight() float64 {
+	return c.weight
+}
+
+func (c *abuseipdbChecker) Describe() map[string]string {
+	return map[string]string{
+		"base_url":      c.baseURL,
+		"key":           utils.Redact(c.key),
+		"weight":        fmt.Sprintf("%g", c.weight),
+		"max_age":       c.maxAge.String(),
+		"quota_reserve": fmt.Sprintf("%d", c.reserve),
+		"report":        fmt.Sprintf("%t", c.reporter.enabled),
+	}
+}
+
+// HealthCheck verifies that cached reports can be read and that quota is
+// left. It deliberately doesn't call the AbuseIPDB API, which would consume
+// quota.
+func (c *abuseipdbChecker) HealthCheck(ctx context.Context) error {
+	var exists int
+	err := c.DB.QueryRowContext(ctx, "SELECT 1 FROM abuseipdb_metadata LIMIT 1").Scan(&exists)
+	if err != nil && err != sql.ErrNoRows {
+		return errors.Wrap(err, "Failed to query abuseipdb_metadata")
+	}
+	if quota := c.quota.get(); quota != nil && quota.Exhausted(time.Now()) {
+		return errors.Wrapf(ErrQuotaExhausted, "Resets at %s", quota.ResetAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
 func (c *abuseipdbChecker) Call(ctx context.Context, ip string) (*AbuseIPDBReport, error) {
 	type Result struct {
 		Data struct {
@@ -71,6 +190,9 @@ func (c *abuseipdbChecker) Call(ctx context.Context, ip string) (*AbuseIPDBRepor
 			IsPublic             bool          `json:"isPublic"`
 		} `json:"data"`
 	}
+	if !c.quota.allows(time.Now(), 0) {
+		return nil, ErrQuotaExhausted
+	}
 	uri := fmt.Sprintf("%s/check", c.baseURL)
 	req, err := http.NewRequestWithContext(ctx, "GET", uri, nil)
 	if err != nil {
@@ -110,6 +232,25 @@ func (c *abuseipdbChecker) Call(ctx context.Context, ip string) (*AbuseIPDBRepor
 		return nil, errors.Wrap(err, "Failed to read response body")
 	}
 
+	c.updateQuota(ctx, parseQuota(resp, time.Now()))
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		c.l.Error(
+			"AbuseIPDB quota exhausted",
+			zap.String("checker", "AbuseIPDB"),
+			zap.String("error", string(body)),
+		)
+		return nil, ErrQuotaExhausted
+	}
+	if resp.StatusCode != http.StatusOK {
+		c.l.Error(
+			"Uknown response from AbuseIPDB API",
+			zap.String("checker", "AbuseIPDB"),
+			zap.String("error", string(body)),
+		)
+		return nil, errors.Errorf("Unknown response from API: %s", string(body))
+	}
+
 	var result Result
 	if err := json.Unmarshal(body, &result); err != nil {
 		c.l.Error(
@@ -129,28 +270,143 @@ func (c *abuseipdbChecker) Call(ctx context.Context, ip string) (*AbuseIPDBRepor
 		NumDistinctUsers:     result.Data.NumDistinctUsers,
 		TotalReports:         result.Data.TotalReports,
 		LastReportedAt:       result.Data.LastReportedAt,
+		FetchedAt:            time.Now(),
 	}, nil
 }
 
-func (c *abuseipdbChecker) Check(ctx context.Context, ip string) (interface{}, error) {
+func (c *abuseipdbChecker) Check(ctx context.Context, ip string) (*CheckResult, error) {
 	report, err := c.GetReport(ctx, ip)
-	if err != nil && err == sql.ErrNoRows {
-		report, err = c.Call(ctx, ip)
-		if err != nil {
-			return nil, err
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if err == nil && !RefreshRequested(ctx) && !c.stale(report) {
+		return c.result(report, "cache"), nil
+	}
+	if CachedOnlyRequested(ctx) {
+		if report == nil {
+			return nil, ErrNotCached
 		}
-		if err := c.SaveReport(ctx, report); err != nil {
+		return c.result(report, "stale"), nil
+	}
+	fresh, err := c.fetch(ctx, ip)
+	if err != nil {
+		if report != nil && !RefreshRequested(ctx) {
 			c.l.Error(
-				"Failed to execute SaveReport",
+				"Failed to refresh stale report, serving cached one",
 				zap.String("checker", "AbuseIPDB"),
+				zap.String("ip", ip),
 				zap.Error(err),
 			)
+			return c.result(report, "stale"), nil
+		}
+		return nil, err
+	}
+	return c.result(fresh, "api"), nil
+}
+
+// Refresh queries AbuseIPDB again when the cached report for ip is missing
+// or older than the configured max age. Refreshes are low priority: once
+// the quota is down to the reserve they are queued until it resets.
+func (c *abuseipdbChecker) Refresh(ctx context.Context, ip string) error {
+	report, err := c.GetReport(ctx, ip)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if err == nil && !c.stale(report) {
+		return nil
+	}
+	if !c.quota.allows(time.Now(), c.reserve) {
+		c.enqueue(ip)
+		return nil
+	}
+	_, err = c.fetch(ctx, ip)
+	if err == ErrQuotaExhausted {
+		c.enqueue(ip)
+		return nil
+	}
+	return err
+}
+
+func (c *abuseipdbChecker) History(ctx context.Context, ip string, limit int) ([]*CheckResult, error) {
+	reports, err := c.GetHistory(ctx, ip, limit)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*CheckResult, 0, len(reports))
+	for _, report := range reports {
+		results = append(results, c.result(report, "history"))
+	}
+	return results, nil
+}
+
+// Scores returns the cached abuse confidence score of every address.
+func (c *abuseipdbChecker) Scores(ctx context.Context) (map[string]int, error) {
+	q := `
+		SELECT
+			INET6_NTOA(ip),
+			abuse_confidence_score
+		FROM
+			abuseipdb_metadata
+	`
+	rows, err := c.DB.QueryContext(ctx, q)
+	if err != nil {
+		c.l.Error(
+			"Failed to execute QueryContext",
+			zap.String("checker", "AbuseIPDB"),
+			zap.Error(err),
+		)
+		return nil, errors.Wrap(err, "Failed to execute QueryContext")
+	}
+	defer rows.Close()
+
+	scores := map[string]int{}
+	for rows.Next() {
+		var ip string
+		var score int
+		if err := rows.Scan(&ip, &score); err != nil {
 			return nil, err
 		}
+		scores[ip] = score
+	}
+	return scores, rows.Err()
+}
+
+func (c *abuseipdbChecker) stale(report *AbuseIPDBReport) bool {
+	return c.maxAge > 0 && time.Since(report.FetchedAt) > c.maxAge
+}
+
+func (c *abuseipdbChecker) fetch(ctx context.Context, ip string) (*AbuseIPDBReport, error) {
+	report, err := c.Call(ctx, ip)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.SaveReport(ctx, report); err != nil {
+		c.l.Error(
+			"Failed to execute SaveReport",
+			zap.String("checker", "AbuseIPDB"),
+			zap.Error(err),
+		)
+		return nil, err
 	}
 	return report, nil
 }
 
+func (c *abuseipdbChecker) result(report *AbuseIPDBReport, source string) *CheckResult {
+	var categories []string
+	if report.UsageType != "" {
+		categories = append(categories, report.UsageType)
+	}
+	return &CheckResult{
+		Checker:    c.Name(),
+		Score:      report.AbuseConfidenceScore,
+		Verdict:    VerdictFromScore(report.AbuseConfidenceScore),
+		Categories: categories,
+		Source:     source,
+		FetchedAt:  report.FetchedAt,
+		Raw:        report,
+	}
+}
+
 func (c *abuseipdbChecker) SaveReport(ctx context.Context, report *AbuseIPDBReport) error {
 	tx, err := c.DB.BeginTx(ctx, nil)
 	if err != nil {
@@ -162,45 +418,50 @@ func (c *abuseipdbChecker) SaveReport(ctx context.Context, report *AbuseIPDBRepo
 		return errors.Wrap(err, "Failed to execute BeginTx")
 	}
 
-	q := `
-		REPLACE INTO
-			abuseipdb_metadata(
-				ip,
-				abuse_confidence_score,
-				country_code,
-				usage_type,
-				isp,
-				total_reports,
-				num_distinct_users,
-				last_reported_at
-			)
-		VALUES
-			(
-				INET_ATON(?),
-				?,
-				?,
-				?,
-				?,
-				?,
-				?,
-				?
-			)
+	columns := `
+		ip,
+		abuse_confidence_score,
+		country_code,
+		usage_type,
+		isp,
+		total_reports,
+		num_distinct_users,
+		last_reported_at,
+		fetched_at
 	`
-	_, err = tx.ExecContext(ctx, q,
-		report.IP, report.AbuseConfidenceScore,
-		report.CountryCode, report.UsageType,
-		report.ISP, report.TotalReports,
-		report.NumDistinctUsers,
-		report.LastReportedAt,
-	)
-	if err != nil {
-		c.l.Error(
-			"Failed to execute ExecContext",
-			zap.String("checker", "AbuseIPDB"),
-			zap.Error(err),
+	values := `
+		INET6_ATON(?),
+		?,
+		?,
+		?,
+		?,
+		?,
+		?,
+		?,
+		?
+	`
+	queries := []string{
+		"REPLACE INTO abuseipdb_metadata(" + columns + ") VALUES (" + values + ")",
+		"INSERT INTO abuseipdb_history(" + columns + ") VALUES (" + values + ")",
+	}
+	for _, q := range queries {
+		_, err = tx.ExecContext(ctx, q,
+			report.IP, report.AbuseConfidenceScore,
+			report.CountryCode, report.UsageType,
+			report.ISP, report.TotalReports,
+			report.NumDistinctUsers,
+			report.LastReportedAt,
+			report.FetchedAt,
 		)
-		tx.Rollback() // nolint
-		return errors.Wrap(err, "Failed to execute ExecContext")
+		if err != nil {
+			c.l.Error(
+				"Failed to execute ExecContext",
+				zap.String("checker", "AbuseIPDB"),
+				zap.Error(err),
+			)
+			tx.Rollback() // nolint
+			return errors.Wrap(err, "Failed to execute ExecContext")
+		}
 	}
 
 	if err := tx.Commit(); err != nil {
@@ -228,18 +489,19 @@ func (c *abuseipdbChecker) GetReport(ctx context.Context, ip string) (*AbuseIPDB
 	}
 	q := `
 		SELECT
-			INET_NTOA(ip),
+			INET6_NTOA(ip),
 			abuse_confidence_score,
 			country_code,
 			usage_type,
 			isp,
 			total_reports,
 			num_distinct_users,
-			last_reported_at
+			last_reported_at,
+			fetched_at
 		FROM
 			abuseipdb_metadata
 		WHERE
-			ip = INET_ATON(?)
+			ip = INET6_ATON(?)
 		LIMIT 1
 	`
 	result := tx.QueryRowContext(ctx, q, ip)
@@ -247,7 +509,9 @@ func (c *abuseipdbChecker) GetReport(ctx context.Context, ip string) (*AbuseIPDB
 		&report.CountryCode, &report.UsageType,
 		&report.ISP, &report.TotalReports,
 		&report.NumDistinctUsers,
-		&report.LastReportedAt); err != nil {
+		&report.LastReportedAt,
+		&report.FetchedAt); err != nil {
+		tx.Rollback() // nolint
 		return nil, err
 	}
 	if err := tx.Commit(); err != nil {
@@ -260,3 +524,50 @@ func (c *abuseipdbChecker) GetReport(ctx context.Context, ip string) (*AbuseIPDB
 	}
 	return &report, nil
 }
+
+func (c *abuseipdbChecker) GetHistory(ctx context.Context, ip string, limit int) ([]*AbuseIPDBReport, error) {
+	q := `
+		SELECT
+			INET6_NTOA(ip),
+			abuse_confidence_score,
+			country_code,
+			usage_type,
+			isp,
+			total_reports,
+			num_distinct_users,
+			last_reported_at,
+			fetched_at
+		FROM
+			abuseipdb_history
+		WHERE
+			ip = INET6_ATON(?)
+		ORDER BY
+			fetched_at DESC
+		LIMIT ?
+	`
+	rows, err := c.DB.QueryContext(ctx, q, ip, limit)
+	if err != nil {
+		c.l.Error(
+			"Failed to execute QueryContext",
+			zap.String("checker", "AbuseIPDB"),
+			zap.Error(err),
+		)
+		return nil, errors.Wrap(err, "Failed to execute QueryContext")
+	}
+	defer rows.Close()
+
+	var reports []*AbuseIPDBReport
+	for rows.Next() {
+		var report AbuseIPDBReport
+		if err := rows.Scan(&report.IP, &report.AbuseConfidenceScore,
+			&report.CountryCode, &report.UsageType,
+			&report.ISP, &report.TotalReports,
+			&report.NumDistinctUsers,
+			&report.LastReportedAt,
+			&report.FetchedAt); err != nil {
+			return nil, err
+		}
+		reports = append(reports, &report)
+	}
+	return reports, rows.Err()
+}
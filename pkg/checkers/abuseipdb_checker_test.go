@@ -0,0 +1,192 @@
+package checkers
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hostinger/hbl/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeCache is the abuseipdb_metadata table of a test, served by the
+// abuseipdb-cache driver to the checker under test. Other tables are
+// ignored.
+type fakeCache struct {
+	mu      sync.Mutex
+	rows    map[string][]driver.Value
+	history int
+}
+
+var fakeCaches sync.Map
+
+func init() {
+	sql.Register("abuseipdb-cache", fakeCacheDriver{})
+}
+
+type fakeCacheDriver struct{}
+
+func (fakeCacheDriver) Open(name string) (driver.Conn, error) {
+	cache, _ := fakeCaches.Load(name)
+	return &fakeCacheConn{cache: cache.(*fakeCache)}, nil
+}
+
+type fakeCacheConn struct {
+	cache *fakeCache
+}
+
+func (c *fakeCacheConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, driver.ErrSkip
+}
+
+func (c *fakeCacheConn) Close() error              { return nil }
+func (c *fakeCacheConn) Begin() (driver.Tx, error) { return c, nil }
+func (c *fakeCacheConn) Commit() error             { return nil }
+func (c *fakeCacheConn) Rollback() error           { return nil }
+
+func (c *fakeCacheConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.cache.mu.Lock()
+	defer c.cache.mu.Unlock()
+	switch {
+	case strings.Contains(query, "abuseipdb_metadata"):
+		row := make([]driver.Value, 0, len(args))
+		for _, arg := range args {
+			row = append(row, arg.Value)
+		}
+		c.cache.rows[row[0].(string)] = row
+	case strings.Contains(query, "abuseipdb_history"):
+		c.cache.history++
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeCacheConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.cache.mu.Lock()
+	defer c.cache.mu.Unlock()
+	rows := &fakeCacheRows{}
+	// Columns are selected in the order they are saved.
+	if strings.Contains(query, "SELECT") && strings.Contains(query, "abuseipdb_metadata") {
+		if row, ok := c.cache.rows[args[0].Value.(string)]; ok {
+			rows.rows = [][]driver.Value{row}
+		}
+	}
+	return rows, nil
+}
+
+type fakeCacheRows struct {
+	rows [][]driver.Value
+}
+
+func (r *fakeCacheRows) Columns() []string {
+	return []string{"ip", "score", "country_code", "usage_type", "isp", "total_reports", "num_distinct_users", "last_reported_at", "fetched_at"}
+}
+
+func (r *fakeCacheRows) Close() error { return nil }
+
+func (r *fakeCacheRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// newCachingChecker returns a checker querying the API at baseURL, whose
+// cache holds a report of 192.0.2.1 fetched at fetchedAt unless it's zero.
+func newCachingChecker(t *testing.T, baseURL string, maxAge time.Duration, fetchedAt time.Time) (*abuseipdbChecker, *fakeCache) {
+	cache := &fakeCache{rows: map[string][]driver.Value{}}
+	fakeCaches.Store(t.Name(), cache)
+	db, err := sql.Open("abuseipdb-cache", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if !fetchedAt.IsZero() {
+		cache.rows["192.0.2.1"] = []driver.Value{"192.0.2.1", int64(10), "LT", "Data Center", "Example", int64(3), int64(2), nil, fetchedAt}
+	}
+	return &abuseipdbChecker{
+		l:       logger.NewLogger("test"),
+		DB:      db,
+		client:  &http.Client{Timeout: time.Second},
+		baseURL: baseURL,
+		key:     "secret",
+		maxAge:  maxAge,
+		pending: map[string]struct{}{},
+	}, cache
+}
+
+func TestAbuseIPDBChecker_Check(t *testing.T) {
+	var calls int32
+	var fail int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		assert.Equal(t, "/check", r.URL.Path)
+		if atomic.LoadInt32(&fail) == 1 {
+			w.WriteHeader(500)
+			return
+		}
+		w.Write([]byte(`{"data":{"ipAddress":"` + r.URL.Query().Get("ipAddress") + `","abuseConfidenceScore":95,"usageType":"Data Center"}}`)) // nolint
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		maxAge    time.Duration
+		fetchedAt time.Time
+		fail      bool
+		source    string
+		score     int
+		err       error
+		calls     int32
+	}{
+		{name: "fresh", maxAge: time.Hour, fetchedAt: time.Now().Add(-time.Minute), source: "cache", score: 10},
+		{name: "kept forever", fetchedAt: time.Now().Add(-365 * 24 * time.Hour), source: "cache", score: 10},
+		{name: "not cached", maxAge: time.Hour, source: "api", score: 95, calls: 1},
+		{name: "older than max age", maxAge: time.Hour, fetchedAt: time.Now().Add(-2 * time.Hour), source: "api", score: 95, calls: 1},
+		{name: "stale when the API fails", maxAge: time.Hour, fetchedAt: time.Now().Add(-2 * time.Hour), fail: true, source: "stale", score: 10, calls: 1},
+		{name: "refresh", ctx: WithRefresh(context.Background()), maxAge: time.Hour, fetchedAt: time.Now(), source: "api", score: 95, calls: 1},
+		{name: "refresh when the API fails", ctx: WithRefresh(context.Background()), maxAge: time.Hour, fetchedAt: time.Now(), fail: true, calls: 1},
+		{name: "cached only", ctx: WithCachedOnly(context.Background()), maxAge: time.Hour, fetchedAt: time.Now().Add(-2 * time.Hour), source: "stale", score: 10},
+		{name: "cached only without cache", ctx: WithCachedOnly(context.Background()), maxAge: time.Hour, err: ErrNotCached},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			atomic.StoreInt32(&calls, 0)
+			atomic.StoreInt32(&fail, 0)
+			if tt.fail {
+				atomic.StoreInt32(&fail, 1)
+			}
+			ctx := tt.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			c, cache := newCachingChecker(t, server.URL, tt.maxAge, tt.fetchedAt)
+
+			result, err := c.Check(ctx, "192.0.2.1")
+			assert.Equal(t, tt.calls, atomic.LoadInt32(&calls))
+			switch {
+			case tt.err != nil:
+				assert.Equal(t, tt.err, err)
+			case tt.source == "":
+				assert.Error(t, err)
+			case assert.NoError(t, err):
+				assert.Equal(t, tt.source, result.Source)
+				assert.Equal(t, tt.score, result.Score)
+			}
+			if tt.source == "api" {
+				assert.Equal(t, int64(95), cache.rows["192.0.2.1"][1])
+				assert.Equal(t, 1, cache.history)
+			}
+		})
+	}
+}
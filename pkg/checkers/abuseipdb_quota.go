@@ -0,0 +1,215 @@
+package checkers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// abuseipdbQuota tracks the daily check allowance AbuseIPDB reports in the
+// X-RateLimit-* headers of every response.
+type abuseipdbQuota struct {
+	mu    sync.RWMutex
+	quota *Quota
+}
+
+func (q *abuseipdbQuota) get() *Quota {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.quota == nil {
+		return nil
+	}
+	quota := *q.quota
+	return &quota
+}
+
+func (q *abuseipdbQuota) set(quota *Quota) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.quota = quota
+}
+
+// allows reports whether a query may be sent, keeping reserve queries back
+// for requests that can't wait.
+func (q *abuseipdbQuota) allows(now time.Time, reserve int) bool {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.quota == nil || q.quota.ResetAt == nil || !now.Before(*q.quota.ResetAt) {
+		return true
+	}
+	return q.quota.Remaining > reserve
+}
+
+// resetAt returns when the quota resets, or now when that's unknown.
+func (q *abuseipdbQuota) resetAt(now time.Time) time.Time {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.quota == nil || q.quota.ResetAt == nil {
+		return now
+	}
+	return *q.quota.ResetAt
+}
+
+// parseQuota reads the rate limit headers of an AbuseIPDB response. It
+// returns nil when the response doesn't carry them.
+func parseQuota(resp *http.Response, now time.Time) *Quota {
+	limit, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Limit"))
+	if err != nil {
+		limit = 0
+	}
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		if resp.StatusCode != http.StatusTooManyRequests {
+			return nil
+		}
+		remaining = 0
+	}
+	quota := &Quota{
+		Limit:     limit,
+		Remaining: remaining,
+		UpdatedAt: now,
+	}
+	if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		resetAt := time.Unix(reset, 0)
+		quota.ResetAt = &resetAt
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		quota.Remaining = 0
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			resetAt := now.Add(time.Duration(seconds) * time.Second)
+			quota.ResetAt = &resetAt
+		}
+	}
+	return quota
+}
+
+func (c *abuseipdbChecker) Quota() *Quota {
+	return c.quota.get()
+}
+
+func (c *abuseipdbChecker) updateQuota(ctx context.Context, quota *Quota) {
+	if quota == nil {
+		return
+	}
+	c.quota.set(quota)
+	if err := c.SaveQuota(ctx, quota); err != nil {
+		c.l.Error(
+			"Failed to execute SaveQuota",
+			zap.String("checker", "AbuseIPDB"),
+			zap.Error(err),
+		)
+	}
+}
+
+// enqueue defers a low priority refresh of ip until the quota resets.
+// Queued refreshes only live in memory: they are lost when the server stops
+// or the checker is closed, and run again by the next refresh of the
+// address.
+func (c *abuseipdbChecker) enqueue(ip string) {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+	if c.closed {
+		return
+	}
+	c.pending[ip] = struct{}{}
+	if c.drainTimer != nil {
+		return
+	}
+	delay := time.Until(c.quota.resetAt(time.Now()))
+	if delay < time.Minute {
+		delay = time.Minute
+	}
+	c.l.Info(
+		"Queued refreshes until AbuseIPDB quota resets",
+		zap.String("checker", "AbuseIPDB"),
+		zap.Duration("delay", delay),
+	)
+	c.drainTimer = time.AfterFunc(delay, c.drain)
+}
+
+// drain runs queued refreshes for as long as the quota allows them and
+// queues the remainder again.
+func (c *abuseipdbChecker) drain() {
+	c.pendingMu.Lock()
+	pending := c.pending
+	c.pending = map[string]struct{}{}
+	c.drainTimer = nil
+	c.pendingMu.Unlock()
+
+	ctx := context.Background()
+	for ip := range pending {
+		if !c.quota.allows(time.Now(), c.reserve) {
+			c.enqueue(ip)
+			continue
+		}
+		if err := c.Refresh(ctx, ip); err != nil {
+			c.l.Error(
+				"Failed to execute queued Refresh",
+				zap.String("checker", "AbuseIPDB"),
+				zap.String("ip", ip),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+// Close drops the queued refreshes and stops waiting for the quota to
+// reset, once the checker is replaced on reload.
+func (c *abuseipdbChecker) Close() error {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+	c.closed = true
+	if c.drainTimer != nil {
+		c.drainTimer.Stop()
+		c.drainTimer = nil
+	}
+	c.pending = map[string]struct{}{}
+	return nil
+}
+
+func (c *abuseipdbChecker) SaveQuota(ctx context.Context, quota *Quota) error {
+	q := `
+		REPLACE INTO abuseipdb_quota(
+			endpoint,
+			quota_limit,
+			remaining,
+			reset_at,
+			updated_at
+		) VALUES (?, ?, ?, ?, ?)
+	`
+	if _, err := c.DB.ExecContext(ctx, q, "check",
+		quota.Limit, quota.Remaining, quota.ResetAt, quota.UpdatedAt); err != nil {
+		return errors.Wrap(err, "Failed to execute ExecContext")
+	}
+	return nil
+}
+
+func (c *abuseipdbChecker) GetQuota(ctx context.Context) (*Quota, error) {
+	var quota Quota
+	q := `
+		SELECT
+			quota_limit,
+			remaining,
+			reset_at,
+			updated_at
+		FROM
+			abuseipdb_quota
+		WHERE
+			endpoint = ?
+	`
+	err := c.DB.QueryRowContext(ctx, q, "check").Scan(
+		&quota.Limit, &quota.Remaining, &quota.ResetAt, &quota.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, errors.Wrap(err, "Failed to execute QueryRowContext")
+	}
+	return &quota, nil
+}
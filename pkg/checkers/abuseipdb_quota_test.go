@@ -0,0 +1,65 @@
+package checkers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hostinger/hbl/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseQuota(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+
+	resp := &http.Response{StatusCode: 200, Header: http.Header{}}
+	assert.Nil(t, parseQuota(resp, now))
+
+	resp.Header.Set("X-RateLimit-Limit", "1000")
+	resp.Header.Set("X-RateLimit-Remaining", "42")
+	resp.Header.Set("X-RateLimit-Reset", "1600003600")
+	quota := parseQuota(resp, now)
+	assert.Equal(t, 1000, quota.Limit)
+	assert.Equal(t, 42, quota.Remaining)
+	assert.Equal(t, now.Add(time.Hour), *quota.ResetAt)
+	assert.False(t, quota.Exhausted(now))
+
+	resp = &http.Response{StatusCode: 429, Header: http.Header{}}
+	resp.Header.Set("Retry-After", "120")
+	quota = parseQuota(resp, now)
+	assert.Equal(t, 0, quota.Remaining)
+	assert.Equal(t, now.Add(2*time.Minute), *quota.ResetAt)
+	assert.True(t, quota.Exhausted(now))
+	assert.False(t, quota.Exhausted(now.Add(3*time.Minute)))
+}
+
+func TestAbuseIPDBQuota_Allows(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	resetAt := now.Add(time.Hour)
+
+	var q abuseipdbQuota
+	assert.True(t, q.allows(now, 10))
+
+	q.set(&Quota{Limit: 1000, Remaining: 10, ResetAt: &resetAt})
+	assert.True(t, q.allows(now, 0))
+	assert.False(t, q.allows(now, 10))
+	assert.True(t, q.allows(resetAt, 10))
+}
+
+func TestAbuseIPDBChecker_Close(t *testing.T) {
+	resetAt := time.Now().Add(time.Hour)
+	c := &abuseipdbChecker{l: logger.NewLogger("test"), pending: map[string]struct{}{}}
+	c.quota.set(&Quota{Limit: 1000, Remaining: 0, ResetAt: &resetAt})
+
+	c.enqueue("192.0.2.1")
+	assert.NotNil(t, c.drainTimer)
+	assert.Len(t, c.pending, 1)
+
+	assert.NoError(t, c.Close())
+	assert.Nil(t, c.drainTimer)
+	assert.Empty(t, c.pending)
+
+	c.enqueue("192.0.2.2")
+	assert.Nil(t, c.drainTimer)
+	assert.Empty(t, c.pending)
+}
@@ -0,0 +1,256 @@
+package checkers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+// abuseipdbReportWindow is how long AbuseIPDB refuses further reports of an
+// address from the same account.
+const abuseipdbReportWindow = 15 * time.Minute
+
+// abuseipdbCategories maps block categories to AbuseIPDB category ids, see
+// https://www.abuseipdb.com/categories.
+var abuseipdbCategories = map[string][]int{
+	"fraud":          {3},
+	"ddos":           {4},
+	"ftp":            {5, 18},
+	"phishing":       {7},
+	"open-proxy":     {9},
+	"web-spam":       {10},
+	"spam":           {11},
+	"email-spam":     {11},
+	"vpn":            {13},
+	"port-scan":      {14},
+	"hacking":        {15},
+	"sql-injection":  {16},
+	"spoofing":       {17},
+	"brute-force":    {18},
+	"bad-bot":        {19},
+	"exploited-host": {20},
+	"web-attack":     {21},
+	"ssh":            {18, 22},
+	"iot":            {23},
+}
+
+type AbuseIPDBReportConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	// Sources lists the block sources trusted enough to be reported. Blocks
+	// from any other source are never submitted.
+	Sources []string `mapstructure:"sources"`
+
+	// Categories extends or overrides the built-in mapping of block
+	// categories to AbuseIPDB category ids.
+	Categories map[string][]int `mapstructure:"categories"`
+}
+
+func (c *AbuseIPDBReportConfig) Validate() error {
+	var err error
+	if c.Enabled && len(c.Sources) == 0 {
+		err = multierr.Append(err, errors.New("Field 'report.sources' must not be empty when 'report.enabled' is set"))
+	}
+	for category, ids := range c.Categories {
+		for _, id := range ids {
+			if id < 1 || id > 23 {
+				err = multierr.Append(err, errors.Errorf("Field 'report.categories.%s' must only contain ids between 1 and 23", category))
+				break
+			}
+		}
+	}
+	return err
+}
+
+type abuseipdbReporter struct {
+	enabled    bool
+	sources    map[string]bool
+	categories map[string][]int
+	reported   map[string]time.Time
+}
+
+func newAbuseIPDBReporter(cfg *AbuseIPDBReportConfig) abuseipdbReporter {
+	r := abuseipdbReporter{
+		enabled:    cfg.Enabled,
+		sources:    map[string]bool{},
+		categories: map[string][]int{},
+		reported:   map[string]time.Time{},
+	}
+	for _, source := range cfg.Sources {
+		r.sources[strings.ToLower(source)] = true
+	}
+	for category, ids := range abuseipdbCategories {
+		r.categories[category] = ids
+	}
+	for category, ids := range cfg.Categories {
+		r.categories[strings.ToLower(category)] = ids
+	}
+	return r
+}
+
+// categoryIDs returns the sorted AbuseIPDB ids the given categories map to.
+func (r *abuseipdbReporter) categoryIDs(categories []string) []int {
+	seen := map[int]bool{}
+	var ids []int
+	for _, category := range categories {
+		for _, id := range r.categories[strings.ToLower(category)] {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// Report submits a blocked address to AbuseIPDB when reporting is enabled
+// and its source opted in. Addresses reported within the last 15 minutes
+// are skipped, as AbuseIPDB would reject them. The address is reserved
+// before it is submitted, so concurrent blocks report it once, and released
+// when submitting fails. Reports are only deduplicated within this process:
+// AbuseIPDB rejects those submitted by other servers with a 429.
+func (c *abuseipdbChecker) Report(ctx context.Context, report *Report) (*ReportResult, error) {
+	if !c.reporter.enabled || !c.reporter.sources[strings.ToLower(report.Source)] {
+		return nil, nil
+	}
+	ids := c.reporter.categoryIDs(report.Categories)
+	if len(ids) == 0 {
+		return c.reportResult(ReportSkipped, "No category maps to an AbuseIPDB category"), nil
+	}
+	if !c.reserveReport(report.IP, time.Now()) {
+		return c.reportResult(ReportSkipped, "Already reported within the last 15 minutes"), nil
+	}
+
+	score, err := c.CallReport(ctx, report.IP, ids, report.Comment)
+	if err != nil {
+		c.releaseReport(report.IP)
+		return nil, err
+	}
+	return c.reportResult(ReportSubmitted, fmt.Sprintf("Abuse confidence score is %d", score)), nil
+}
+
+// reserveReport records ip as reported at now, unless it was reported
+// within the report window, and forgets the reports older than it.
+func (c *abuseipdbChecker) reserveReport(ip string, now time.Time) bool {
+	c.reportedMu.Lock()
+	defer c.reportedMu.Unlock()
+	for reported, at := range c.reporter.reported {
+		if now.Sub(at) >= abuseipdbReportWindow {
+			delete(c.reporter.reported, reported)
+		}
+	}
+	if _, ok := c.reporter.reported[ip]; ok {
+		return false
+	}
+	c.reporter.reported[ip] = now
+	return true
+}
+
+// releaseReport forgets the reservation of ip after it failed to be
+// reported.
+func (c *abuseipdbChecker) releaseReport(ip string) {
+	c.reportedMu.Lock()
+	defer c.reportedMu.Unlock()
+	delete(c.reporter.reported, ip)
+}
+
+func (c *abuseipdbChecker) reportResult(status, message string) *ReportResult {
+	return &ReportResult{
+		Reporter: c.Name(),
+		Status:   status,
+		Message:  message,
+		At:       time.Now(),
+	}
+}
+
+// CallReport submits ip to the AbuseIPDB report API and returns the abuse
+// confidence score AbuseIPDB assigns it afterwards.
+func (c *abuseipdbChecker) CallReport(ctx context.Context, ip string, categories []int, comment string) (int, error) {
+	type Result struct {
+		Data struct {
+			IPAddress            string `json:"ipAddress"`
+			AbuseConfidenceScore int    `json:"abuseConfidenceScore"`
+		} `json:"data"`
+	}
+	ids := make([]string, 0, len(categories))
+	for _, id := range categories {
+		ids = append(ids, strconv.Itoa(id))
+	}
+	if len(comment) > 1024 {
+		comment = comment[:1024]
+	}
+	form := url.Values{}
+	form.Set("ip", ip)
+	form.Set("categories", strings.Join(ids, ","))
+	form.Set("comment", comment)
+
+	uri := fmt.Sprintf("%s/report", c.baseURL)
+	req, err := http.NewRequestWithContext(ctx, "POST", uri, strings.NewReader(form.Encode()))
+	if err != nil {
+		c.l.Error(
+			"Failed to create new request object",
+			zap.String("checker", "AbuseIPDB"),
+			zap.Error(err),
+		)
+		return 0, errors.Wrap(err, "Failed creating new request object")
+	}
+	req.Header.Set("Key", c.key)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		c.l.Error(
+			"Failed to execute request",
+			zap.String("checker", "AbuseIPDB"),
+			zap.Error(err),
+		)
+		return 0, errors.Wrap(err, "Failed executing request")
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		c.l.Error(
+			"Failed to read response body",
+			zap.String("checker", "AbuseIPDB"),
+			zap.Error(err),
+		)
+		return 0, errors.Wrap(err, "Failed to read response body")
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return 0, errors.Wrap(ErrQuotaExhausted, string(body))
+	}
+	if resp.StatusCode != http.StatusOK {
+		c.l.Error(
+			"Uknown response from AbuseIPDB API",
+			zap.String("checker", "AbuseIPDB"),
+			zap.String("error", string(body)),
+		)
+		return 0, errors.Errorf("Unknown response from API: %s", string(body))
+	}
+
+	var result Result
+	if err := json.Unmarshal(body, &result); err != nil {
+		c.l.Error(
+			"Failed to unmarshal JSON",
+			zap.String("checker", "AbuseIPDB"),
+			zap.Error(err),
+		)
+		return 0, err
+	}
+	return result.Data.AbuseConfidenceScore, nil
+}
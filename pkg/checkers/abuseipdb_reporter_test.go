@@ -0,0 +1,113 @@
+package checkers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hostinger/hbl/pkg/logger"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func newReportingChecker(baseURL string, cfg *AbuseIPDBReportConfig) *abuseipdbChecker {
+	return &abuseipdbChecker{
+		l:        logger.NewLogger("test"),
+		client:   &http.Client{Timeout: time.Second},
+		baseURL:  baseURL,
+		key:      "secret",
+		reporter: newAbuseIPDBReporter(cfg),
+	}
+}
+
+func TestAbuseIPDBReporter_categoryIDs(t *testing.T) {
+	r := newAbuseIPDBReporter(&AbuseIPDBReportConfig{Categories: map[string][]int{"Scanner": {14}, "ssh": {22}}})
+	assert.Equal(t, []int{18, 22}, r.categoryIDs([]string{"SSH", "brute-force"}))
+	assert.Equal(t, []int{14}, r.categoryIDs([]string{"scanner"}))
+	assert.Nil(t, r.categoryIDs([]string{"unknown"}))
+}
+
+func TestAbuseIPDBChecker_Report(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		assert.Equal(t, "/report", r.URL.Path)
+		assert.Equal(t, "secret", r.Header.Get("Key"))
+		if r.FormValue("ip") == "192.0.2.9" {
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"errors":[{"detail":"Daily rate limit of 1000 requests exceeded"}]}`)) // nolint
+			return
+		}
+		assert.Equal(t, "18,22", r.FormValue("categories"))
+		assert.Equal(t, "Brute force", r.FormValue("comment"))
+		w.Write([]byte(`{"data":{"ipAddress":"` + r.FormValue("ip") + `","abuseConfidenceScore":87}}`)) // nolint
+	}))
+	defer server.Close()
+
+	c := newReportingChecker(server.URL, &AbuseIPDBReportConfig{Enabled: true, Sources: []string{"Fail2ban"}})
+	ctx := context.Background()
+	report := &Report{IP: "192.0.2.1", Source: "fail2ban", Comment: "Brute force", Categories: []string{"ssh"}}
+
+	result, err := c.Report(ctx, &Report{IP: "192.0.2.1", Source: "manual", Categories: []string{"ssh"}})
+	assert.NoError(t, err)
+	assert.Nil(t, result)
+
+	result, err = c.Report(ctx, &Report{IP: "192.0.2.1", Source: "fail2ban", Categories: []string{"unknown"}})
+	if assert.NoError(t, err) {
+		assert.Equal(t, ReportSkipped, result.Status)
+	}
+	assert.Equal(t, int32(0), atomic.LoadInt32(&calls))
+
+	result, err = c.Report(ctx, report)
+	if assert.NoError(t, err) {
+		assert.Equal(t, ReportSubmitted, result.Status)
+		assert.Equal(t, "Abuse confidence score is 87", result.Message)
+	}
+	result, err = c.Report(ctx, report)
+	if assert.NoError(t, err) {
+		assert.Equal(t, ReportSkipped, result.Status)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// Once the window has passed, the address is reported again.
+	c.reporter.reported["192.0.2.1"] = time.Now().Add(-abuseipdbReportWindow)
+	result, err = c.Report(ctx, report)
+	if assert.NoError(t, err) {
+		assert.Equal(t, ReportSubmitted, result.Status)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	// A rejected report doesn't hold the address back.
+	rejected := &Report{IP: "192.0.2.9", Source: "fail2ban", Categories: []string{"ssh"}}
+	_, err = c.Report(ctx, rejected)
+	assert.Equal(t, ErrQuotaExhausted, errors.Cause(err))
+	_, err = c.Report(ctx, rejected)
+	assert.Equal(t, ErrQuotaExhausted, errors.Cause(err))
+	assert.Equal(t, int32(4), atomic.LoadInt32(&calls))
+}
+
+func TestAbuseIPDBChecker_Report_concurrent(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(10 * time.Millisecond)
+		w.Write([]byte(`{"data":{"abuseConfidenceScore":87}}`)) // nolint
+	}))
+	defer server.Close()
+
+	c := newReportingChecker(server.URL, &AbuseIPDBReportConfig{Enabled: true, Sources: []string{"fail2ban"}})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Report(context.Background(), &Report{IP: "192.0.2.1", Source: "fail2ban", Categories: []string{"ssh"}}) // nolint
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
@@ -2,34 +2,571 @@ package checkers
 
 import (
 	"context"
+	"io"
+	"math"
+	"sort"
 	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+)
+
+var (
+	ErrNotFound  = errors.New("Checker doesn't exist")
+	ErrNoHistory = errors.New("Checker doesn't keep history")
+
+	// ErrQuotaExhausted is returned by checkers whose source refuses further
+	// queries until their quota resets.
+	ErrQuotaExhausted = errors.New("Checker quota exhausted")
+
+	// ErrNotCached is returned by checkers asked for cached results only
+	// which hold none for the address.
+	ErrNotCached = errors.New("Checker holds no cached result")
+)
+
+const (
+	VerdictClean      = "clean"
+	VerdictSuspicious = "suspicious"
+	VerdictMalicious  = "malicious"
+	VerdictUnknown    = "unknown"
 )
 
+// CheckResult is what a checker knows about an address. Score goes from 0
+// (clean) to 100 (certainly malicious); Raw holds the checker specific data
+// the result was derived from.
+type CheckResult struct {
+	Checker    string
+	Score      int
+	Verdict    string
+	Categories []string
+	Source     string
+	FetchedAt  time.Time
+	Raw        interface{}
+}
+
+// Fielder is implemented by Raw values of a CheckResult which expose
+// checker specific fields, keyed in snake case, to policy rules.
+type Fielder interface {
+	Fields() map[string]interface{}
+}
+
+// Aggregate combines the results of all checkers into a single verdict,
+// weighting each score by the weight of its checker.
+type Aggregate struct {
+	IP      string
+	Score   int
+	Verdict string
+	Results []*CheckResult
+	Errors  map[string]string
+}
+
 type Checker interface {
 	Name() string
-	Check(ctx context.Context, ip string) (interface{}, error)
+	Check(ctx context.Context, ip string) (*CheckResult, error)
 }
 
-var (
-	checkersMu = new(sync.Mutex)
-	checkers   = map[string]Checker{}
+// Refreshable is implemented by checkers which cache results. Refresh
+// queries the source again when the cached result for ip is stale.
+type Refreshable interface {
+	Refresh(ctx context.Context, ip string) error
+}
+
+// Historian is implemented by checkers which keep past results. History
+// returns the most recent ones first.
+type Historian interface {
+	History(ctx context.Context, ip string, limit int) ([]*CheckResult, error)
+}
+
+// Scorer is implemented by checkers which cache results. Scores returns
+// the cached score of every address they know without querying their
+// source.
+type Scorer interface {
+	Scores(ctx context.Context) (map[string]int, error)
+}
+
+type refreshKey struct{}
+
+// WithRefresh returns a context which asks checkers to bypass their caches.
+func WithRefresh(ctx context.Context) context.Context {
+	return context.WithValue(ctx, refreshKey{}, true)
+}
+
+// RefreshRequested reports whether ctx asks checkers to bypass their caches.
+func RefreshRequested(ctx context.Context) bool {
+	refresh, _ := ctx.Value(refreshKey{}).(bool)
+	return refresh
+}
+
+type cachedOnlyKey struct{}
+
+// WithCachedOnly returns a context which asks checkers with a quota to serve
+// cached results only, stale ones included, and never query their source.
+func WithCachedOnly(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cachedOnlyKey{}, true)
+}
+
+// CachedOnlyRequested reports whether ctx asks checkers to serve cached
+// results only.
+func CachedOnlyRequested(ctx context.Context) bool {
+	cached, _ := ctx.Value(cachedOnlyKey{}).(bool)
+	return cached
+}
+
+// Weighted is implemented by checkers whose results should count more or
+// less than others in an Aggregate. Checkers without it weigh 1.
+type Weighted interface {
+	Weight() float64
+}
+
+// HealthChecker is implemented by checkers which are able to report whether
+// their backend is usable.
+type HealthChecker interface {
+	HealthCheck(ctx context.Context) error
+}
+
+const (
+	ReportSubmitted = "submitted"
+	ReportSkipped   = "skipped"
+	ReportFailed    = "failed"
 )
 
-func CheckOnOne(ctx context.Context, ip, name string) (interface{}, error) {
-	if checker, ok := checkers[name]; ok {
-		result, err := checker.Check(ctx, ip)
+// Report is a blocked address a checker may contribute back to its source.
+// Source names what produced the block, Categories why it was blocked.
+type Report struct {
+	IP         string
+	Source     string
+	Comment    string
+	Categories []string
+}
+
+// ReportResult is the outcome of submitting a Report to one checker.
+type ReportResult struct {
+	Reporter string
+	Status   string
+	Message  string `json:",omitempty"`
+	At       time.Time
+}
+
+// Reporter is implemented by checkers which can contribute blocked
+// addresses back to their source. A nil result means the checker doesn't
+// take part, e.g. because the source didn't opt in; reports it declines for
+// other reasons return a ReportSkipped result.
+type Reporter interface {
+	Report(ctx context.Context, report *Report) (*ReportResult, error)
+}
+
+// Enrichment is descriptive data about an address which, unlike a
+// CheckResult, doesn't judge it.
+type Enrichment struct {
+	Country      string `json:",omitempty"`
+	ASN          uint   `json:",omitempty"`
+	Organization string `json:",omitempty"`
+}
+
+func (e *Enrichment) Fields() map[string]interface{} {
+	return map[string]interface{}{
+		"country":      e.Country,
+		"asn":          int(e.ASN),
+		"organization": e.Organization,
+	}
+}
+
+// Enricher is implemented by checkers which can describe where an address
+// comes from, e.g. from local GeoIP databases.
+type Enricher interface {
+	Enrich(ctx context.Context, ip string) (*Enrichment, error)
+}
+
+// Quota is the query allowance a checker has left at its source.
+type Quota struct {
+	Limit     int
+	Remaining int
+	ResetAt   *time.Time `json:",omitempty"`
+	UpdatedAt time.Time
+}
+
+// Exhausted reports whether no queries are left before the quota resets.
+func (q *Quota) Exhausted(now time.Time) bool {
+	return q.Remaining <= 0 && q.ResetAt != nil && now.Before(*q.ResetAt)
+}
+
+// QuotaReporter is implemented by checkers whose source limits how often it
+// can be queried. Quota returns nil while the quota is still unknown.
+type QuotaReporter interface {
+	Quota() *Quota
+}
+
+// Describer is implemented by checkers which can summarize their
+// configuration. Secrets must be redacted.
+type Describer interface {
+	Describe() map[string]string
+}
+
+// Result is the outcome of the last operation run on a checker.
+type Result struct {
+	Operation string
+	IP        string `json:",omitempty"`
+	Error     string `json:",omitempty"`
+	At        time.Time
+}
+
+// Info describes a registered checker and its runtime state.
+type Info struct {
+	Name          string
+	Enabled       bool
+	Config        map[string]string
+	Quota         *Quota `json:",omitempty"`
+	LastOperation *Result
+	LastHealth    *Result
+}
+
+// Registry holds a set of checkers keyed by name. It is safe for concurrent
+// use; checks run against the checkers registered when they started, so
+// Replace never interrupts work already in flight.
+type Registry struct {
+	mu       sync.RWMutex
+	checkers map[string]Checker
+	last     map[string]*Result
+	health   map[string]*Result
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		checkers: map[string]Checker{},
+		last:     map[string]*Result{},
+		health:   map[string]*Result{},
+	}
+}
+
+func (r *Registry) snapshot() map[string]Checker {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.checkers
+}
+
+func (r *Registry) Register(checker Checker) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.checkers[checker.Name()]; !ok {
+		registered := make(map[string]Checker, len(r.checkers)+1)
+		for name, c := range r.checkers {
+			registered[name] = c
+		}
+		registered[checker.Name()] = checker
+		r.checkers = registered
+	}
+}
+
+// Replace atomically swaps all registered checkers for the given ones.
+// Checkers dropped by the swap are closed when they implement io.Closer, so
+// Close must wait for calls already in flight.
+func (r *Registry) Replace(list ...Checker) {
+	registered := make(map[string]Checker, len(list))
+	for _, checker := range list {
+		if _, ok := registered[checker.Name()]; !ok {
+			registered[checker.Name()] = checker
+		}
+	}
+	r.mu.Lock()
+	previous := r.checkers
+	r.checkers = registered
+	r.mu.Unlock()
+
+	for name, checker := range previous {
+		if registered[name] == checker {
+			continue
+		}
+		if closer, ok := checker.(io.Closer); ok {
+			closer.Close() // nolint
+		}
+	}
+}
+
+// Close closes the registered checkers which implement io.Closer.
+func (r *Registry) Close() error {
+	var err error
+	for _, checker := range r.List() {
+		if closer, ok := checker.(io.Closer); ok {
+			err = multierr.Append(err, errors.Wrapf(closer.Close(), "Failed to close checker '%s'", checker.Name()))
+		}
+	}
+	return err
+}
+
+func (r *Registry) Get(name string) (Checker, bool) {
+	checker, ok := r.snapshot()[name]
+	return checker, ok
+}
+
+// List returns the registered checkers ordered by name.
+func (r *Registry) List() []Checker {
+	registered := r.snapshot()
+	list := make([]Checker, 0, len(registered))
+	for _, checker := range registered {
+		list = append(list, checker)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name() < list[j].Name()
+	})
+	return list
+}
+
+func (r *Registry) CheckOnOne(ctx context.Context, ip, name string) (*CheckResult, error) {
+	checker, ok := r.Get(name)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	result, err := checker.Check(ctx, ip)
+	if err != ErrNotCached {
+		r.record(name, ip, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// CheckOnAll runs every registered checker concurrently and combines their
+// results. Failed checkers are reported in Errors and left out of the score.
+func (r *Registry) CheckOnAll(ctx context.Context, ip string) *Aggregate {
+	list := r.List()
+	results := make([]*CheckResult, len(list))
+	errs := make([]error, len(list))
+
+	var wg sync.WaitGroup
+	for i, checker := range list {
+		wg.Add(1)
+		go func(i int, checker Checker) {
+			defer wg.Done()
+			results[i], errs[i] = r.CheckOnOne(ctx, ip, checker.Name())
+		}(i, checker)
+	}
+	wg.Wait()
+
+	aggregate := &Aggregate{
+		IP:      ip,
+		Verdict: VerdictUnknown,
+		Results: []*CheckResult{},
+		Errors:  map[string]string{},
+	}
+	var total, weights float64
+	for i, checker := range list {
+		if errs[i] != nil {
+			aggregate.Errors[checker.Name()] = errs[i].Error()
+			continue
+		}
+		weight := 1.0
+		if w, ok := checker.(Weighted); ok {
+			weight = w.Weight()
+		}
+		total += weight * float64(results[i].Score)
+		weights += weight
+		aggregate.Results = append(aggregate.Results, results[i])
+	}
+	if weights > 0 {
+		aggregate.Score = int(math.Round(total / weights))
+		aggregate.Verdict = VerdictFromScore(aggregate.Score)
+	}
+	return aggregate
+}
+
+// Enrich combines the enrichments of every checker which supports it. The
+// first checker, by name, to know a field wins. Failures are returned
+// together with whatever could still be found.
+func (r *Registry) Enrich(ctx context.Context, ip string) (*Enrichment, error) {
+	enrichment := &Enrichment{}
+	var errs error
+	for _, checker := range r.List() {
+		enricher, ok := checker.(Enricher)
+		if !ok {
+			continue
+		}
+		e, err := enricher.Enrich(ctx, ip)
 		if err != nil {
-			return nil, err
+			errs = multierr.Append(errs, errors.Wrap(err, checker.Name()))
+			continue
+		}
+		if enrichment.Country == "" {
+			enrichment.Country = e.Country
+		}
+		if enrichment.ASN == 0 {
+			enrichment.ASN = e.ASN
+			enrichment.Organization = e.Organization
 		}
-		return result, nil
 	}
-	return nil, nil
+	return enrichment, errs
 }
 
-func Register(checker Checker) {
-	checkersMu.Lock()
-	defer checkersMu.Unlock()
-	if _, ok := checkers[checker.Name()]; !ok {
-		checkers[checker.Name()] = checker
+// ReportOnAll submits report to every checker which supports it. Failures
+// are returned as ReportFailed results rather than errors, so one reporter
+// can't prevent the others from running.
+func (r *Registry) ReportOnAll(ctx context.Context, report *Report) []*ReportResult {
+	var results []*ReportResult
+	for _, checker := range r.List() {
+		reporter, ok := checker.(Reporter)
+		if !ok {
+			continue
+		}
+		result, err := reporter.Report(ctx, report)
+		if err == nil && result == nil {
+			continue
+		}
+		if err != nil {
+			result = &ReportResult{
+				Reporter: checker.Name(),
+				Status:   ReportFailed,
+				Message:  err.Error(),
+				At:       time.Now(),
+			}
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// RefreshOnAll refreshes stale cached results for ip on every checker which
+// supports it.
+func (r *Registry) RefreshOnAll(ctx context.Context, ip string) error {
+	for _, checker := range r.List() {
+		if refreshable, ok := checker.(Refreshable); ok {
+			if err := refreshable.Refresh(ctx, ip); err != nil {
+				return errors.Wrapf(err, "Refresh failed on Checker '%s'", checker.Name())
+			}
+		}
+	}
+	return nil
+}
+
+// Scores returns the highest cached score of every address known to the
+// checkers which support it.
+func (r *Registry) Scores(ctx context.Context) (map[string]int, error) {
+	scores := map[string]int{}
+	for _, checker := range r.List() {
+		scorer, ok := checker.(Scorer)
+		if !ok {
+			continue
+		}
+		s, err := scorer.Scores(ctx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Scores failed on Checker '%s'", checker.Name())
+		}
+		for ip, score := range s {
+			if score > scores[ip] {
+				scores[ip] = score
+			}
+		}
+	}
+	return scores, nil
+}
+
+func (r *Registry) History(ctx context.Context, ip, name string, limit int) ([]*CheckResult, error) {
+	checker, ok := r.Get(name)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	historian, ok := checker.(Historian)
+	if !ok {
+		return nil, ErrNoHistory
+	}
+	return historian.History(ctx, ip, limit)
+}
+
+// VerdictFromScore maps a 0-100 score onto a verdict.
+func VerdictFromScore(score int) string {
+	switch {
+	case score >= 75:
+		return VerdictMalicious
+	case score >= 25:
+		return VerdictSuspicious
+	default:
+		return VerdictClean
+	}
+}
+
+// Info returns the description and runtime state of every registered
+// checker, ordered by name.
+func (r *Registry) Info() []*Info {
+	list := r.List()
+	infos := make([]*Info, 0, len(list))
+	for _, checker := range list {
+		info := &Info{
+			Name:    checker.Name(),
+			Enabled: true,
+		}
+		if d, ok := checker.(Describer); ok {
+			info.Config = d.Describe()
+		}
+		if q, ok := checker.(QuotaReporter); ok {
+			info.Quota = q.Quota()
+		}
+		r.mu.RLock()
+		info.LastHealth = r.health[checker.Name()]
+		info.LastOperation = r.last[checker.Name()]
+		r.mu.RUnlock()
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// HealthCheck runs the health check of the named checker. It reports false
+// when the checker doesn't exist or doesn't support health checks.
+func (r *Registry) HealthCheck(ctx context.Context, name string) (bool, error) {
+	checker, ok := r.Get(name)
+	if !ok {
+		return false, nil
 	}
+	hc, ok := checker.(HealthChecker)
+	if !ok {
+		return false, nil
+	}
+	err := hc.HealthCheck(ctx)
+	result := newResult("HealthCheck", "", err)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.health[name] = result
+	return true, err
+}
+
+func (r *Registry) record(name, ip string, err error) {
+	result := newResult("Check", ip, err)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.last[name] = result
+}
+
+func newResult(operation, ip string, err error) *Result {
+	result := &Result{
+		Operation: operation,
+		IP:        ip,
+		At:        time.Now(),
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+var defaultRegistry = NewRegistry()
+
+// Default returns the process-wide registry used by the package functions.
+func Default() *Registry {
+	return defaultRegistry
+}
+
+func CheckOnOne(ctx context.Context, ip, name string) (*CheckResult, error) {
+	return defaultRegistry.CheckOnOne(ctx, ip, name)
+}
+
+func CheckOnAll(ctx context.Context, ip string) *Aggregate {
+	return defaultRegistry.CheckOnAll(ctx, ip)
+}
+
+func Register(checker Checker) {
+	defaultRegistry.Register(checker)
+}
+
+// Replace atomically swaps all checkers of the default registry.
+func Replace(list ...Checker) {
+	defaultRegistry.Replace(list...)
 }
@@ -0,0 +1,75 @@
+package checkers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeChecker struct {
+	name   string
+	score  int
+	weight float64
+	err    error
+}
+
+func (f *fakeChecker) Name() string { return f.name }
+
+func (f *fakeChecker) Weight() float64 { return f.weight }
+
+func (f *fakeChecker) Check(ctx context.Context, ip string) (*CheckResult, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &CheckResult{Checker: f.name, Score: f.score, Verdict: VerdictFromScore(f.score)}, nil
+}
+
+func TestRegistry_CheckOnAll(t *testing.T) {
+	r := NewRegistry()
+	r.Register(&fakeChecker{name: "A", score: 100, weight: 3})
+	r.Register(&fakeChecker{name: "B", score: 0, weight: 1})
+	r.Register(&fakeChecker{name: "C", err: errors.New("unavailable"), weight: 1})
+
+	aggregate := r.CheckOnAll(context.Background(), "127.0.0.1")
+	assert.Equal(t, 75, aggregate.Score)
+	assert.Equal(t, VerdictMalicious, aggregate.Verdict)
+	assert.Len(t, aggregate.Results, 2)
+	assert.Equal(t, "unavailable", aggregate.Errors["C"])
+
+	_, err := r.CheckOnOne(context.Background(), "127.0.0.1", "D")
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestRegistry_CheckOnAll_Empty(t *testing.T) {
+	aggregate := NewRegistry().CheckOnAll(context.Background(), "127.0.0.1")
+	assert.Equal(t, VerdictUnknown, aggregate.Verdict)
+	assert.Empty(t, aggregate.Results)
+}
+
+type closingChecker struct {
+	fakeChecker
+	closed int
+}
+
+func (c *closingChecker) Close() error {
+	c.closed++
+	return nil
+}
+
+func TestRegistry_Close(t *testing.T) {
+	r := NewRegistry()
+	kept, dropped := &closingChecker{fakeChecker: fakeChecker{name: "A"}}, &closingChecker{fakeChecker: fakeChecker{name: "B"}}
+	r.Register(kept)
+	r.Register(dropped)
+	r.Register(&fakeChecker{name: "C"})
+
+	r.Replace(kept, &fakeChecker{name: "C"})
+	assert.Equal(t, 0, kept.closed)
+	assert.Equal(t, 1, dropped.closed)
+
+	assert.NoError(t, r.Close())
+	assert.Equal(t, 1, kept.closed)
+	assert.Equal(t, 1, dropped.closed)
+}
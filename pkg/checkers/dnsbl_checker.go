@@ -0,0 +1,292 @@
+package checkers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hostinger/hbl/pkg/logger"
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+type DNSBLZone struct {
+	// Name is a human readable name of the list, e.g. 'Spamhaus ZEN'.
+	Name string `mapstructure:"name"`
+	Zone string `mapstructure:"zone"`
+
+	// IPv6 tells whether the zone lists IPv6 addresses. IPv6 addresses are
+	// never looked up in zones without it.
+	IPv6 bool `mapstructure:"ipv6"`
+
+	// Score is the score given to listed addresses. Zero means 100.
+	Score int `mapstructure:"score"`
+
+	// Codes maps return codes, e.g. '127.0.0.2', to categories. Unknown
+	// codes are reported as 'listed'.
+	Codes map[string]string `mapstructure:"codes"`
+}
+
+type DNSBLConfig struct {
+	Enabled bool    `mapstructure:"enabled"`
+	Weight  float64 `mapstructure:"weight"`
+
+	// Resolver is the 'host:port' of the DNS server to query. When empty the
+	// system resolver is used. Public resolvers are refused by most lists.
+	Resolver string        `mapstructure:"resolver"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+
+	Zones []DNSBLZone `mapstructure:"zones"`
+}
+
+func (c *DNSBLConfig) Validate() error {
+	var err error
+	if c.Weight < 0 {
+		err = multierr.Append(err, errors.New("Field 'weight' must not be negative"))
+	}
+	if c.Timeout <= 0 {
+		err = multierr.Append(err, errors.New("Field 'timeout' must be positive"))
+	}
+	if c.Resolver != "" {
+		if _, _, e := net.SplitHostPort(c.Resolver); e != nil {
+			err = multierr.Append(err, errors.New("Field 'resolver' must be in 'host:port' form"))
+		}
+	}
+	if len(c.Zones) == 0 {
+		err = multierr.Append(err, errors.New("Field 'zones' must not be empty"))
+	}
+	for i, zone := range c.Zones {
+		if strings.TrimSpace(zone.Zone) == "" {
+			err = multierr.Append(err, errors.Errorf("Field 'zones[%d].zone' must not be empty", i))
+		}
+		if zone.Score < 0 || zone.Score > 100 {
+			err = multierr.Append(err, errors.Errorf("Field 'zones[%d].score' must be between 0 and 100", i))
+		}
+		for code := range zone.Codes {
+			if net.ParseIP(code) == nil {
+				err = multierr.Append(err, errors.Errorf("Field 'zones[%d].codes' must be keyed by IP addresses", i))
+				break
+			}
+		}
+	}
+	return err
+}
+
+// DNSBLListing is the answer of one zone about an address.
+type DNSBLListing struct {
+	Name       string
+	Zone       string
+	Listed     bool
+	Codes      []string `json:",omitempty"`
+	Categories []string `json:",omitempty"`
+	Error      string   `json:",omitempty"`
+}
+
+type dnsblChecker struct {
+	l        logger.Logger
+	resolver *net.Resolver
+	address  string
+	timeout  time.Duration
+	weight   float64
+	zones    []DNSBLZone
+}
+
+func NewDNSBLChecker(l logger.Logger, cfg *DNSBLConfig) (Checker, error) {
+	l.Info("Starting execution of NewDNSBLChecker", zap.String("checker", "DNSBL"))
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	c := &dnsblChecker{
+		l:        l,
+		resolver: net.DefaultResolver,
+		address:  cfg.Resolver,
+		timeout:  cfg.Timeout,
+		weight:   cfg.Weight,
+		zones:    cfg.Zones,
+	}
+	if cfg.Resolver != "" {
+		c.resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, cfg.Resolver)
+			},
+		}
+	}
+	l.Info("Finished execution of NewDNSBLChecker", zap.String("checker", "DNSBL"))
+	return c, nil
+}
+
+func (c *dnsblChecker) Name() string {
+	return "DNSBL"
+}
+
+func (c *dnsblChecker) Weight() float64 {
+	return c.weight
+}
+
+func (c *dnsblChecker) Describe() map[string]string {
+	zones := make([]string, 0, len(c.zones))
+	for _, zone := range c.zones {
+		zones = append(zones, zone.Zone)
+	}
+	return map[string]string{
+		"resolver": c.address,
+		"timeout":  c.timeout.String(),
+		"weight":   fmt.Sprintf("%g", c.weight),
+		"zones":    strings.Join(zones, ","),
+	}
+}
+
+// HealthCheck looks up 127.0.0.2, which every list must answer for, in
+// every zone.
+func (c *dnsblChecker) HealthCheck(ctx context.Context) error {
+	test := net.ParseIP("127.0.0.2")
+	var err error
+	for _, listing := range c.lookupAll(ctx, test) {
+		if listing.Error != "" {
+			err = multierr.Append(err, errors.Errorf("%s: %s", listing.Zone, listing.Error))
+		} else if !listing.Listed {
+			err = multierr.Append(err, errors.Errorf("%s: Test address is not listed", listing.Zone))
+		}
+	}
+	return err
+}
+
+// Check looks ip up in every zone concurrently. It only fails when no zone
+// could be queried at all.
+func (c *dnsblChecker) Check(ctx context.Context, ip string) (*CheckResult, error) {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return nil, errors.New("Argument 'IP' must be a valid IP address")
+	}
+	listings := c.lookupAll(ctx, addr)
+
+	result := &CheckResult{
+		Checker:   c.Name(),
+		Source:    "dns",
+		FetchedAt: time.Now(),
+		Raw:       listings,
+	}
+	seen := map[string]bool{}
+	var errs error
+	queried := 0
+	for i, listing := range listings {
+		if listing.Error != "" {
+			errs = multierr.Append(errs, errors.Errorf("%s: %s", listing.Zone, listing.Error))
+			continue
+		}
+		queried++
+		if !listing.Listed {
+			continue
+		}
+		if score := zoneScore(c.zones[i]); score > result.Score {
+			result.Score = score
+		}
+		for _, category := range listing.Categories {
+			if !seen[category] {
+				seen[category] = true
+				result.Categories = append(result.Categories, category)
+			}
+		}
+	}
+	if queried == 0 && errs != nil {
+		return nil, errs
+	}
+	if errs != nil {
+		c.l.Error(
+			"Failed to query some DNSBL zones",
+			zap.String("checker", "DNSBL"),
+			zap.String("ip", ip),
+			zap.Error(errs),
+		)
+	}
+	sort.Strings(result.Categories)
+	result.Verdict = VerdictFromScore(result.Score)
+	return result, nil
+}
+
+// lookupAll queries every zone applicable to ip concurrently, each with its
+// own timeout. Listings are returned in the order of the configured zones.
+func (c *dnsblChecker) lookupAll(ctx context.Context, ip net.IP) []*DNSBLListing {
+	listings := make([]*DNSBLListing, len(c.zones))
+	var wg sync.WaitGroup
+	for i, zone := range c.zones {
+		listings[i] = &DNSBLListing{Name: zone.Name, Zone: zone.Zone}
+		if ip.To4() == nil && !zone.IPv6 {
+			continue
+		}
+		wg.Add(1)
+		go func(listing *DNSBLListing, zone DNSBLZone) {
+			defer wg.Done()
+			c.lookup(ctx, ip, zone, listing)
+		}(listings[i], zone)
+	}
+	wg.Wait()
+	return listings
+}
+
+func (c *dnsblChecker) lookup(ctx context.Context, ip net.IP, zone DNSBLZone, listing *DNSBLListing) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	codes, err := c.resolver.LookupHost(ctx, dnsblName(ip, zone.Zone))
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return
+		}
+		listing.Error = err.Error()
+		return
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		// Lists answer 127.255.255.0/24 when they refuse the query, e.g.
+		// because it came through a public resolver.
+		if strings.HasPrefix(code, "127.255.255.") {
+			listing.Error = fmt.Sprintf("Query refused with code %s", code)
+			return
+		}
+		listing.Codes = append(listing.Codes, code)
+		category, ok := zone.Codes[code]
+		if !ok {
+			category = "listed"
+		}
+		if !seen[category] {
+			seen[category] = true
+			listing.Categories = append(listing.Categories, category)
+		}
+	}
+	sort.Strings(listing.Codes)
+	sort.Strings(listing.Categories)
+	listing.Listed = len(listing.Codes) > 0
+}
+
+func zoneScore(zone DNSBLZone) int {
+	if zone.Score == 0 {
+		return 100
+	}
+	return zone.Score
+}
+
+// dnsblName returns the name to look ip up under in zone: the reversed
+// octets for IPv4 and the reversed nibbles for IPv6.
+func dnsblName(ip net.IP, zone string) string {
+	var labels []string
+	if v4 := ip.To4(); v4 != nil {
+		for i := len(v4) - 1; i >= 0; i-- {
+			labels = append(labels, fmt.Sprintf("%d", v4[i]))
+		}
+	} else {
+		v6 := ip.To16()
+		for i := len(v6) - 1; i >= 0; i-- {
+			labels = append(labels, fmt.Sprintf("%x", v6[i]&0x0f), fmt.Sprintf("%x", v6[i]>>4))
+		}
+	}
+	return strings.Join(labels, ".") + "." + strings.TrimSuffix(zone, ".") + "."
+}
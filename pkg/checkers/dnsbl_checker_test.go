@@ -0,0 +1,108 @@
+package checkers
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hostinger/hbl/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// serveDNS answers A queries for the names in records and NXDOMAIN for any
+// other name. It returns the address it listens on.
+func serveDNS(t *testing.T, records map[string][]string) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var req dnsmessage.Message
+			if err := req.Unpack(buf[:n]); err != nil || len(req.Questions) == 0 {
+				continue
+			}
+			q := req.Questions[0]
+			resp := dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: req.ID, Response: true, Authoritative: true},
+				Questions: req.Questions,
+			}
+			answers, ok := records[q.Name.String()]
+			if !ok {
+				resp.RCode = dnsmessage.RCodeNameError
+			}
+			if q.Type == dnsmessage.TypeA {
+				for _, answer := range answers {
+					var a [4]byte
+					copy(a[:], net.ParseIP(answer).To4())
+					resp.Answers = append(resp.Answers, dnsmessage.Resource{
+						Header: dnsmessage.ResourceHeader{Name: q.Name, Type: q.Type, Class: q.Class, TTL: 60},
+						Body:   &dnsmessage.AResource{A: a},
+					})
+				}
+			}
+			packed, err := resp.Pack()
+			if err != nil {
+				continue
+			}
+			conn.WriteTo(packed, addr) // nolint
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestDNSBLChecker_Check(t *testing.T) {
+	resolver := serveDNS(t, map[string][]string{
+		"4.3.2.1.zen.example.":  {"127.0.0.2", "127.0.0.4"},
+		"4.3.2.1.spam.example.": {"127.0.0.9"},
+		"5.3.2.1.zen.example.":  {"127.255.255.254"},
+		"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.zen.example.": {"127.0.0.3"},
+	})
+	c, err := NewDNSBLChecker(logger.NewLogger("test"), &DNSBLConfig{
+		Resolver: resolver,
+		Timeout:  time.Second,
+		Weight:   1,
+		Zones: []DNSBLZone{
+			{
+				Name:  "ZEN",
+				Zone:  "zen.example",
+				IPv6:  true,
+				Codes: map[string]string{"127.0.0.2": "sbl", "127.0.0.3": "css", "127.0.0.4": "xbl"},
+			},
+			{Name: "Spam", Zone: "spam.example", Score: 50},
+		},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	result, err := c.Check(context.Background(), "1.2.3.4")
+	assert.NoError(t, err)
+	assert.Equal(t, 100, result.Score)
+	assert.Equal(t, VerdictMalicious, result.Verdict)
+	assert.Equal(t, []string{"listed", "sbl", "xbl"}, result.Categories)
+
+	result, err = c.Check(context.Background(), "1.2.3.6")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, result.Score)
+	assert.Equal(t, VerdictClean, result.Verdict)
+
+	result, err = c.Check(context.Background(), "1.2.3.5")
+	assert.NoError(t, err)
+	listings := result.Raw.([]*DNSBLListing)
+	assert.NotEmpty(t, listings[0].Error)
+	assert.False(t, listings[1].Listed)
+
+	result, err = c.Check(context.Background(), "2001:db8::1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"css"}, result.Categories)
+}
@@ -0,0 +1,243 @@
+package checkers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hostinger/hbl/pkg/logger"
+	"github.com/oschwald/geoip2-golang"
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+type GeoIPConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	// CityDatabase and ASNDatabase are paths to GeoLite2 City (or Country)
+	// and ASN .mmdb files. At least one must be set.
+	CityDatabase string `mapstructure:"city_database"`
+	ASNDatabase  string `mapstructure:"asn_database"`
+
+	// ReloadInterval is how often the files are checked for changes, e.g.
+	// after geoipupdate ran. Zero never reloads them.
+	ReloadInterval time.Duration `mapstructure:"reload_interval"`
+}
+
+func (c *GeoIPConfig) Validate() error {
+	var err error
+	if strings.TrimSpace(c.CityDatabase) == "" && strings.TrimSpace(c.ASNDatabase) == "" {
+		err = multierr.Append(err, errors.New("Field 'city_database' or 'asn_database' must be set"))
+	}
+	if c.ReloadInterval < 0 {
+		err = multierr.Append(err, errors.New("Field 'reload_interval' must not be negative"))
+	}
+	return err
+}
+
+// geoipDatabase is an opened .mmdb file together with the modification time
+// it had when it was opened.
+type geoipDatabase struct {
+	path    string
+	reader  *geoip2.Reader
+	modTime time.Time
+}
+
+func openGeoIPDatabase(path string) (*geoipDatabase, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to stat database")
+	}
+	reader, err := geoip2.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to open database '%s'", path)
+	}
+	return &geoipDatabase{path: path, reader: reader, modTime: info.ModTime()}, nil
+}
+
+// geoipChecker enriches addresses with their country and ASN from local
+// MaxMind databases. It never judges an address, so it has no weight.
+type geoipChecker struct {
+	l        logger.Logger
+	interval time.Duration
+
+	// mu guards the databases: lookups hold it for reading, so databases
+	// are only closed once no lookup uses them anymore.
+	mu        sync.RWMutex
+	city      *geoipDatabase
+	asn       *geoipDatabase
+	checkedAt time.Time
+}
+
+func NewGeoIPChecker(l logger.Logger, cfg *GeoIPConfig) (Checker, error) {
+	l.Info("Starting execution of NewGeoIPChecker", zap.String("checker", "GeoIP"))
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	c := &geoipChecker{
+		l:         l,
+		interval:  cfg.ReloadInterval,
+		checkedAt: time.Now(),
+	}
+	var err error
+	if cfg.CityDatabase != "" {
+		if c.city, err = openGeoIPDatabase(cfg.CityDatabase); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.ASNDatabase != "" {
+		if c.asn, err = openGeoIPDatabase(cfg.ASNDatabase); err != nil {
+			c.Close() // nolint
+			return nil, err
+		}
+	}
+	l.Info("Finished execution of NewGeoIPChecker", zap.String("checker", "GeoIP"))
+	return c, nil
+}
+
+func (c *geoipChecker) Name() string {
+	return "GeoIP"
+}
+
+func (c *geoipChecker) Weight() float64 {
+	return 0
+}
+
+func (c *geoipChecker) Describe() map[string]string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	description := map[string]string{
+		"reload_interval": c.interval.String(),
+	}
+	for key, db := range map[string]*geoipDatabase{"city_database": c.city, "asn_database": c.asn} {
+		if db == nil {
+			continue
+		}
+		built := time.Unix(int64(db.reader.Metadata().BuildEpoch), 0).UTC()
+		description[key] = fmt.Sprintf("%s (built %s)", db.path, built.Format("2006-01-02"))
+	}
+	return description
+}
+
+func (c *geoipChecker) HealthCheck(ctx context.Context) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.city == nil && c.asn == nil {
+		return errors.New("No database is open")
+	}
+	return nil
+}
+
+// Check returns the enrichment of ip as an unscored result, so it can be
+// seen alongside the other checkers.
+func (c *geoipChecker) Check(ctx context.Context, ip string) (*CheckResult, error) {
+	enrichment, err := c.Enrich(ctx, ip)
+	if err != nil {
+		return nil, err
+	}
+	var categories []string
+	if enrichment.Country != "" {
+		categories = append(categories, enrichment.Country)
+	}
+	if enrichment.ASN != 0 {
+		categories = append(categories, fmt.Sprintf("AS%d", enrichment.ASN))
+	}
+	return &CheckResult{
+		Checker:    c.Name(),
+		Verdict:    VerdictUnknown,
+		Categories: categories,
+		Source:     "mmdb",
+		FetchedAt:  time.Now(),
+		Raw:        enrichment,
+	}, nil
+}
+
+func (c *geoipChecker) Enrich(ctx context.Context, ip string) (*Enrichment, error) {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return nil, errors.New("Argument 'IP' must be a valid IP address")
+	}
+	c.reload()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	enrichment := &Enrichment{}
+	if c.city != nil {
+		record, err := c.city.reader.Country(addr)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to look up country")
+		}
+		enrichment.Country = record.Country.IsoCode
+	}
+	if c.asn != nil {
+		record, err := c.asn.reader.ASN(addr)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to look up ASN")
+		}
+		enrichment.ASN = record.AutonomousSystemNumber
+		enrichment.Organization = record.AutonomousSystemOrganization
+	}
+	return enrichment, nil
+}
+
+// reload reopens databases whose file changed, at most once per interval.
+// A database which fails to open is logged and the previous one kept.
+func (c *geoipChecker) reload() {
+	if c.interval <= 0 {
+		return
+	}
+	c.mu.RLock()
+	due := time.Since(c.checkedAt) >= c.interval
+	c.mu.RUnlock()
+	if !due {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.checkedAt) < c.interval {
+		return
+	}
+	c.checkedAt = time.Now()
+	for _, db := range []**geoipDatabase{&c.city, &c.asn} {
+		if *db == nil {
+			continue
+		}
+		info, err := os.Stat((*db).path)
+		if err != nil || info.ModTime().Equal((*db).modTime) {
+			continue
+		}
+		reopened, err := openGeoIPDatabase((*db).path)
+		if err != nil {
+			c.l.Error(
+				"Failed to reload database",
+				zap.String("checker", "GeoIP"),
+				zap.String("path", (*db).path),
+				zap.Error(err),
+			)
+			continue
+		}
+		(*db).reader.Close() // nolint
+		*db = reopened
+		c.l.Info("Reloaded database", zap.String("checker", "GeoIP"), zap.String("path", reopened.path))
+	}
+}
+
+// Close closes the databases once lookups in flight are done.
+func (c *geoipChecker) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var err error
+	for _, db := range []**geoipDatabase{&c.city, &c.asn} {
+		if *db != nil {
+			err = multierr.Append(err, (*db).reader.Close())
+			*db = nil
+		}
+	}
+	return err
+}
@@ -0,0 +1,133 @@
+package checkers
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hostinger/hbl/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+// The databases in testdata only list 192.0.2.0/24: country.mmdb in LT,
+// country-updated.mmdb in DE and asn.mmdb in AS64496 'Example'.
+
+// copyDatabase copies the testdata database name to path.
+func copyDatabase(t *testing.T, name, path string) {
+	b, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	replaceFile(t, path, b)
+}
+
+// replaceFile replaces the file at path with one holding b, the way
+// geoipupdate does, rather than writing over the file in use.
+func replaceFile(t *testing.T, path string, b []byte) {
+	if err := ioutil.WriteFile(path+".tmp", b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGeoIPChecker_Enrich(t *testing.T) {
+	checker, err := NewGeoIPChecker(logger.NewLogger("test"), &GeoIPConfig{
+		CityDatabase: "testdata/country.mmdb",
+		ASNDatabase:  "testdata/asn.mmdb",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer checker.(*geoipChecker).Close()
+	ctx := context.Background()
+
+	enrichment, err := checker.(Enricher).Enrich(ctx, "192.0.2.1")
+	assert.NoError(t, err)
+	assert.Equal(t, &Enrichment{Country: "LT", ASN: 64496, Organization: "Example"}, enrichment)
+
+	enrichment, err = checker.(Enricher).Enrich(ctx, "198.51.100.1")
+	assert.NoError(t, err)
+	assert.Equal(t, &Enrichment{}, enrichment)
+
+	result, err := checker.Check(ctx, "192.0.2.1")
+	if assert.NoError(t, err) {
+		assert.Equal(t, VerdictUnknown, result.Verdict)
+		assert.Equal(t, []string{"LT", "AS64496"}, result.Categories)
+	}
+
+	_, err = checker.(Enricher).Enrich(ctx, "192.0.2")
+	assert.Error(t, err)
+}
+
+func TestGeoIPChecker_reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "country.mmdb")
+	copyDatabase(t, "country.mmdb", path)
+	checker, err := NewGeoIPChecker(logger.NewLogger("test"), &GeoIPConfig{
+		CityDatabase:   path,
+		ReloadInterval: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := checker.(*geoipChecker)
+	defer c.Close()
+	ctx := context.Background()
+
+	enrichment, err := c.Enrich(ctx, "192.0.2.1")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "LT", enrichment.Country)
+	}
+
+	copyDatabase(t, "country-updated.mmdb", path)
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * time.Millisecond)
+	enrichment, err = c.Enrich(ctx, "192.0.2.1")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "DE", enrichment.Country)
+	}
+
+	// A broken update keeps the database in use.
+	replaceFile(t, path, []byte("broken"))
+	time.Sleep(2 * time.Millisecond)
+	enrichment, err = c.Enrich(ctx, "192.0.2.1")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "DE", enrichment.Country)
+	}
+}
+
+func TestGeoIPChecker_Close(t *testing.T) {
+	checker, err := NewGeoIPChecker(logger.NewLogger("test"), &GeoIPConfig{
+		CityDatabase:   "testdata/country.mmdb",
+		ASNDatabase:    "testdata/asn.mmdb",
+		ReloadInterval: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := checker.(*geoipChecker)
+	ctx := context.Background()
+	assert.NoError(t, c.HealthCheck(ctx))
+
+	assert.NoError(t, c.Close())
+	time.Sleep(2 * time.Millisecond)
+	enrichment, err := c.Enrich(ctx, "192.0.2.1")
+	assert.NoError(t, err)
+	assert.Equal(t, &Enrichment{}, enrichment)
+	assert.Error(t, c.HealthCheck(ctx))
+	assert.NoError(t, c.Close())
+}
+
+func TestNewGeoIPChecker(t *testing.T) {
+	_, err := NewGeoIPChecker(logger.NewLogger("test"), &GeoIPConfig{})
+	assert.Error(t, err)
+	_, err = NewGeoIPChecker(logger.NewLogger("test"), &GeoIPConfig{CityDatabase: "testdata/missing.mmdb"})
+	assert.Error(t, err)
+}
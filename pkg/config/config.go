@@ -0,0 +1,476 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hostinger/hbl/pkg/alerters"
+	"github.com/hostinger/hbl/pkg/checkers"
+	"github.com/hostinger/hbl/pkg/endpoints"
+	"github.com/hostinger/hbl/pkg/hbl"
+	"github.com/hostinger/hbl/pkg/utils"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"go.uber.org/multierr"
+	"go.uber.org/zap/zapcore"
+)
+
+// Config describes which endpoints, checkers and alerters the server runs
+// and how they are set up. It is read from a YAML, TOML or JSON file, and
+// every value can be overridden through environment variables.
+type Config struct {
+	Listen    ListenConfig    `mapstructure:"listen"`
+	Database  DatabaseConfig  `mapstructure:"database"`
+	Log       LogConfig       `mapstructure:"log"`
+	Endpoints EndpointsConfig `mapstructure:"endpoints"`
+	Checkers  CheckersConfig  `mapstructure:"checkers"`
+	Alerters  AlertersConfig  `mapstructure:"alerters"`
+
+	Health HealthConfig `mapstructure:"health"`
+
+	// ProtectedRanges lists networks which can never be blocked.
+	ProtectedRanges []string `mapstructure:"protected_ranges"`
+
+	// PrefixFile is a Routeviews prefix-to-AS file used to block ASNs on
+	// endpoints which can't block them natively, e.g. PowerDNS.
+	PrefixFile string `mapstructure:"prefix_file"`
+
+	// Policy holds the rules deciding automatically what to do with an
+	// address.
+	Policy hbl.PolicyConfig `mapstructure:"policy"`
+
+	// Escalation suggests blocking whole networks once enough of their
+	// addresses are blocked.
+	Escalation hbl.EscalationConfig `mapstructure:"escalation"`
+
+	// Incidents decides when HBL pages about itself, e.g. a failed sync.
+	Incidents hbl.IncidentsConfig `mapstructure:"incidents"`
+
+	// Webhooks tunes the delivery of address changes to webhooks.
+	Webhooks hbl.WebhooksConfig `mapstructure:"webhooks"`
+
+	// Stream tunes the stream of list changes served by /api/v1/events.
+	Stream hbl.StreamConfig `mapstructure:"stream"`
+
+	// Changes tunes the change log served by /api/v1/changes.
+	Changes hbl.ChangesConfig `mapstructure:"changes"`
+
+	// Slack lets operators manage addresses from Slack.
+	Slack hbl.SlackConfig `mapstructure:"slack"`
+}
+
+// HealthConfig lists the components whose failure makes the server not
+// ready. Failures of any other component only degrade readiness.
+type HealthConfig struct {
+	Critical []string `mapstructure:"critical"`
+}
+
+type ListenConfig struct {
+	Host string `mapstructure:"host"`
+	Port string `mapstructure:"port"`
+}
+
+type DatabaseConfig struct {
+	Host     string `mapstructure:"host"`
+	Port     string `mapstructure:"port"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	Name     string `mapstructure:"name"`
+}
+
+type LogConfig struct {
+	Channel string `mapstructure:"channel"`
+	Level   string `mapstructure:"level"`
+}
+
+type EndpointsConfig struct {
+	PowerDNS   endpoints.PDNSConfig       `mapstructure:"powerdns"`
+	Cloudflare endpoints.CloudflareConfig `mapstructure:"cloudflare"`
+}
+
+type CheckersConfig struct {
+	// RefreshInterval is how often cached results of listed addresses are
+	// refreshed in the background. Zero disables the refresher.
+	RefreshInterval time.Duration `mapstructure:"refresh_interval"`
+
+	AbuseIPDB checkers.AbuseIPDBConfig `mapstructure:"abuseipdb"`
+	DNSBL     checkers.DNSBLConfig     `mapstructure:"dnsbl"`
+	GeoIP     checkers.GeoIPConfig     `mapstructure:"geoip"`
+}
+
+type AlertersConfig struct {
+	Slack alerters.SlackConfig `mapstructure:"slack"`
+	Email alerters.EmailConfig `mapstructure:"email"`
+
+	Teams      alerters.TeamsConfig      `mapstructure:"teams"`
+	Mattermost alerters.MattermostConfig `mapstructure:"mattermost"`
+	Telegram   alerters.TelegramConfig   `mapstructure:"telegram"`
+
+	// Queue tunes how alerts are delivered to every alerter.
+	Queue alerters.QueueConfig `mapstructure:"queue"`
+
+	// Routes pick the alerters alerts are sent to.
+	Routes []alerters.Route `mapstructure:"routes"`
+
+	// PagerDuty and Opsgenie page on-call, by default only for incidents.
+	PagerDuty alerters.PagerDutyConfig `mapstructure:"pagerduty"`
+	Opsgenie  alerters.OpsgenieConfig  `mapstructure:"opsgenie"`
+}
+
+// legacyEnv maps configuration keys to the environment variables which were
+// used before the configuration file existed, so older deployments keep
+// working unchanged.
+var legacyEnv = map[string]string{
+	"listen.host":                         "HBL_LISTEN_ADDRESS",
+	"listen.port":                         "HBL_LISTEN_PORT",
+	"database.host":                       "HBL_MYSQL_HOST",
+	"database.port":                       "HBL_MYSQL_PORT",
+	"database.username":                   "HBL_MYSQL_USERNAME",
+	"database.password":                   "HBL_MYSQL_PASSWORD",
+	"database.name":                       "HBL_MYSQL_DATABASE",
+	"log.channel":                         "LOG_CHANNEL",
+	"log.level":                           "LOG_LEVEL",
+	"endpoints.powerdns.scheme":           "PDNS_API_SCHEME",
+	"endpoints.powerdns.host":             "PDNS_API_HOST",
+	"endpoints.powerdns.port":             "PDNS_API_PORT",
+	"endpoints.powerdns.key":              "PDNS_API_KEY",
+	"endpoints.powerdns.zone":             "PDNS_API_ZONE",
+	"endpoints.powerdns.zone_create":      "PDNS_API_ZONE_CREATE",
+	"endpoints.powerdns.zone_nameservers": "PDNS_API_ZONE_NAMESERVERS",
+	"endpoints.powerdns.zone_hostmaster":  "PDNS_API_ZONE_HOSTMASTER",
+	"endpoints.cloudflare.account":        "CF_API_ACCOUNT",
+	"endpoints.cloudflare.email":          "CF_API_EMAIL",
+	"endpoints.cloudflare.key":            "CF_API_KEY",
+	"checkers.abuseipdb.key":              "ABUSEIPDB_API_KEY",
+	"alerters.slack.webhook_url":          "SLACK_WEBHOOK_URL",
+	"alerters.slack.channel":              "SLACK_WEBHOOK_CHANNEL",
+	"alerters.slack.username":             "SLACK_WEBHOOK_USERNAME",
+}
+
+// secrets lists the keys which may also be given as '<key>_file' pointing to
+// a file holding the actual value.
+var secrets = []string{
+	"database.password",
+	"endpoints.powerdns.key",
+	"endpoints.cloudflare.key",
+	"checkers.abuseipdb.key",
+	"alerters.slack.webhook_url",
+	"alerters.email.password",
+	"alerters.teams.webhook_url",
+	"alerters.mattermost.webhook_url",
+	"alerters.telegram.token",
+	"alerters.pagerduty.routing_key",
+	"alerters.opsgenie.api_key",
+	"slack.signing_secret",
+}
+
+var defaults = map[string]interface{}{
+	"listen.host":                         "0.0.0.0",
+	"listen.port":                         "9040",
+	"database.host":                       "",
+	"database.port":                       "3306",
+	"database.username":                   "",
+	"database.password":                   "",
+	"database.name":                       "hbl",
+	"log.channel":                         "",
+	"log.level":                           "",
+	"protected_ranges":                    []string{},
+	"prefix_file":                         "",
+	"health.critical":                     []string{"database"},
+	"endpoints.powerdns.enabled":          true,
+	"endpoints.powerdns.scheme":           "http",
+	"endpoints.powerdns.host":             "",
+	"endpoints.powerdns.port":             "8081",
+	"endpoints.powerdns.key":              "",
+	"endpoints.powerdns.zone":             "",
+	"endpoints.powerdns.zone_create":      false,
+	"endpoints.powerdns.zone_nameservers": []string{},
+	"endpoints.powerdns.zone_hostmaster":  "",
+	"endpoints.cloudflare.enabled":        false,
+	"endpoints.cloudflare.account":        "",
+	"endpoints.cloudflare.email":          "",
+	"endpoints.cloudflare.key":            "",
+	"endpoints.cloudflare.aggregate":      false,
+	"endpoints.cloudflare.capacity":       0,
+	"checkers.abuseipdb.enabled":          true,
+	"checkers.abuseipdb.base_url":         "https://api.abuseipdb.com/api/v2",
+	"checkers.abuseipdb.key":              "",
+	"checkers.abuseipdb.weight":           1.0,
+	"checkers.abuseipdb.max_age":          "24h",
+	"checkers.abuseipdb.quota_reserve":    0,
+	"checkers.abuseipdb.report.enabled":   false,
+	"checkers.abuseipdb.report.sources":   []string{},
+	"checkers.dnsbl.enabled":              false,
+	"checkers.dnsbl.weight":               1.0,
+	"checkers.dnsbl.resolver":             "",
+	"checkers.dnsbl.timeout":              "2s",
+	"checkers.geoip.enabled":              false,
+	"checkers.geoip.city_database":        "",
+	"checkers.geoip.asn_database":         "",
+	"checkers.geoip.reload_interval":      "1h",
+	"checkers.refresh_interval":           "0s",
+	"policy.file":                         "",
+	"escalation.enabled":                  false,
+	"escalation.interval":                 "10m",
+	"escalation.window":                   "24h",
+	"escalation.ipv4_prefix":              24,
+	"escalation.ipv6_prefix":              64,
+	"escalation.threshold":                20,
+	"escalation.auto_block":               false,
+	"incidents.interval":                  "1m",
+	"incidents.mass_block_threshold":      100,
+	"incidents.mass_block_window":         "5m",
+	"incidents.protected_window":          "15m",
+	"webhooks.poll":                       "1s",
+	"webhooks.queue_size":                 1000,
+	"webhooks.workers":                    4,
+	"webhooks.timeout":                    "10s",
+	"webhooks.retries":                    5,
+	"webhooks.backoff":                    "10s",
+	"webhooks.max_backoff":                "10m",
+	"webhooks.retention":                  "720h",
+	"stream.poll":                         "1s",
+	"stream.heartbeat":                    "30s",
+	"changes.retention":                   "720h",
+	"slack.enabled":                       false,
+	"slack.signing_secret":                "",
+	"alerters.queue.size":                 1000,
+	"alerters.queue.retries":              3,
+	"alerters.queue.backoff":              "1s",
+	"alerters.queue.max_backoff":          "30s",
+	"alerters.queue.digest.enabled":       false,
+	"alerters.queue.digest.size":          50,
+	"alerters.queue.digest.interval":      "5m",
+	"alerters.slack.enabled":              false,
+	"alerters.slack.webhook_url":          "",
+	"alerters.slack.channel":              "",
+	"alerters.slack.username":             "",
+	"alerters.slack.template":             "",
+	"alerters.slack.interactive":          false,
+	"alerters.email.enabled":              false,
+	"alerters.email.host":                 "",
+	"alerters.email.port":                 587,
+	"alerters.email.security":             "starttls",
+	"alerters.email.username":             "",
+	"alerters.email.password":             "",
+	"alerters.email.from":                 "",
+	"alerters.email.to":                   []string{},
+	"alerters.email.subject":              "[HBL] {{.Action}} {{.IP}}",
+	"alerters.email.text_template":        "",
+	"alerters.email.html_template":        "",
+	"alerters.email.timeout":              "10s",
+	"alerters.teams.enabled":              false,
+	"alerters.teams.webhook_url":          "",
+	"alerters.mattermost.enabled":         false,
+	"alerters.mattermost.webhook_url":     "",
+	"alerters.mattermost.channel":         "",
+	"alerters.mattermost.username":        "",
+	"alerters.mattermost.icon_url":        "",
+	"alerters.telegram.enabled":           false,
+	"alerters.telegram.api_url":           "https://api.telegram.org",
+	"alerters.telegram.token":             "",
+	"alerters.telegram.chat_id":           "",
+	"alerters.pagerduty.enabled":          false,
+	"alerters.pagerduty.api_url":          "https://events.pagerduty.com",
+	"alerters.pagerduty.routing_key":      "",
+	"alerters.pagerduty.severities":       []string{"warning", "error", "critical"},
+	"alerters.opsgenie.enabled":           false,
+	"alerters.opsgenie.api_url":           "https://api.opsgenie.com",
+	"alerters.opsgenie.api_key":           "",
+	"alerters.opsgenie.severities":        []string{"warning", "error", "critical"},
+}
+
+// Load reads the configuration file at path, if any, and applies environment
+// overrides on top of it. Every key can be set through 'HBL_' followed by the
+// upper-cased key with dots replaced by underscores, for example
+// HBL_ENDPOINTS_CLOUDFLARE_ENABLED.
+func Load(path string) (*Config, error) {
+	// ENVIRONMENT used to pick the endpoints, checkers and alerters. They
+	// are enabled in the configuration now, and ignoring it would silently
+	// run without some of them.
+	if env, ok := os.LookupEnv("ENVIRONMENT"); ok {
+		return nil, errors.Errorf("ENVIRONMENT=%s is no longer supported: enable endpoints, checkers and alerters in the configuration and unset it", env)
+	}
+	v := viper.New()
+	for key, value := range defaults {
+		v.SetDefault(key, value)
+	}
+	for _, key := range secrets {
+		v.SetDefault(key+"_file", "")
+	}
+
+	v.SetEnvPrefix("HBL")
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+	for key, env := range legacyEnv {
+		if err := bindLegacyEnv(v, key, env); err != nil {
+			return nil, err
+		}
+		if isSecret(key) {
+			if err := bindLegacyEnv(v, key+"_file", env+"_FILE"); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if path != "" {
+		v.SetConfigFile(path)
+		if err := v.ReadInConfig(); err != nil {
+			return nil, errors.Wrapf(err, "Failed to read configuration file '%s'", path)
+		}
+	}
+
+	if err := resolveSecrets(v); err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	if err := v.Unmarshal(&cfg); err != nil {
+		return nil, errors.Wrap(err, "Failed to decode configuration")
+	}
+	if err := cfg.Policy.Resolve(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Validate checks the whole configuration and reports every problem found
+// rather than stopping at the first one. Use multierr.Errors to list them.
+func (c *Config) Validate() error {
+	var err error
+	if strings.TrimSpace(c.Listen.Port) == "" {
+		err = multierr.Append(err, errors.New("listen: Field 'port' must not be empty"))
+	}
+	if strings.TrimSpace(c.Database.Host) == "" {
+		err = multierr.Append(err, errors.New("database: Field 'host' must not be empty"))
+	}
+	if strings.TrimSpace(c.Database.Username) == "" {
+		err = multierr.Append(err, errors.New("database: Field 'username' must not be empty"))
+	}
+	if strings.TrimSpace(c.Database.Name) == "" {
+		err = multierr.Append(err, errors.New("database: Field 'name' must not be empty"))
+	}
+	if c.Log.Level != "" {
+		var level zapcore.Level
+		if e := level.UnmarshalText([]byte(c.Log.Level)); e != nil {
+			err = multierr.Append(err, errors.Errorf("log: Field 'level' must be a valid level: %s", e))
+		}
+	}
+	if e := hbl.ValidateCritical(c.Health.Critical); e != nil {
+		err = multierr.Append(err, errors.Wrap(e, "health: Field 'critical' is invalid"))
+	}
+	if _, e := utils.ParseRanges(c.ProtectedRanges); e != nil {
+		err = multierr.Append(err, errors.Wrap(e, "protected_ranges"))
+	}
+	if c.PrefixFile != "" {
+		if _, e := os.Stat(c.PrefixFile); e != nil {
+			err = multierr.Append(err, errors.Wrap(e, "prefix_file: Failed to read prefix file"))
+		}
+	}
+	if e := hbl.ValidatePolicy(&c.Policy); e != nil {
+		err = multierr.Append(err, prefix("policy", e))
+	}
+	err = multierr.Append(err, prefix("escalation", c.Escalation.Validate()))
+	err = multierr.Append(err, prefix("incidents", c.Incidents.Validate()))
+	err = multierr.Append(err, prefix("webhooks", c.Webhooks.Validate()))
+	err = multierr.Append(err, prefix("stream", c.Stream.Validate()))
+	err = multierr.Append(err, prefix("changes", c.Changes.Validate()))
+	err = multierr.Append(err, prefix("slack", c.Slack.Validate()))
+	if c.Checkers.RefreshInterval < 0 {
+		err = multierr.Append(err, errors.New("checkers: Field 'refresh_interval' must not be negative"))
+	}
+	if c.Endpoints.PowerDNS.Enabled {
+		err = multierr.Append(err, prefix("endpoints.powerdns", c.Endpoints.PowerDNS.Validate()))
+	}
+	if c.Endpoints.Cloudflare.Enabled {
+		err = multierr.Append(err, prefix("endpoints.cloudflare", c.Endpoints.Cloudflare.Validate()))
+	}
+	if c.Checkers.AbuseIPDB.Enabled {
+		err = multierr.Append(err, prefix("checkers.abuseipdb", c.Checkers.AbuseIPDB.Validate()))
+	}
+	if c.Checkers.DNSBL.Enabled {
+		err = multierr.Append(err, prefix("checkers.dnsbl", c.Checkers.DNSBL.Validate()))
+	}
+	if c.Checkers.GeoIP.Enabled {
+		err = multierr.Append(err, prefix("checkers.geoip", c.Checkers.GeoIP.Validate()))
+	}
+	err = multierr.Append(err, prefix("alerters.queue", c.Alerters.Queue.Validate()))
+	for i, route := range c.Alerters.Routes {
+		err = multierr.Append(err, prefix(fmt.Sprintf("alerters.routes[%d]", i), route.Validate()))
+	}
+	if c.Alerters.Slack.Enabled {
+		err = multierr.Append(err, prefix("alerters.slack", c.Alerters.Slack.Validate()))
+	}
+	if c.Alerters.Email.Enabled {
+		err = multierr.Append(err, prefix("alerters.email", c.Alerters.Email.Validate()))
+	}
+	if c.Alerters.Teams.Enabled {
+		err = multierr.Append(err, prefix("alerters.teams", c.Alerters.Teams.Validate()))
+	}
+	if c.Alerters.Mattermost.Enabled {
+		err = multierr.Append(err, prefix("alerters.mattermost", c.Alerters.Mattermost.Validate()))
+	}
+	if c.Alerters.Telegram.Enabled {
+		err = multierr.Append(err, prefix("alerters.telegram", c.Alerters.Telegram.Validate()))
+	}
+	if c.Alerters.PagerDuty.Enabled {
+		err = multierr.Append(err, prefix("alerters.pagerduty", c.Alerters.PagerDuty.Validate()))
+	}
+	if c.Alerters.Opsgenie.Enabled {
+		err = multierr.Append(err, prefix("alerters.opsgenie", c.Alerters.Opsgenie.Validate()))
+	}
+	return err
+}
+
+func resolveSecrets(v *viper.Viper) error {
+	var err error
+	for _, key := range secrets {
+		file := v.GetString(key + "_file")
+		if file == "" {
+			continue
+		}
+		content, e := ioutil.ReadFile(file)
+		if e != nil {
+			err = multierr.Append(err, errors.Wrapf(e, "%s_file: Failed to read secret", key))
+			continue
+		}
+		v.Set(key, strings.TrimRight(string(content), "\r\n"))
+	}
+	return err
+}
+
+// bindLegacyEnv binds key to its legacy environment variable unless the
+// prefixed variable is set, which always takes precedence.
+func bindLegacyEnv(v *viper.Viper, key, env string) error {
+	if _, ok := os.LookupEnv("HBL_" + envKey(key)); ok {
+		return nil
+	}
+	if err := v.BindEnv(key, env); err != nil {
+		return errors.Wrapf(err, "Failed to bind environment for '%s'", key)
+	}
+	return nil
+}
+
+func isSecret(key string) bool {
+	for _, secret := range secrets {
+		if secret == key {
+			return true
+		}
+	}
+	return false
+}
+
+func prefix(section string, err error) error {
+	var result error
+	for _, e := range multierr.Errors(err) {
+		result = multierr.Append(result, errors.Wrap(e, section))
+	}
+	return result
+}
+
+func envKey(key string) string {
+	return strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
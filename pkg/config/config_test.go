@@ -0,0 +1,222 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/multierr"
+)
+
+// setenv sets the environment variables in env, unsetting those mapped to
+// an empty value, until the test ends.
+func setenv(t *testing.T, env map[string]string) {
+	for key, value := range env {
+		previous, ok := os.LookupEnv(key)
+		if value == "" {
+			os.Unsetenv(key)
+		} else {
+			os.Setenv(key, value)
+		}
+		key := key
+		t.Cleanup(func() {
+			if ok {
+				os.Setenv(key, previous)
+			} else {
+				os.Unsetenv(key)
+			}
+		})
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	secret := writeFile(t, "password", "s3cret\n")
+	file := writeFile(t, "hbl.yaml", `
+database:
+  host: db.example.com
+  password_file: `+secret+`
+webhooks:
+  workers: 8
+`)
+
+	tests := []struct {
+		name  string
+		path  string
+		env   map[string]string
+		err   string
+		check func(t *testing.T, cfg *Config)
+	}{
+		{
+			name: "defaults",
+			check: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, "9040", cfg.Listen.Port)
+				assert.Equal(t, "hbl", cfg.Database.Name)
+				assert.True(t, cfg.Endpoints.PowerDNS.Enabled)
+				assert.Equal(t, time.Second, cfg.Webhooks.Poll)
+				assert.Equal(t, []string{"database"}, cfg.Health.Critical)
+			},
+		},
+		{
+			name: "file",
+			path: file,
+			check: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, "db.example.com", cfg.Database.Host)
+				assert.Equal(t, "s3cret", cfg.Database.Password)
+				assert.Equal(t, 8, cfg.Webhooks.Workers)
+				assert.Equal(t, 1000, cfg.Webhooks.QueueSize)
+			},
+		},
+		{
+			name: "environment overrides file",
+			path: file,
+			env:  map[string]string{"HBL_DATABASE_HOST": "db.internal", "HBL_WEBHOOKS_WORKERS": "2"},
+			check: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, "db.internal", cfg.Database.Host)
+				assert.Equal(t, 2, cfg.Webhooks.Workers)
+			},
+		},
+		{
+			name: "legacy environment",
+			env:  map[string]string{"HBL_MYSQL_HOST": "legacy.internal", "PDNS_API_ZONE": "hbl.example.com"},
+			check: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, "legacy.internal", cfg.Database.Host)
+				assert.Equal(t, "hbl.example.com", cfg.Endpoints.PowerDNS.Zone)
+			},
+		},
+		{
+			name: "prefixed environment wins over legacy one",
+			env:  map[string]string{"HBL_MYSQL_HOST": "legacy.internal", "HBL_DATABASE_HOST": "db.internal"},
+			check: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, "db.internal", cfg.Database.Host)
+			},
+		},
+		{
+			name: "missing file",
+			path: filepath.Join(t.TempDir(), "missing.yaml"),
+			err:  "Failed to read configuration file",
+		},
+		{
+			name: "missing secret",
+			env:  map[string]string{"HBL_DATABASE_PASSWORD_FILE": filepath.Join(t.TempDir(), "missing")},
+			err:  "database.password_file: Failed to read secret",
+		},
+		{
+			name: "ENVIRONMENT",
+			env:  map[string]string{"ENVIRONMENT": "PRODUCTION"},
+			err:  "ENVIRONMENT=PRODUCTION is no longer supported",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{
+				"ENVIRONMENT":       "",
+				"HBL_DATABASE_HOST": "",
+				"HBL_MYSQL_HOST":    "",
+			}
+			for key, value := range tt.env {
+				env[key] = value
+			}
+			setenv(t, env)
+
+			cfg, err := Load(tt.path)
+			if tt.err != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), tt.err)
+				}
+				return
+			}
+			if assert.NoError(t, err) {
+				tt.check(t, cfg)
+			}
+		})
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	setenv(t, map[string]string{"ENVIRONMENT": ""})
+
+	tests := []struct {
+		name   string
+		modify func(cfg *Config)
+		errs   []string
+	}{
+		{
+			name:   "valid",
+			modify: func(cfg *Config) {},
+		},
+		{
+			name: "missing database",
+			modify: func(cfg *Config) {
+				cfg.Database.Host = ""
+				cfg.Database.Username = " "
+			},
+			errs: []string{
+				"database: Field 'host' must not be empty",
+				"database: Field 'username' must not be empty",
+			},
+		},
+		{
+			name: "invalid ranges and level",
+			modify: func(cfg *Config) {
+				cfg.ProtectedRanges = []string{"10.0.0.0/8", "10.0.0.300"}
+				cfg.Log.Level = "loud"
+			},
+			errs: []string{
+				"log: Field 'level' must be a valid level: unrecognized level: \"loud\"",
+				"protected_ranges: Range '10.0.0.300' must be a valid IP address or CIDR",
+			},
+		},
+		{
+			name: "disabled components aren't validated",
+			modify: func(cfg *Config) {
+				cfg.Endpoints.PowerDNS.Enabled = false
+				cfg.Endpoints.PowerDNS.Zone = ""
+				cfg.Checkers.AbuseIPDB.Enabled = false
+				cfg.Checkers.AbuseIPDB.Key = ""
+			},
+		},
+		{
+			name: "enabled components are",
+			modify: func(cfg *Config) {
+				cfg.Endpoints.PowerDNS.Zone = ""
+				cfg.Webhooks.Workers = 0
+			},
+			errs: []string{
+				"webhooks: Field 'workers' must be positive",
+				"endpoints.powerdns: Field 'zone' must not be empty",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Load("")
+			if !assert.NoError(t, err) {
+				return
+			}
+			cfg.Database.Host = "db.example.com"
+			cfg.Database.Username = "hbl"
+			cfg.Endpoints.PowerDNS.Host = "pdns.example.com"
+			cfg.Endpoints.PowerDNS.Key = "key"
+			cfg.Endpoints.PowerDNS.Zone = "hbl.example.com"
+			cfg.Checkers.AbuseIPDB.Key = "key"
+			tt.modify(cfg)
+
+			var errs []string
+			for _, e := range multierr.Errors(cfg.Validate()) {
+				errs = append(errs, e.Error())
+			}
+			assert.Equal(t, tt.errs, errs)
+		})
+	}
+}
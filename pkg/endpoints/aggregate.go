@@ -0,0 +1,300 @@
+package endpoints
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Aggregation describes how an endpoint wants the blocked set pushed to it.
+type Aggregation struct {
+	// Capacity is the maximum number of networks the backend holds. Zero
+	// means it's unlimited.
+	Capacity int
+
+	// IPv4Lengths and IPv6Lengths are the prefix lengths the backend
+	// accepts, in increasing order. Empty means any length.
+	IPv4Lengths []int
+	IPv6Lengths []int
+
+	// MaxSplit is the most networks of accepted lengths a single network
+	// may be split into. Networks needing more are refused. Zero means
+	// Capacity, or DefaultMaxSplit when the capacity is unlimited.
+	MaxSplit int
+}
+
+// DefaultMaxSplit bounds how many networks a single network is split into
+// on endpoints which don't bound it themselves.
+const DefaultMaxSplit = 1 << 16
+
+// Aggregator is implemented by NetworkBlocker endpoints which would rather
+// hold a few covering networks than every blocked address, e.g. because
+// their rule count is limited. Aggregation returns nil when aggregation is
+// disabled.
+//
+// Once aggregated, single addresses and networks are no longer synced one at
+// a time on the endpoint: SyncAggregated pushes the whole set at once.
+type Aggregator interface {
+	NetworkBlocker
+	Aggregation() *Aggregation
+
+	// ReplaceNetworks makes networks the only addresses and networks the
+	// endpoint blocks, leaving autonomous systems and countries alone.
+	ReplaceNetworks(ctx context.Context, networks []string) error
+}
+
+// Entry is a blocked address or network handed to SyncAggregated. Score and
+// CreatedAt decide what's kept when an endpoint can't hold everything.
+type Entry struct {
+	// Network is a single address or a network in CIDR notation.
+	Network   string
+	Score     int
+	CreatedAt time.Time
+}
+
+// AggregationResult is the outcome of the last SyncAggregated on an
+// endpoint. Truncated counts the networks left out because the endpoint's
+// capacity was exceeded.
+type AggregationResult struct {
+	Entries   int
+	Networks  int
+	Truncated int
+	At        time.Time
+}
+
+// aggregated is a network covering one or more entries, with the highest
+// score and most recent creation time among them.
+type aggregated struct {
+	network   *net.IPNet
+	score     int
+	createdAt time.Time
+}
+
+// Aggregate collapses entries into the fewest networks of the lengths cfg
+// accepts which cover exactly the same addresses. When there are more than
+// cfg.Capacity of them, the networks holding the highest scored and then
+// the most recently created entries are kept, and the number of networks
+// left out is returned.
+func Aggregate(entries []*Entry, cfg *Aggregation) ([]string, int, error) {
+	var networks []*net.IPNet
+	for _, entry := range entries {
+		network, err := parseNetwork(entry.Network)
+		if err != nil {
+			return nil, 0, err
+		}
+		networks = append(networks, network)
+	}
+	var covering []*aggregated
+	for _, network := range collapse(networks) {
+		covering = append(covering, &aggregated{network: network})
+	}
+	for i, entry := range entries {
+		if a := find(covering, networks[i]); a != nil {
+			if entry.Score > a.score {
+				a.score = entry.Score
+			}
+			if entry.CreatedAt.After(a.createdAt) {
+				a.createdAt = entry.CreatedAt
+			}
+		}
+	}
+	var collapsed []*aggregated
+	for _, a := range covering {
+		splits, err := cfg.split(a.network)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, split := range splits {
+			collapsed = append(collapsed, &aggregated{network: split, score: a.score, createdAt: a.createdAt})
+		}
+	}
+
+	truncated := 0
+	if cfg.Capacity > 0 && len(collapsed) > cfg.Capacity {
+		prioritized := make([]*aggregated, len(collapsed))
+		copy(prioritized, collapsed)
+		sort.SliceStable(prioritized, func(i, j int) bool {
+			if prioritized[i].score != prioritized[j].score {
+				return prioritized[i].score > prioritized[j].score
+			}
+			return prioritized[i].createdAt.After(prioritized[j].createdAt)
+		})
+		truncated = len(collapsed) - cfg.Capacity
+		collapsed = prioritized[:cfg.Capacity]
+		sort.Slice(collapsed, func(i, j int) bool {
+			return compareNetworks(collapsed[i].network, collapsed[j].network) < 0
+		})
+	}
+
+	result := make([]string, 0, len(collapsed))
+	for _, a := range collapsed {
+		result = append(result, a.network.String())
+	}
+	return result, truncated, nil
+}
+
+// split splits network into networks of the lengths cfg accepts, refusing
+// it when that takes more than the networks cfg allows.
+func (cfg *Aggregation) split(network *net.IPNet) ([]*net.IPNet, error) {
+	limit := cfg.MaxSplit
+	if limit <= 0 {
+		limit = cfg.Capacity
+	}
+	if limit <= 0 {
+		limit = DefaultMaxSplit
+	}
+	return splitNetwork(network, cfg.lengths(network), limit)
+}
+
+func (cfg *Aggregation) lengths(network *net.IPNet) []int {
+	if len(network.IP) == net.IPv4len {
+		return cfg.IPv4Lengths
+	}
+	return cfg.IPv6Lengths
+}
+
+// parseNetwork parses a single address or a network in CIDR notation. IPv4
+// networks always use 4 byte addresses.
+func parseNetwork(s string) (*net.IPNet, error) {
+	if ip := net.ParseIP(s); ip != nil {
+		if v4 := ip.To4(); v4 != nil {
+			return &net.IPNet{IP: v4, Mask: net.CIDRMask(32, 32)}, nil
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+	}
+	_, network, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, errors.Errorf("Network '%s' must be an IP address or in CIDR notation", s)
+	}
+	if v4 := network.IP.To4(); v4 != nil && len(network.Mask) == net.IPv4len {
+		network.IP = v4
+	}
+	return network, nil
+}
+
+// compareNetworks orders IPv4 networks before IPv6 ones, then by address
+// and then wider networks first.
+func compareNetworks(a, b *net.IPNet) int {
+	if len(a.IP) != len(b.IP) {
+		return len(a.IP) - len(b.IP)
+	}
+	if c := bytes.Compare(a.IP, b.IP); c != 0 {
+		return c
+	}
+	onesA, _ := a.Mask.Size()
+	onesB, _ := b.Mask.Size()
+	return onesA - onesB
+}
+
+// contains tells whether a covers all of b.
+func contains(a, b *net.IPNet) bool {
+	onesA, bitsA := a.Mask.Size()
+	onesB, bitsB := b.Mask.Size()
+	return bitsA == bitsB && onesA <= onesB && a.Contains(b.IP)
+}
+
+// collapse returns the fewest networks covering exactly the given ones,
+// ordered by compareNetworks.
+func collapse(networks []*net.IPNet) []*net.IPNet {
+	sorted := make([]*net.IPNet, len(networks))
+	copy(sorted, networks)
+	sort.Slice(sorted, func(i, j int) bool {
+		return compareNetworks(sorted[i], sorted[j]) < 0
+	})
+	var stack []*net.IPNet
+	for _, network := range sorted {
+		if len(stack) > 0 && contains(stack[len(stack)-1], network) {
+			continue
+		}
+		stack = append(stack, network)
+		for len(stack) > 1 {
+			parent, ok := siblings(stack[len(stack)-2], stack[len(stack)-1])
+			if !ok {
+				break
+			}
+			stack = append(stack[:len(stack)-2], parent)
+		}
+	}
+	return stack
+}
+
+// siblings returns the parent of a and b when they are the two halves of
+// it, a being the lower one.
+func siblings(a, b *net.IPNet) (*net.IPNet, bool) {
+	onesA, bits := a.Mask.Size()
+	onesB, _ := b.Mask.Size()
+	if onesA != onesB || onesA == 0 || len(a.IP) != len(b.IP) {
+		return nil, false
+	}
+	mask := net.CIDRMask(onesA-1, bits)
+	parent := a.IP.Mask(mask)
+	if !parent.Equal(a.IP) || !b.IP.Mask(mask).Equal(parent) || a.IP.Equal(b.IP) {
+		return nil, false
+	}
+	return &net.IPNet{IP: parent, Mask: mask}, true
+}
+
+// splitNetwork splits network into networks of the shortest accepted length
+// which isn't shorter than its own, or into single addresses when there is
+// none. It fails when that takes more than limit networks.
+func splitNetwork(network *net.IPNet, lengths []int, limit int) ([]*net.IPNet, error) {
+	ones, bits := network.Mask.Size()
+	if len(lengths) == 0 {
+		return []*net.IPNet{network}, nil
+	}
+	size := bits
+	for _, length := range lengths {
+		if length >= ones {
+			size = length
+			break
+		}
+	}
+	if size == ones {
+		return []*net.IPNet{network}, nil
+	}
+	// Gaps of 63 bits or more overflow the count, and are beyond any limit.
+	gap := uint(size - ones)
+	if gap >= 63 || uint64(1)<<gap > uint64(limit) {
+		return nil, errors.Errorf("Network '%s' needs more than %d networks of accepted lengths", network, limit)
+	}
+	count := 1 << gap
+	networks := make([]*net.IPNet, 0, count)
+	ip := network.IP
+	for i := 0; i < count; i++ {
+		networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(size, bits)})
+		ip = nextNetwork(ip, size)
+	}
+	return networks, nil
+}
+
+// exclude returns the networks covering network except for excluded, which
+// it must contain.
+func exclude(network, excluded *net.IPNet) []*net.IPNet {
+	ones, bits := network.Mask.Size()
+	onesExcluded, _ := excluded.Mask.Size()
+	var networks []*net.IPNet
+	for length := onesExcluded; length > ones; length-- {
+		half := &net.IPNet{IP: excluded.IP.Mask(net.CIDRMask(length, bits)), Mask: net.CIDRMask(length, bits)}
+		sibling := make(net.IP, len(half.IP))
+		copy(sibling, half.IP)
+		sibling[(length-1)/8] ^= 1 << uint(7-(length-1)%8)
+		networks = append(networks, &net.IPNet{IP: sibling, Mask: half.Mask})
+	}
+	return networks
+}
+
+// find returns the network of sorted covering network, if any. The
+// networks of sorted must not overlap.
+func find(sorted []*aggregated, network *net.IPNet) *aggregated {
+	i := sort.Search(len(sorted), func(i int) bool {
+		return compareNetworks(sorted[i].network, network) > 0
+	})
+	if i > 0 && contains(sorted[i-1].network, network) {
+		return sorted[i-1]
+	}
+	return nil
+}
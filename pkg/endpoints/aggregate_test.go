@@ -0,0 +1,134 @@
+package endpoints
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAggregate(t *testing.T) {
+	var entries []*Entry
+	for i := 0; i < 4; i++ {
+		entries = append(entries, &Entry{Network: fmt.Sprintf("192.0.2.%d", i)})
+	}
+	entries = append(entries,
+		&Entry{Network: "192.0.2.5"},
+		&Entry{Network: "192.0.2.1"},
+		&Entry{Network: "198.51.100.0/25"},
+		&Entry{Network: "198.51.100.128/25"},
+		&Entry{Network: "198.51.100.7"},
+		&Entry{Network: "2001:db8::1"},
+	)
+
+	networks, truncated, err := Aggregate(entries, &Aggregation{})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, truncated)
+	assert.Equal(t, []string{"192.0.2.0/30", "192.0.2.5/32", "198.51.100.0/24", "2001:db8::1/128"}, networks)
+
+	networks, _, err = Aggregate(entries, &Aggregation{IPv4Lengths: []int{16, 24, 32}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"192.0.2.0/32", "192.0.2.1/32", "192.0.2.2/32", "192.0.2.3/32",
+		"192.0.2.5/32", "198.51.100.0/24", "2001:db8::1/128",
+	}, networks)
+
+	_, _, err = Aggregate([]*Entry{{Network: "invalid"}}, &Aggregation{})
+	assert.Error(t, err)
+}
+
+func TestAggregate_Capacity(t *testing.T) {
+	now := time.Now()
+	entries := []*Entry{
+		{Network: "192.0.2.1", Score: 10, CreatedAt: now},
+		{Network: "192.0.2.3", Score: 90, CreatedAt: now.Add(-time.Hour)},
+		{Network: "192.0.2.5", Score: 10, CreatedAt: now.Add(-time.Hour)},
+		{Network: "192.0.2.7", Score: 50, CreatedAt: now},
+	}
+	networks, truncated, err := Aggregate(entries, &Aggregation{Capacity: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, truncated)
+	assert.Equal(t, []string{"192.0.2.1/32", "192.0.2.3/32", "192.0.2.7/32"}, networks)
+}
+
+func TestAggregate_split(t *testing.T) {
+	cfg := &Aggregation{
+		IPv4Lengths: []int{16, 24, 32},
+		IPv6Lengths: []int{32, 48, 64, 128},
+		MaxSplit:    256,
+	}
+	networks, _, err := Aggregate([]*Entry{{Network: "10.0.0.0/8"}, {Network: "2001:db8::/31"}}, cfg)
+	assert.NoError(t, err)
+	assert.Len(t, networks, 258)
+	assert.Equal(t, "10.0.0.0/16", networks[0])
+	assert.Equal(t, "10.255.0.0/16", networks[255])
+	assert.Equal(t, []string{"2001:db8::/32", "2001:db9::/32"}, networks[256:])
+
+	// Networks needing more than MaxSplit networks are refused rather than
+	// truncated, including gaps too wide to count in an int.
+	for _, network := range []string{"10.0.0.0/7", "0.0.0.0/0", "2001:db8::/65", "2001:db8::/100", "::/0"} {
+		_, _, err := Aggregate([]*Entry{{Network: network}}, cfg)
+		assert.Error(t, err, network)
+	}
+
+	// Without MaxSplit the capacity bounds splits.
+	_, _, err = Aggregate([]*Entry{{Network: "192.0.2.0/29"}}, &Aggregation{Capacity: 4, IPv4Lengths: []int{32}})
+	assert.Error(t, err)
+	_, _, err = Aggregate([]*Entry{{Network: "192.0.2.0/30"}}, &Aggregation{Capacity: 4, IPv4Lengths: []int{32}})
+	assert.NoError(t, err)
+}
+
+type fakeAggregator struct {
+	fakeNetworkEndpoint
+	capacity  int
+	replaced  []string
+	unblocked []string
+}
+
+func (f *fakeAggregator) Aggregation() *Aggregation {
+	return &Aggregation{Capacity: f.capacity}
+}
+
+func (f *fakeAggregator) ReplaceNetworks(ctx context.Context, networks []string) error {
+	f.replaced = networks
+	return nil
+}
+
+func (f *fakeAggregator) UnblockNetworks(ctx context.Context, networks []string) error {
+	f.unblocked = append(f.unblocked, networks...)
+	return nil
+}
+
+func TestRegistry_SyncAggregated(t *testing.T) {
+	r := NewRegistry()
+	cf := &fakeAggregator{fakeNetworkEndpoint: fakeNetworkEndpoint{fakeEndpoint: fakeEndpoint{name: "Cloudflare"}}, capacity: 2}
+	r.Register(cf)
+	r.Register(&fakeEndpoint{name: "PowerDNS"})
+
+	results, err := r.SyncAggregated(context.Background(), []*Entry{
+		{Network: "192.0.2.0"}, {Network: "192.0.2.1"}, {Network: "192.0.2.2"}, {Network: "192.0.2.3"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"192.0.2.0/30"}, cf.replaced)
+	assert.Len(t, results, 1)
+	assert.Equal(t, 1, results["Cloudflare"].Networks)
+
+	// Covered addresses are neither synced nor blocked again.
+	assert.NoError(t, r.ExecuteOnAll(context.Background(), "192.0.2.1", "Sync"))
+	assert.NoError(t, r.ExecuteOnAll(context.Background(), "192.0.2.1", "Block"))
+	assert.Empty(t, cf.blocked)
+
+	// Unblocking a covered address keeps the rest of its network blocked.
+	assert.NoError(t, r.ExecuteOnAll(context.Background(), "192.0.2.1", "Unblock"))
+	assert.Equal(t, []string{"192.0.2.0/32", "192.0.2.2/31"}, cf.networks)
+	assert.Equal(t, []string{"192.0.2.0/30"}, cf.unblocked)
+
+	// Past capacity new addresses are truncated instead of failing.
+	assert.NoError(t, r.ExecuteOnAll(context.Background(), "198.51.100.1", "Block"))
+	assert.Empty(t, cf.blocked)
+	info, err := r.InfoOne("Cloudflare")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, info.Aggregation.Truncated)
+}
@@ -2,9 +2,20 @@ package endpoints
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"net"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+)
+
+var (
+	ErrNotFound          = errors.New("Endpoint doesn't exist")
+	ErrTargetUnsupported = errors.New("Endpoint doesn't support the target")
 )
 
 type Endpoint interface {
@@ -14,55 +25,694 @@ type Endpoint interface {
 	Unblock(ctx context.Context, ip string) error
 }
 
-var (
-	endpointsMu = new(sync.Mutex)
-	endpoints   = map[string]Endpoint{}
-)
+// HealthChecker is implemented by endpoints which are able to report
+// whether their backend is ready to accept changes.
+type HealthChecker interface {
+	HealthCheck(ctx context.Context) error
+}
 
-func ExecuteOnAll(ctx context.Context, ip, action string) error {
-	for _, endpoint := range endpoints {
-		switch action {
-		case "Block":
-			if err := endpoint.Block(ctx, ip); err != nil {
-				return errors.Wrapf(err, "Block failed on Endpoint '%s'", endpoint.Name())
+// Describer is implemented by endpoints which can summarize their
+// configuration. Secrets must be redacted.
+type Describer interface {
+	Describe() map[string]string
+}
+
+// Target is a whole autonomous system, country or network to act on instead
+// of a single address.
+type Target struct {
+	// Type is 'asn', 'country' or 'network'.
+	Type string
+
+	// Value is the AS number, e.g. 'AS64496', the ISO 3166-1 alpha-2
+	// country code, e.g. 'RU', or the network, e.g. '192.0.2.0/24'.
+	Value string
+
+	// Prefixes are the networks the target covers, for endpoints which can
+	// only block networks. They are unknown for countries.
+	Prefixes []string
+}
+
+// TargetBlocker is implemented by endpoints which block autonomous systems
+// or countries natively. Networks are always blocked through NetworkBlocker.
+type TargetBlocker interface {
+	BlockTarget(ctx context.Context, target *Target) error
+	UnblockTarget(ctx context.Context, target *Target) error
+	SyncTarget(ctx context.Context, target *Target) error
+}
+
+// NetworkBlocker is implemented by endpoints which can block whole networks
+// given in CIDR notation. Targets are expanded into their prefixes for
+// endpoints which only implement NetworkBlocker. BlockNetworks must be
+// idempotent as it's also used to sync.
+type NetworkBlocker interface {
+	BlockNetworks(ctx context.Context, networks []string) error
+	UnblockNetworks(ctx context.Context, networks []string) error
+}
+
+// Result is the outcome of the last operation or health check run on an
+// endpoint.
+type Result struct {
+	Operation string
+	IP        string `json:",omitempty"`
+	Error     string `json:",omitempty"`
+	At        time.Time
+}
+
+// Info describes a registered endpoint and its runtime state.
+type Info struct {
+	Name          string
+	Enabled       bool
+	State         string
+	Config        map[string]string
+	Queued        int
+	LastOperation *Result
+	LastHealth    *Result
+	Aggregation   *AggregationResult `json:",omitempty"`
+}
+
+// operation is either on ip or, when target is set, on a whole target.
+// Replace operations carry the networks an Aggregator must block instead.
+type operation struct {
+	ip       string
+	target   *Target
+	networks []string
+	action   string
+}
+
+func (o operation) subject() string {
+	if o.action == "Replace" {
+		return fmt.Sprintf("%d networks", len(o.networks))
+	}
+	if o.target != nil {
+		return o.target.Value
+	}
+	return o.ip
+}
+
+// state is kept per endpoint name, so that it survives Replace when an
+// endpoint is rebuilt on configuration reload.
+type state struct {
+	paused        bool
+	draining      bool
+	queue         []operation
+	lastOperation *Result
+	lastHealth    *Result
+
+	// networks are what an Aggregator was last told to block, nil until
+	// SyncAggregated first runs on it.
+	networks    []*net.IPNet
+	aggregation *AggregationResult
+}
+
+// Registry holds a set of endpoints keyed by name. It is safe for concurrent
+// use; operations run against the endpoints registered when they started,
+// so Replace never interrupts work already in flight.
+type Registry struct {
+	mu        sync.RWMutex
+	endpoints map[string]Endpoint
+	states    map[string]*state
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		endpoints: map[string]Endpoint{},
+		states:    map[string]*state{},
+	}
+}
+
+func (r *Registry) snapshot() map[string]Endpoint {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.endpoints
+}
+
+func (r *Registry) Register(endpoint Endpoint) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.endpoints[endpoint.Name()]; !ok {
+		registered := make(map[string]Endpoint, len(r.endpoints)+1)
+		for name, e := range r.endpoints {
+			registered[name] = e
+		}
+		registered[endpoint.Name()] = endpoint
+		r.endpoints = registered
+	}
+}
+
+// Replace atomically swaps all registered endpoints for the given ones.
+// Endpoints dropped by the swap are closed when they implement io.Closer, so
+// Close must wait for calls already in flight.
+func (r *Registry) Replace(list ...Endpoint) {
+	registered := make(map[string]Endpoint, len(list))
+	for _, endpoint := range list {
+		if _, ok := registered[endpoint.Name()]; !ok {
+			registered[endpoint.Name()] = endpoint
+		}
+	}
+	r.mu.Lock()
+	previous := r.endpoints
+	r.endpoints = registered
+	r.mu.Unlock()
+
+	for name, endpoint := range previous {
+		if registered[name] == endpoint {
+			continue
+		}
+		if closer, ok := endpoint.(io.Closer); ok {
+			closer.Close() // nolint
+		}
+	}
+}
+
+// Close closes the registered endpoints which implement io.Closer.
+func (r *Registry) Close() error {
+	var err error
+	for _, endpoint := range r.List() {
+		if closer, ok := endpoint.(io.Closer); ok {
+			err = multierr.Append(err, errors.Wrapf(closer.Close(), "Failed to close endpoint '%s'", endpoint.Name()))
+		}
+	}
+	return err
+}
+
+func (r *Registry) Get(name string) (Endpoint, bool) {
+	endpoint, ok := r.snapshot()[name]
+	return endpoint, ok
+}
+
+// List returns the registered endpoints ordered by name.
+func (r *Registry) List() []Endpoint {
+	registered := r.snapshot()
+	list := make([]Endpoint, 0, len(registered))
+	for _, endpoint := range registered {
+		list = append(list, endpoint)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name() < list[j].Name()
+	})
+	return list
+}
+
+// Outcome tells which endpoints an action ran on.
+type Outcome struct {
+	// Applied lists the endpoints which ran the action, and Queued the
+	// paused ones holding it until they are resumed.
+	Applied []string
+	Queued  []string
+}
+
+func (o *Outcome) add(name string, queued bool) {
+	if queued {
+		o.Queued = append(o.Queued, name)
+	} else {
+		o.Applied = append(o.Applied, name)
+	}
+}
+
+func (r *Registry) ExecuteOnAll(ctx context.Context, ip, action string) error {
+	_, err := r.Apply(ctx, ip, action)
+	return err
+}
+
+// Apply runs action for ip on every endpoint like ExecuteOnAll, and tells
+// which endpoints it ran on, up to the one which failed.
+func (r *Registry) Apply(ctx context.Context, ip, action string) (*Outcome, error) {
+	outcome := &Outcome{}
+	for _, endpoint := range r.List() {
+		queued, err := r.execute(ctx, endpoint, operation{ip: ip, action: action})
+		if err != nil {
+			return outcome, err
+		}
+		outcome.add(endpoint.Name(), queued)
+	}
+	return outcome, nil
+}
+
+func (r *Registry) ExecuteOnOne(ctx context.Context, ip, action, name string) error {
+	if endpoint, ok := r.Get(name); ok {
+		_, err := r.execute(ctx, endpoint, operation{ip: ip, action: action})
+		return err
+	}
+	return nil
+}
+
+// ExecuteTargetOnAll runs action for target on every endpoint which supports
+// it, natively or through its prefixes. Endpoints which don't are skipped,
+// but blocking fails with ErrTargetUnsupported when no endpoint could.
+func (r *Registry) ExecuteTargetOnAll(ctx context.Context, target *Target, action string) error {
+	_, err := r.ApplyTarget(ctx, target, action)
+	return err
+}
+
+// ApplyTarget runs action for target like ExecuteTargetOnAll, and tells
+// which endpoints it ran on.
+func (r *Registry) ApplyTarget(ctx context.Context, target *Target, action string) (*Outcome, error) {
+	list := r.List()
+	outcome := &Outcome{}
+	for _, endpoint := range list {
+		queued, err := r.execute(ctx, endpoint, operation{target: target, action: action})
+		if err == ErrTargetUnsupported {
+			continue
+		}
+		if err != nil {
+			return outcome, err
+		}
+		outcome.add(endpoint.Name(), queued)
+	}
+	if action == "Block" && len(outcome.Applied)+len(outcome.Queued) == 0 && len(list) > 0 {
+		return outcome, ErrTargetUnsupported
+	}
+	return outcome, nil
+}
+
+// SyncAggregated pushes entries, collapsed by Aggregate, to every endpoint
+// with aggregation enabled, replacing whatever addresses and networks they
+// blocked before. Endpoints which can't hold every network are reported as
+// truncated rather than failing.
+func (r *Registry) SyncAggregated(ctx context.Context, entries []*Entry) (map[string]*AggregationResult, error) {
+	results := map[string]*AggregationResult{}
+	for _, endpoint := range r.List() {
+		cfg := aggregation(endpoint)
+		if cfg == nil {
+			continue
+		}
+		networks, truncated, err := Aggregate(entries, cfg)
+		if err != nil {
+			return results, err
+		}
+		result := &AggregationResult{
+			Entries:   len(entries),
+			Networks:  len(networks),
+			Truncated: truncated,
+			At:        time.Now(),
+		}
+		if _, err := r.execute(ctx, endpoint, operation{networks: networks, action: "Replace"}); err != nil {
+			return results, err
+		}
+		parsed := make([]*net.IPNet, 0, len(networks))
+		for _, network := range networks {
+			n, _ := parseNetwork(network)
+			parsed = append(parsed, n)
+		}
+		r.record(endpoint.Name(), func(s *state) {
+			s.networks = parsed
+			s.aggregation = result
+		})
+		results[endpoint.Name()] = result
+	}
+	return results, nil
+}
+
+// HealthCheck runs the health check of the named endpoint. It reports false
+// when the endpoint doesn't exist or doesn't support health checks.
+func (r *Registry) HealthCheck(ctx context.Context, name string) (bool, error) {
+	endpoint, ok := r.Get(name)
+	if !ok {
+		return false, nil
+	}
+	hc, ok := endpoint.(HealthChecker)
+	if !ok {
+		return false, nil
+	}
+	err := hc.HealthCheck(ctx)
+	r.record(name, func(s *state) {
+		s.lastHealth = newResult("HealthCheck", "", err)
+	})
+	return true, err
+}
+
+func (r *Registry) HealthCheckOnAll(ctx context.Context) map[string]error {
+	results := map[string]error{}
+	for _, endpoint := range r.List() {
+		if ok, err := r.HealthCheck(ctx, endpoint.Name()); ok {
+			results[endpoint.Name()] = err
+		}
+	}
+	return results
+}
+
+// Info returns the description and runtime state of every registered
+// endpoint, ordered by name.
+func (r *Registry) Info() []*Info {
+	list := r.List()
+	infos := make([]*Info, 0, len(list))
+	for _, endpoint := range list {
+		infos = append(infos, r.info(endpoint))
+	}
+	return infos
+}
+
+func (r *Registry) InfoOne(name string) (*Info, error) {
+	endpoint, ok := r.Get(name)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return r.info(endpoint), nil
+}
+
+// Pause stops sending operations to the endpoint. Operations issued while
+// it is paused are queued and replayed in order by Resume.
+func (r *Registry) Pause(name string) error {
+	if _, ok := r.Get(name); !ok {
+		return ErrNotFound
+	}
+	r.record(name, func(s *state) {
+		s.paused = true
+	})
+	return nil
+}
+
+// Resume replays every queued operation and then lets new operations reach
+// the endpoint again. If an operation fails the endpoint stays paused with
+// the failed operation at the head of the queue.
+func (r *Registry) Resume(ctx context.Context, name string) error {
+	endpoint, ok := r.Get(name)
+	if !ok {
+		return ErrNotFound
+	}
+
+	r.mu.Lock()
+	s := r.state(name)
+	if s.draining {
+		r.mu.Unlock()
+		return errors.Errorf("Endpoint '%s' is already being resumed", name)
+	}
+	s.draining = true
+	r.mu.Unlock()
+
+	defer func() {
+		r.mu.Lock()
+		s.draining = false
+		r.mu.Unlock()
+	}()
+
+	for {
+		r.mu.Lock()
+		if len(s.queue) == 0 {
+			s.paused = false
+			r.mu.Unlock()
+			return nil
+		}
+		op := s.queue[0]
+		r.mu.Unlock()
+
+		err := execute(ctx, endpoint, op)
+		r.mu.Lock()
+		s.lastOperation = newResult(op.action, op.subject(), err)
+		if err == nil {
+			s.queue = s.queue[1:]
+		}
+		r.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (r *Registry) info(endpoint Endpoint) *Info {
+	info := &Info{
+		Name:    endpoint.Name(),
+		Enabled: true,
+		State:   "active",
+	}
+	if d, ok := endpoint.(Describer); ok {
+		info.Config = d.Describe()
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if s, ok := r.states[endpoint.Name()]; ok {
+		if s.paused {
+			info.Enabled = false
+			info.State = "paused"
+		}
+		info.Queued = len(s.queue)
+		info.LastOperation = s.lastOperation
+		info.LastHealth = s.lastHealth
+		info.Aggregation = s.aggregation
+	}
+	return info
+}
+
+// state returns the state for name, creating it if needed. The caller must
+// hold r.mu for writing.
+func (r *Registry) state(name string) *state {
+	s, ok := r.states[name]
+	if !ok {
+		s = &state{}
+		r.states[name] = s
+	}
+	return s
+}
+
+func (r *Registry) record(name string, fn func(s *state)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fn(r.state(name))
+}
+
+// execute runs op on endpoint, or queues it while the endpoint is paused,
+// and tells whether it was queued.
+func (r *Registry) execute(ctx context.Context, endpoint Endpoint, op operation) (bool, error) {
+	if op.target != nil && !supports(endpoint, op.target) {
+		return false, ErrTargetUnsupported
+	}
+	ops := []operation{op}
+	if cfg := aggregation(endpoint); cfg != nil {
+		var err error
+		if ops, err = r.aggregate(endpoint.Name(), cfg, op); err != nil {
+			return false, err
+		}
+	}
+	held := false
+	for _, op := range ops {
+		queued := false
+		r.record(endpoint.Name(), func(s *state) {
+			if s.paused {
+				s.queue = append(s.queue, op)
+				queued = true
 			}
-		case "Unblock":
-			if err := endpoint.Unblock(ctx, ip); err != nil {
-				return errors.Wrapf(err, "Unblock failed on Endpoint '%s'", endpoint.Name())
+		})
+		if queued {
+			held = true
+			continue
+		}
+		err := execute(ctx, endpoint, op)
+		r.record(endpoint.Name(), func(s *state) {
+			s.lastOperation = newResult(op.action, op.subject(), err)
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+	return held, nil
+}
+
+// aggregate rewrites an operation on a single address or network for an
+// endpoint which holds the aggregated set:
+//
+//   - syncing is left to SyncAggregated, which may have truncated the set;
+//   - blocking what's already covered, or anything once the capacity is
+//     reached, does nothing until the next SyncAggregated;
+//   - unblocking what's covered by a wider network replaces that network by
+//     the networks covering the rest of it, so nothing stays over-blocked.
+//
+// Networks which would be split into more networks than the endpoint allows
+// are refused. Operations on other targets are returned unchanged.
+func (r *Registry) aggregate(name string, cfg *Aggregation, op operation) ([]operation, error) {
+	subject := op.ip
+	if op.target != nil {
+		if op.target.Type != "network" {
+			return []operation{op}, nil
+		}
+		subject = op.target.Value
+	}
+	network, err := parseNetwork(subject)
+	if err != nil || op.action == "Replace" {
+		return []operation{op}, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.state(name)
+	if s.networks == nil {
+		return []operation{op}, nil
+	}
+	switch op.action {
+	case "Sync":
+		return nil, nil
+	case "Block":
+		for _, n := range s.networks {
+			if contains(n, network) {
+				return nil, nil
 			}
-		case "Sync":
-			if err := endpoint.Sync(ctx, ip); err != nil {
-				return errors.Wrapf(err, "Sync failed on Endpoint '%s'", endpoint.Name())
+		}
+		if cfg.Capacity > 0 && len(s.networks) >= cfg.Capacity {
+			if s.aggregation != nil {
+				s.aggregation.Truncated++
 			}
+			return nil, nil
+		}
+		splits, err := cfg.split(network)
+		if err != nil {
+			return nil, err
 		}
+		s.networks = append(s.networks, splits...)
+	case "Unblock":
+		for i, n := range s.networks {
+			if !contains(n, network) || compareNetworks(n, network) == 0 {
+				continue
+			}
+			var rest []*net.IPNet
+			for _, e := range exclude(n, network) {
+				splits, err := cfg.split(e)
+				if err != nil {
+					return nil, err
+				}
+				rest = append(rest, splits...)
+			}
+			s.networks = append(append(s.networks[:i:i], s.networks[i+1:]...), rest...)
+			prefixes := make([]string, 0, len(rest))
+			for _, e := range rest {
+				prefixes = append(prefixes, e.String())
+			}
+			return []operation{
+				{target: &Target{Type: "network", Value: n.String(), Prefixes: prefixes}, action: "Block"},
+				{target: &Target{Type: "network", Value: n.String(), Prefixes: []string{n.String()}}, action: "Unblock"},
+			}, nil
+		}
+		kept := s.networks[:0:0]
+		for _, n := range s.networks {
+			if !contains(network, n) {
+				kept = append(kept, n)
+			}
+		}
+		s.networks = kept
+	}
+	return []operation{op}, nil
+}
+
+// aggregation returns the aggregation settings of endpoint, or nil when it
+// doesn't aggregate.
+func aggregation(endpoint Endpoint) *Aggregation {
+	if aggregator, ok := endpoint.(Aggregator); ok {
+		return aggregator.Aggregation()
 	}
 	return nil
 }
 
-func ExecuteOnOne(ctx context.Context, ip, action, name string) error {
-	if endpoint, ok := endpoints[name]; ok {
+// supports tells whether endpoint can act on target, either natively or by
+// blocking the prefixes of the target.
+func supports(endpoint Endpoint, target *Target) bool {
+	if _, ok := endpoint.(TargetBlocker); ok && target.Type != "network" {
+		return true
+	}
+	_, ok := endpoint.(NetworkBlocker)
+	return ok && len(target.Prefixes) > 0
+}
+
+func execute(ctx context.Context, endpoint Endpoint, op operation) error {
+	if op.action == "Replace" {
+		aggregator, ok := endpoint.(Aggregator)
+		if !ok {
+			return nil
+		}
+		if err := aggregator.ReplaceNetworks(ctx, op.networks); err != nil {
+			return errors.Wrapf(err, "Replace failed on Endpoint '%s'", endpoint.Name())
+		}
+		return nil
+	}
+	if op.target != nil {
+		return executeTarget(ctx, endpoint, op.target, op.action)
+	}
+	ip, action := op.ip, op.action
+	switch action {
+	case "Block":
+		if err := endpoint.Block(ctx, ip); err != nil {
+			return errors.Wrapf(err, "Block failed on Endpoint '%s'", endpoint.Name())
+		}
+	case "Unblock":
+		if err := endpoint.Unblock(ctx, ip); err != nil {
+			return errors.Wrapf(err, "Unblock failed on Endpoint '%s'", endpoint.Name())
+		}
+	case "Sync":
+		if err := endpoint.Sync(ctx, ip); err != nil {
+			return errors.Wrapf(err, "Sync failed on Endpoint '%s'", endpoint.Name())
+		}
+	}
+	return nil
+}
+
+func executeTarget(ctx context.Context, endpoint Endpoint, target *Target, action string) error {
+	var err error
+	if tb, ok := endpoint.(TargetBlocker); ok && target.Type != "network" {
 		switch action {
 		case "Block":
-			if err := endpoint.Block(ctx, ip); err != nil {
-				return errors.Wrapf(err, "Block failed on Endpoint '%s'", endpoint.Name())
-			}
+			err = tb.BlockTarget(ctx, target)
 		case "Unblock":
-			if err := endpoint.Unblock(ctx, ip); err != nil {
-				return errors.Wrapf(err, "Unblock failed on Endpoint '%s'", endpoint.Name())
-			}
+			err = tb.UnblockTarget(ctx, target)
 		case "Sync":
-			if err := endpoint.Sync(ctx, ip); err != nil {
-				return errors.Wrapf(err, "Sync failed on Endpoint '%s'", endpoint.Name())
-			}
+			err = tb.SyncTarget(ctx, target)
+		}
+	} else if nb, ok := endpoint.(NetworkBlocker); ok && len(target.Prefixes) > 0 {
+		switch action {
+		case "Block", "Sync":
+			err = nb.BlockNetworks(ctx, target.Prefixes)
+		case "Unblock":
+			err = nb.UnblockNetworks(ctx, target.Prefixes)
 		}
+	} else {
+		return ErrTargetUnsupported
+	}
+	if err != nil {
+		return errors.Wrapf(err, "%s failed on Endpoint '%s'", action, endpoint.Name())
 	}
 	return nil
 }
 
-func Register(endpoint Endpoint) {
-	endpointsMu.Lock()
-	defer endpointsMu.Unlock()
-	if _, ok := endpoints[endpoint.Name()]; !ok {
-		endpoints[endpoint.Name()] = endpoint
+func newResult(operation, ip string, err error) *Result {
+	result := &Result{
+		Operation: operation,
+		IP:        ip,
+		At:        time.Now(),
 	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+var defaultRegistry = NewRegistry()
+
+// Default returns the process-wide registry used by the package functions.
+func Default() *Registry {
+	return defaultRegistry
+}
+
+func ExecuteOnAll(ctx context.Context, ip, action string) error {
+	return defaultRegistry.ExecuteOnAll(ctx, ip, action)
+}
+
+func ExecuteOnOne(ctx context.Context, ip, action, name string) error {
+	return defaultRegistry.ExecuteOnOne(ctx, ip, action, name)
+}
+
+func ExecuteTargetOnAll(ctx context.Context, target *Target, action string) error {
+	return defaultRegistry.ExecuteTargetOnAll(ctx, target, action)
+}
+
+func SyncAggregated(ctx context.Context, entries []*Entry) (map[string]*AggregationResult, error) {
+	return defaultRegistry.SyncAggregated(ctx, entries)
+}
+
+func HealthCheckOnAll(ctx context.Context) map[string]error {
+	return defaultRegistry.HealthCheckOnAll(ctx)
+}
+
+func Register(endpoint Endpoint) {
+	defaultRegistry.Register(endpoint)
+}
+
+// Replace atomically swaps all endpoints of the default registry.
+func Replace(list ...Endpoint) {
+	defaultRegistry.Replace(list...)
 }
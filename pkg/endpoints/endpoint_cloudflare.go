@@ -3,56 +3,308 @@ package endpoints
 import (
 	"context"
 	"fmt"
-	"os"
+	"net"
+	"strconv"
+	"strings"
 
 	"github.com/cloudflare/cloudflare-go"
 	"github.com/hostinger/hbl/pkg/logger"
+	"github.com/hostinger/hbl/pkg/utils"
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
 	"go.uber.org/zap"
 )
 
+type CloudflareConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Account string `mapstructure:"account"`
+	Email   string `mapstructure:"email"`
+	Key     string `mapstructure:"key"`
+
+	// Aggregate collapses blocked addresses into covering ranges on sync,
+	// keeping at most Capacity rules when it's set.
+	Aggregate bool `mapstructure:"aggregate"`
+	Capacity  int  `mapstructure:"capacity"`
+}
+
+func (c *CloudflareConfig) Validate() error {
+	var err error
+	if strings.TrimSpace(c.Account) == "" {
+		err = multierr.Append(err, errors.New("Field 'account' must not be empty"))
+	}
+	if strings.TrimSpace(c.Email) == "" {
+		err = multierr.Append(err, errors.New("Field 'email' must not be empty"))
+	}
+	if strings.TrimSpace(c.Key) == "" {
+		err = multierr.Append(err, errors.New("Field 'key' must not be empty"))
+	}
+	if c.Capacity < 0 {
+		err = multierr.Append(err, errors.New("Field 'capacity' must not be negative"))
+	}
+	return err
+}
+
 type cloudflareEndpoint struct {
 	l       logger.Logger
 	client  *cloudflare.API
 	account string
 	email   string
 	key     string
+
+	aggregate bool
+	capacity  int
 }
 
-func NewCloudflareEndpoint(l logger.Logger) Endpoint {
+func NewCloudflareEndpoint(l logger.Logger, cfg *CloudflareConfig) (Endpoint, error) {
 	l.Info("Starting execution of NewCloudflareEndpoint", zap.String("endpoint", "Cloudflare"))
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
 	e := &cloudflareEndpoint{
-		account: os.Getenv("CF_API_ACCOUNT"),
-		email:   os.Getenv("CF_API_EMAIL"),
-		key:     os.Getenv("CF_API_KEY"),
+		account: cfg.Account,
+		email:   cfg.Email,
+		key:     cfg.Key,
 		l:       l,
+
+		aggregate: cfg.Aggregate,
+		capacity:  cfg.Capacity,
 	}
 	api, err := cloudflare.New(e.key, e.email)
 	if err != nil {
-		l.Fatal(
-			"Failed to initialize Cloudflare API client",
-			zap.String("endpoint", "Cloudflare"),
-			zap.Error(err),
-		)
+		return nil, errors.Wrap(err, "Failed to initialize Cloudflare API client")
 	}
 	e.client = api
 	l.Info("Finished execution of NewCloudflareEndpoint", zap.String("endpoint", "Cloudflare"))
-	return e
+	return e, nil
 }
 
 func (c *cloudflareEndpoint) Name() string {
 	return "Cloudflare"
 }
 
+func (c *cloudflareEndpoint) Describe() map[string]string {
+	return map[string]string{
+		"account":   c.account,
+		"email":     c.email,
+		"key":       utils.Redact(c.key),
+		"aggregate": strconv.FormatBool(c.aggregate),
+		"capacity":  strconv.Itoa(c.capacity),
+	}
+}
+
 func (c *cloudflareEndpoint) Block(ctx context.Context, ip string) error {
-	rule := cloudflare.AccessRule{
+	return c.CreateRule(ctx, "ip", ip)
+}
+
+func (c *cloudflareEndpoint) Unblock(ctx context.Context, ip string) error {
+	return c.DeleteRule(ctx, "ip", ip)
+}
+
+func (c *cloudflareEndpoint) Exists(ctx context.Context, ip string) error {
+	return c.FindRule(ctx, "ip", ip)
+}
+
+func (c *cloudflareEndpoint) Sync(ctx context.Context, ip string) error {
+	if err := c.Exists(ctx, ip); err != nil {
+		return c.Block(ctx, ip)
+	}
+	return nil
+}
+
+// BlockTarget creates an access rule for a whole ASN or country, which
+// Cloudflare supports natively.
+func (c *cloudflareEndpoint) BlockTarget(ctx context.Context, target *Target) error {
+	return c.CreateRule(ctx, target.Type, target.Value)
+}
+
+func (c *cloudflareEndpoint) UnblockTarget(ctx context.Context, target *Target) error {
+	return c.DeleteRule(ctx, target.Type, target.Value)
+}
+
+func (c *cloudflareEndpoint) SyncTarget(ctx context.Context, target *Target) error {
+	if err := c.FindRule(ctx, target.Type, target.Value); err != nil {
+		return c.BlockTarget(ctx, target)
+	}
+	return nil
+}
+
+// BlockNetworks creates access rules for networks, split into the ranges
+// Cloudflare accepts, see cloudflareRanges.
+func (c *cloudflareEndpoint) BlockNetworks(ctx context.Context, networks []string) error {
+	for _, network := range networks {
+		ranges, err := cloudflareRanges(network)
+		if err != nil {
+			return err
+		}
+		for _, r := range ranges {
+			if err := c.FindRule(ctx, r.target, r.value); err == nil {
+				continue
+			}
+			if err := c.CreateRule(ctx, r.target, r.value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *cloudflareEndpoint) UnblockNetworks(ctx context.Context, networks []string) error {
+	for _, network := range networks {
+		ranges, err := cloudflareRanges(network)
+		if err != nil {
+			return err
+		}
+		for _, r := range ranges {
+			if err := c.DeleteRule(ctx, r.target, r.value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Aggregation collapses addresses into the ranges access rules accept, see
+// cloudflareRanges.
+func (c *cloudflareEndpoint) Aggregation() *Aggregation {
+	if !c.aggregate {
+		return nil
+	}
+	return &Aggregation{
+		Capacity:    c.capacity,
+		IPv4Lengths: []int{16, 24, 32},
+		IPv6Lengths: []int{32, 48, 64, 128},
+		MaxSplit:    cloudflareMaxRanges,
+	}
+}
+
+// ReplaceNetworks creates the rules networks are missing and deletes every
+// other address or range rule created by HBL.
+func (c *cloudflareEndpoint) ReplaceNetworks(ctx context.Context, networks []string) error {
+	wanted := map[cloudflareRange]bool{}
+	for _, network := range networks {
+		ranges, err := cloudflareRanges(network)
+		if err != nil {
+			return err
+		}
+		for _, r := range ranges {
+			wanted[r] = true
+		}
+	}
+	existing := map[cloudflareRange]string{}
+	for _, target := range []string{"ip", "ip_range"} {
+		rules, err := c.ListRules(ctx, target)
+		if err != nil {
+			return err
+		}
+		for _, rule := range rules {
+			existing[cloudflareRange{target: target, value: rule.Configuration.Value}] = rule.ID
+		}
+	}
+	for r := range wanted {
+		if _, ok := existing[r]; ok {
+			continue
+		}
+		if err := c.CreateRule(ctx, r.target, r.value); err != nil {
+			return err
+		}
+	}
+	for r, id := range existing {
+		if wanted[r] {
+			continue
+		}
+		response, err := c.client.DeleteAccountAccessRule(ctx, c.account, id)
+		if err != nil || !response.Success {
+			c.l.Error(
+				"Failed to execute DeleteAccountAccessRule",
+				zap.String("endpoint", "Cloudflare"),
+				zap.Error(err),
+			)
+			return err
+		}
+	}
+	return nil
+}
+
+type cloudflareRange struct {
+	target string
+	value  string
+}
+
+// cloudflareMaxRanges bounds how many rules a single network may be split
+// into.
+const cloudflareMaxRanges = 256
+
+// cloudflareRanges splits network into the ranges access rules accept:
+// /16 and /24 for IPv4 and /32, /48 and /64 for IPv6. Narrower networks are
+// split into single addresses.
+func cloudflareRanges(network string) ([]cloudflareRange, error) {
+	_, ipnet, err := net.ParseCIDR(network)
+	if err != nil {
+		return nil, errors.Errorf("Network '%s' must be in CIDR notation", network)
+	}
+	ones, bits := ipnet.Mask.Size()
+	allowed := []int{16, 24, 32}
+	if bits == 128 {
+		allowed = []int{32, 48, 64, 128}
+	}
+	size := bits
+	for _, length := range allowed {
+		if length >= ones {
+			size = length
+			break
+		}
+	}
+	if size-ones > 8 || 1<<uint(size-ones) > cloudflareMaxRanges {
+		return nil, errors.Errorf("Network '%s' needs more than %d rules", network, cloudflareMaxRanges)
+	}
+	ranges := make([]cloudflareRange, 0, 1<<uint(size-ones))
+	ip := ipnet.IP
+	for i := 0; i < 1<<uint(size-ones); i++ {
+		if size == bits {
+			ranges = append(ranges, cloudflareRange{target: "ip", value: ip.String()})
+		} else {
+			ranges = append(ranges, cloudflareRange{target: "ip_range", value: fmt.Sprintf("%s/%d", ip, size)})
+		}
+		ip = nextNetwork(ip, size)
+	}
+	return ranges, nil
+}
+
+// nextNetwork returns the first address of the network of length ones that
+// follows the one ip belongs to.
+func nextNetwork(ip net.IP, ones int) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	i := ones - 1
+	for byteIndex := i / 8; byteIndex >= 0; byteIndex-- {
+		shift := uint(7 - i%8)
+		if byteIndex != i/8 {
+			shift = 0
+		}
+		sum := uint(next[byteIndex]) + 1<<shift
+		next[byteIndex] = byte(sum)
+		if sum < 256 {
+			break
+		}
+	}
+	return next
+}
+
+func newCloudflareRule(target, value string) cloudflare.AccessRule {
+	return cloudflare.AccessRule{
 		Mode: "block",
 		Configuration: cloudflare.AccessRuleConfiguration{
-			Target: "ip",
-			Value:  ip,
+			Target: target,
+			Value:  value,
 		},
 		Notes: "Created automatically by HBL API.",
 	}
-	response, err := c.client.CreateAccountAccessRule(ctx, c.account, rule)
+}
+
+// CreateRule creates a blocking access rule, target being one of 'ip',
+// 'asn' or 'country'.
+func (c *cloudflareEndpoint) CreateRule(ctx context.Context, target, value string) error {
+	response, err := c.client.CreateAccountAccessRule(ctx, c.account, newCloudflareRule(target, value))
 	if err != nil || !response.Success {
 		c.l.Error(
 			"Failed to execute CreateAccountAccessRule",
@@ -64,16 +316,8 @@ func (c *cloudflareEndpoint) Block(ctx context.Context, ip string) error {
 	return nil
 }
 
-func (c *cloudflareEndpoint) Unblock(ctx context.Context, ip string) error {
-	rule := cloudflare.AccessRule{
-		Mode: "block",
-		Configuration: cloudflare.AccessRuleConfiguration{
-			Target: "ip",
-			Value:  ip,
-		},
-		Notes: "Created automatically by HBL API.",
-	}
-	rules, err := c.client.ListAccountAccessRules(ctx, c.account, rule, 1)
+func (c *cloudflareEndpoint) DeleteRule(ctx context.Context, target, value string) error {
+	rules, err := c.client.ListAccountAccessRules(ctx, c.account, newCloudflareRule(target, value), 1)
 	if err != nil {
 		c.l.Error(
 			"Failed to execute ListAccountAccessRules",
@@ -83,7 +327,7 @@ func (c *cloudflareEndpoint) Unblock(ctx context.Context, ip string) error {
 		return err
 	}
 	if rules.Count <= 0 || rules.Count > 1 {
-		return fmt.Errorf("AccessRule for IP address '%s' was not found. ", ip)
+		return fmt.Errorf("AccessRule for %s '%s' was not found. ", target, value)
 	}
 	response, err := c.client.DeleteAccountAccessRule(ctx, c.account, rules.Result[0].ID)
 	if err != nil || !response.Success {
@@ -97,16 +341,28 @@ func (c *cloudflareEndpoint) Unblock(ctx context.Context, ip string) error {
 	return nil
 }
 
-func (c *cloudflareEndpoint) Exists(ctx context.Context, ip string) error {
-	rule := cloudflare.AccessRule{
-		Mode: "block",
-		Configuration: cloudflare.AccessRuleConfiguration{
-			Target: "ip",
-			Value:  ip,
-		},
-		Notes: "Created automatically by HBL API.",
+// ListRules returns every blocking access rule for target created by HBL.
+func (c *cloudflareEndpoint) ListRules(ctx context.Context, target string) ([]cloudflare.AccessRule, error) {
+	var rules []cloudflare.AccessRule
+	for page := 1; ; page++ {
+		response, err := c.client.ListAccountAccessRules(ctx, c.account, newCloudflareRule(target, ""), page)
+		if err != nil {
+			c.l.Error(
+				"Failed to execute ListAccountAccessRules",
+				zap.String("endpoint", "Cloudflare"),
+				zap.Error(err),
+			)
+			return nil, err
+		}
+		rules = append(rules, response.Result...)
+		if page >= response.TotalPages {
+			return rules, nil
+		}
 	}
-	rules, err := c.client.ListAccountAccessRules(ctx, c.account, rule, 1)
+}
+
+func (c *cloudflareEndpoint) FindRule(ctx context.Context, target, value string) error {
+	rules, err := c.client.ListAccountAccessRules(ctx, c.account, newCloudflareRule(target, value), 1)
 	if err != nil {
 		c.l.Error(
 			"Failed to execute ListAccountAccessRules",
@@ -116,14 +372,7 @@ func (c *cloudflareEndpoint) Exists(ctx context.Context, ip string) error {
 		return err
 	}
 	if rules.Count <= 0 || rules.Count > 1 {
-		return fmt.Errorf("Address '%s' doesn't exist", ip)
-	}
-	return nil
-}
-
-func (c *cloudflareEndpoint) Sync(ctx context.Context, ip string) error {
-	if err := c.Exists(ctx, ip); err != nil {
-		return c.Block(ctx, ip)
+		return fmt.Errorf("AccessRule for %s '%s' doesn't exist", target, value)
 	}
 	return nil
 }
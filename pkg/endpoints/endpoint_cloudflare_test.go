@@ -0,0 +1,37 @@
+package endpoints
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_cloudflareRanges(t *testing.T) {
+	ranges, err := cloudflareRanges("192.0.2.0/24")
+	assert.NoError(t, err)
+	assert.Equal(t, []cloudflareRange{{target: "ip_range", value: "192.0.2.0/24"}}, ranges)
+
+	ranges, err = cloudflareRanges("198.51.254.0/23")
+	assert.NoError(t, err)
+	assert.Equal(t, []cloudflareRange{
+		{target: "ip_range", value: "198.51.254.0/24"},
+		{target: "ip_range", value: "198.51.255.0/24"},
+	}, ranges)
+
+	ranges, err = cloudflareRanges("203.0.113.254/31")
+	assert.NoError(t, err)
+	assert.Equal(t, []cloudflareRange{
+		{target: "ip", value: "203.0.113.254"},
+		{target: "ip", value: "203.0.113.255"},
+	}, ranges)
+
+	ranges, err = cloudflareRanges("2001:db8::/63")
+	assert.NoError(t, err)
+	assert.Equal(t, []cloudflareRange{
+		{target: "ip_range", value: "2001:db8::/64"},
+		{target: "ip_range", value: "2001:db8:0:1::/64"},
+	}, ranges)
+
+	_, err = cloudflareRanges("10.0.0.0/7")
+	assert.Error(t, err)
+}
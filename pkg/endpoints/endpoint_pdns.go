@@ -8,43 +8,141 @@ import (
 	"io/ioutil"
 	"net"
 	"net/http"
-	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/hostinger/hbl/pkg/logger"
 	"github.com/hostinger/hbl/pkg/utils"
 	"github.com/pkg/errors"
+	"go.uber.org/multierr"
 	"go.uber.org/zap"
 )
 
+type PDNSConfig struct {
+	Enabled         bool     `mapstructure:"enabled"`
+	Scheme          string   `mapstructure:"scheme"`
+	Host            string   `mapstructure:"host"`
+	Port            string   `mapstructure:"port"`
+	Key             string   `mapstructure:"key"`
+	Zone            string   `mapstructure:"zone"`
+	ZoneCreate      bool     `mapstructure:"zone_create"`
+	ZoneNameservers []string `mapstructure:"zone_nameservers"`
+	ZoneHostmaster  string   `mapstructure:"zone_hostmaster"`
+}
+
+func (c *PDNSConfig) Validate() error {
+	var err error
+	if c.Scheme != "http" && c.Scheme != "https" {
+		err = multierr.Append(err, errors.New("Field 'scheme' must be either 'http' or 'https'"))
+	}
+	if strings.TrimSpace(c.Host) == "" {
+		err = multierr.Append(err, errors.New("Field 'host' must not be empty"))
+	}
+	if strings.TrimSpace(c.Port) == "" {
+		err = multierr.Append(err, errors.New("Field 'port' must not be empty"))
+	}
+	if strings.TrimSpace(c.Key) == "" {
+		err = multierr.Append(err, errors.New("Field 'key' must not be empty"))
+	}
+	if strings.TrimSpace(c.Zone) == "" {
+		err = multierr.Append(err, errors.New("Field 'zone' must not be empty"))
+	}
+	if c.ZoneCreate && len(c.ZoneNameservers) == 0 {
+		err = multierr.Append(err, errors.New("Field 'zone_nameservers' must not be empty when 'zone_create' is set"))
+	}
+	if c.ZoneCreate && strings.TrimSpace(c.ZoneHostmaster) == "" {
+		err = multierr.Append(err, errors.New("Field 'zone_hostmaster' must not be empty when 'zone_create' is set"))
+	}
+	return err
+}
+
 type pdnsEndpoint struct {
-	l       logger.Logger
-	client  *http.Client
-	baseURL string
-	scheme  string
-	zone    string
-	host    string
-	port    string
-	key     string
+	l           logger.Logger
+	client      *http.Client
+	baseURL     string
+	scheme      string
+	zone        string
+	host        string
+	port        string
+	key         string
+	create      bool
+	nameservers []string
+	hostmaster  string
+
+	// zoneErr is why the zone couldn't be verified or created at startup.
+	zoneMu  sync.Mutex
+	zoneErr error
 }
 
-func NewPDNSEndpoint(l logger.Logger) Endpoint {
+type pdnsRecord struct {
+	Content  string `json:"content"`
+	Disabled bool   `json:"disabled"`
+}
+
+type pdnsRRSet struct {
+	Records    []pdnsRecord `json:"records"`
+	ChangeType string       `json:"changetype,omitempty"`
+	Name       string       `json:"name"`
+	Type       string       `json:"type"`
+	TTL        int          `json:"ttl"`
+}
+
+type pdnsZone struct {
+	Name       string      `json:"name,omitempty"`
+	Kind       string      `json:"kind,omitempty"`
+	SOAEdit    string      `json:"soa_edit,omitempty"`
+	SOAEditAPI string      `json:"soa_edit_api,omitempty"`
+	RRSets     []pdnsRRSet `json:"rrsets"`
+}
+
+// pdnsAPIError is returned by Call when PowerDNS answers with an unexpected
+// status code, so callers can tell a missing zone apart from other failures.
+type pdnsAPIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *pdnsAPIError) Error() string {
+	return fmt.Sprintf("Unknown response from API: %s", e.Body)
+}
+
+func NewPDNSEndpoint(l logger.Logger, cfg *PDNSConfig) (Endpoint, error) {
 	l.Info("Starting execution of NewPDNSEndpoint", zap.String("endpoint", "PowerDNS"))
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
 	c := &pdnsEndpoint{
 		client: &http.Client{
 			Timeout: 10 * time.Second,
 		},
-		scheme: os.Getenv("PDNS_API_SCHEME"),
-		zone:   os.Getenv("PDNS_API_ZONE"),
-		host:   os.Getenv("PDNS_API_HOST"),
-		port:   os.Getenv("PDNS_API_PORT"),
-		key:    os.Getenv("PDNS_API_KEY"),
-		l:      l,
+		scheme:      cfg.Scheme,
+		zone:        cfg.Zone,
+		host:        cfg.Host,
+		port:        cfg.Port,
+		key:         cfg.Key,
+		create:      cfg.ZoneCreate,
+		nameservers: cfg.ZoneNameservers,
+		hostmaster:  cfg.ZoneHostmaster,
+		l:           l,
 	}
 	c.baseURL = fmt.Sprintf("%s://%s:%s/api/v1/servers/localhost", c.scheme, c.host, c.port)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := c.EnsureZone(ctx); err != nil {
+		l.Error(
+			"Failed to verify PowerDNS zone",
+			zap.String("endpoint", "PowerDNS"),
+			zap.String("zone", c.zone),
+			zap.Error(err),
+		)
+		// The endpoint is unhealthy, so readiness reports it, until a
+		// health check manages to verify the zone.
+		c.zoneErr = err
+	}
 	l.Info("Finished execution of NewPDNSEndpoint", zap.String("endpoint", "PowerDNS"))
-	return c
+	return c, nil
 }
 
 func (c *pdnsEndpoint) Call(ctx context.Context, uri, method string, code int, data interface{}) ([]byte, error) {
@@ -95,36 +193,22 @@ func (c *pdnsEndpoint) Call(ctx context.Context, uri, method string, code int, d
 			zap.String("endpoint", "PowerDNS"),
 			zap.String("error", string(body)),
 		)
-		return nil, errors.Errorf("Unknown response from API: %s", string(body))
+		return nil, &pdnsAPIError{StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	return body, nil
 }
 
 func (c *pdnsEndpoint) PatchZone(ctx context.Context, ip, action string) error {
-	type Record struct {
-		Content  string `json:"content"`
-		Disabled bool   `json:"disabled"`
-	}
-	type RRSet struct {
-		Records    []Record `json:"records"`
-		ChangeType string   `json:"changetype"`
-		Name       string   `json:"name"`
-		Type       string   `json:"type"`
-		TTL        int      `json:"ttl"`
-	}
-	type Zone struct {
-		RRSets []RRSet `json:"rrsets"`
-	}
 	reverseIP := utils.ReverseAddress(strings.Split(ip, "."))
-	data := Zone{
-		RRSets: []RRSet{
+	data := pdnsZone{
+		RRSets: []pdnsRRSet{
 			{
 				Name:       fmt.Sprintf("%s.%s.", reverseIP, c.zone),
 				Type:       "A",
 				TTL:        3600,
 				ChangeType: action,
-				Records: []Record{
+				Records: []pdnsRecord{
 					{
 						Content:  "127.0.0.1",
 						Disabled: false,
@@ -140,6 +224,144 @@ func (c *pdnsEndpoint) PatchZone(ctx context.Context, ip, action string) error {
 	return nil
 }
 
+// PatchNetworks adds or removes the records listing every address of the
+// given networks in one request, see pdnsNetworkNames.
+func (c *pdnsEndpoint) PatchNetworks(ctx context.Context, networks []string, action string) error {
+	var rrsets []pdnsRRSet
+	for _, network := range networks {
+		names, err := pdnsNetworkNames(network)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			rrsets = append(rrsets, pdnsRRSet{
+				Name:       fmt.Sprintf("%s.%s.", name, c.zone),
+				Type:       "A",
+				TTL:        3600,
+				ChangeType: action,
+				Records: []pdnsRecord{
+					{
+						Content:  "127.0.0.1",
+						Disabled: false,
+					},
+				},
+			})
+		}
+	}
+	if len(rrsets) == 0 {
+		return nil
+	}
+	uri := fmt.Sprintf("%s/zones/%s", c.baseURL, c.zone)
+	if _, err := c.Call(ctx, uri, "PATCH", 204, pdnsZone{RRSets: rrsets}); err != nil {
+		return err
+	}
+	return nil
+}
+
+// pdnsNetworkNames returns the zone relative names covering every address
+// of network. Networks of /24 or wider become one wildcard per /24, since a
+// wider wildcard stops matching below any name listed inside it. Narrower
+// networks become one name per address. Networks wider than /16 are refused
+// and IPv6 networks ignored, as the zone only lists IPv4 addresses.
+func pdnsNetworkNames(network string) ([]string, error) {
+	_, ipnet, err := net.ParseCIDR(network)
+	if err != nil {
+		return nil, errors.Errorf("Network '%s' must be in CIDR notation", network)
+	}
+	ip := ipnet.IP.To4()
+	if ip == nil {
+		return nil, nil
+	}
+	ones, _ := ipnet.Mask.Size()
+	if ones < 16 {
+		return nil, errors.Errorf("Network '%s' is wider than /16", network)
+	}
+	start := uint32(ip[0])<<24 | uint32(ip[1])<<16 | uint32(ip[2])<<8 | uint32(ip[3])
+	var names []string
+	if ones <= 24 {
+		for i := uint32(0); i < 1<<(24-ones); i++ {
+			n := start + i<<8
+			names = append(names, fmt.Sprintf("*.%d.%d.%d", n>>8&0xff, n>>16&0xff, n>>24))
+		}
+		return names, nil
+	}
+	for i := uint32(0); i < 1<<(32-ones); i++ {
+		n := start + i
+		names = append(names, fmt.Sprintf("%d.%d.%d.%d", n&0xff, n>>8&0xff, n>>16&0xff, n>>24))
+	}
+	return names, nil
+}
+
+func (c *pdnsEndpoint) GetZone(ctx context.Context) error {
+	uri := fmt.Sprintf("%s/zones/%s", c.baseURL, c.zone)
+	if _, err := c.Call(ctx, uri, "GET", 200, nil); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *pdnsEndpoint) CreateZone(ctx context.Context) error {
+	if len(c.nameservers) == 0 {
+		return errors.New("Zone creation requires at least one nameserver")
+	}
+	if c.hostmaster == "" {
+		return errors.New("Zone creation requires a hostmaster")
+	}
+	name := fqdn(c.zone)
+	soa := fmt.Sprintf("%s %s %s01 10800 3600 604800 3600",
+		fqdn(c.nameservers[0]), fqdn(c.hostmaster), time.Now().UTC().Format("20060102"))
+	ns := make([]pdnsRecord, 0, len(c.nameservers))
+	for _, nameserver := range c.nameservers {
+		ns = append(ns, pdnsRecord{Content: fqdn(nameserver)})
+	}
+	data := pdnsZone{
+		Name:       name,
+		Kind:       "Native",
+		SOAEdit:    "INCEPTION-INCREMENT",
+		SOAEditAPI: "INCEPTION-INCREMENT",
+		RRSets: []pdnsRRSet{
+			{
+				Name:    name,
+				Type:    "SOA",
+				TTL:     3600,
+				Records: []pdnsRecord{{Content: soa}},
+			},
+			{
+				Name:    name,
+				Type:    "NS",
+				TTL:     3600,
+				Records: ns,
+			},
+		},
+	}
+	uri := fmt.Sprintf("%s/zones", c.baseURL)
+	if _, err := c.Call(ctx, uri, "POST", 201, data); err != nil {
+		return err
+	}
+	return nil
+}
+
+// EnsureZone verifies that the configured zone exists and, when zone creation
+// is enabled, creates it with SOA, NS and SOA-EDIT-API set up.
+func (c *pdnsEndpoint) EnsureZone(ctx context.Context) error {
+	err := c.GetZone(ctx)
+	if err == nil {
+		return nil
+	}
+	var apiErr *pdnsAPIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		return errors.Wrap(err, "Failed to fetch zone")
+	}
+	if !c.create {
+		return errors.Errorf("Zone '%s' doesn't exist", c.zone)
+	}
+	if err := c.CreateZone(ctx); err != nil {
+		return errors.Wrap(err, "Failed to create zone")
+	}
+	c.l.Info("Created PowerDNS zone", zap.String("endpoint", "PowerDNS"), zap.String("zone", c.zone))
+	return nil
+}
+
 func (c *pdnsEndpoint) SearchZone(ctx context.Context, ip string) error {
 	type SearchResult struct {
 		Content    string `json:"content"`
@@ -178,6 +400,35 @@ func (c *pdnsEndpoint) Name() string {
 	return "PowerDNS"
 }
 
+func (c *pdnsEndpoint) Describe() map[string]string {
+	return map[string]string{
+		"scheme":      c.scheme,
+		"host":        c.host,
+		"port":        c.port,
+		"zone":        c.zone,
+		"zone_create": fmt.Sprintf("%t", c.create),
+		"key":         utils.Redact(c.key),
+	}
+}
+
+// HealthCheck verifies the zone is available. When it couldn't be verified
+// or created at startup, it's ensured again, creating it if enabled.
+func (c *pdnsEndpoint) HealthCheck(ctx context.Context) error {
+	c.zoneMu.Lock()
+	defer c.zoneMu.Unlock()
+	if c.zoneErr != nil {
+		if err := c.EnsureZone(ctx); err != nil {
+			return errors.Wrapf(err, "Zone '%s' is not ready", c.zone)
+		}
+		c.zoneErr = nil
+		return nil
+	}
+	if err := c.GetZone(ctx); err != nil {
+		return errors.Wrapf(err, "Zone '%s' is not available", c.zone)
+	}
+	return nil
+}
+
 func (c *pdnsEndpoint) Block(ctx context.Context, ip string) error {
 	return c.PatchZone(ctx, ip, "REPLACE")
 }
@@ -186,6 +437,15 @@ func (c *pdnsEndpoint) Unblock(ctx context.Context, ip string) error {
 	return c.PatchZone(ctx, ip, "DELETE")
 }
 
+// BlockNetworks lists whole networks, e.g. the prefixes of an ASN.
+func (c *pdnsEndpoint) BlockNetworks(ctx context.Context, networks []string) error {
+	return c.PatchNetworks(ctx, networks, "REPLACE")
+}
+
+func (c *pdnsEndpoint) UnblockNetworks(ctx context.Context, networks []string) error {
+	return c.PatchNetworks(ctx, networks, "DELETE")
+}
+
 func (c *pdnsEndpoint) Exists(ctx context.Context, ip string) error {
 	return c.SearchZone(ctx, ip)
 }
@@ -196,3 +456,10 @@ func (c *pdnsEndpoint) Sync(ctx context.Context, ip string) error {
 	}
 	return nil
 }
+
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
@@ -0,0 +1,76 @@
+package endpoints
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/hostinger/hbl/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_pdnsNetworkNames(t *testing.T) {
+	names, err := pdnsNetworkNames("192.0.2.0/23")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"*.2.0.192", "*.3.0.192"}, names)
+
+	names, err = pdnsNetworkNames("198.51.100.4/30")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"4.100.51.198", "5.100.51.198", "6.100.51.198", "7.100.51.198"}, names)
+
+	names, err = pdnsNetworkNames("2001:db8::/32")
+	assert.NoError(t, err)
+	assert.Empty(t, names)
+
+	_, err = pdnsNetworkNames("10.0.0.0/8")
+	assert.Error(t, err)
+}
+
+func TestPDNSEndpoint_HealthCheck_zone(t *testing.T) {
+	// PowerDNS is down at startup, then up without the zone.
+	var up, created int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case atomic.LoadInt32(&up) == 0:
+			w.WriteHeader(503)
+		case r.Method == "POST" && r.URL.Path == "/api/v1/servers/localhost/zones":
+			atomic.StoreInt32(&created, 1)
+			w.WriteHeader(201)
+		case r.Method == "GET" && atomic.LoadInt32(&created) == 1:
+			w.Write([]byte(`{}`)) // nolint
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	host, port, _ := net.SplitHostPort(u.Host)
+
+	endpoint, err := NewPDNSEndpoint(logger.NewLogger("test"), &PDNSConfig{
+		Scheme:          "http",
+		Host:            host,
+		Port:            port,
+		Key:             "key",
+		Zone:            "hbl.example.com",
+		ZoneCreate:      true,
+		ZoneNameservers: []string{"ns1.example.com"},
+		ZoneHostmaster:  "hostmaster.example.com",
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	hc := endpoint.(HealthChecker)
+	err = hc.HealthCheck(context.Background())
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "Zone 'hbl.example.com' is not ready")
+	}
+
+	atomic.StoreInt32(&up, 1)
+	assert.NoError(t, hc.HealthCheck(context.Background()))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&created))
+	assert.NoError(t, hc.HealthCheck(context.Background()))
+}
@@ -0,0 +1,143 @@
+package endpoints
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeEndpoint struct {
+	name    string
+	blocked []string
+}
+
+func (f *fakeEndpoint) Name() string { return f.name }
+
+func (f *fakeEndpoint) Sync(ctx context.Context, ip string) error { return nil }
+
+func (f *fakeEndpoint) Block(ctx context.Context, ip string) error {
+	f.blocked = append(f.blocked, ip)
+	return nil
+}
+
+func (f *fakeEndpoint) Unblock(ctx context.Context, ip string) error { return nil }
+
+func TestRegistry_Isolation(t *testing.T) {
+	a, b := NewRegistry(), NewRegistry()
+	pdns, cf := &fakeEndpoint{name: "PowerDNS"}, &fakeEndpoint{name: "Cloudflare"}
+
+	a.Register(pdns)
+	a.Register(cf)
+	b.Register(&fakeEndpoint{name: "PowerDNS"})
+
+	assert.NoError(t, a.ExecuteOnAll(context.Background(), "127.0.0.1", "Block"))
+	assert.Equal(t, []string{"127.0.0.1"}, pdns.blocked)
+	assert.Equal(t, []string{"127.0.0.1"}, cf.blocked)
+
+	names := []string{}
+	for _, endpoint := range a.List() {
+		names = append(names, endpoint.Name())
+	}
+	assert.Equal(t, []string{"Cloudflare", "PowerDNS"}, names)
+	assert.Len(t, b.List(), 1)
+
+	a.Replace(cf)
+	_, ok := a.Get("PowerDNS")
+	assert.False(t, ok)
+	assert.Len(t, a.List(), 1)
+}
+
+func TestRegistry_PauseResume(t *testing.T) {
+	r := NewRegistry()
+	pdns := &fakeEndpoint{name: "PowerDNS"}
+	r.Register(pdns)
+
+	assert.Equal(t, ErrNotFound, r.Pause("Cloudflare"))
+	assert.NoError(t, r.Pause("PowerDNS"))
+
+	assert.NoError(t, r.ExecuteOnAll(context.Background(), "127.0.0.1", "Block"))
+	assert.NoError(t, r.ExecuteOnAll(context.Background(), "127.0.0.2", "Block"))
+	assert.Empty(t, pdns.blocked)
+
+	info, err := r.InfoOne("PowerDNS")
+	assert.NoError(t, err)
+	assert.Equal(t, "paused", info.State)
+	assert.Equal(t, 2, info.Queued)
+
+	assert.NoError(t, r.Resume(context.Background(), "PowerDNS"))
+	assert.Equal(t, []string{"127.0.0.1", "127.0.0.2"}, pdns.blocked)
+
+	info, err = r.InfoOne("PowerDNS")
+	assert.NoError(t, err)
+	assert.Equal(t, "active", info.State)
+	assert.Equal(t, 0, info.Queued)
+	assert.Equal(t, "127.0.0.2", info.LastOperation.IP)
+}
+
+func TestRegistry_Apply(t *testing.T) {
+	r := NewRegistry()
+	r.Register(&fakeEndpoint{name: "PowerDNS"})
+	r.Register(&fakeEndpoint{name: "Cloudflare"})
+	assert.NoError(t, r.Pause("PowerDNS"))
+
+	outcome, err := r.Apply(context.Background(), "127.0.0.1", "Block")
+	assert.NoError(t, err)
+	assert.Equal(t, &Outcome{Applied: []string{"Cloudflare"}, Queued: []string{"PowerDNS"}}, outcome)
+}
+
+type fakeNetworkEndpoint struct {
+	fakeEndpoint
+	networks []string
+}
+
+func (f *fakeNetworkEndpoint) BlockNetworks(ctx context.Context, networks []string) error {
+	f.networks = append(f.networks, networks...)
+	return nil
+}
+
+func (f *fakeNetworkEndpoint) UnblockNetworks(ctx context.Context, networks []string) error {
+	return nil
+}
+
+func TestRegistry_ExecuteTargetOnAll(t *testing.T) {
+	r := NewRegistry()
+	pdns := &fakeNetworkEndpoint{fakeEndpoint: fakeEndpoint{name: "PowerDNS"}}
+	r.Register(pdns)
+	r.Register(&fakeEndpoint{name: "Other"})
+
+	asn := &Target{Type: "asn", Value: "AS64496", Prefixes: []string{"192.0.2.0/24"}}
+	assert.NoError(t, r.ExecuteTargetOnAll(context.Background(), asn, "Block"))
+	assert.Equal(t, []string{"192.0.2.0/24"}, pdns.networks)
+
+	country := &Target{Type: "country", Value: "RU"}
+	assert.Equal(t, ErrTargetUnsupported, r.ExecuteTargetOnAll(context.Background(), country, "Block"))
+	assert.NoError(t, r.ExecuteTargetOnAll(context.Background(), country, "Unblock"))
+}
+
+type closingEndpoint struct {
+	fakeEndpoint
+	closed int
+}
+
+func (c *closingEndpoint) Close() error {
+	c.closed++
+	return nil
+}
+
+func TestRegistry_Replace_Close(t *testing.T) {
+	r := NewRegistry()
+	kept, dropped := &closingEndpoint{fakeEndpoint: fakeEndpoint{name: "PowerDNS"}}, &closingEndpoint{fakeEndpoint: fakeEndpoint{name: "Cloudflare"}}
+	r.Register(kept)
+	r.Register(dropped)
+
+	replacement := &closingEndpoint{fakeEndpoint: fakeEndpoint{name: "Cloudflare"}}
+	r.Replace(kept, replacement)
+	assert.Equal(t, 0, kept.closed)
+	assert.Equal(t, 1, dropped.closed)
+
+	assert.NoError(t, r.Close())
+	assert.Equal(t, 1, kept.closed)
+	assert.Equal(t, 1, replacement.closed)
+	assert.Equal(t, 1, dropped.closed)
+}
@@ -0,0 +1,131 @@
+package hbl
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/hostinger/hbl/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// ChangeFeed is a page of the change log, served by /api/v1/changes. Next
+// is the cursor to ask for the following changes, and More tells whether
+// there are some already. Reset means the changes following the cursor
+// asked for are no longer kept, or no cursor was given: the whole list must
+// be fetched, then the changes following Next applied to it.
+type ChangeFeed struct {
+	Changes []*Change
+	Next    int64
+	More    bool
+	Reset   bool
+}
+
+// resumable tells whether the change log still holds every change following
+// since, given head, the sequence of the last change, and oldest, the
+// sequence of the oldest change kept or zero when none is. Sequences start
+// at 1, so a zero since is never resumable.
+func resumable(since, head, oldest int64) bool {
+	if since <= 0 || since > head {
+		return false
+	}
+	if oldest == 0 {
+		return since == head
+	}
+	return since >= oldest-1
+}
+
+// ChangesConfig tunes the change log every change of the list is recorded
+// in.
+type ChangesConfig struct {
+	// Retention is how long changes are kept. Clients whose cursor is
+	// older have to fetch the whole list again. Zero keeps them forever.
+	Retention time.Duration `mapstructure:"retention"`
+}
+
+func (c *ChangesConfig) Validate() error {
+	if c.Retention < 0 {
+		return errors.New("Field 'retention' must not be negative")
+	}
+	return nil
+}
+
+// ChangeLog prunes the change log hourly. The changes themselves are
+// recorded by the repository, together with the change they describe.
+type ChangeLog struct {
+	l          logger.Logger
+	repository Repository
+	now        func() time.Time
+
+	mu  sync.RWMutex
+	cfg ChangesConfig
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewChangeLog(l logger.Logger, r Repository, cfg *ChangesConfig) *ChangeLog {
+	c := &ChangeLog{
+		l:          l,
+		repository: r,
+		now:        time.Now,
+	}
+	c.Set(cfg)
+	return c
+}
+
+func (c *ChangeLog) Set(cfg *ChangesConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cfg = *cfg
+}
+
+func (c *ChangeLog) config() ChangesConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cfg
+}
+
+// Start prunes the change log in the background until Stop is called.
+func (c *ChangeLog) Start() {
+	var ctx context.Context
+	ctx, c.cancel = context.WithCancel(context.Background())
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			c.prune(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (c *ChangeLog) Stop() {
+	if c.cancel == nil {
+		return
+	}
+	c.cancel()
+	c.wg.Wait()
+}
+
+func (c *ChangeLog) prune(ctx context.Context) {
+	retention := c.config().Retention
+	if retention <= 0 {
+		return
+	}
+	n, err := c.repository.DeleteChanges(ctx, c.now().Add(-retention))
+	if err != nil {
+		c.l.Error("Failed to prune changes", zap.Error(err))
+		return
+	}
+	if n > 0 {
+		c.l.Info("Pruned changes", zap.Int64("changes", n))
+	}
+}
@@ -0,0 +1,47 @@
+package hbl
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hostinger/hbl/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_resumable(t *testing.T) {
+	tests := []struct {
+		since, head, oldest int64
+		want                bool
+	}{
+		{0, 1, 0, false},
+		{1, 1, 0, true},
+		{1, 5, 2, true},
+		{3, 5, 2, true},
+		{5, 5, 2, true},
+		{6, 5, 2, false},
+		{2, 9, 4, false},
+		{3, 9, 0, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, resumable(tt.since, tt.head, tt.oldest), "since %d, head %d, oldest %d", tt.since, tt.head, tt.oldest)
+	}
+}
+
+func TestChangeLog_prune(t *testing.T) {
+	r := NewMockRepository()
+	ctx := context.Background()
+	r.CreateAddress(ctx, &Address{IP: "192.0.2.1", Target: TargetIP, Action: "Block"}) // nolint
+	r.DeleteAddress(ctx, "192.0.2.1")                                                  // nolint
+
+	c := NewChangeLog(logger.NewLogger("test"), r, &ChangesConfig{Retention: time.Hour})
+	c.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	c.prune(ctx)
+
+	feed, _ := r.GetChanges(ctx, 1, 10)
+	assert.True(t, feed.Reset)
+	assert.Equal(t, int64(3), feed.Next)
+	feed, _ = r.GetChanges(ctx, 3, 10)
+	assert.False(t, feed.Reset)
+	assert.Empty(t, feed.Changes)
+}
@@ -0,0 +1,264 @@
+package hbl
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hostinger/hbl/pkg/alerters"
+	"github.com/hostinger/hbl/pkg/logger"
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+// EscalationConfig decides when blocked addresses sharing a network are
+// worth blocking as a whole network, e.g. 20 addresses of a /24 blocked
+// within a day.
+type EscalationConfig struct {
+	// Enabled runs the analyser in the background every Interval. Suggestions
+	// are always available through the API.
+	Enabled  bool          `mapstructure:"enabled"`
+	Interval time.Duration `mapstructure:"interval"`
+
+	// Window only counts addresses blocked within it. Zero counts every
+	// blocked address.
+	Window time.Duration `mapstructure:"window"`
+
+	// IPv4Prefix and IPv6Prefix are the lengths of the networks addresses
+	// are grouped by.
+	IPv4Prefix int `mapstructure:"ipv4_prefix"`
+	IPv6Prefix int `mapstructure:"ipv6_prefix"`
+
+	// Threshold is how many blocked addresses a network must hold.
+	Threshold int `mapstructure:"threshold"`
+
+	// AutoBlock blocks suggested networks and retires the addresses they
+	// cover instead of only alerting about them.
+	AutoBlock bool `mapstructure:"auto_block"`
+}
+
+func (c *EscalationConfig) Validate() error {
+	var err error
+	if c.Enabled && c.Interval <= 0 {
+		err = multierr.Append(err, errors.New("Field 'interval' must be positive"))
+	}
+	if c.Window < 0 {
+		err = multierr.Append(err, errors.New("Field 'window' must not be negative"))
+	}
+	if c.IPv4Prefix < 8 || c.IPv4Prefix > 31 {
+		err = multierr.Append(err, errors.New("Field 'ipv4_prefix' must be between 8 and 31"))
+	}
+	if c.IPv6Prefix < 16 || c.IPv6Prefix > 127 {
+		err = multierr.Append(err, errors.New("Field 'ipv6_prefix' must be between 16 and 127"))
+	}
+	if c.Threshold < 2 {
+		err = multierr.Append(err, errors.New("Field 'threshold' must be at least 2"))
+	}
+	return err
+}
+
+// Escalation is a network holding enough recently blocked addresses to be
+// blocked as a whole.
+type Escalation struct {
+	Network        string
+	Count          int
+	Addresses      []string
+	FirstBlockedAt time.Time
+	LastBlockedAt  time.Time
+
+	// Skipped explains why the network must not be blocked, e.g. because
+	// it holds an allowed address or overlaps a protected range.
+	Skipped string `json:",omitempty"`
+
+	// Retired is how many addresses were deleted once the network was
+	// blocked.
+	Retired int `json:",omitempty"`
+}
+
+// EscalationPolicy holds the escalation settings. It is safe for concurrent
+// use and can be replaced at runtime.
+type EscalationPolicy struct {
+	mu  sync.RWMutex
+	cfg EscalationConfig
+}
+
+func NewEscalationPolicy(cfg *EscalationConfig) *EscalationPolicy {
+	p := &EscalationPolicy{}
+	p.Set(cfg)
+	return p
+}
+
+func (p *EscalationPolicy) Set(cfg *EscalationConfig) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cfg = *cfg
+}
+
+// Get returns the current settings. A nil policy never suggests anything.
+func (p *EscalationPolicy) Get() EscalationConfig {
+	if p == nil {
+		return EscalationConfig{}
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.cfg
+}
+
+// findEscalations groups the blocked IP addresses of entries created since
+// now minus the window by network, and returns the networks holding at least
+// the threshold of them, ordered by count.
+func findEscalations(entries []*Address, cfg EscalationConfig, now time.Time) []*Escalation {
+	if cfg.Threshold < 2 {
+		return nil
+	}
+	groups := map[string]*Escalation{}
+	for _, entry := range entries {
+		if !entry.isIP() || entry.Action != "Block" {
+			continue
+		}
+		if cfg.Window > 0 && entry.CreatedAt.Before(now.Add(-cfg.Window)) {
+			continue
+		}
+		ip := net.ParseIP(entry.IP)
+		if ip == nil {
+			continue
+		}
+		network := &net.IPNet{IP: ip.Mask(net.CIDRMask(cfg.IPv6Prefix, 128)), Mask: net.CIDRMask(cfg.IPv6Prefix, 128)}
+		if v4 := ip.To4(); v4 != nil {
+			network = &net.IPNet{IP: v4.Mask(net.CIDRMask(cfg.IPv4Prefix, 32)), Mask: net.CIDRMask(cfg.IPv4Prefix, 32)}
+		}
+		group, ok := groups[network.String()]
+		if !ok {
+			group = &Escalation{Network: network.String(), FirstBlockedAt: entry.CreatedAt, LastBlockedAt: entry.CreatedAt}
+			groups[network.String()] = group
+		}
+		group.Count++
+		group.Addresses = append(group.Addresses, entry.IP)
+		if entry.CreatedAt.Before(group.FirstBlockedAt) {
+			group.FirstBlockedAt = entry.CreatedAt
+		}
+		if entry.CreatedAt.After(group.LastBlockedAt) {
+			group.LastBlockedAt = entry.CreatedAt
+		}
+	}
+	var escalations []*Escalation
+	for _, group := range groups {
+		if group.Count >= cfg.Threshold {
+			sort.Strings(group.Addresses)
+			escalations = append(escalations, group)
+		}
+	}
+	sort.Slice(escalations, func(i, j int) bool {
+		if escalations[i].Count != escalations[j].Count {
+			return escalations[i].Count > escalations[j].Count
+		}
+		return escalations[i].Network < escalations[j].Network
+	})
+	return escalations
+}
+
+// networksOverlap tells whether a and b share any address.
+func networksOverlap(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+// Escalator periodically looks for networks worth blocking as a whole. It
+// alerts about new ones or, with auto_block set, blocks them.
+type Escalator struct {
+	l        logger.Logger
+	service  Service
+	alerters *alerters.Registry
+	policy   *EscalationPolicy
+	alerted  map[string]bool
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+func NewEscalator(l logger.Logger, s Service, a *alerters.Registry, p *EscalationPolicy) *Escalator {
+	return &Escalator{
+		l:        l,
+		service:  s,
+		alerters: a,
+		policy:   p,
+		alerted:  map[string]bool{},
+	}
+}
+
+// Start runs the escalator in the background until Stop is called. It does
+// nothing when escalation is disabled.
+func (e *Escalator) Start() {
+	cfg := e.policy.Get()
+	if !cfg.Enabled || cfg.Interval <= 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	e.cancel = cancel
+	e.done = make(chan struct{})
+	go func() {
+		defer close(e.done)
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				e.EscalateAll(ctx)
+			}
+		}
+	}()
+}
+
+func (e *Escalator) Stop() {
+	if e.cancel == nil {
+		return
+	}
+	e.cancel()
+	<-e.done
+}
+
+// EscalateAll handles every current suggestion once. Each network is only
+// alerted about once for as long as it stays suggested.
+func (e *Escalator) EscalateAll(ctx context.Context) {
+	cfg := e.policy.Get()
+	escalations, err := e.service.GetEscalations(ctx)
+	if err != nil {
+		e.l.Error("Failed to execute GetEscalations", zap.Error(err))
+		return
+	}
+	suggested := map[string]bool{}
+	for _, escalation := range escalations {
+		if escalation.Skipped != "" {
+			continue
+		}
+		suggested[escalation.Network] = true
+		if cfg.AutoBlock {
+			comment := fmt.Sprintf("Escalated from %d blocked addresses", escalation.Count)
+			escalated, err := e.service.Escalate(ctx, escalation.Network, "hbl", comment)
+			if err != nil {
+				e.l.Error("Failed to execute Escalate", zap.String("network", escalation.Network), zap.Error(err))
+				continue
+			}
+			e.l.Info(
+				"Escalated addresses into a network block",
+				zap.String("network", escalated.Network),
+				zap.Int("retired", escalated.Retired),
+			)
+			continue
+		}
+		if e.alerted[escalation.Network] {
+			continue
+		}
+		e.alerters.AlertOnAll(ctx, &alerters.Alert{
+			IP:      escalation.Network,
+			Action:  "Escalate",
+			Author:  "hbl",
+			Comment: fmt.Sprintf("%d addresses of this network are blocked, consider blocking it as a whole", escalation.Count),
+		})
+	}
+	e.alerted = suggested
+}
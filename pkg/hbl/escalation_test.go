@@ -0,0 +1,125 @@
+package hbl
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hostinger/hbl/pkg/alerters"
+	"github.com/hostinger/hbl/pkg/endpoints"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_findEscalations(t *testing.T) {
+	now := time.Now()
+	var entries []*Address
+	for i := 1; i <= 3; i++ {
+		entries = append(entries,
+			&Address{IP: fmt.Sprintf("192.0.2.%d", i), Action: "Block", CreatedAt: now},
+			&Address{IP: fmt.Sprintf("2001:db8::%d", i), Action: "Block", CreatedAt: now},
+		)
+	}
+	entries = append(entries,
+		&Address{IP: "192.0.2.200", Action: "Block", CreatedAt: now.Add(-48 * time.Hour)},
+		&Address{IP: "198.51.100.1", Action: "Block", CreatedAt: now},
+		&Address{IP: "198.51.100.2", Action: "Allow", CreatedAt: now},
+	)
+	cfg := EscalationConfig{Window: 24 * time.Hour, IPv4Prefix: 24, IPv6Prefix: 64, Threshold: 3}
+
+	escalations := findEscalations(entries, cfg, now)
+	if assert.Len(t, escalations, 2) {
+		assert.Equal(t, "192.0.2.0/24", escalations[0].Network)
+		assert.Equal(t, []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"}, escalations[0].Addresses)
+		assert.Equal(t, "2001:db8::/64", escalations[1].Network)
+	}
+
+	cfg.Window = 0
+	escalations = findEscalations(entries, cfg, now)
+	if assert.Len(t, escalations, 2) {
+		assert.Equal(t, 4, escalations[0].Count)
+	}
+}
+
+func Test_service_Escalate(t *testing.T) {
+	repository := NewMockRepository()
+	for i := 1; i <= 3; i++ {
+		repository.CreateAddress(context.Background(), &Address{IP: fmt.Sprintf("192.0.2.%d", i), Target: TargetIP, Action: "Block", CreatedAt: time.Now()})
+		repository.CreateAddress(context.Background(), &Address{IP: fmt.Sprintf("198.51.100.%d", i), Target: TargetIP, Action: "Block", CreatedAt: time.Now()})
+		repository.CreateAddress(context.Background(), &Address{IP: fmt.Sprintf("203.0.113.%d", i), Target: TargetIP, Action: "Block", CreatedAt: time.Now()})
+	}
+	repository.CreateAddress(context.Background(), &Address{IP: "198.51.100.9", Target: TargetIP, Action: "Allow", CreatedAt: time.Now()})
+
+	protected, err := NewProtectedRanges([]string{"203.0.113.0/25"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &service{
+		repository: repository,
+		protected:  protected,
+		escalation: NewEscalationPolicy(&EscalationConfig{IPv4Prefix: 24, IPv6Prefix: 64, Threshold: 3}),
+		endpoints:  endpoints.NewRegistry(),
+		alerters:   alerters.NewRegistry(),
+	}
+
+	escalations, err := s.GetEscalations(context.Background())
+	assert.NoError(t, err)
+	skipped := map[string]string{}
+	for _, escalation := range escalations {
+		skipped[escalation.Network] = escalation.Skipped
+	}
+	assert.Equal(t, map[string]string{
+		"192.0.2.0/24":    "",
+		"198.51.100.0/24": "Holds allowed address 198.51.100.9",
+		"203.0.113.0/24":  "Overlaps a protected range",
+	}, skipped)
+
+	_, err = s.Escalate(context.Background(), "198.51.100.0/24", "Test", "Test")
+	assert.Equal(t, ErrEscalationSkipped, err)
+	_, err = s.Escalate(context.Background(), "10.0.0.0/24", "Test", "Test")
+	assert.Equal(t, ErrNoEscalation, err)
+
+	escalation, err := s.Escalate(context.Background(), "192.0.2.0/24", "Test", "Test")
+	if assert.NoError(t, err) {
+		assert.Equal(t, 3, escalation.Retired)
+	}
+	address, err := repository.GetAddress(context.Background(), "192.0.2.0/24")
+	if assert.NoError(t, err) {
+		assert.Equal(t, TargetNetwork, address.Target)
+	}
+	_, err = repository.GetAddress(context.Background(), "192.0.2.1")
+	assert.Error(t, err)
+
+	escalations, err = s.GetEscalations(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, escalations, 2)
+}
+
+func Test_service_Escalate_ipv6(t *testing.T) {
+	repository := NewMockRepository()
+	for i := 1; i <= 3; i++ {
+		repository.CreateAddress(context.Background(), &Address{IP: fmt.Sprintf("2001:db8::%d", i), Target: TargetIP, Action: "Block", CreatedAt: time.Now()})
+	}
+	repository.CreateAddress(context.Background(), &Address{IP: "2001:db8:0:1::1", Target: TargetIP, Action: "Block", CreatedAt: time.Now()})
+	s := &service{
+		repository: repository,
+		escalation: NewEscalationPolicy(&EscalationConfig{IPv4Prefix: 24, IPv6Prefix: 64, Threshold: 3}),
+		endpoints:  endpoints.NewRegistry(),
+		alerters:   alerters.NewRegistry(),
+	}
+
+	escalations, err := s.GetEscalations(context.Background())
+	if assert.NoError(t, err) && assert.Len(t, escalations, 1) {
+		assert.Equal(t, "2001:db8::/64", escalations[0].Network)
+		assert.Equal(t, 3, escalations[0].Count)
+	}
+
+	escalation, err := s.Escalate(context.Background(), "2001:db8::/64", "Test", "Test")
+	if assert.NoError(t, err) {
+		assert.Equal(t, 3, escalation.Retired)
+	}
+	_, err = repository.GetAddress(context.Background(), "2001:db8::1")
+	assert.Error(t, err)
+	_, err = repository.GetAddress(context.Background(), "2001:db8:0:1::1")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,71 @@
+package hbl
+
+import (
+	"context"
+	"time"
+
+	"github.com/hostinger/hbl/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// Expirer periodically unblocks and deletes addresses whose block expired,
+// as set by the duration of the policy rule they matched.
+type Expirer struct {
+	l        logger.Logger
+	service  Service
+	interval time.Duration
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+func NewExpirer(l logger.Logger, s Service, interval time.Duration) *Expirer {
+	return &Expirer{
+		l:        l,
+		service:  s,
+		interval: interval,
+	}
+}
+
+// Start runs the expirer in the background until Stop is called. It does
+// nothing when the interval is zero.
+func (e *Expirer) Start() {
+	if e.interval <= 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	e.cancel = cancel
+	e.done = make(chan struct{})
+	go func() {
+		defer close(e.done)
+		ticker := time.NewTicker(e.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				e.ExpireAll(ctx)
+			}
+		}
+	}()
+}
+
+func (e *Expirer) Stop() {
+	if e.cancel == nil {
+		return
+	}
+	e.cancel()
+	<-e.done
+}
+
+// ExpireAll lifts every expired block once.
+func (e *Expirer) ExpireAll(ctx context.Context) {
+	expired, err := e.service.Expire(ctx)
+	if err != nil {
+		e.l.Error("Failed to execute Expire", zap.Error(err))
+		return
+	}
+	if expired > 0 {
+		e.l.Info("Expired blocked addresses", zap.Int("addresses", expired))
+	}
+}
@@ -4,12 +4,35 @@ import "github.com/labstack/echo/v4"
 
 type Handler interface {
 	HandleHealth(c echo.Context) error
+	HandleHealthLive(c echo.Context) error
+	HandleHealthReady(c echo.Context) error
 	HandleVersion(c echo.Context) error
 	HandleAddressesPost(c echo.Context) error
 	HandleAddressesCheck(c echo.Context) error
+	HandleAddressesCheckAll(c echo.Context) error
+	HandleAddressesCheckHistory(c echo.Context) error
 	HandleAddressesGetOne(c echo.Context) error
 	HandleAddressesGetAll(c echo.Context) error
+	HandleAddressesExport(c echo.Context) error
 	HandleAddressesDelete(c echo.Context) error
 	HandleAddressesSyncOne(c echo.Context) error
 	HandleAddressesSyncAll(c echo.Context) error
+	HandleEvaluate(c echo.Context) error
+	HandleEscalationsGetAll(c echo.Context) error
+	HandleEscalationsPost(c echo.Context) error
+	HandleAdminReload(c echo.Context) error
+	HandleEndpointsGetAll(c echo.Context) error
+	HandleEndpointsState(c echo.Context) error
+	HandleCheckersGetAll(c echo.Context) error
+	HandleAlertersGetAll(c echo.Context) error
+	HandleWebhooksGetAll(c echo.Context) error
+	HandleWebhooksPost(c echo.Context) error
+	HandleWebhooksGetOne(c echo.Context) error
+	HandleWebhooksDelete(c echo.Context) error
+	HandleWebhooksDeliveries(c echo.Context) error
+	HandleWebhooksRedeliver(c echo.Context) error
+	HandleEvents(c echo.Context) error
+	HandleChanges(c echo.Context) error
+	HandleSlackCommands(c echo.Context) error
+	HandleSlackActions(c echo.Context) error
 }
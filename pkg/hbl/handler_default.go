@@ -3,27 +3,59 @@ package hbl
 import (
 	"context"
 	"database/sql"
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/hostinger/hbl/pkg/checkers"
+	"github.com/hostinger/hbl/pkg/endpoints"
 	"github.com/hostinger/hbl/pkg/logger"
 	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/slack-go/slack"
+	"go.uber.org/zap"
 )
 
+// ReloadFunc re-reads the configuration and applies it to the running server.
+type ReloadFunc func(ctx context.Context) error
+
 type handler struct {
 	l       logger.Logger
 	service Service
+	reload  ReloadFunc
+	slack   *SlackPolicy
+	client  *http.Client
 }
 
-func NewDefaultHandler(l logger.Logger, s Service) Handler {
+func NewDefaultHandler(l logger.Logger, s Service, slackPolicy *SlackPolicy, reload ReloadFunc) Handler {
 	return &handler{
 		l:       l,
 		service: s,
+		reload:  reload,
+		slack:   slackPolicy,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// paramKey reads the key of an entry from the 'ip' path param. Networks have
+// their slash escaped, e.g. '192.0.2.0%2F24'.
+func paramKey(c echo.Context) (*Address, error) {
+	key, err := url.PathUnescape(c.Param("ip"))
+	if err != nil {
+		return nil, err
 	}
+	return ParseKey(key)
 }
 
-// @Summary     Block or Allow an IP address.
-// @Description Use this endpoint to Block or Allow an IP address depending on Action argument in body.
+// @Summary     Block or Allow an IP address, ASN or country.
+// @Description Use this endpoint to Block or Allow an IP address depending on Action argument in body. Set Target to 'asn', 'country' or 'network' together with ASN, Country or Network to act on a whole autonomous system, country or network instead.
 // @Produce     json
 // @Accept      json
 // @Tags        Addresses
@@ -35,7 +67,7 @@ func (h *handler) HandleAddressesPost(c echo.Context) error {
 	if err := req.Bind(c, &address); err != nil {
 		return echo.NewHTTPError(422, fmt.Sprintf("Failed to validate request body: %s", err))
 	}
-	a, err := h.service.GetOne(context.Background(), address.IP)
+	a, err := h.service.GetOne(context.Background(), address.Key())
 	if err != nil && err != sql.ErrNoRows {
 		return echo.NewHTTPError(500, fmt.Sprintf("Error: %s", err))
 	}
@@ -45,6 +77,12 @@ func (h *handler) HandleAddressesPost(c echo.Context) error {
 	switch req.Action {
 	case "Block":
 		if err := h.service.Block(context.Background(), &address); err != nil {
+			if err == ErrProtected || err == ErrRejected {
+				return echo.NewHTTPError(403, fmt.Sprintf("Error: %s", err))
+			}
+			if err == endpoints.ErrTargetUnsupported {
+				return echo.NewHTTPError(422, fmt.Sprintf("Error: %s", err))
+			}
 			return echo.NewHTTPError(500, fmt.Sprintf("Error: %s", err))
 		}
 	case "Allow":
@@ -61,13 +99,14 @@ func (h *handler) HandleAddressesPost(c echo.Context) error {
 // @Accept      json
 // @Tags        Addresses
 // @Success     200
-// @Param 		ip path string true "IP Address"
+// @Param 		ip path string true "IP Address, AS number, country code or escaped network"
 // @Router      /addresses/{ip} [DELETE]
 func (h *handler) HandleAddressesDelete(c echo.Context) error {
-	ip := c.Param("ip")
-	if net.ParseIP(ip) == nil {
-		return echo.NewHTTPError(422, "Param 'IP' must be a valid IP address")
+	key, err := paramKey(c)
+	if err != nil {
+		return echo.NewHTTPError(422, "Param 'IP' must be an IP address, an AS number, a country code or a network")
 	}
+	ip := key.Key()
 	address, err := h.service.GetOne(context.Background(), ip)
 	if err != nil && err == sql.ErrNoRows {
 		if err == sql.ErrNoRows {
@@ -92,13 +131,14 @@ func (h *handler) HandleAddressesDelete(c echo.Context) error {
 // @Accept      json
 // @Tags        Addresses
 // @Success     200 {object} Address
-// @Param 		ip path string true "IP Address"
+// @Param 		ip path string true "IP Address, AS number, country code or escaped network"
 // @Router      /addresses/{ip} [GET]
 func (h *handler) HandleAddressesGetOne(c echo.Context) error {
-	ip := c.Param("ip")
-	if net.ParseIP(ip) == nil {
-		return echo.NewHTTPError(422, "Param 'IP' must be a valid IP address")
+	key, err := paramKey(c)
+	if err != nil {
+		return echo.NewHTTPError(422, "Param 'IP' must be an IP address, an AS number, a country code or a network")
 	}
+	ip := key.Key()
 	address, err := h.service.GetOne(context.Background(), ip)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -115,36 +155,248 @@ func (h *handler) HandleAddressesGetOne(c echo.Context) error {
 // @Accept      json
 // @Tags        Addresses
 // @Success     200 {array} Address
+// @Param 		target query string false "Only entries for this target, 'ip', 'asn', 'country' or 'network'"
+// @Param 		action query string false "Only addresses with this action"
+// @Param 		country query string false "Only addresses from this ISO country code"
+// @Param 		asn query int false "Only addresses from this autonomous system"
 // @Router      /addresses [GET]
 func (h *handler) HandleAddressesGetAll(c echo.Context) error {
-	addresses, err := h.service.GetAll(context.Background())
+	var filter AddressFilter
+	if err := new(AddressFilterRequest).Bind(c, &filter); err != nil {
+		return echo.NewHTTPError(422, err.Error())
+	}
+	addresses, err := h.service.GetAll(context.Background(), &filter)
 	if err != nil {
 		return echo.NewHTTPError(500, fmt.Sprintf("Error: %s", err))
 	}
 	return c.JSON(200, addresses)
 }
 
-// @Summary     Get an IP address.
-// @Description Use this endpoint to fetch details about an already blocked or allowed IP address.
+// @Summary     Export IP addresses as CSV.
+// @Description Use this endpoint to download all, or a filtered set of, blocked or allowed IP addresses as CSV.
+// @Produce     text/csv
+// @Tags        Addresses
+// @Success     200 {string} string
+// @Param 		target query string false "Only entries for this target, 'ip', 'asn', 'country' or 'network'"
+// @Param 		action query string false "Only addresses with this action"
+// @Param 		country query string false "Only addresses from this ISO country code"
+// @Param 		asn query int false "Only addresses from this autonomous system"
+// @Router      /addresses/export [GET]
+func (h *handler) HandleAddressesExport(c echo.Context) error {
+	var filter AddressFilter
+	if err := new(AddressFilterRequest).Bind(c, &filter); err != nil {
+		return echo.NewHTTPError(422, err.Error())
+	}
+	addresses, err := h.service.GetAll(context.Background(), &filter)
+	if err != nil {
+		return echo.NewHTTPError(500, fmt.Sprintf("Error: %s", err))
+	}
+	c.Response().Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="addresses.csv"`)
+	c.Response().WriteHeader(200)
+	w := csv.NewWriter(c.Response())
+	w.Write([]string{ // nolint
+		"ip", "action", "author", "comment", "source", "categories",
+		"country", "asn", "organization", "created_at", "target",
+	})
+	for _, address := range addresses {
+		asn := ""
+		if address.ASN != 0 {
+			asn = strconv.FormatUint(uint64(address.ASN), 10)
+		}
+		w.Write([]string{ // nolint
+			address.IP, address.Action, address.Author, address.Comment,
+			address.Source, strings.Join(address.Categories, ","),
+			address.Country, asn, address.Organization,
+			address.CreatedAt.Format(time.RFC3339), address.Target,
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// @Summary     Check an IP address with one checker.
+// @Description Use this endpoint to fetch what a single checker knows about an IP address.
 // @Produce     json
 // @Accept      json
 // @Tags        Addresses
-// @Success     200 {object} Address
+// @Success     200 {object} checkers.CheckResult
 // @Param 		name path string true "Name of the Checker"
 // @Param 		ip path string true "IP Address"
+// @Param 		refresh query bool false "Bypass cached results"
 // @Router      /addresses/check/{name}/{ip} [GET]
 func (h *handler) HandleAddressesCheck(c echo.Context) error {
 	name, ip := c.Param("name"), c.Param("ip")
 	if net.ParseIP(ip) == nil {
 		return echo.NewHTTPError(422, "Param 'IP' must be a valid IP address")
 	}
-	result, err := h.service.Check(context.Background(), name, ip)
+	ctx, err := checkContext(c)
 	if err != nil {
+		return err
+	}
+	result, err := h.service.Check(ctx, name, ip)
+	if err != nil {
+		if err == checkers.ErrNotFound {
+			return echo.NewHTTPError(404, "Checker doesn't exist")
+		}
+		if errors.Cause(err) == checkers.ErrQuotaExhausted {
+			return echo.NewHTTPError(429, "Checker quota exhausted")
+		}
 		return echo.NewHTTPError(500, fmt.Sprintf("Error: %s", err))
 	}
 	return c.JSON(200, result)
 }
 
+// @Summary     Check an IP address with all checkers.
+// @Description Use this endpoint to run every checker concurrently and get a weighted aggregate verdict.
+// @Produce     json
+// @Accept      json
+// @Tags        Addresses
+// @Success     200 {object} checkers.Aggregate
+// @Param 		ip path string true "IP Address"
+// @Param 		refresh query bool false "Bypass cached results"
+// @Router      /addresses/check/{ip} [GET]
+func (h *handler) HandleAddressesCheckAll(c echo.Context) error {
+	ip := c.Param("ip")
+	if net.ParseIP(ip) == nil {
+		return echo.NewHTTPError(422, "Param 'IP' must be a valid IP address")
+	}
+	ctx, err := checkContext(c)
+	if err != nil {
+		return err
+	}
+	aggregate, err := h.service.CheckAll(ctx, ip)
+	if err != nil {
+		return echo.NewHTTPError(500, fmt.Sprintf("Error: %s", err))
+	}
+	return c.JSON(200, aggregate)
+}
+
+// @Summary     Get past results of one checker for an IP address.
+// @Description Use this endpoint to see how what a checker knows about an IP address changed over time.
+// @Produce     json
+// @Accept      json
+// @Tags        Addresses
+// @Success     200 {array} checkers.CheckResult
+// @Param 		name path string true "Name of the Checker"
+// @Param 		ip path string true "IP Address"
+// @Param 		limit query int false "Maximum number of results"
+// @Router      /addresses/check/{name}/{ip}/history [GET]
+func (h *handler) HandleAddressesCheckHistory(c echo.Context) error {
+	name, ip := c.Param("name"), c.Param("ip")
+	if net.ParseIP(ip) == nil {
+		return echo.NewHTTPError(422, "Param 'IP' must be a valid IP address")
+	}
+	limit := 50
+	if value := c.QueryParam("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return echo.NewHTTPError(422, "Param 'limit' must be a positive number")
+		}
+		limit = n
+	}
+	results, err := h.service.CheckHistory(context.Background(), name, ip, limit)
+	if err != nil {
+		if err == checkers.ErrNotFound {
+			return echo.NewHTTPError(404, "Checker doesn't exist")
+		}
+		if err == checkers.ErrNoHistory {
+			return echo.NewHTTPError(422, "Checker doesn't keep history")
+		}
+		return echo.NewHTTPError(500, fmt.Sprintf("Error: %s", err))
+	}
+	return c.JSON(200, results)
+}
+
+// checkContext returns the context for a check request, asking checkers to
+// bypass their caches when the 'refresh' query param is set.
+func checkContext(c echo.Context) (context.Context, error) {
+	ctx := context.Background()
+	value := c.QueryParam("refresh")
+	if value == "" {
+		return ctx, nil
+	}
+	refresh, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, echo.NewHTTPError(422, "Param 'refresh' must be a boolean")
+	}
+	if refresh {
+		ctx = checkers.WithRefresh(ctx)
+	}
+	return ctx, nil
+}
+
+// @Summary     Evaluate the policy for an IP address.
+// @Description Use this endpoint to find out what the policy rules decide for an IP address and which rule matched.
+// @Produce     json
+// @Accept      json
+// @Tags        Policy
+// @Success     200 {object} Decision
+// @Param 		ip path string true "IP Address"
+// @Param 		body body EvaluateRequest false "Metadata of the block being decided on"
+// @Router      /evaluate/{ip} [POST]
+func (h *handler) HandleEvaluate(c echo.Context) error {
+	ip := c.Param("ip")
+	if net.ParseIP(ip) == nil {
+		return echo.NewHTTPError(422, "Param 'IP' must be a valid IP address")
+	}
+	var request PolicyRequest
+	if err := new(EvaluateRequest).Bind(c, &request); err != nil {
+		return echo.NewHTTPError(422, err.Error())
+	}
+	ctx, err := checkContext(c)
+	if err != nil {
+		return err
+	}
+	decision, err := h.service.Evaluate(ctx, ip, &request)
+	if err != nil {
+		return echo.NewHTTPError(500, fmt.Sprintf("Error: %s", err))
+	}
+	return c.JSON(200, decision)
+}
+
+// @Summary     Get networks worth blocking as a whole.
+// @Description Use this endpoint to list networks holding enough recently blocked addresses to be blocked as a whole. Networks which must not be blocked explain why in Skipped.
+// @Produce     json
+// @Tags        Escalations
+// @Success     200 {array} Escalation
+// @Router      /escalations [GET]
+func (h *handler) HandleEscalationsGetAll(c echo.Context) error {
+	escalations, err := h.service.GetEscalations(context.Background())
+	if err != nil {
+		return echo.NewHTTPError(500, fmt.Sprintf("Error: %s", err))
+	}
+	return c.JSON(200, escalations)
+}
+
+// @Summary     Block a suggested network.
+// @Description Use this endpoint to block a network suggested by GET /escalations and retire the blocked addresses it covers.
+// @Produce     json
+// @Accept      json
+// @Tags        Escalations
+// @Success     200 {object} Escalation
+// @Param 		body body EscalateRequest true "Network to block"
+// @Router      /escalations [POST]
+func (h *handler) HandleEscalationsPost(c echo.Context) error {
+	var req EscalateRequest
+	if err := req.Bind(c); err != nil {
+		return echo.NewHTTPError(422, fmt.Sprintf("Failed to validate request body: %s", err))
+	}
+	escalation, err := h.service.Escalate(context.Background(), req.Network, req.Author, req.Comment)
+	if err != nil {
+		switch err {
+		case ErrNoEscalation:
+			return echo.NewHTTPError(404, fmt.Sprintf("Error: %s", err))
+		case ErrEscalationSkipped:
+			return echo.NewHTTPError(403, fmt.Sprintf("Error: %s: %s", err, escalation.Skipped))
+		case ErrProtected:
+			return echo.NewHTTPError(403, fmt.Sprintf("Error: %s", err))
+		}
+		return echo.NewHTTPError(500, fmt.Sprintf("Error: %s", err))
+	}
+	return c.JSON(200, escalation)
+}
+
 func (h *handler) HandleAddressesSyncAll(c echo.Context) error {
 	if err := h.service.SyncAll(context.Background()); err != nil {
 		return echo.NewHTTPError(500, fmt.Sprintf("Error: %s", err))
@@ -153,10 +405,11 @@ func (h *handler) HandleAddressesSyncAll(c echo.Context) error {
 }
 
 func (h *handler) HandleAddressesSyncOne(c echo.Context) error {
-	ip := c.Param("ip")
-	if net.ParseIP(ip) == nil {
-		return echo.NewHTTPError(422, "Param 'IP' must be a valid IP address")
+	key, err := paramKey(c)
+	if err != nil {
+		return echo.NewHTTPError(422, "Param 'IP' must be an IP address, an AS number, a country code or a network")
 	}
+	ip := key.Key()
 	if err := h.service.SyncOne(context.Background(), ip); err != nil {
 		if err == sql.ErrNoRows {
 			return echo.NewHTTPError(404, "Address doesn't exist")
@@ -166,10 +419,421 @@ func (h *handler) HandleAddressesSyncOne(c echo.Context) error {
 	return c.JSON(200, nil)
 }
 
+// @Summary     Reload configuration.
+// @Description Use this endpoint to re-read the configuration and swap in new endpoints, checkers and alerters.
+// @Produce     json
+// @Tags        Admin
+// @Success     200
+// @Router      /admin/reload [POST]
+func (h *handler) HandleAdminReload(c echo.Context) error {
+	if h.reload == nil {
+		return echo.NewHTTPError(501, "Reload is not supported")
+	}
+	if err := h.reload(context.Background()); err != nil {
+		return echo.NewHTTPError(500, fmt.Sprintf("Error: %s", err))
+	}
+	return c.JSON(200, nil)
+}
+
+// @Summary     Get all endpoints.
+// @Description Use this endpoint to list registered endpoints with their state, configuration and last results.
+// @Produce     json
+// @Tags        Endpoints
+// @Success     200 {array} endpoints.Info
+// @Router      /endpoints [GET]
+func (h *handler) HandleEndpointsGetAll(c echo.Context) error {
+	return c.JSON(200, h.service.GetEndpoints(context.Background()))
+}
+
+// @Summary     Pause or resume an endpoint.
+// @Description Use this endpoint to pause an endpoint for maintenance or resume it. Operations issued while paused are queued and replayed on resume.
+// @Produce     json
+// @Accept      json
+// @Tags        Endpoints
+// @Success     200 {object} endpoints.Info
+// @Param 		name path string true "Name of the Endpoint"
+// @Router      /endpoints/{name}/state [PUT]
+func (h *handler) HandleEndpointsState(c echo.Context) error {
+	var req EndpointStateRequest
+	if err := req.Bind(c); err != nil {
+		return echo.NewHTTPError(422, fmt.Sprintf("Failed to validate request body: %s", err))
+	}
+	info, err := h.service.SetEndpointState(context.Background(), c.Param("name"), req.State)
+	if err != nil {
+		if err == endpoints.ErrNotFound {
+			return echo.NewHTTPError(404, "Endpoint doesn't exist")
+		}
+		return echo.NewHTTPError(500, fmt.Sprintf("Error: %s", err))
+	}
+	return c.JSON(200, info)
+}
+
+// @Summary     Get all checkers.
+// @Description Use this endpoint to list registered checkers with their configuration and last results.
+// @Produce     json
+// @Tags        Checkers
+// @Success     200 {array} checkers.Info
+// @Router      /checkers [GET]
+func (h *handler) HandleCheckersGetAll(c echo.Context) error {
+	return c.JSON(200, h.service.GetCheckers(context.Background()))
+}
+
+// @Summary     Get all alerters.
+// @Description Use this endpoint to list registered alerters with their configuration and last results.
+// @Produce     json
+// @Tags        Alerters
+// @Success     200 {array} alerters.Info
+// @Router      /alerters [GET]
+func (h *handler) HandleAlertersGetAll(c echo.Context) error {
+	return c.JSON(200, h.service.GetAlerters(context.Background()))
+}
+
+// paramID reads a numeric ID from the path param name.
+func paramID(c echo.Context, name string) (int64, error) {
+	id, err := strconv.ParseInt(c.Param(name), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, echo.NewHTTPError(422, fmt.Sprintf("Param '%s' must be a positive number", name))
+	}
+	return id, nil
+}
+
+// @Summary     Get all webhooks.
+// @Description Use this endpoint to list the webhooks subscribed to address changes. Secrets are never listed.
+// @Produce     json
+// @Tags        Webhooks
+// @Success     200 {array} Webhook
+// @Router      /webhooks [GET]
+func (h *handler) HandleWebhooksGetAll(c echo.Context) error {
+	webhooks, err := h.service.GetWebhooks(context.Background())
+	if err != nil {
+		return echo.NewHTTPError(500, fmt.Sprintf("Error: %s", err))
+	}
+	return c.JSON(200, webhooks)
+}
+
+// @Summary     Subscribe a webhook.
+// @Description Use this endpoint to deliver address changes to URL. Events filters them by type, e.g. 'address.blocked' or 'address.*', and Secret signs them. A secret is generated unless given, and is only returned now.
+// @Produce     json
+// @Accept      json
+// @Tags        Webhooks
+// @Success     200 {object} Webhook
+// @Router      /webhooks [POST]
+func (h *handler) HandleWebhooksPost(c echo.Context) error {
+	var req WebhookRequest
+	var webhook Webhook
+	if err := req.Bind(c, &webhook); err != nil {
+		return echo.NewHTTPError(422, fmt.Sprintf("Failed to validate request body: %s", err))
+	}
+	created, err := h.service.CreateWebhook(context.Background(), &webhook)
+	if err != nil {
+		return echo.NewHTTPError(500, fmt.Sprintf("Error: %s", err))
+	}
+	return c.JSON(200, created)
+}
+
+// @Summary     Get a webhook.
+// @Produce     json
+// @Tags        Webhooks
+// @Success     200 {object} Webhook
+// @Param       id path int true "ID of the Webhook"
+// @Router      /webhooks/{id} [GET]
+func (h *handler) HandleWebhooksGetOne(c echo.Context) error {
+	id, err := paramID(c, "id")
+	if err != nil {
+		return err
+	}
+	webhook, err := h.service.GetWebhook(context.Background(), id)
+	if err != nil {
+		return webhookError(err)
+	}
+	return c.JSON(200, webhook)
+}
+
+// @Summary     Delete a webhook.
+// @Description Use this endpoint to unsubscribe a webhook and delete its deliveries.
+// @Produce     json
+// @Tags        Webhooks
+// @Success     200
+// @Param       id path int true "ID of the Webhook"
+// @Router      /webhooks/{id} [DELETE]
+func (h *handler) HandleWebhooksDelete(c echo.Context) error {
+	id, err := paramID(c, "id")
+	if err != nil {
+		return err
+	}
+	if err := h.service.DeleteWebhook(context.Background(), id); err != nil {
+		return webhookError(err)
+	}
+	return c.JSON(200, nil)
+}
+
+// @Summary     Get the deliveries of a webhook.
+// @Description Use this endpoint to list the latest deliveries of a webhook with the outcome of their last attempt, optionally only those with the given status: 'pending', 'delivered' or 'failed'.
+// @Produce     json
+// @Tags        Webhooks
+// @Success     200 {array} WebhookDelivery
+// @Param       id path int true "ID of the Webhook"
+// @Param       status query string false "Status of the deliveries"
+// @Param       limit query int false "Maximum number of deliveries, 50 by default"
+// @Router      /webhooks/{id}/deliveries [GET]
+func (h *handler) HandleWebhooksDeliveries(c echo.Context) error {
+	id, err := paramID(c, "id")
+	if err != nil {
+		return err
+	}
+	status := c.QueryParam("status")
+	if status != "" && status != DeliveryPending && status != DeliveryDelivered && status != DeliveryFailed {
+		return echo.NewHTTPError(422, "Param 'status' must be 'pending', 'delivered' or 'failed'")
+	}
+	limit := 50
+	if value := c.QueryParam("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return echo.NewHTTPError(422, "Param 'limit' must be a positive number")
+		}
+		limit = n
+	}
+	deliveries, err := h.service.GetDeliveries(context.Background(), id, status, limit)
+	if err != nil {
+		return webhookError(err)
+	}
+	return c.JSON(200, deliveries)
+}
+
+// @Summary     Redeliver an event.
+// @Description Use this endpoint to send the event of a past delivery again. It's recorded as a new delivery of the same event ID.
+// @Produce     json
+// @Tags        Webhooks
+// @Success     200 {object} WebhookDelivery
+// @Param       id path int true "ID of the Webhook"
+// @Param       delivery path int true "ID of the Delivery"
+// @Router      /webhooks/{id}/deliveries/{delivery}/redeliver [POST]
+func (h *handler) HandleWebhooksRedeliver(c echo.Context) error {
+	id, err := paramID(c, "id")
+	if err != nil {
+		return err
+	}
+	deliveryID, err := paramID(c, "delivery")
+	if err != nil {
+		return err
+	}
+	delivery, err := h.service.Redeliver(context.Background(), id, deliveryID)
+	if err != nil {
+		if err == ErrWebhooksDisabled {
+			return echo.NewHTTPError(501, fmt.Sprintf("Error: %s", err))
+		}
+		if err == sql.ErrNoRows {
+			return echo.NewHTTPError(404, "Delivery doesn't exist")
+		}
+		return echo.NewHTTPError(500, fmt.Sprintf("Error: %s", err))
+	}
+	return c.JSON(200, delivery)
+}
+
+func webhookError(err error) error {
+	if err == sql.ErrNoRows {
+		return echo.NewHTTPError(404, "Webhook doesn't exist")
+	}
+	return echo.NewHTTPError(500, fmt.Sprintf("Error: %s", err))
+}
+
+// @Summary     Stream changes of the list.
+// @Description Use this endpoint to mirror the list: changes are read from the change log and streamed as server-sent events named 'add', 'update' or 'remove', with the sequence of the change as their ID and the change as JSON data. Clients reconnecting with the Last-Event-ID header resume after that change, as with the cursor of /changes. Without the header, or when the changes following it are no longer kept, the stream starts with a 'reset' event whose ID is the cursor: fetch the whole list, then apply the changes which follow.
+// @Produce     text/event-stream
+// @Tags        Addresses
+// @Success     200 {object} Change
+// @Param       Last-Event-ID header int false "Sequence of the last change received"
+// @Router      /events [GET]
+func (h *handler) HandleEvents(c echo.Context) error {
+	var last int64
+	if value := c.Request().Header.Get("Last-Event-ID"); value != "" {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n <= 0 {
+			return echo.NewHTTPError(422, "Header 'Last-Event-ID' must be a positive number")
+		}
+		last = n
+	}
+	ctx := c.Request().Context()
+	feed, err := h.service.GetChanges(ctx, last, 1000)
+	if err != nil {
+		return echo.NewHTTPError(500, fmt.Sprintf("Error: %s", err))
+	}
+	sub := h.service.Subscribe()
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(200)
+
+	heartbeat := time.NewTicker(sub.Heartbeat)
+	defer heartbeat.Stop()
+	for {
+		if feed.Reset {
+			if err := writeChange(res, &Change{Sequence: feed.Next, Type: ChangeReset, At: time.Now()}); err != nil {
+				return nil
+			}
+		}
+		for _, change := range feed.Changes {
+			if err := writeChange(res, change); err != nil {
+				return nil
+			}
+		}
+		last = feed.Next
+		res.Flush()
+	wait:
+		for !feed.More {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-sub.Done():
+				return nil
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(res, ": heartbeat\n\n"); err != nil {
+					return nil
+				}
+				res.Flush()
+			case <-sub.Changed(last):
+				break wait
+			}
+		}
+		if feed, err = h.service.GetChanges(ctx, last, 1000); err != nil {
+			if ctx.Err() == nil {
+				h.l.Error("Failed to execute GetChanges", zap.Error(err))
+			}
+			return nil
+		}
+	}
+}
+
+// @Summary     Get changes of the list.
+// @Description Use this endpoint to mirror the list by polling: it returns the changes following the cursor 'since', oldest first, and the cursor to ask for the next ones. Without a cursor, or when the changes following it are no longer kept, Reset is set: fetch the whole list, then ask for the changes following Next.
+// @Produce     json
+// @Tags        Addresses
+// @Success     200 {object} ChangeFeed
+// @Param       since query int false "Cursor returned as Next by the previous call"
+// @Param       limit query int false "Maximum number of changes, 1000 by default"
+// @Router      /changes [GET]
+func (h *handler) HandleChanges(c echo.Context) error {
+	var since int64
+	if value := c.QueryParam("since"); value != "" {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 0 {
+			return echo.NewHTTPError(422, "Param 'since' must be a cursor returned as 'Next'")
+		}
+		since = n
+	}
+	limit := 1000
+	if value := c.QueryParam("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > 10000 {
+			return echo.NewHTTPError(422, "Param 'limit' must be a number between 1 and 10000")
+		}
+		limit = n
+	}
+	feed, err := h.service.GetChanges(context.Background(), since, limit)
+	if err != nil {
+		return echo.NewHTTPError(500, fmt.Sprintf("Error: %s", err))
+	}
+	return c.JSON(200, feed)
+}
+
+// writeChange writes change as a server-sent event.
+func writeChange(w io.Writer, change *Change) error {
+	data, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", change.Sequence, change.Type, data)
+	return err
+}
+
+// @Summary     Run a Slack slash command.
+// @Description Use this endpoint as the request URL of the '/hbl' slash command of a Slack app: '/hbl block|allow|delete|lookup <ip> <reason>'. Requests must be signed by Slack and come from a configured user allowed to run the command. The outcome is posted to the response URL of the command.
+// @Accept      x-www-form-urlencoded
+// @Produce     json
+// @Tags        Slack
+// @Success     200
+// @Router      /slack/commands [POST]
+func (h *handler) HandleSlackCommands(c echo.Context) error {
+	cfg := h.slack.Get()
+	if err := slackRequest(c, &cfg); err != nil {
+		return err
+	}
+	command, err := slack.SlashCommandParse(c.Request())
+	if err != nil {
+		return echo.NewHTTPError(400, fmt.Sprintf("Failed to parse slash command: %s", err))
+	}
+	cmd, err := parseSlackCommand(command.Text)
+	if err != nil {
+		return c.JSON(200, ephemeral(err.Error()))
+	}
+	user, ok := cfg.user(command.UserID)
+	if !ok || !user.can(cmd.name) {
+		h.l.Info("Refused Slack command", zap.String("user", command.UserID), zap.String("command", cmd.name))
+		return c.JSON(200, ephemeral(fmt.Sprintf("You aren't allowed to %s addresses", cmd.name)))
+	}
+	h.respond(command.ResponseURL, func(ctx context.Context) *slackReply {
+		return h.runSlackCommand(ctx, user, command.UserID, cmd)
+	})
+	return c.JSON(200, ephemeral(fmt.Sprintf("Running '%s %s'...", cmd.name, cmd.address.Key())))
+}
+
+// @Summary     Handle a Slack interaction.
+// @Description Use this endpoint as the interactivity request URL of a Slack app to handle the Unblock button of alerts. Requests must be signed by Slack and come from a configured user allowed to delete addresses.
+// @Accept      x-www-form-urlencoded
+// @Tags        Slack
+// @Success     200
+// @Router      /slack/actions [POST]
+func (h *handler) HandleSlackActions(c echo.Context) error {
+	cfg := h.slack.Get()
+	if err := slackRequest(c, &cfg); err != nil {
+		return err
+	}
+	var callback slack.InteractionCallback
+	if err := json.Unmarshal([]byte(c.FormValue("payload")), &callback); err != nil {
+		return echo.NewHTTPError(400, fmt.Sprintf("Failed to parse interaction payload: %s", err))
+	}
+	action, ok := unblockAction(&callback)
+	if !ok {
+		return c.NoContent(200)
+	}
+	key := action.Value
+	user, ok := cfg.user(callback.User.ID)
+	if !ok || !user.can(SlackDelete) {
+		h.l.Info("Refused Slack action", zap.String("user", callback.User.ID), zap.String("action", action.ActionID))
+		h.respond(callback.ResponseURL, func(ctx context.Context) *slackReply {
+			return ephemeral("You aren't allowed to unblock addresses")
+		})
+		return c.NoContent(200)
+	}
+	h.respond(callback.ResponseURL, func(ctx context.Context) *slackReply {
+		if err := h.slackDelete(ctx, key, user.Author); err != nil {
+			return ephemeral(fmt.Sprintf("Failed to unblock %s: %s", key, err))
+		}
+		return inChannel(fmt.Sprintf("<@%s> unblocked %s", callback.User.ID, key))
+	})
+	return c.NoContent(200)
+}
+
 func (h *handler) HandleHealth(c echo.Context) error {
 	return c.String(200, "OK")
 }
 
+func (h *handler) HandleHealthLive(c echo.Context) error {
+	return c.String(200, "OK")
+}
+
+func (h *handler) HandleHealthReady(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	report := h.service.Readiness(ctx)
+	if report.Status == HealthFailed {
+		return c.JSON(503, report)
+	}
+	return c.JSON(200, report)
+}
+
 func (h *handler) HandleVersion(c echo.Context) error {
 	return c.String(200, "1.0.0")
 }
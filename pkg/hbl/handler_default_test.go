@@ -3,9 +3,19 @@ package hbl
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/hostinger/hbl/pkg/alerters"
+	"github.com/hostinger/hbl/pkg/checkers"
+	"github.com/hostinger/hbl/pkg/endpoints"
+	"github.com/hostinger/hbl/pkg/logger"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 )
@@ -40,6 +50,267 @@ func Test_handler_HandleAddressesGetAll(t *testing.T) {
 	}
 }
 
+func Test_handler_HandleAddressesPost_Protected(t *testing.T) {
+	e := echo.New()
+
+	protected, err := NewProtectedRanges([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ph := &handler{
+		service: &service{
+			repository: NewMockRepository(),
+			protected:  protected,
+		},
+	}
+
+	body := `{"IP":"10.1.2.3","Author":"Test","Action":"Block","Comment":"Test"}`
+	req := httptest.NewRequest("POST", "/api/v1/addresses", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	ctx := e.NewContext(req, rec)
+	ctx.SetPath("/api/v1/addresses")
+
+	err = ph.HandleAddressesPost(ctx)
+	if assert.Error(t, err) {
+		assert.Equal(t, 403, err.(*echo.HTTPError).Code)
+	}
+}
+
+func Test_handler_HandleAddressesPost_Target(t *testing.T) {
+	e := echo.New()
+
+	path := filepath.Join(t.TempDir(), "pfx2as")
+	if err := ioutil.WriteFile(path, []byte("192.0.2.0\t24\t64496\n10.0.0.0\t16\t64497_64496\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	prefixes, err := NewPrefixes(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"192.0.2.0/24", "10.0.0.0/16"}, prefixes.ForASN(64496))
+
+	protected, err := NewProtectedRanges([]string{"10.0.1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	th := &handler{
+		service: &service{
+			repository: NewMockRepository(),
+			protected:  protected,
+			prefixes:   prefixes,
+			endpoints:  endpoints.NewRegistry(),
+			alerters:   alerters.NewRegistry(),
+		},
+	}
+
+	post := func(body string) error {
+		req := httptest.NewRequest("POST", "/api/v1/addresses", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		ctx := e.NewContext(req, httptest.NewRecorder())
+		ctx.SetPath("/api/v1/addresses")
+		return th.HandleAddressesPost(ctx)
+	}
+
+	err = post(`{"Target":"asn","ASN":64497,"Author":"Test","Action":"Block","Comment":"Test"}`)
+	if assert.Error(t, err) {
+		assert.Equal(t, 403, err.(*echo.HTTPError).Code)
+	}
+	err = post(`{"Target":"country","Country":"xx1","Author":"Test","Action":"Block","Comment":"Test"}`)
+	if assert.Error(t, err) {
+		assert.Equal(t, 422, err.(*echo.HTTPError).Code)
+	}
+	assert.NoError(t, post(`{"Target":"country","Country":"ru","Author":"Test","Action":"Block","Comment":"Test"}`))
+
+	req := httptest.NewRequest("GET", "/api/v1/addresses/RU", nil)
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	ctx.SetPath("/api/v1/addresses/:ip")
+	ctx.SetParamNames("ip")
+	ctx.SetParamValues("ru")
+	if assert.NoError(t, th.HandleAddressesGetOne(ctx)) {
+		var address Address
+		if err := json.Unmarshal(rec.Body.Bytes(), &address); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, TargetCountry, address.Target)
+		assert.Equal(t, "RU", address.Country)
+	}
+}
+
+func Test_handler_HandleAddressesExport(t *testing.T) {
+	e := echo.New()
+
+	repository := NewMockRepository()
+	repository.CreateAddress(context.Background(), &Address{IP: "192.0.2.1", Author: "Test", Comment: "Test", Action: "Block", Country: "NL", ASN: 64496})
+	repository.CreateAddress(context.Background(), &Address{IP: "192.0.2.2", Author: "Test", Comment: "Test", Action: "Block", Country: "LT", ASN: 64497})
+	eh := &handler{service: &service{repository: repository}}
+
+	req := httptest.NewRequest("GET", "/api/v1/addresses/export?country=nl", nil)
+	rec := httptest.NewRecorder()
+
+	ctx := e.NewContext(req, rec)
+	ctx.SetPath("/api/v1/addresses/export")
+
+	if assert.NoError(t, eh.HandleAddressesExport(ctx)) {
+		lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+		assert.Equal(t, 200, rec.Code)
+		assert.Len(t, lines, 2)
+		assert.True(t, strings.HasPrefix(lines[1], "192.0.2.1,Block,Test,Test,,,NL,64496,,"))
+	}
+
+	req = httptest.NewRequest("GET", "/api/v1/addresses/export?asn=invalid", nil)
+	ctx = e.NewContext(req, httptest.NewRecorder())
+	err := eh.HandleAddressesExport(ctx)
+	if assert.Error(t, err) {
+		assert.Equal(t, 422, err.(*echo.HTTPError).Code)
+	}
+}
+
+func Test_handler_HandleAddressesCheck_NotFound(t *testing.T) {
+	e := echo.New()
+
+	req := httptest.NewRequest("GET", "/api/v1/addresses/check/Unknown/127.0.0.1", nil)
+	rec := httptest.NewRecorder()
+
+	ctx := e.NewContext(req, rec)
+	ctx.SetPath("/api/v1/addresses/check/:name/:ip")
+	ctx.SetParamNames("name", "ip")
+	ctx.SetParamValues("Unknown", "127.0.0.1")
+
+	err := h.HandleAddressesCheck(ctx)
+	if assert.Error(t, err) {
+		assert.Equal(t, 404, err.(*echo.HTTPError).Code)
+	}
+}
+
+func Test_checkContext(t *testing.T) {
+	e := echo.New()
+	for query, refresh := range map[string]bool{"": false, "?refresh=true": true, "?refresh=0": false} {
+		ctx, err := checkContext(e.NewContext(httptest.NewRequest("GET", "/api/v1/addresses/check/127.0.0.1"+query, nil), httptest.NewRecorder()))
+		if assert.NoError(t, err, query) {
+			assert.Equal(t, refresh, checkers.RefreshRequested(ctx), query)
+		}
+	}
+	_, err := checkContext(e.NewContext(httptest.NewRequest("GET", "/api/v1/addresses/check/127.0.0.1?refresh=yes", nil), httptest.NewRecorder()))
+	if assert.Error(t, err) {
+		assert.Equal(t, 422, err.(*echo.HTTPError).Code)
+	}
+}
+
+func Test_handler_HandleEvents(t *testing.T) {
+	e := echo.New()
+
+	r := NewMockRepository()
+	stream := NewStream(logger.NewLogger("test"), r, &StreamConfig{Poll: time.Second, Heartbeat: time.Second})
+	sh := &handler{
+		service: &service{
+			repository: r,
+			stream:     stream,
+			checkers:   checkers.NewRegistry(),
+			alerters:   alerters.NewRegistry(),
+		},
+	}
+	assert.NoError(t, sh.service.Allow(context.Background(), &Address{IP: "192.0.2.1", Author: "Test", Action: "Allow"}))
+	start, _ := r.GetChanges(context.Background(), 0, 10)
+	assert.NoError(t, sh.service.Allow(context.Background(), &Address{IP: "192.0.2.2", Author: "Test", Action: "Allow"}))
+	assert.NoError(t, sh.service.Delete(context.Background(), "192.0.2.2"))
+	// Stopping the stream ends the response once the change log is read.
+	stream.Stop()
+
+	events := func(last string) []string {
+		req := httptest.NewRequest("GET", "/api/v1/events", nil)
+		if last != "" {
+			req.Header.Set("Last-Event-ID", last)
+		}
+		rec := httptest.NewRecorder()
+		ctx := e.NewContext(req, rec)
+		ctx.SetPath("/api/v1/events")
+		if !assert.NoError(t, sh.HandleEvents(ctx)) {
+			t.FailNow()
+		}
+		assert.Equal(t, 200, rec.Code)
+		assert.Equal(t, "text/event-stream", rec.Header().Get("Content-Type"))
+		return strings.Split(strings.TrimSuffix(rec.Body.String(), "\n\n"), "\n\n")
+	}
+
+	resumed := events(strconv.FormatInt(start.Next, 10))
+	if assert.Len(t, resumed, 2) {
+		assert.True(t, strings.HasPrefix(resumed[0], fmt.Sprintf("id: %d\nevent: add\ndata: {", start.Next+1)))
+		assert.True(t, strings.HasPrefix(resumed[1], fmt.Sprintf("id: %d\nevent: remove\ndata: {", start.Next+2)))
+	}
+
+	// Without a cursor, the stream starts with a reset carrying one.
+	reset := events("")
+	if assert.Len(t, reset, 1) {
+		assert.True(t, strings.HasPrefix(reset[0], fmt.Sprintf("id: %d\nevent: reset\ndata: {", start.Next+2)))
+	}
+
+	req := httptest.NewRequest("GET", "/api/v1/events", nil)
+	req.Header.Set("Last-Event-ID", "latest")
+	ctx := e.NewContext(req, httptest.NewRecorder())
+	err := sh.HandleEvents(ctx)
+	if assert.Error(t, err) {
+		assert.Equal(t, 422, err.(*echo.HTTPError).Code)
+	}
+}
+
+func Test_handler_HandleChanges(t *testing.T) {
+	e := echo.New()
+
+	ch := &handler{
+		service: &service{
+			repository: NewMockRepository(),
+			checkers:   checkers.NewRegistry(),
+			alerters:   alerters.NewRegistry(),
+		},
+	}
+	get := func(query string) *ChangeFeed {
+		req := httptest.NewRequest("GET", "/api/v1/changes"+query, nil)
+		rec := httptest.NewRecorder()
+		ctx := e.NewContext(req, rec)
+		ctx.SetPath("/api/v1/changes")
+		if !assert.NoError(t, ch.HandleChanges(ctx)) {
+			t.FailNow()
+		}
+		var feed ChangeFeed
+		if err := json.Unmarshal(rec.Body.Bytes(), &feed); err != nil {
+			t.Fatal(err)
+		}
+		return &feed
+	}
+
+	start := get("")
+	assert.True(t, start.Reset)
+
+	ctx := context.Background()
+	assert.NoError(t, ch.service.Allow(ctx, &Address{IP: "192.0.2.1", Author: "Test", Action: "Allow"}))
+	assert.NoError(t, ch.service.Allow(ctx, &Address{IP: "192.0.2.2", Author: "Test", Action: "Allow"}))
+	assert.NoError(t, ch.service.Delete(ctx, "192.0.2.1"))
+
+	feed := get(fmt.Sprintf("?since=%d&limit=2", start.Next))
+	assert.False(t, feed.Reset)
+	assert.True(t, feed.More)
+	if assert.Len(t, feed.Changes, 2) {
+		assert.Equal(t, ChangeAdd, feed.Changes[0].Type)
+		assert.Equal(t, "192.0.2.2", feed.Changes[1].Address.IP)
+	}
+	feed = get(fmt.Sprintf("?since=%d", feed.Next))
+	assert.False(t, feed.More)
+	if assert.Len(t, feed.Changes, 1) {
+		assert.Equal(t, ChangeRemove, feed.Changes[0].Type)
+		assert.Equal(t, "192.0.2.1", feed.Changes[0].Address.IP)
+		assert.Equal(t, start.Next+3, feed.Next)
+	}
+
+	req := httptest.NewRequest("GET", "/api/v1/changes?since=-1", nil)
+	err := ch.HandleChanges(e.NewContext(req, httptest.NewRecorder()))
+	if assert.Error(t, err) {
+		assert.Equal(t, 422, err.(*echo.HTTPError).Code)
+	}
+}
+
 func Test_handler_HandleHealth(t *testing.T) {
 	e := echo.New()
 
@@ -55,6 +326,28 @@ func Test_handler_HandleHealth(t *testing.T) {
 	}
 }
 
+func Test_handler_HandleHealthReady(t *testing.T) {
+	e := echo.New()
+
+	req := httptest.NewRequest("GET", "/health/ready", nil)
+	rec := httptest.NewRecorder()
+
+	ctx := e.NewContext(req, rec)
+	ctx.SetPath("/health/ready")
+
+	if assert.NoError(t, h.HandleHealthReady(ctx)) {
+		var report HealthReport
+		if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, HealthOK, report.Status)
+		assert.Equal(t, 1, len(report.Components))
+		assert.Equal(t, "database", report.Components[0].Name)
+		assert.True(t, report.Components[0].Critical)
+		assert.Equal(t, 200, rec.Code)
+	}
+}
+
 func Test_handler_HandleVersion(t *testing.T) {
 	e := echo.New()
 
@@ -75,6 +368,9 @@ func init() {
 
 	s = &service{
 		repository: r,
+		endpoints:  endpoints.NewRegistry(),
+		checkers:   checkers.NewRegistry(),
+		alerters:   alerters.NewRegistry(),
 	}
 
 	h = &handler{
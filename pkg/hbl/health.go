@@ -0,0 +1,166 @@
+package hbl
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	HealthOK       = "ok"
+	HealthDegraded = "degraded"
+	HealthFailed   = "failed"
+)
+
+// ComponentHealth is the result of checking a single dependency, such as
+// the database or an endpoint.
+type ComponentHealth struct {
+	Name     string
+	Status   string
+	Critical bool
+	Latency  string
+	Error    string `json:",omitempty"`
+}
+
+// HealthReport is the readiness breakdown. Status is "failed" when a
+// critical component fails and "degraded" when only others do.
+type HealthReport struct {
+	Status     string
+	Components []*ComponentHealth
+}
+
+// HealthPolicy decides which components are critical for readiness. It is
+// safe for concurrent use and can be replaced at runtime.
+//
+// Components are named "database", "endpoints/<name>", "checkers/<name>"
+// and "alerters/<name>"; "<kind>/*" matches every plugin of that kind.
+type HealthPolicy struct {
+	mu       sync.RWMutex
+	critical map[string]bool
+}
+
+func NewHealthPolicy(critical []string) (*HealthPolicy, error) {
+	p := &HealthPolicy{}
+	if err := p.Set(critical); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// ValidateCritical checks that every entry names a known kind of component.
+func ValidateCritical(critical []string) error {
+	for _, name := range critical {
+		if name == "database" {
+			continue
+		}
+		parts := strings.SplitN(name, "/", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return errors.Errorf("Component '%s' must be 'database' or '<kind>/<name>'", name)
+		}
+		switch parts[0] {
+		case "endpoints", "checkers", "alerters":
+		default:
+			return errors.Errorf("Component '%s' must be of kind endpoints, checkers or alerters", name)
+		}
+	}
+	return nil
+}
+
+func (p *HealthPolicy) Set(critical []string) error {
+	if err := ValidateCritical(critical); err != nil {
+		return err
+	}
+	names := make(map[string]bool, len(critical))
+	for _, name := range critical {
+		names[name] = true
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.critical = names
+	return nil
+}
+
+// Replace makes p hold the critical components of other, which can't fail.
+func (p *HealthPolicy) Replace(other *HealthPolicy) {
+	other.mu.RLock()
+	critical := other.critical
+	other.mu.RUnlock()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.critical = critical
+}
+
+// IsCritical reports whether a failure of the component makes the service
+// not ready. Without a policy only the database is critical.
+func (p *HealthPolicy) IsCritical(name string) bool {
+	if p == nil {
+		return name == "database"
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.critical[name] {
+		return true
+	}
+	if i := strings.Index(name, "/"); i > 0 {
+		return p.critical[name[:i]+"/*"]
+	}
+	return false
+}
+
+type healthCheck struct {
+	name  string
+	check func(ctx context.Context) (bool, error)
+}
+
+// runHealthChecks runs every check concurrently and builds the report.
+// Checks reporting false are not supported and are left out.
+func runHealthChecks(ctx context.Context, policy *HealthPolicy, checks []healthCheck) *HealthReport {
+	results := make([]*ComponentHealth, len(checks))
+	var wg sync.WaitGroup
+	for i, hc := range checks {
+		wg.Add(1)
+		go func(i int, hc healthCheck) {
+			defer wg.Done()
+			start := time.Now()
+			ok, err := hc.check(ctx)
+			if !ok {
+				return
+			}
+			result := &ComponentHealth{
+				Name:     hc.name,
+				Status:   HealthOK,
+				Critical: policy.IsCritical(hc.name),
+				Latency:  time.Since(start).String(),
+			}
+			if err != nil {
+				result.Status = HealthFailed
+				result.Error = err.Error()
+			}
+			results[i] = result
+		}(i, hc)
+	}
+	wg.Wait()
+
+	report := &HealthReport{
+		Status:     HealthOK,
+		Components: []*ComponentHealth{},
+	}
+	for _, result := range results {
+		if result == nil {
+			continue
+		}
+		report.Components = append(report.Components, result)
+		if result.Status != HealthFailed {
+			continue
+		}
+		if result.Critical {
+			report.Status = HealthFailed
+		} else if report.Status == HealthOK {
+			report.Status = HealthDegraded
+		}
+	}
+	return report
+}
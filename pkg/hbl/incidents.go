@@ -0,0 +1,257 @@
+package hbl
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hostinger/hbl/pkg/alerters"
+	"github.com/hostinger/hbl/pkg/logger"
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+// Incidents HBL raises about itself, rather than about an address.
+const (
+	// IncidentMassBlock is raised when many addresses are blocked in a short
+	// time, which is either an attack or a runaway client.
+	IncidentMassBlock = "MassBlock"
+
+	// IncidentProtectedRange is raised when blocks are rejected because they
+	// would block a protected range.
+	IncidentProtectedRange = "ProtectedRange"
+
+	// IncidentSyncAll is raised when syncing every address with endpoints
+	// fails.
+	IncidentSyncAll = "SyncAll"
+)
+
+// IncidentsConfig decides when incidents are raised and resolved.
+type IncidentsConfig struct {
+	// Interval is how often incidents are checked for resolution.
+	Interval time.Duration `mapstructure:"interval"`
+
+	// MassBlockThreshold blocks within MassBlockWindow raise a mass block
+	// incident, resolved once fewer happened within the window. Zero
+	// disables the incident.
+	MassBlockThreshold int           `mapstructure:"mass_block_threshold"`
+	MassBlockWindow    time.Duration `mapstructure:"mass_block_window"`
+
+	// ProtectedWindow is how long a protected range incident stays open
+	// after the last rejected block.
+	ProtectedWindow time.Duration `mapstructure:"protected_window"`
+}
+
+func (c *IncidentsConfig) Validate() error {
+	var err error
+	if c.Interval <= 0 {
+		err = multierr.Append(err, errors.New("Field 'interval' must be positive"))
+	}
+	if c.MassBlockThreshold < 0 {
+		err = multierr.Append(err, errors.New("Field 'mass_block_threshold' must not be negative"))
+	}
+	if c.MassBlockThreshold > 0 && c.MassBlockWindow <= 0 {
+		err = multierr.Append(err, errors.New("Field 'mass_block_window' must be positive"))
+	}
+	if c.ProtectedWindow <= 0 {
+		err = multierr.Append(err, errors.New("Field 'protected_window' must be positive"))
+	}
+	return err
+}
+
+// Incidents tracks the conditions worth paging on-call about and alerts
+// when they are raised and once they clear. It is safe for concurrent use,
+// and a nil Incidents ignores everything.
+type Incidents struct {
+	mu       sync.Mutex
+	l        logger.Logger
+	alerters *alerters.Registry
+	cfg      IncidentsConfig
+	now      func() time.Time
+
+	// blocks holds the times of the latest blocks, at most the threshold
+	// of them.
+	blocks   []time.Time
+	rejected time.Time
+	open     map[string]bool
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewIncidents(l logger.Logger, a *alerters.Registry, cfg *IncidentsConfig) *Incidents {
+	i := &Incidents{
+		l:        l,
+		alerters: a,
+		now:      time.Now,
+		open:     map[string]bool{},
+	}
+	i.Set(cfg)
+	return i
+}
+
+func (i *Incidents) Set(cfg *IncidentsConfig) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.cfg = *cfg
+}
+
+// Start checks incidents for resolution in the background until Stop is
+// called.
+func (i *Incidents) Start() {
+	i.mu.Lock()
+	interval := i.cfg.Interval
+	i.mu.Unlock()
+	if interval <= 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	i.cancel = cancel
+	i.done = make(chan struct{})
+	go func() {
+		defer close(i.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				i.Check(ctx)
+			}
+		}
+	}()
+}
+
+func (i *Incidents) Stop() {
+	if i == nil || i.cancel == nil {
+		return
+	}
+	i.cancel()
+	<-i.done
+}
+
+// Blocked records a block and raises a mass block incident once the
+// threshold is reached within the window.
+func (i *Incidents) Blocked(ctx context.Context) {
+	if i == nil {
+		return
+	}
+	i.mu.Lock()
+	threshold, window := i.cfg.MassBlockThreshold, i.cfg.MassBlockWindow
+	if threshold <= 0 {
+		i.mu.Unlock()
+		return
+	}
+	now := i.now()
+	i.blocks = append(i.blocks, now)
+	if len(i.blocks) > threshold {
+		i.blocks = i.blocks[len(i.blocks)-threshold:]
+	}
+	raise := len(i.blocks) == threshold && now.Sub(i.blocks[0]) <= window && i.raise(IncidentMassBlock)
+	i.mu.Unlock()
+	if raise {
+		i.alert(ctx, IncidentMassBlock, alerters.SeverityCritical, false,
+			fmt.Sprintf("%d addresses were blocked within %s", threshold, window))
+	}
+}
+
+// Rejected raises a protected range incident for a block rejected because
+// of address.
+func (i *Incidents) Rejected(ctx context.Context, address *Address) {
+	if i == nil {
+		return
+	}
+	i.mu.Lock()
+	i.rejected = i.now()
+	raise := i.raise(IncidentProtectedRange)
+	i.mu.Unlock()
+	if raise {
+		i.alert(ctx, IncidentProtectedRange, alerters.SeverityWarning, false,
+			fmt.Sprintf("Rejected blocking %s by %s, it belongs to a protected range", address.Key(), address.Author))
+	}
+}
+
+// Synced raises a sync incident when err is set and resolves it otherwise.
+func (i *Incidents) Synced(ctx context.Context, err error) {
+	if i == nil {
+		return
+	}
+	i.mu.Lock()
+	var changed bool
+	if err != nil {
+		changed = i.raise(IncidentSyncAll)
+	} else {
+		changed = i.resolve(IncidentSyncAll)
+	}
+	i.mu.Unlock()
+	switch {
+	case changed && err != nil:
+		i.alert(ctx, IncidentSyncAll, alerters.SeverityError, false, fmt.Sprintf("Failed to sync addresses with endpoints: %s", err))
+	case changed:
+		i.alert(ctx, IncidentSyncAll, alerters.SeverityError, true, "Synced addresses with endpoints")
+	}
+}
+
+// Check resolves the mass block and protected range incidents which
+// cleared.
+func (i *Incidents) Check(ctx context.Context) {
+	if i == nil {
+		return
+	}
+	i.mu.Lock()
+	now := i.now()
+	var massBlock, protected bool
+	if i.open[IncidentMassBlock] {
+		cleared := len(i.blocks) < i.cfg.MassBlockThreshold || now.Sub(i.blocks[0]) > i.cfg.MassBlockWindow
+		massBlock = cleared && i.resolve(IncidentMassBlock)
+	}
+	if i.open[IncidentProtectedRange] && now.Sub(i.rejected) > i.cfg.ProtectedWindow {
+		protected = i.resolve(IncidentProtectedRange)
+	}
+	i.mu.Unlock()
+	if massBlock {
+		i.alert(ctx, IncidentMassBlock, alerters.SeverityCritical, true, "Blocks are back under the threshold")
+	}
+	if protected {
+		i.alert(ctx, IncidentProtectedRange, alerters.SeverityWarning, true, "No blocks of protected ranges were rejected lately")
+	}
+}
+
+// raise marks incident as open and tells whether it wasn't already. It must
+// be called with mu held.
+func (i *Incidents) raise(incident string) bool {
+	if i.open[incident] {
+		return false
+	}
+	i.open[incident] = true
+	return true
+}
+
+// resolve marks incident as closed and tells whether it was open. It must
+// be called with mu held.
+func (i *Incidents) resolve(incident string) bool {
+	if !i.open[incident] {
+		return false
+	}
+	delete(i.open, incident)
+	return true
+}
+
+func (i *Incidents) alert(ctx context.Context, incident, severity string, resolved bool, comment string) {
+	state := "Raised"
+	if resolved {
+		state = "Resolved"
+	}
+	i.l.Info(state+" incident", zap.String("incident", incident), zap.String("comment", comment))
+	i.alerters.AlertOnAll(ctx, &alerters.Alert{
+		Action:   incident,
+		Author:   "hbl",
+		Comment:  comment,
+		Severity: severity,
+		Incident: incident,
+		Resolved: resolved,
+	})
+}
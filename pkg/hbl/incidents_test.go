@@ -0,0 +1,84 @@
+package hbl
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hostinger/hbl/pkg/alerters"
+	"github.com/hostinger/hbl/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingAlerter struct {
+	alerts []*alerters.Alert
+}
+
+func (r *recordingAlerter) Name() string {
+	return "Recording"
+}
+
+func (r *recordingAlerter) Alert(ctx context.Context, alert *alerters.Alert) error {
+	r.alerts = append(r.alerts, alert)
+	return nil
+}
+
+func TestIncidents(t *testing.T) {
+	ctx := context.Background()
+	recorder := &recordingAlerter{}
+	registry := alerters.NewRegistry()
+	registry.Register(recorder)
+	incidents := NewIncidents(logger.NewLogger("test"), registry, &IncidentsConfig{
+		Interval:           time.Minute,
+		MassBlockThreshold: 3,
+		MassBlockWindow:    time.Minute,
+		ProtectedWindow:    time.Minute,
+	})
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	incidents.now = func() time.Time { return now }
+
+	t.Run("MassBlock", func(t *testing.T) {
+		recorder.alerts = nil
+		for i := 0; i < 4; i++ {
+			incidents.Blocked(ctx)
+			now = now.Add(time.Second)
+		}
+		incidents.Check(ctx)
+		now = now.Add(time.Minute)
+		incidents.Check(ctx)
+		if assert.Len(t, recorder.alerts, 2) {
+			assert.Equal(t, IncidentMassBlock, recorder.alerts[0].Incident)
+			assert.Equal(t, alerters.SeverityCritical, recorder.alerts[0].Severity)
+			assert.False(t, recorder.alerts[0].Resolved)
+			assert.True(t, recorder.alerts[1].Resolved)
+		}
+	})
+
+	t.Run("ProtectedRange", func(t *testing.T) {
+		recorder.alerts = nil
+		incidents.Rejected(ctx, &Address{IP: "10.0.0.1", Author: "ops"})
+		incidents.Rejected(ctx, &Address{IP: "10.0.0.2", Author: "ops"})
+		now = now.Add(30 * time.Second)
+		incidents.Check(ctx)
+		now = now.Add(time.Minute)
+		incidents.Check(ctx)
+		if assert.Len(t, recorder.alerts, 2) {
+			assert.Equal(t, "Rejected blocking 10.0.0.1 by ops, it belongs to a protected range", recorder.alerts[0].Comment)
+			assert.True(t, recorder.alerts[1].Resolved)
+		}
+	})
+
+	t.Run("SyncAll", func(t *testing.T) {
+		recorder.alerts = nil
+		incidents.Synced(ctx, nil)
+		incidents.Synced(ctx, errors.New("Cloudflare is unreachable"))
+		incidents.Synced(ctx, errors.New("Cloudflare is unreachable"))
+		incidents.Synced(ctx, nil)
+		if assert.Len(t, recorder.alerts, 2) {
+			assert.Equal(t, IncidentSyncAll, recorder.alerts[0].Incident)
+			assert.False(t, recorder.alerts[0].Resolved)
+			assert.True(t, recorder.alerts[1].Resolved)
+		}
+	})
+}
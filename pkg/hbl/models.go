@@ -1,13 +1,148 @@
 package hbl
 
 import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/hostinger/hbl/pkg/checkers"
+)
+
+// Targets an address entry can apply to.
+const (
+	TargetIP      = "ip"
+	TargetASN     = "asn"
+	TargetCountry = "country"
+	TargetNetwork = "network"
 )
 
 type Address struct {
-	IP        string
-	Author    string
-	Action    string
-	Comment   string
+	IP string
+
+	// Target is what the entry applies to. Entries for a whole autonomous
+	// system, country or network have no IP, their ASN, Country or Network
+	// is set instead.
+	Target  string
+	Network string `json:",omitempty"`
+
+	Author     string
+	Action     string
+	Comment    string
+	Source     string   `json:",omitempty"`
+	Categories []string `json:",omitempty"`
+
+	// Country, ASN and Organization are looked up when an IP address is
+	// created, if an enricher such as GeoIP is enabled.
+	Country      string `json:",omitempty"`
+	ASN          uint   `json:",omitempty"`
+	Organization string `json:",omitempty"`
+
 	CreatedAt time.Time
+
+	// ExpiresAt is when the block of an IP address is lifted, set from the
+	// duration of the policy rule it matched. Nil never expires.
+	ExpiresAt *time.Time `json:",omitempty"`
+
+	// Reports holds the outcome of contributing the address to checkers
+	// such as AbuseIPDB. It's only filled in when fetching one address.
+	Reports []*checkers.ReportResult `json:",omitempty"`
+}
+
+// Key identifies the entry: its IP address, its AS number such as
+// 'AS64496', its country code such as 'RU' or its network such as
+// '192.0.2.0/24'.
+func (a *Address) Key() string {
+	switch a.Target {
+	case TargetNetwork:
+		return a.Network
+	case TargetASN:
+		return fmt.Sprintf("AS%d", a.ASN)
+	case TargetCountry:
+		return a.Country
+	}
+	return a.IP
+}
+
+// isIP tells whether the entry is for a single IP address. Entries created
+// before targets existed have no Target set.
+func (a *Address) isIP() bool {
+	return a.Target != TargetASN && a.Target != TargetCountry && a.Target != TargetNetwork
+}
+
+// ParseKey returns an entry identified by key, which is an IP address, an
+// AS number, a country code or a network in CIDR notation, with only its
+// target filled in.
+func ParseKey(key string) (*Address, error) {
+	if net.ParseIP(key) != nil {
+		return &Address{IP: key, Target: TargetIP}, nil
+	}
+	if _, network, err := net.ParseCIDR(key); err == nil {
+		return &Address{Target: TargetNetwork, Network: network.String()}, nil
+	}
+	upper := strings.ToUpper(strings.TrimSpace(key))
+	if strings.HasPrefix(upper, "AS") {
+		if asn, err := strconv.ParseUint(upper[2:], 10, 32); err == nil && asn != 0 {
+			return &Address{Target: TargetASN, ASN: uint(asn)}, nil
+		}
+	}
+	if isCountryCode(upper) {
+		return &Address{Target: TargetCountry, Country: upper}, nil
+	}
+	return nil, errors.New("Must be an IP address, an AS number, a country code or a network")
+}
+
+// isCountryCode tells whether code looks like an ISO 3166-1 alpha-2 code.
+func isCountryCode(code string) bool {
+	if len(code) != 2 {
+		return false
+	}
+	for _, c := range strings.ToUpper(code) {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// AddressFilter narrows down a listing of addresses. Empty fields match
+// every address.
+type AddressFilter struct {
+	Target  string
+	Action  string
+	Country string
+	ASN     uint
+
+	// ExpiresBefore only keeps IP addresses expiring before it, when set.
+	ExpiresBefore time.Time
+}
+
+func (f *AddressFilter) Matches(address *Address) bool {
+	if f == nil {
+		return true
+	}
+	if f.Target != "" {
+		target := address.Target
+		if address.isIP() {
+			target = TargetIP
+		}
+		if f.Target != target {
+			return false
+		}
+	}
+	if f.Action != "" && f.Action != address.Action {
+		return false
+	}
+	if f.Country != "" && !strings.EqualFold(f.Country, address.Country) {
+		return false
+	}
+	if f.ASN != 0 && f.ASN != address.ASN {
+		return false
+	}
+	if !f.ExpiresBefore.IsZero() && (address.ExpiresAt == nil || !address.ExpiresAt.Before(f.ExpiresBefore)) {
+		return false
+	}
+	return true
 }
@@ -0,0 +1,358 @@
+package hbl
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/vm"
+	"github.com/hostinger/hbl/pkg/checkers"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"go.uber.org/multierr"
+)
+
+const (
+	PolicyBlock  = "block"
+	PolicyAllow  = "allow"
+	PolicyReject = "reject"
+	PolicyNone   = "none"
+)
+
+// PolicyRule decides what to do with an address when its When expression
+// holds, e.g. 'abuseipdb.score >= 90 && country != "LT"'.
+type PolicyRule struct {
+	Name   string `mapstructure:"name"`
+	When   string `mapstructure:"when"`
+	Action string `mapstructure:"action"`
+
+	// Duration is how long a block decided by the rule should last. Zero
+	// means forever.
+	Duration time.Duration `mapstructure:"duration"`
+}
+
+// PolicyConfig holds the rules, evaluated in order until one matches, and
+// named lists the rules can refer to, e.g. 'asn in protected_asns'. Rules
+// and lists may also be kept in a separate File, see Resolve.
+type PolicyConfig struct {
+	File  string                   `mapstructure:"file"`
+	Lists map[string][]interface{} `mapstructure:"lists"`
+	Rules []PolicyRule             `mapstructure:"rules"`
+}
+
+// LoadPolicyFile reads rules and lists from a YAML, TOML or JSON file.
+func LoadPolicyFile(path string) (*PolicyConfig, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, errors.Wrapf(err, "Failed to read policy file '%s'", path)
+	}
+	var cfg PolicyConfig
+	if err := v.Unmarshal(&cfg); err != nil {
+		return nil, errors.Wrapf(err, "Failed to decode policy file '%s'", path)
+	}
+	return &cfg, nil
+}
+
+// Resolve merges the rules and lists of File, if set, into c. Rules from
+// the file are evaluated after those set inline; lists set inline win.
+func (c *PolicyConfig) Resolve() error {
+	if c.File == "" {
+		return nil
+	}
+	file, err := LoadPolicyFile(c.File)
+	if err != nil {
+		return err
+	}
+	c.Rules = append(c.Rules, file.Rules...)
+	if c.Lists == nil {
+		c.Lists = map[string][]interface{}{}
+	}
+	for name, list := range file.Lists {
+		if _, ok := c.Lists[name]; !ok {
+			c.Lists[name] = list
+		}
+	}
+	return nil
+}
+
+// PolicyInput is what rules are evaluated against.
+type PolicyInput struct {
+	IP         string
+	Aggregate  *checkers.Aggregate
+	Enrichment *checkers.Enrichment
+	Request    *PolicyRequest
+}
+
+// PolicyRequest is the metadata of the block being decided on.
+type PolicyRequest struct {
+	Source     string
+	Author     string
+	Comment    string
+	Categories []string
+}
+
+// RuleEvaluation explains the outcome of one rule.
+type RuleEvaluation struct {
+	Name    string
+	When    string
+	Matched bool
+	Error   string `json:",omitempty"`
+}
+
+// Decision is the outcome of evaluating the policy for an address. Rule is
+// the rule which matched, if any, and Rules every rule evaluated up to it.
+type Decision struct {
+	IP         string
+	Action     string
+	Duration   string `json:",omitempty"`
+	Rule       string `json:",omitempty"`
+	Rules      []*RuleEvaluation
+	Aggregate  *checkers.Aggregate  `json:",omitempty"`
+	Enrichment *checkers.Enrichment `json:",omitempty"`
+
+	duration time.Duration
+}
+
+type policyRule struct {
+	PolicyRule
+	program *vm.Program
+}
+
+// Policy holds the compiled rules. It is safe for concurrent use and can be
+// replaced at runtime.
+type Policy struct {
+	mu    sync.RWMutex
+	rules []*policyRule
+	lists map[string]interface{}
+}
+
+func NewPolicy(cfg *PolicyConfig) (*Policy, error) {
+	p := &Policy{}
+	if err := p.Set(cfg); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// ValidatePolicy compiles every rule and reports all problems at once.
+func ValidatePolicy(cfg *PolicyConfig) error {
+	_, err := compilePolicy(cfg)
+	return err
+}
+
+func compilePolicy(cfg *PolicyConfig) ([]*policyRule, error) {
+	var errs error
+	names := map[string]bool{}
+	rules := make([]*policyRule, 0, len(cfg.Rules))
+	for i, rule := range cfg.Rules {
+		if strings.TrimSpace(rule.Name) == "" {
+			errs = multierr.Append(errs, errors.Errorf("Field 'rules[%d].name' must not be empty", i))
+		} else if names[rule.Name] {
+			errs = multierr.Append(errs, errors.Errorf("Rule '%s' is defined more than once", rule.Name))
+		}
+		names[rule.Name] = true
+		switch rule.Action {
+		case PolicyBlock, PolicyAllow, PolicyReject:
+		default:
+			errs = multierr.Append(errs, errors.Errorf("Rule '%s' must have action 'block', 'allow' or 'reject'", rule.Name))
+		}
+		if rule.Duration < 0 {
+			errs = multierr.Append(errs, errors.Errorf("Rule '%s' must not have a negative duration", rule.Name))
+		}
+		program, err := expr.Compile(rule.When, expr.AsBool())
+		if err != nil {
+			errs = multierr.Append(errs, errors.Wrapf(err, "Rule '%s' has an invalid expression", rule.Name))
+			continue
+		}
+		rules = append(rules, &policyRule{PolicyRule: rule, program: program})
+	}
+	for name := range cfg.Lists {
+		if reservedPolicyNames[name] {
+			errs = multierr.Append(errs, errors.Errorf("List '%s' shadows a built-in variable", name))
+		}
+	}
+	if errs != nil {
+		return nil, errs
+	}
+	return rules, nil
+}
+
+func (p *Policy) Set(cfg *PolicyConfig) error {
+	rules, err := compilePolicy(cfg)
+	if err != nil {
+		return err
+	}
+	lists := make(map[string]interface{}, len(cfg.Lists))
+	for name, values := range cfg.Lists {
+		list := make([]interface{}, 0, len(values))
+		for _, value := range values {
+			list = append(list, normalizePolicyValue(value))
+		}
+		lists[name] = list
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rules = rules
+	p.lists = lists
+	return nil
+}
+
+// Replace makes p hold the rules and lists of other, which can't fail.
+func (p *Policy) Replace(other *Policy) {
+	other.mu.RLock()
+	rules, lists := other.rules, other.lists
+	other.mu.RUnlock()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rules = rules
+	p.lists = lists
+}
+
+// Empty tells whether there are no rules to evaluate.
+func (p *Policy) Empty() bool {
+	if p == nil {
+		return true
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.rules) == 0
+}
+
+// Evaluate runs the rules in order against in and returns the decision of
+// the first one which matches. Rules which fail to evaluate, e.g. because a
+// checker had no result, don't match and are explained in the decision.
+func (p *Policy) Evaluate(in *PolicyInput) *Decision {
+	decision := &Decision{
+		IP:         in.IP,
+		Action:     PolicyNone,
+		Rules:      []*RuleEvaluation{},
+		Aggregate:  in.Aggregate,
+		Enrichment: in.Enrichment,
+	}
+	if p == nil {
+		return decision
+	}
+	p.mu.RLock()
+	rules, lists := p.rules, p.lists
+	p.mu.RUnlock()
+
+	env := policyEnv(in, lists)
+	for _, rule := range rules {
+		evaluation := &RuleEvaluation{Name: rule.Name, When: rule.When}
+		decision.Rules = append(decision.Rules, evaluation)
+		output, err := expr.Run(rule.program, env)
+		if err != nil {
+			evaluation.Error = err.Error()
+			continue
+		}
+		matched, ok := output.(bool)
+		if !ok {
+			evaluation.Error = "Expression doesn't evaluate to a boolean"
+			continue
+		}
+		if matched {
+			evaluation.Matched = true
+			decision.Action = rule.Action
+			decision.Rule = rule.Name
+			if rule.Action == PolicyBlock && rule.Duration > 0 {
+				decision.Duration = rule.Duration.String()
+				decision.duration = rule.Duration
+			}
+			break
+		}
+	}
+	return decision
+}
+
+var reservedPolicyNames = map[string]bool{
+	"ip": true, "score": true, "verdict": true,
+	"country": true, "asn": true, "organization": true,
+	"source": true, "author": true, "comment": true, "categories": true,
+}
+
+// policyEnv builds the variables rules can use. Every checker result is
+// exposed under the lower-cased checker name with its score, verdict,
+// categories, source and, when Raw provides them, checker specific fields.
+func policyEnv(in *PolicyInput, lists map[string]interface{}) map[string]interface{} {
+	env := make(map[string]interface{}, len(lists)+len(reservedPolicyNames))
+	for name, list := range lists {
+		env[name] = list
+	}
+	env["ip"] = in.IP
+	env["score"] = 0
+	env["verdict"] = checkers.VerdictUnknown
+	env["country"] = ""
+	env["asn"] = 0
+	env["organization"] = ""
+	env["source"] = ""
+	env["author"] = ""
+	env["comment"] = ""
+	env["categories"] = []interface{}{}
+
+	if in.Aggregate != nil {
+		env["score"] = in.Aggregate.Score
+		env["verdict"] = in.Aggregate.Verdict
+		for _, result := range in.Aggregate.Results {
+			checker := map[string]interface{}{}
+			switch raw := result.Raw.(type) {
+			case checkers.Fielder:
+				for key, value := range raw.Fields() {
+					checker[key] = normalizePolicyValue(value)
+				}
+			case map[string]interface{}:
+				for key, value := range raw {
+					checker[key] = normalizePolicyValue(value)
+				}
+			}
+			checker["score"] = result.Score
+			checker["verdict"] = result.Verdict
+			checker["categories"] = stringsToPolicyList(result.Categories)
+			checker["source"] = result.Source
+			env[strings.ToLower(result.Checker)] = checker
+		}
+	}
+	if in.Enrichment != nil {
+		env["country"] = in.Enrichment.Country
+		env["asn"] = int(in.Enrichment.ASN)
+		env["organization"] = in.Enrichment.Organization
+	}
+	if in.Request != nil {
+		env["source"] = in.Request.Source
+		env["author"] = in.Request.Author
+		env["comment"] = in.Request.Comment
+		env["categories"] = stringsToPolicyList(in.Request.Categories)
+	}
+	return env
+}
+
+func stringsToPolicyList(values []string) []interface{} {
+	list := make([]interface{}, 0, len(values))
+	for _, value := range values {
+		list = append(list, value)
+	}
+	return list
+}
+
+// normalizePolicyValue turns every whole number into an int, so values
+// decoded from YAML or JSON compare equal to those set by checkers.
+func normalizePolicyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int64:
+		return int(v)
+	case int32:
+		return int(v)
+	case uint:
+		return int(v)
+	case uint32:
+		return int(v)
+	case uint64:
+		return int(v)
+	case float64:
+		if v == float64(int(v)) {
+			return int(v)
+		}
+	}
+	return value
+}
@@ -0,0 +1,154 @@
+package hbl
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hostinger/hbl/pkg/alerters"
+	"github.com/hostinger/hbl/pkg/checkers"
+	"github.com/hostinger/hbl/pkg/endpoints"
+	"github.com/hostinger/hbl/pkg/logger"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+type policyCase struct {
+	Name  string
+	Input struct {
+		IP         string
+		Enrichment checkers.Enrichment
+		Request    PolicyRequest
+		Results    []struct {
+			Checker    string
+			Score      int
+			Categories []string
+			Fields     map[string]interface{}
+		}
+	}
+	Expect struct {
+		Action   string
+		Rule     string
+		Duration string
+	}
+}
+
+func TestPolicy_Fixtures(t *testing.T) {
+	cfg, err := LoadPolicyFile("../../config/policy.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := NewPolicy(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := viper.New()
+	v.SetConfigFile("testdata/policy.yaml")
+	if err := v.ReadInConfig(); err != nil {
+		t.Fatal(err)
+	}
+	var fixtures struct {
+		Cases []policyCase
+	}
+	if err := v.Unmarshal(&fixtures); err != nil {
+		t.Fatal(err)
+	}
+	assert.NotEmpty(t, fixtures.Cases)
+
+	for _, c := range fixtures.Cases {
+		t.Run(c.Name, func(t *testing.T) {
+			aggregate := &checkers.Aggregate{IP: c.Input.IP}
+			for _, result := range c.Input.Results {
+				aggregate.Results = append(aggregate.Results, &checkers.CheckResult{
+					Checker:    result.Checker,
+					Score:      result.Score,
+					Verdict:    checkers.VerdictFromScore(result.Score),
+					Categories: result.Categories,
+					Raw:        result.Fields,
+				})
+			}
+			decision := policy.Evaluate(&PolicyInput{
+				IP:         c.Input.IP,
+				Aggregate:  aggregate,
+				Enrichment: &c.Input.Enrichment,
+				Request:    &c.Input.Request,
+			})
+			assert.Equal(t, c.Expect.Action, decision.Action)
+			assert.Equal(t, c.Expect.Rule, decision.Rule)
+			assert.Equal(t, c.Expect.Duration, decision.Duration)
+		})
+	}
+}
+
+func TestValidatePolicy(t *testing.T) {
+	err := ValidatePolicy(&PolicyConfig{
+		Lists: map[string][]interface{}{"asn": {1}},
+		Rules: []PolicyRule{
+			{Name: "a", When: "score >=", Action: PolicyBlock},
+			{Name: "a", When: "score > 50", Action: "ban"},
+		},
+	})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "Rule 'a' has an invalid expression")
+		assert.Contains(t, err.Error(), "Rule 'a' is defined more than once")
+		assert.Contains(t, err.Error(), "must have action")
+		assert.Contains(t, err.Error(), "List 'asn' shadows a built-in variable")
+	}
+}
+
+func Test_service_Block_policy(t *testing.T) {
+	policy, err := NewPolicy(&PolicyConfig{
+		Rules: []PolicyRule{
+			{Name: "untrusted", When: `author == "importer"`, Action: PolicyReject},
+			{Name: "scanner", When: `source == "scanner"`, Action: PolicyBlock, Duration: time.Hour},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	repository := NewMockRepository()
+	recorder := &recordingAlerter{}
+	registry := alerters.NewRegistry()
+	registry.Register(recorder)
+	s := &service{
+		logger:     logger.NewLogger("test"),
+		repository: repository,
+		policy:     policy,
+		endpoints:  endpoints.NewRegistry(),
+		checkers:   checkers.NewRegistry(),
+		alerters:   registry,
+	}
+	ctx := context.Background()
+
+	err = s.Block(ctx, &Address{IP: "192.0.2.1", Target: TargetIP, Action: "Block", Author: "importer"})
+	assert.Equal(t, ErrRejected, err)
+	_, err = repository.GetAddress(ctx, "192.0.2.1")
+	assert.Error(t, err)
+
+	assert.NoError(t, s.Block(ctx, &Address{IP: "192.0.2.2", Target: TargetIP, Action: "Block", Source: "scanner"}))
+	assert.NoError(t, s.Block(ctx, &Address{IP: "192.0.2.3", Target: TargetIP, Action: "Block"}))
+	scanner, err := repository.GetAddress(ctx, "192.0.2.2")
+	if assert.NoError(t, err) && assert.NotNil(t, scanner.ExpiresAt) {
+		assert.WithinDuration(t, time.Now().Add(time.Hour), *scanner.ExpiresAt, time.Minute)
+	}
+	if assert.Len(t, recorder.alerts, 2) {
+		assert.Equal(t, "Block", recorder.alerts[0].List)
+		assert.Equal(t, scanner.ExpiresAt, recorder.alerts[0].ExpiresAt)
+		assert.Nil(t, recorder.alerts[1].ExpiresAt)
+	}
+
+	// Only blocks past their expiry are lifted.
+	expired, err := s.Expire(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, expired)
+	past := time.Now().Add(-time.Minute)
+	scanner.ExpiresAt = &past
+	expired, err = s.Expire(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, expired)
+	_, err = repository.GetAddress(ctx, "192.0.2.2")
+	assert.Error(t, err)
+	_, err = repository.GetAddress(ctx, "192.0.2.3")
+	assert.NoError(t, err)
+}
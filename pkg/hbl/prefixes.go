@@ -0,0 +1,117 @@
+package hbl
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Prefixes maps autonomous systems to the networks they announce, so ASN
+// targets can be blocked on endpoints which only block networks. It is safe
+// for concurrent use and can be replaced at runtime.
+type Prefixes struct {
+	mu    sync.RWMutex
+	byASN map[uint][]string
+}
+
+func NewPrefixes(path string) (*Prefixes, error) {
+	p := &Prefixes{}
+	if err := p.Load(path); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Load replaces the dataset with the one read from path. An empty path
+// clears it.
+func (p *Prefixes) Load(path string) error {
+	byASN := map[uint][]string{}
+	if path != "" {
+		var err error
+		if byASN, err = ReadPrefixes(path); err != nil {
+			return err
+		}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.byASN = byASN
+	return nil
+}
+
+// Replace makes p hold the dataset of other, which can't fail.
+func (p *Prefixes) Replace(other *Prefixes) {
+	other.mu.RLock()
+	byASN := other.byASN
+	other.mu.RUnlock()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.byASN = byASN
+}
+
+// ForASN returns the networks announced by asn, or nothing when the dataset
+// doesn't know it.
+func (p *Prefixes) ForASN(asn uint) []string {
+	if p == nil {
+		return nil
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.byASN[asn]
+}
+
+// ReadPrefixes reads a CAIDA Routeviews prefix-to-AS file, optionally
+// gzipped. Each line holds a prefix, its length and its origin, separated
+// by whitespace, e.g. '192.0.2.0 24 64496'. Prefixes with several origins,
+// written as '64496_64497' or '64496,64497', belong to each of them.
+func ReadPrefixes(path string) (map[uint][]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to open prefix file '%s'", path)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to decompress prefix file '%s'", path)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	byASN := map[uint][]string{}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, errors.Errorf("Line %d of prefix file '%s' must have 3 fields", n, path)
+		}
+		_, network, err := net.ParseCIDR(fields[0] + "/" + fields[1])
+		if err != nil {
+			return nil, errors.Errorf("Line %d of prefix file '%s' has an invalid prefix", n, path)
+		}
+		for _, origin := range strings.FieldsFunc(fields[2], func(r rune) bool { return r == '_' || r == ',' }) {
+			asn, err := strconv.ParseUint(origin, 10, 32)
+			if err != nil {
+				return nil, errors.Errorf("Line %d of prefix file '%s' has an invalid AS number", n, path)
+			}
+			byASN[uint(asn)] = append(byASN[uint(asn)], network.String())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "Failed to read prefix file '%s'", path)
+	}
+	return byASN, nil
+}
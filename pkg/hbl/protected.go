@@ -0,0 +1,82 @@
+package hbl
+
+import (
+	"net"
+	"sync"
+
+	"github.com/hostinger/hbl/pkg/utils"
+)
+
+// ProtectedRanges holds the networks which must never be blocked. It is safe
+// for concurrent use and can be replaced at runtime.
+type ProtectedRanges struct {
+	mu       sync.RWMutex
+	networks []*net.IPNet
+}
+
+func NewProtectedRanges(ranges []string) (*ProtectedRanges, error) {
+	p := &ProtectedRanges{}
+	if err := p.Set(ranges); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *ProtectedRanges) Set(ranges []string) error {
+	networks, err := utils.ParseRanges(ranges)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.networks = networks
+	return nil
+}
+
+// Replace makes p hold the ranges of other, which can't fail.
+func (p *ProtectedRanges) Replace(other *ProtectedRanges) {
+	other.mu.RLock()
+	networks := other.networks
+	other.mu.RUnlock()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.networks = networks
+}
+
+func (p *ProtectedRanges) Contains(ip string) bool {
+	if p == nil {
+		return false
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, network := range p.networks {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Overlaps tells whether network, in CIDR notation, shares any address with
+// a protected range.
+func (p *ProtectedRanges) Overlaps(network string) bool {
+	if p == nil {
+		return false
+	}
+	_, n, err := net.ParseCIDR(network)
+	if err != nil {
+		return p.Contains(network)
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, protected := range p.networks {
+		if protected.Contains(n.IP) || n.Contains(protected.IP) {
+			return true
+		}
+	}
+	return false
+}
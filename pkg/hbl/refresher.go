@@ -0,0 +1,84 @@
+package hbl
+
+import (
+	"context"
+	"time"
+
+	"github.com/hostinger/hbl/pkg/checkers"
+	"github.com/hostinger/hbl/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// Refresher periodically refreshes stale cached checker results of every
+// blocked address, so that reports served for listed addresses stay
+// current without waiting for someone to look them up.
+type Refresher struct {
+	l          logger.Logger
+	repository Repository
+	checkers   *checkers.Registry
+	interval   time.Duration
+	cancel     context.CancelFunc
+	done       chan struct{}
+}
+
+func NewRefresher(l logger.Logger, r Repository, c *checkers.Registry, interval time.Duration) *Refresher {
+	return &Refresher{
+		l:          l,
+		repository: r,
+		checkers:   c,
+		interval:   interval,
+	}
+}
+
+// Start runs the refresher in the background until Stop is called. It does
+// nothing when the interval is zero.
+func (r *Refresher) Start() {
+	if r.interval <= 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.done = make(chan struct{})
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				r.RefreshAll(ctx)
+			}
+		}
+	}()
+}
+
+func (r *Refresher) Stop() {
+	if r.cancel == nil {
+		return
+	}
+	r.cancel()
+	<-r.done
+}
+
+// RefreshAll refreshes stale results of every blocked address once.
+func (r *Refresher) RefreshAll(ctx context.Context) {
+	addresses, err := r.repository.GetAddresses(ctx, &AddressFilter{Target: TargetIP, Action: "Block"})
+	if err != nil {
+		r.l.Error("Failed to fetch addresses for refresh", zap.Error(err))
+		return
+	}
+	refreshed := 0
+	for _, address := range addresses {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := r.checkers.RefreshOnAll(ctx, address.IP); err != nil {
+			r.l.Error("Failed to refresh address", zap.String("address", address.IP), zap.Error(err))
+			continue
+		}
+		refreshed++
+	}
+	r.l.Info("Refreshed checker results of listed addresses", zap.Int("addresses", refreshed))
+}
@@ -2,11 +2,39 @@ package hbl
 
 import (
 	"context"
+	"time"
+
+	"github.com/hostinger/hbl/pkg/checkers"
 )
 
 type Repository interface {
 	GetAddress(ctx context.Context, ip string) (*Address, error)
 	CreateAddress(ctx context.Context, address *Address) error
-	GetAddresses(ctx context.Context) ([]*Address, error)
+	GetAddresses(ctx context.Context, filter *AddressFilter) ([]*Address, error)
 	DeleteAddress(ctx context.Context, ip string) error
+	SaveReports(ctx context.Context, ip string, reports []*checkers.ReportResult) error
+	Ping(ctx context.Context) error
+
+	// GetChanges returns at most limit changes following the sequence since.
+	// Changes are recorded by CreateAddress, DeleteAddress and SaveReports.
+	GetChanges(ctx context.Context, since int64, limit int) (*ChangeFeed, error)
+	DeleteChanges(ctx context.Context, before time.Time) (int64, error)
+
+	GetWebhook(ctx context.Context, id int64) (*Webhook, error)
+	GetWebhooks(ctx context.Context) ([]*Webhook, error)
+	CreateWebhook(ctx context.Context, webhook *Webhook) error
+	DeleteWebhook(ctx context.Context, id int64) error
+	GetDelivery(ctx context.Context, id int64) (*WebhookDelivery, error)
+	GetDeliveries(ctx context.Context, filter *DeliveryFilter) ([]*WebhookDelivery, error)
+	CreateDelivery(ctx context.Context, delivery *WebhookDelivery) error
+
+	// GetWebhookCursor returns the sequence of the last change published to
+	// webhooks. CreateDeliveries records the deliveries of the changes up to
+	// the sequence to and moves the cursor there from from, or returns
+	// ErrCursorMoved without recording anything when it isn't at from.
+	GetWebhookCursor(ctx context.Context) (int64, error)
+	CreateDeliveries(ctx context.Context, from, to int64, deliveries []*WebhookDelivery) error
+
+	UpdateDelivery(ctx context.Context, delivery *WebhookDelivery) error
+	DeleteDeliveries(ctx context.Context, before time.Time) (int64, error)
 }
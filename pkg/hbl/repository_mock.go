@@ -4,46 +4,285 @@ package hbl
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"sync"
+	"time"
+
+	"github.com/hostinger/hbl/pkg/checkers"
 )
 
 type mockRepository struct {
 	db map[string]*Address
+
+	// Webhooks and deliveries are sent from other goroutines, and share
+	// their IDs.
+	mu         sync.Mutex
+	lastID     int64
+	webhooks   map[int64]*Webhook
+	deliveries map[int64]*WebhookDelivery
+
+	// The change log starts at sequence 1, like the one in MySQL.
+	sequence int64
+	changes  []*Change
+	cursor   int64
 }
 
 func NewMockRepository() Repository {
 	return &mockRepository{
-		db: make(map[string]*Address),
+		db:       make(map[string]*Address),
+		sequence: 1,
+		cursor:   1,
 	}
 }
 
 func (r *mockRepository) CreateAddress(ctx context.Context, address *Address) error {
-	if _, ok := r.db[address.IP]; !ok {
-		r.db[address.IP] = address
+	if _, ok := r.db[address.Key()]; !ok {
+		r.db[address.Key()] = address
+		r.recordChange(ChangeAdd, address)
 		return nil
 	}
 	return errors.New("Address already exists")
 }
 
 func (r *mockRepository) DeleteAddress(ctx context.Context, ip string) error {
+	ip = mockKey(ip)
 	if _, ok := r.db[ip]; !ok {
 		return errors.New("Address doesn't exist")
 	}
+	r.recordChange(ChangeRemove, r.db[ip])
 	delete(r.db, ip)
 	return nil
 }
 
 func (r *mockRepository) GetAddress(ctx context.Context, ip string) (*Address, error) {
+	ip = mockKey(ip)
 	if _, ok := r.db[ip]; !ok {
-		return nil, errors.New("Address doesn't exist")
+		return nil, sql.ErrNoRows
 	}
 	return r.db[ip], nil
 }
 
-func (r *mockRepository) GetAddresses(ctx context.Context) ([]*Address, error) {
+// mockKey normalizes keys such as 'as64496' the way they are stored.
+func mockKey(key string) string {
+	if address, err := ParseKey(key); err == nil {
+		return address.Key()
+	}
+	return key
+}
+
+func (r *mockRepository) GetAddresses(ctx context.Context, filter *AddressFilter) ([]*Address, error) {
 	var addresses []*Address
 	for _, address := range r.db {
-		addresses = append(addresses, address)
+		if filter.Matches(address) {
+			addresses = append(addresses, address)
+		}
 	}
 	return addresses, nil
 }
+
+func (r *mockRepository) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (r *mockRepository) SaveReports(ctx context.Context, ip string, reports []*checkers.ReportResult) error {
+	if _, ok := r.db[ip]; !ok {
+		return errors.New("Address doesn't exist")
+	}
+	r.db[ip].Reports = append(r.db[ip].Reports, reports...)
+	r.recordChange(ChangeUpdate, r.db[ip])
+	return nil
+}
+
+func (r *mockRepository) recordChange(kind string, address *Address) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sequence++
+	copied := *address
+	r.changes = append(r.changes, &Change{Sequence: r.sequence, Type: kind, Address: &copied, At: time.Now()})
+}
+
+func (r *mockRepository) GetChanges(ctx context.Context, since int64, limit int) (*ChangeFeed, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var oldest int64
+	if len(r.changes) > 0 {
+		oldest = r.changes[0].Sequence
+	}
+	if !resumable(since, r.sequence, oldest) {
+		return &ChangeFeed{Next: r.sequence, Reset: true}, nil
+	}
+	feed := &ChangeFeed{Next: since}
+	for _, change := range r.changes {
+		if change.Sequence <= since {
+			continue
+		}
+		if len(feed.Changes) == limit {
+			feed.More = true
+			break
+		}
+		feed.Changes = append(feed.Changes, change)
+		feed.Next = change.Sequence
+	}
+	return feed, nil
+}
+
+func (r *mockRepository) DeleteChanges(ctx context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var kept []*Change
+	for _, change := range r.changes {
+		if !change.At.Before(before) {
+			kept = append(kept, change)
+		}
+	}
+	n := int64(len(r.changes) - len(kept))
+	r.changes = kept
+	return n, nil
+}
+
+func (r *mockRepository) GetWebhook(ctx context.Context, id int64) (*Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	webhook, ok := r.webhooks[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *webhook
+	return &copied, nil
+}
+
+func (r *mockRepository) GetWebhooks(ctx context.Context) ([]*Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var webhooks []*Webhook
+	for id := int64(1); id <= r.lastID; id++ {
+		if webhook, ok := r.webhooks[id]; ok {
+			copied := *webhook
+			webhooks = append(webhooks, &copied)
+		}
+	}
+	return webhooks, nil
+}
+
+func (r *mockRepository) CreateWebhook(ctx context.Context, webhook *Webhook) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.webhooks == nil {
+		r.webhooks = map[int64]*Webhook{}
+	}
+	r.lastID++
+	webhook.ID = r.lastID
+	webhook.CreatedAt = time.Now()
+	copied := *webhook
+	r.webhooks[webhook.ID] = &copied
+	return nil
+}
+
+func (r *mockRepository) DeleteWebhook(ctx context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.webhooks[id]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(r.webhooks, id)
+	for _, delivery := range r.deliveries {
+		if delivery.WebhookID == id {
+			delete(r.deliveries, delivery.ID)
+		}
+	}
+	return nil
+}
+
+func (r *mockRepository) GetDelivery(ctx context.Context, id int64) (*WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delivery, ok := r.deliveries[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *delivery
+	return &copied, nil
+}
+
+func (r *mockRepository) GetDeliveries(ctx context.Context, filter *DeliveryFilter) ([]*WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var deliveries []*WebhookDelivery
+	for id := r.lastID; id >= 1; id-- {
+		delivery, ok := r.deliveries[id]
+		if !ok || (filter.WebhookID != 0 && delivery.WebhookID != filter.WebhookID) ||
+			(filter.Status != "" && delivery.Status != filter.Status) {
+			continue
+		}
+		if filter.Limit > 0 && len(deliveries) == filter.Limit {
+			break
+		}
+		copied := *delivery
+		deliveries = append(deliveries, &copied)
+	}
+	return deliveries, nil
+}
+
+func (r *mockRepository) CreateDelivery(ctx context.Context, delivery *WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.createDelivery(delivery)
+	return nil
+}
+
+func (r *mockRepository) createDelivery(delivery *WebhookDelivery) {
+	if r.deliveries == nil {
+		r.deliveries = map[int64]*WebhookDelivery{}
+	}
+	r.lastID++
+	delivery.ID = r.lastID
+	delivery.CreatedAt = time.Now()
+	delivery.UpdatedAt = delivery.CreatedAt
+	copied := *delivery
+	r.deliveries[delivery.ID] = &copied
+}
+
+func (r *mockRepository) GetWebhookCursor(ctx context.Context) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cursor, nil
+}
+
+func (r *mockRepository) CreateDeliveries(ctx context.Context, from, to int64, deliveries []*WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cursor != from {
+		return ErrCursorMoved
+	}
+	r.cursor = to
+	for _, delivery := range deliveries {
+		r.createDelivery(delivery)
+	}
+	return nil
+}
+
+func (r *mockRepository) UpdateDelivery(ctx context.Context, delivery *WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.deliveries[delivery.ID]; !ok {
+		return sql.ErrNoRows
+	}
+	delivery.UpdatedAt = time.Now()
+	copied := *delivery
+	r.deliveries[delivery.ID] = &copied
+	return nil
+}
+
+func (r *mockRepository) DeleteDeliveries(ctx context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var n int64
+	for id, delivery := range r.deliveries {
+		if delivery.CreatedAt.Before(before) {
+			delete(r.deliveries, id)
+			n++
+		}
+	}
+	return n, nil
+}
@@ -3,7 +3,9 @@ package hbl
 import (
 	"context"
 	"database/sql"
+	"strings"
 
+	"github.com/hostinger/hbl/pkg/checkers"
 	"github.com/hostinger/hbl/pkg/logger"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
@@ -21,7 +23,14 @@ func NewMySQLRepository(l logger.Logger, db *sql.DB) Repository {
 	}
 }
 
+func (s *mysqlRepository) Ping(ctx context.Context) error {
+	return s.DB.PingContext(ctx)
+}
+
 func (s *mysqlRepository) CreateAddress(ctx context.Context, address *Address) error {
+	if !address.isIP() {
+		return s.createTarget(ctx, address)
+	}
 	tx, err := s.DB.BeginTx(ctx, nil)
 	if err != nil {
 		s.l.Error(
@@ -39,17 +48,31 @@ func (s *mysqlRepository) CreateAddress(ctx context.Context, address *Address) e
 				ip,
 				author,
 				action,
-				comment
+				comment,
+				source,
+				categories,
+				country,
+				asn,
+				organization,
+				expires_at
 			)
 		VALUES
 			(
-				INET_ATON(?),
+				INET6_ATON(?),
+				?,
+				?,
+				?,
+				?,
+				?,
+				?,
 				?,
 				?,
 				?
 			)
 	`
-	_, err = tx.ExecContext(ctx, q, address.IP, address.Author, address.Action, address.Comment)
+	_, err = tx.ExecContext(ctx, q, address.IP, address.Author, address.Action, address.Comment,
+		address.Source, strings.Join(address.Categories, ","),
+		address.Country, address.ASN, address.Organization, address.ExpiresAt)
 	if err != nil {
 		s.l.Error(
 			"Failed to execute ExecContext",
@@ -60,6 +83,10 @@ func (s *mysqlRepository) CreateAddress(ctx context.Context, address *Address) e
 		tx.Rollback() // nolint
 		return errors.Wrap(err, "Failed to execute ExecContext")
 	}
+	if err := s.recordChange(ctx, tx, "CreateAddress", ChangeAdd, address); err != nil {
+		tx.Rollback() // nolint
+		return err
+	}
 
 	if err := tx.Commit(); err != nil {
 		s.l.Error(
@@ -74,6 +101,9 @@ func (s *mysqlRepository) CreateAddress(ctx context.Context, address *Address) e
 }
 
 func (s *mysqlRepository) DeleteAddress(ctx context.Context, ip string) error {
+	if key, err := ParseKey(ip); err == nil && !key.isIP() {
+		return s.deleteTarget(ctx, key)
+	}
 	tx, err := s.DB.BeginTx(ctx, nil)
 	if err != nil {
 		s.l.Error(
@@ -84,11 +114,21 @@ func (s *mysqlRepository) DeleteAddress(ctx context.Context, ip string) error {
 		)
 		return errors.Wrap(err, "Failed to execute BeginTx")
 	}
+	// The address is read first for the change log. There's nothing to
+	// delete nor record when it doesn't exist.
+	address, err := s.getIP(ctx, tx, ip)
+	if err != nil {
+		tx.Rollback() // nolint
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	}
 	q := `
 		DELETE FROM
 			addresses
 		WHERE
-			ip = INET_ATON(?)
+			ip = INET6_ATON(?)
 		LIMIT 1
 	`
 	_, err = tx.ExecContext(ctx, q, ip)
@@ -102,6 +142,10 @@ func (s *mysqlRepository) DeleteAddress(ctx context.Context, ip string) error {
 		tx.Rollback() // nolint
 		return errors.Wrap(err, "Failed to execute ExecContext")
 	}
+	if err := s.recordChange(ctx, tx, "DeleteAddress", ChangeRemove, address); err != nil {
+		tx.Rollback() // nolint
+		return err
+	}
 	if err := tx.Commit(); err != nil {
 		s.l.Error(
 			"Failed to execute Commit",
@@ -115,6 +159,9 @@ func (s *mysqlRepository) DeleteAddress(ctx context.Context, ip string) error {
 }
 
 func (s *mysqlRepository) GetAddress(ctx context.Context, ip string) (*Address, error) {
+	if key, err := ParseKey(ip); err == nil && !key.isIP() {
+		return s.getTarget(ctx, s.DB, key)
+	}
 	tx, err := s.DB.BeginTx(ctx, nil)
 	if err != nil {
 		s.l.Error(
@@ -125,38 +172,118 @@ func (s *mysqlRepository) GetAddress(ctx context.Context, ip string) (*Address,
 		)
 		return nil, errors.Wrap(err, "Failed to execute BeginTx")
 	}
+	address, err := s.getIP(ctx, tx, ip)
+	if err != nil {
+		tx.Rollback() // nolint
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		s.l.Error(
+			"Failed to execute Commit",
+			zap.String("repository", "MySQLRepository"),
+			zap.String("method", "GetAddresses"),
+			zap.Error(err),
+		)
+		return nil, errors.Wrap(err, "Failed to execute Commit")
+	}
+	return address, nil
+}
+
+// getIP reads an IP address together with its reports.
+func (s *mysqlRepository) getIP(ctx context.Context, db querier, ip string) (*Address, error) {
 	q := `
 		SELECT
-			INET_NTOA(ip),
+			INET6_NTOA(ip),
 			author,
 			action,
 			comment,
-			created_at
+			source,
+			categories,
+			country,
+			asn,
+			organization,
+			created_at,
+			expires_at
 		FROM
 			addresses
 		WHERE
-			ip = INET_ATON(?)
+			ip = INET6_ATON(?)
 		LIMIT 1
 	`
 	var address Address
-	result := tx.QueryRowContext(ctx, q, ip)
+	var categories string
+	var expiresAt sql.NullTime
+	result := db.QueryRowContext(ctx, q, ip)
 	if err := result.Scan(&address.IP, &address.Author, &address.Action,
-		&address.Comment, &address.CreatedAt); err != nil {
+		&address.Comment, &address.Source, &categories,
+		&address.Country, &address.ASN, &address.Organization, &address.CreatedAt, &expiresAt); err != nil {
 		return nil, err
 	}
-	if err := tx.Commit(); err != nil {
+	address.Target = TargetIP
+	address.Categories = splitCategories(categories)
+	if expiresAt.Valid {
+		address.ExpiresAt = &expiresAt.Time
+	}
+
+	q = `
+		SELECT
+			reporter,
+			status,
+			message,
+			reported_at
+		FROM
+			address_reports
+		WHERE
+			ip = INET6_ATON(?)
+		ORDER BY
+			reporter
+	`
+	reports, err := db.QueryContext(ctx, q, ip)
+	if err != nil {
 		s.l.Error(
-			"Failed to execute Commit",
+			"Failed to execute QueryContext",
 			zap.String("repository", "MySQLRepository"),
-			zap.String("method", "GetAddresses"),
+			zap.String("method", "GetAddress"),
 			zap.Error(err),
 		)
-		return nil, errors.Wrap(err, "Failed to execute Commit")
+		return nil, errors.Wrap(err, "Failed to execute QueryContext")
 	}
+	for reports.Next() {
+		var report checkers.ReportResult
+		if err := reports.Scan(&report.Reporter, &report.Status,
+			&report.Message, &report.At); err != nil {
+			reports.Close()
+			return nil, err
+		}
+		address.Reports = append(address.Reports, &report)
+	}
+	reports.Close()
 	return &address, nil
 }
 
-func (s *mysqlRepository) GetAddresses(ctx context.Context) ([]*Address, error) {
+// GetAddresses returns the IP addresses followed by the ASNs and countries
+// matching filter.
+func (s *mysqlRepository) GetAddresses(ctx context.Context, filter *AddressFilter) ([]*Address, error) {
+	var addresses []*Address
+	if filter == nil || filter.Target == "" || filter.Target == TargetIP {
+		ips, err := s.getIPs(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, ips...)
+	}
+	// Only IP addresses expire.
+	if filter == nil || (filter.Target != TargetIP && filter.ExpiresBefore.IsZero()) {
+		targets, err := s.getTargets(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, targets...)
+	}
+	return addresses, nil
+}
+
+func (s *mysqlRepository) getIPs(ctx context.Context, filter *AddressFilter) ([]*Address, error) {
 	tx, err := s.DB.BeginTx(ctx, nil)
 	if err != nil {
 		s.l.Error(
@@ -169,15 +296,44 @@ func (s *mysqlRepository) GetAddresses(ctx context.Context) ([]*Address, error)
 	}
 	q := `
 		SELECT
-			INET_NTOA(ip),
+			INET6_NTOA(ip),
 			author,
 			action,
 			comment,
-			created_at
+			source,
+			categories,
+			country,
+			asn,
+			organization,
+			created_at,
+			expires_at
 		FROM
 			addresses
 	`
-	results, err := tx.QueryContext(ctx, q)
+	var conditions []string
+	var args []interface{}
+	if filter != nil {
+		if filter.Action != "" {
+			conditions = append(conditions, "action = ?")
+			args = append(args, filter.Action)
+		}
+		if filter.Country != "" {
+			conditions = append(conditions, "country = ?")
+			args = append(args, strings.ToUpper(filter.Country))
+		}
+		if filter.ASN != 0 {
+			conditions = append(conditions, "asn = ?")
+			args = append(args, filter.ASN)
+		}
+		if !filter.ExpiresBefore.IsZero() {
+			conditions = append(conditions, "expires_at < ?")
+			args = append(args, filter.ExpiresBefore)
+		}
+	}
+	if len(conditions) > 0 {
+		q += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	results, err := tx.QueryContext(ctx, q, args...)
 	if err != nil {
 		s.l.Error(
 			"Failed to execute QueryContext",
@@ -191,12 +347,23 @@ func (s *mysqlRepository) GetAddresses(ctx context.Context) ([]*Address, error)
 	var addresses []*Address
 	for results.Next() {
 		var address Address
+		var categories string
+		var expiresAt sql.NullTime
 		if err := results.Scan(&address.IP, &address.Author, &address.Action,
-			&address.Comment, &address.CreatedAt); err != nil {
+			&address.Comment, &address.Source, &categories,
+			&address.Country, &address.ASN, &address.Organization, &address.CreatedAt, &expiresAt); err != nil {
+			results.Close()
+			tx.Rollback() // nolint
 			return nil, err
 		}
+		address.Target = TargetIP
+		address.Categories = splitCategories(categories)
+		if expiresAt.Valid {
+			address.ExpiresAt = &expiresAt.Time
+		}
 		addresses = append(addresses, &address)
 	}
+	results.Close()
 
 	if err := tx.Commit(); err != nil {
 		s.l.Error(
@@ -209,3 +376,245 @@ func (s *mysqlRepository) GetAddresses(ctx context.Context) ([]*Address, error)
 	}
 	return addresses, nil
 }
+
+func (s *mysqlRepository) SaveReports(ctx context.Context, ip string, reports []*checkers.ReportResult) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		s.l.Error(
+			"Failed to execute BeginTx",
+			zap.String("repository", "MySQLRepository"),
+			zap.String("method", "SaveReports"),
+			zap.Error(err),
+		)
+		return errors.Wrap(err, "Failed to execute BeginTx")
+	}
+	q := `
+		REPLACE INTO
+			address_reports(
+				ip,
+				reporter,
+				status,
+				message,
+				reported_at
+			)
+		VALUES
+			(
+				INET6_ATON(?),
+				?,
+				?,
+				?,
+				?
+			)
+	`
+	for _, report := range reports {
+		_, err = tx.ExecContext(ctx, q, ip, report.Reporter, report.Status, report.Message, report.At)
+		if err != nil {
+			s.l.Error(
+				"Failed to execute ExecContext",
+				zap.String("repository", "MySQLRepository"),
+				zap.String("method", "SaveReports"),
+				zap.Error(err),
+			)
+			tx.Rollback() // nolint
+			return errors.Wrap(err, "Failed to execute ExecContext")
+		}
+	}
+	address, err := s.getIP(ctx, tx, ip)
+	if err == nil {
+		err = s.recordChange(ctx, tx, "SaveReports", ChangeUpdate, address)
+	}
+	// Reports of an address deleted meanwhile don't change the list.
+	if err != nil && err != sql.ErrNoRows {
+		tx.Rollback() // nolint
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		s.l.Error(
+			"Failed to execute Commit",
+			zap.String("repository", "MySQLRepository"),
+			zap.String("method", "SaveReports"),
+			zap.Error(err),
+		)
+		return errors.Wrap(err, "Failed to execute Commit")
+	}
+	return nil
+}
+
+func (s *mysqlRepository) createTarget(ctx context.Context, address *Address) error {
+	return s.inTx(ctx, "CreateTarget", func(tx *sql.Tx) error {
+		q := `
+			INSERT INTO
+				targets(
+					target,
+					value,
+					author,
+					action,
+					comment,
+					source,
+					categories
+				)
+			VALUES
+				(
+					?,
+					?,
+					?,
+					?,
+					?,
+					?,
+					?
+				)
+		`
+		_, err := tx.ExecContext(ctx, q, address.Target, address.Key(), address.Author, address.Action,
+			address.Comment, address.Source, strings.Join(address.Categories, ","))
+		if err != nil {
+			s.l.Error(
+				"Failed to execute ExecContext",
+				zap.String("repository", "MySQLRepository"),
+				zap.String("method", "CreateTarget"),
+				zap.Error(err),
+			)
+			return errors.Wrap(err, "Failed to execute ExecContext")
+		}
+		return s.recordChange(ctx, tx, "CreateTarget", ChangeAdd, address)
+	})
+}
+
+func (s *mysqlRepository) deleteTarget(ctx context.Context, key *Address) error {
+	return s.inTx(ctx, "DeleteTarget", func(tx *sql.Tx) error {
+		address, err := s.getTarget(ctx, tx, key)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		q := `
+			DELETE FROM
+				targets
+			WHERE
+				target = ? AND value = ?
+			LIMIT 1
+		`
+		if _, err := tx.ExecContext(ctx, q, key.Target, key.Key()); err != nil {
+			s.l.Error(
+				"Failed to execute ExecContext",
+				zap.String("repository", "MySQLRepository"),
+				zap.String("method", "DeleteTarget"),
+				zap.Error(err),
+			)
+			return errors.Wrap(err, "Failed to execute ExecContext")
+		}
+		return s.recordChange(ctx, tx, "DeleteTarget", ChangeRemove, address)
+	})
+}
+
+func (s *mysqlRepository) getTarget(ctx context.Context, db querier, key *Address) (*Address, error) {
+	q := `
+		SELECT
+			target,
+			value,
+			author,
+			action,
+			comment,
+			source,
+			categories,
+			created_at
+		FROM
+			targets
+		WHERE
+			target = ? AND value = ?
+		LIMIT 1
+	`
+	return scanTarget(db.QueryRowContext(ctx, q, key.Target, key.Key()))
+}
+
+func (s *mysqlRepository) getTargets(ctx context.Context, filter *AddressFilter) ([]*Address, error) {
+	q := `
+		SELECT
+			target,
+			value,
+			author,
+			action,
+			comment,
+			source,
+			categories,
+			created_at
+		FROM
+			targets
+	`
+	var conditions []string
+	var args []interface{}
+	if filter != nil {
+		if filter.Target != "" {
+			conditions = append(conditions, "target = ?")
+			args = append(args, filter.Target)
+		}
+		if filter.Action != "" {
+			conditions = append(conditions, "action = ?")
+			args = append(args, filter.Action)
+		}
+		// A target is either a country or an ASN, never both.
+		if filter.Country != "" {
+			conditions = append(conditions, "target = ? AND value = ?")
+			args = append(args, TargetCountry, strings.ToUpper(filter.Country))
+		}
+		if filter.ASN != 0 {
+			key := &Address{Target: TargetASN, ASN: filter.ASN}
+			conditions = append(conditions, "target = ? AND value = ?")
+			args = append(args, TargetASN, key.Key())
+		}
+	}
+	if len(conditions) > 0 {
+		q += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	results, err := s.DB.QueryContext(ctx, q, args...)
+	if err != nil {
+		s.l.Error(
+			"Failed to execute QueryContext",
+			zap.String("repository", "MySQLRepository"),
+			zap.String("method", "GetTargets"),
+			zap.Error(err),
+		)
+		return nil, errors.Wrap(err, "Failed to execute QueryContext")
+	}
+	defer results.Close()
+	var targets []*Address
+	for results.Next() {
+		target, err := scanTarget(results)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+	return targets, results.Err()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTarget(row scanner) (*Address, error) {
+	var target, value, categories string
+	var address Address
+	if err := row.Scan(&target, &value, &address.Author, &address.Action,
+		&address.Comment, &address.Source, &categories, &address.CreatedAt); err != nil {
+		return nil, err
+	}
+	key, err := ParseKey(value)
+	if err != nil || key.Target != target {
+		return nil, errors.Errorf("Target '%s' has an invalid value '%s'", target, value)
+	}
+	address.Target = key.Target
+	address.ASN = key.ASN
+	address.Country = key.Country
+	address.Network = key.Network
+	address.Categories = splitCategories(categories)
+	return &address, nil
+}
+
+func splitCategories(categories string) []string {
+	if categories == "" {
+		return nil
+	}
+	return strings.Split(categories, ",")
+}
@@ -0,0 +1,186 @@
+package hbl
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// querier runs queries on the database or within a transaction.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// inTx runs f within a transaction, committed unless f fails.
+func (s *mysqlRepository) inTx(ctx context.Context, method string, f func(tx *sql.Tx) error) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		s.l.Error(
+			"Failed to execute BeginTx",
+			zap.String("repository", "MySQLRepository"),
+			zap.String("method", method),
+			zap.Error(err),
+		)
+		return errors.Wrap(err, "Failed to execute BeginTx")
+	}
+	if err := f(tx); err != nil {
+		tx.Rollback() // nolint
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		s.l.Error(
+			"Failed to execute Commit",
+			zap.String("repository", "MySQLRepository"),
+			zap.String("method", method),
+			zap.Error(err),
+		)
+		return errors.Wrap(err, "Failed to execute Commit")
+	}
+	return nil
+}
+
+// recordChange appends a change of address to the change log within tx.
+// The row of the sequence stays locked until tx ends, so changes commit in
+// the order of their sequence and readers never skip one still in flight.
+func (s *mysqlRepository) recordChange(ctx context.Context, tx *sql.Tx, method, kind string, address *Address) error {
+	result, err := tx.ExecContext(ctx, `UPDATE address_changes_sequence SET id = LAST_INSERT_ID(id + 1)`)
+	if err != nil {
+		s.l.Error(
+			"Failed to execute ExecContext",
+			zap.String("repository", "MySQLRepository"),
+			zap.String("method", method),
+			zap.Error(err),
+		)
+		return errors.Wrap(err, "Failed to execute ExecContext")
+	}
+	sequence, err := result.LastInsertId()
+	if err != nil {
+		return errors.Wrap(err, "Failed to execute LastInsertId")
+	}
+	snapshot := *address
+	if snapshot.CreatedAt.IsZero() {
+		snapshot.CreatedAt = time.Now()
+	}
+	data, err := json.Marshal(&snapshot)
+	if err != nil {
+		return errors.Wrap(err, "Failed to marshal address into JSON")
+	}
+	q := `
+		INSERT INTO
+			address_changes(
+				id,
+				type,
+				entry,
+				address
+			)
+		VALUES
+			(
+				?,
+				?,
+				?,
+				?
+			)
+	`
+	if _, err := tx.ExecContext(ctx, q, sequence, kind, address.Key(), string(data)); err != nil {
+		s.l.Error(
+			"Failed to execute ExecContext",
+			zap.String("repository", "MySQLRepository"),
+			zap.String("method", method),
+			zap.Error(err),
+		)
+		return errors.Wrap(err, "Failed to execute ExecContext")
+	}
+	return nil
+}
+
+func (s *mysqlRepository) GetChanges(ctx context.Context, since int64, limit int) (*ChangeFeed, error) {
+	var feed *ChangeFeed
+	err := s.inTx(ctx, "GetChanges", func(tx *sql.Tx) error {
+		// Both reads see the same snapshot as the changes which follow.
+		var head int64
+		var oldest sql.NullInt64
+		if err := tx.QueryRowContext(ctx, `SELECT id FROM address_changes_sequence LIMIT 1`).Scan(&head); err != nil {
+			return errors.Wrap(err, "Failed to read the sequence of changes")
+		}
+		if err := tx.QueryRowContext(ctx, `SELECT MIN(id) FROM address_changes`).Scan(&oldest); err != nil {
+			return errors.Wrap(err, "Failed to read the oldest change")
+		}
+		if !resumable(since, head, oldest.Int64) {
+			feed = &ChangeFeed{Next: head, Reset: true}
+			return nil
+		}
+		q := `
+			SELECT
+				id,
+				type,
+				address,
+				created_at
+			FROM
+				address_changes
+			WHERE
+				id > ?
+			ORDER BY
+				id
+			LIMIT ?
+		`
+		rows, err := tx.QueryContext(ctx, q, since, limit+1)
+		if err != nil {
+			s.l.Error(
+				"Failed to execute QueryContext",
+				zap.String("repository", "MySQLRepository"),
+				zap.String("method", "GetChanges"),
+				zap.Error(err),
+			)
+			return errors.Wrap(err, "Failed to execute QueryContext")
+		}
+		defer rows.Close()
+		feed = &ChangeFeed{Next: since}
+		for rows.Next() {
+			if len(feed.Changes) == limit {
+				feed.More = true
+				break
+			}
+			var change Change
+			var address string
+			if err := rows.Scan(&change.Sequence, &change.Type, &address, &change.At); err != nil {
+				return err
+			}
+			if err := json.Unmarshal([]byte(address), &change.Address); err != nil {
+				return errors.Wrap(err, "Failed to unmarshal address from JSON")
+			}
+			feed.Changes = append(feed.Changes, &change)
+			feed.Next = change.Sequence
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return feed, nil
+}
+
+func (s *mysqlRepository) DeleteChanges(ctx context.Context, before time.Time) (int64, error) {
+	q := `
+		DELETE FROM
+			address_changes
+		WHERE
+			created_at < ?
+	`
+	result, err := s.DB.ExecContext(ctx, q, before)
+	if err != nil {
+		s.l.Error(
+			"Failed to execute ExecContext",
+			zap.String("repository", "MySQLRepository"),
+			zap.String("method", "DeleteChanges"),
+			zap.Error(err),
+		)
+		return 0, errors.Wrap(err, "Failed to execute ExecContext")
+	}
+	return result.RowsAffected()
+}
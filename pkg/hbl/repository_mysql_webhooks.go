@@ -0,0 +1,363 @@
+package hbl
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+func (s *mysqlRepository) GetWebhook(ctx context.Context, id int64) (*Webhook, error) {
+	q := `
+		SELECT
+			id,
+			url,
+			events,
+			secret,
+			created_at
+		FROM
+			webhooks
+		WHERE
+			id = ?
+		LIMIT 1
+	`
+	return scanWebhook(s.DB.QueryRowContext(ctx, q, id))
+}
+
+func (s *mysqlRepository) GetWebhooks(ctx context.Context) ([]*Webhook, error) {
+	q := `
+		SELECT
+			id,
+			url,
+			events,
+			secret,
+			created_at
+		FROM
+			webhooks
+		ORDER BY
+			id
+	`
+	rows, err := s.DB.QueryContext(ctx, q)
+	if err != nil {
+		s.l.Error(
+			"Failed to execute QueryContext",
+			zap.String("repository", "MySQLRepository"),
+			zap.String("method", "GetWebhooks"),
+			zap.Error(err),
+		)
+		return nil, errors.Wrap(err, "Failed to execute QueryContext")
+	}
+	defer rows.Close()
+	var webhooks []*Webhook
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+func scanWebhook(row scanner) (*Webhook, error) {
+	var webhook Webhook
+	var events string
+	if err := row.Scan(&webhook.ID, &webhook.URL, &events, &webhook.Secret, &webhook.CreatedAt); err != nil {
+		return nil, err
+	}
+	webhook.Events = splitCategories(events)
+	return &webhook, nil
+}
+
+func (s *mysqlRepository) CreateWebhook(ctx context.Context, webhook *Webhook) error {
+	q := `
+		INSERT INTO
+			webhooks(
+				url,
+				events,
+				secret
+			)
+		VALUES
+			(
+				?,
+				?,
+				?
+			)
+	`
+	result, err := s.DB.ExecContext(ctx, q, webhook.URL, strings.Join(webhook.Events, ","), webhook.Secret)
+	if err != nil {
+		s.l.Error(
+			"Failed to execute ExecContext",
+			zap.String("repository", "MySQLRepository"),
+			zap.String("method", "CreateWebhook"),
+			zap.Error(err),
+		)
+		return errors.Wrap(err, "Failed to execute ExecContext")
+	}
+	webhook.ID, err = result.LastInsertId()
+	return err
+}
+
+// DeleteWebhook deletes the webhook and its deliveries.
+func (s *mysqlRepository) DeleteWebhook(ctx context.Context, id int64) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		s.l.Error(
+			"Failed to execute BeginTx",
+			zap.String("repository", "MySQLRepository"),
+			zap.String("method", "DeleteWebhook"),
+			zap.Error(err),
+		)
+		return errors.Wrap(err, "Failed to execute BeginTx")
+	}
+	for _, q := range []string{
+		`DELETE FROM webhook_deliveries WHERE webhook_id = ?`,
+		`DELETE FROM webhooks WHERE id = ?`,
+	} {
+		if _, err := tx.ExecContext(ctx, q, id); err != nil {
+			s.l.Error(
+				"Failed to execute ExecContext",
+				zap.String("repository", "MySQLRepository"),
+				zap.String("method", "DeleteWebhook"),
+				zap.Error(err),
+			)
+			tx.Rollback() // nolint
+			return errors.Wrap(err, "Failed to execute ExecContext")
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		s.l.Error(
+			"Failed to execute Commit",
+			zap.String("repository", "MySQLRepository"),
+			zap.String("method", "DeleteWebhook"),
+			zap.Error(err),
+		)
+		return errors.Wrap(err, "Failed to execute Commit")
+	}
+	return nil
+}
+
+const deliveryColumns = `
+			id,
+			webhook_id,
+			event_id,
+			event,
+			payload,
+			status,
+			attempts,
+			status_code,
+			error,
+			created_at,
+			updated_at
+`
+
+func (s *mysqlRepository) GetDelivery(ctx context.Context, id int64) (*WebhookDelivery, error) {
+	q := `SELECT` + deliveryColumns + `
+		FROM
+			webhook_deliveries
+		WHERE
+			id = ?
+		LIMIT 1
+	`
+	return scanDelivery(s.DB.QueryRowContext(ctx, q, id))
+}
+
+// GetDeliveries returns the deliveries matching filter, newest first.
+func (s *mysqlRepository) GetDeliveries(ctx context.Context, filter *DeliveryFilter) ([]*WebhookDelivery, error) {
+	var conditions []string
+	var args []interface{}
+	if filter.WebhookID != 0 {
+		conditions = append(conditions, "webhook_id = ?")
+		args = append(args, filter.WebhookID)
+	}
+	if filter.Status != "" {
+		conditions = append(conditions, "status = ?")
+		args = append(args, filter.Status)
+	}
+	q := `SELECT` + deliveryColumns + `
+		FROM
+			webhook_deliveries
+	`
+	if len(conditions) > 0 {
+		q += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	q += " ORDER BY id DESC"
+	if filter.Limit > 0 {
+		q += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+	rows, err := s.DB.QueryContext(ctx, q, args...)
+	if err != nil {
+		s.l.Error(
+			"Failed to execute QueryContext",
+			zap.String("repository", "MySQLRepository"),
+			zap.String("method", "GetDeliveries"),
+			zap.Error(err),
+		)
+		return nil, errors.Wrap(err, "Failed to execute QueryContext")
+	}
+	defer rows.Close()
+	var deliveries []*WebhookDelivery
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+func scanDelivery(row scanner) (*WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	var payload string
+	if err := row.Scan(&delivery.ID, &delivery.WebhookID, &delivery.EventID, &delivery.Event,
+		&payload, &delivery.Status, &delivery.Attempts, &delivery.StatusCode, &delivery.Error,
+		&delivery.CreatedAt, &delivery.UpdatedAt); err != nil {
+		return nil, err
+	}
+	delivery.Payload = []byte(payload)
+	return &delivery, nil
+}
+
+func (s *mysqlRepository) CreateDelivery(ctx context.Context, delivery *WebhookDelivery) error {
+	return s.createDelivery(ctx, s.DB, "CreateDelivery", delivery)
+}
+
+func (s *mysqlRepository) createDelivery(ctx context.Context, db querier, method string, delivery *WebhookDelivery) error {
+	q := `
+		INSERT INTO
+			webhook_deliveries(
+				webhook_id,
+				event_id,
+				event,
+				payload,
+				status
+			)
+		VALUES
+			(
+				?,
+				?,
+				?,
+				?,
+				?
+			)
+	`
+	result, err := db.ExecContext(ctx, q, delivery.WebhookID, delivery.EventID, delivery.Event,
+		string(delivery.Payload), delivery.Status)
+	if err != nil {
+		s.l.Error(
+			"Failed to execute ExecContext",
+			zap.String("repository", "MySQLRepository"),
+			zap.String("method", method),
+			zap.Error(err),
+		)
+		return errors.Wrap(err, "Failed to execute ExecContext")
+	}
+	delivery.ID, err = result.LastInsertId()
+	return err
+}
+
+func (s *mysqlRepository) GetWebhookCursor(ctx context.Context) (int64, error) {
+	var cursor int64
+	if err := s.DB.QueryRowContext(ctx, `SELECT id FROM webhook_cursor LIMIT 1`).Scan(&cursor); err != nil {
+		s.l.Error(
+			"Failed to execute QueryRowContext",
+			zap.String("repository", "MySQLRepository"),
+			zap.String("method", "GetWebhookCursor"),
+			zap.Error(err),
+		)
+		return 0, errors.Wrap(err, "Failed to execute QueryRowContext")
+	}
+	return cursor, nil
+}
+
+func (s *mysqlRepository) CreateDeliveries(ctx context.Context, from, to int64, deliveries []*WebhookDelivery) error {
+	return s.inTx(ctx, "CreateDeliveries", func(tx *sql.Tx) error {
+		// The row of the cursor stays locked until tx ends, so servers
+		// publishing the same changes wait for each other and all but one
+		// find it moved.
+		result, err := tx.ExecContext(ctx, `UPDATE webhook_cursor SET id = ? WHERE id = ?`, to, from)
+		if err != nil {
+			s.l.Error(
+				"Failed to execute ExecContext",
+				zap.String("repository", "MySQLRepository"),
+				zap.String("method", "CreateDeliveries"),
+				zap.Error(err),
+			)
+			return errors.Wrap(err, "Failed to execute ExecContext")
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return errors.Wrap(err, "Failed to execute RowsAffected")
+		}
+		if n == 0 {
+			return ErrCursorMoved
+		}
+		for _, delivery := range deliveries {
+			if err := s.createDelivery(ctx, tx, "CreateDeliveries", delivery); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *mysqlRepository) UpdateDelivery(ctx context.Context, delivery *WebhookDelivery) error {
+	q := `
+		UPDATE
+			webhook_deliveries
+		SET
+			status = ?,
+			attempts = ?,
+			status_code = ?,
+			error = ?
+		WHERE
+			id = ?
+	`
+	_, err := s.DB.ExecContext(ctx, q, delivery.Status, delivery.Attempts, delivery.StatusCode,
+		truncate(delivery.Error, 255), delivery.ID)
+	if err != nil {
+		s.l.Error(
+			"Failed to execute ExecContext",
+			zap.String("repository", "MySQLRepository"),
+			zap.String("method", "UpdateDelivery"),
+			zap.Error(err),
+		)
+		return errors.Wrap(err, "Failed to execute ExecContext")
+	}
+	return nil
+}
+
+// DeleteDeliveries deletes the deliveries created before before, pending
+// ones included, and returns how many there were.
+func (s *mysqlRepository) DeleteDeliveries(ctx context.Context, before time.Time) (int64, error) {
+	q := `
+		DELETE FROM
+			webhook_deliveries
+		WHERE
+			created_at < ?
+	`
+	result, err := s.DB.ExecContext(ctx, q, before)
+	if err != nil {
+		s.l.Error(
+			"Failed to execute ExecContext",
+			zap.String("repository", "MySQLRepository"),
+			zap.String("method", "DeleteDeliveries"),
+			zap.Error(err),
+		)
+		return 0, errors.Wrap(err, "Failed to execute ExecContext")
+	}
+	return result.RowsAffected()
+}
+
+// truncate cuts s to at most n bytes to fit its column.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
@@ -3,16 +3,28 @@ package hbl
 import (
 	"errors"
 	"net"
+	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/labstack/echo/v4"
 )
 
 type BlockRequest struct {
-	IP      string
-	Author  string
-	Action  string
-	Comment string
+	IP string
+
+	// Target is 'ip', the default, 'asn', 'country' or 'network'. ASN,
+	// Country or Network identifies the target when it isn't an IP address.
+	Target  string
+	ASN     uint
+	Country string
+	Network string
+
+	Author     string
+	Action     string
+	Comment    string
+	Source     string
+	Categories []string
 }
 
 func (m *BlockRequest) Bind(c echo.Context, a *Address) error {
@@ -22,16 +34,47 @@ func (m *BlockRequest) Bind(c echo.Context, a *Address) error {
 	if err := m.Validate(); err != nil {
 		return err
 	}
-	a.IP = m.IP
+	a.Target = m.Target
+	switch m.Target {
+	case TargetASN:
+		a.ASN = m.ASN
+	case TargetCountry:
+		a.Country = strings.ToUpper(m.Country)
+	case TargetNetwork:
+		_, network, _ := net.ParseCIDR(m.Network)
+		a.Network = network.String()
+	default:
+		a.Target = TargetIP
+		a.IP = m.IP
+	}
 	a.Action = m.Action
 	a.Author = m.Author
 	a.Comment = m.Comment
+	a.Source = m.Source
+	a.Categories = m.Categories
 	return nil
 }
 
 func (m *BlockRequest) Validate() error {
-	if net.ParseIP(m.IP) == nil {
-		return errors.New("Field 'IP' must be a valid IP address")
+	switch m.Target {
+	case "", TargetIP:
+		if net.ParseIP(m.IP) == nil {
+			return errors.New("Field 'IP' must be a valid IP address")
+		}
+	case TargetASN:
+		if m.ASN == 0 {
+			return errors.New("Field 'ASN' must be an AS number")
+		}
+	case TargetCountry:
+		if !isCountryCode(m.Country) {
+			return errors.New("Field 'Country' must be an ISO 3166-1 alpha-2 code")
+		}
+	case TargetNetwork:
+		if _, _, err := net.ParseCIDR(m.Network); err != nil {
+			return errors.New("Field 'Network' must be in CIDR notation")
+		}
+	default:
+		return errors.New("Field 'Target' must be 'ip', 'asn', 'country' or 'network'")
 	}
 	if strings.TrimSpace(m.Author) == "" {
 		return errors.New("Field 'Author' must not be empty")
@@ -47,3 +90,163 @@ func (m *BlockRequest) Validate() error {
 	}
 	return nil
 }
+
+// AddressFilterRequest reads an AddressFilter from query params.
+type AddressFilterRequest struct {
+	Target  string
+	Action  string
+	Country string
+	ASN     string
+}
+
+func (m *AddressFilterRequest) Bind(c echo.Context, f *AddressFilter) error {
+	m.Target = c.QueryParam("target")
+	m.Action = c.QueryParam("action")
+	m.Country = c.QueryParam("country")
+	m.ASN = c.QueryParam("asn")
+	if err := m.Validate(); err != nil {
+		return err
+	}
+	f.Target = m.Target
+	f.Action = m.Action
+	f.Country = strings.ToUpper(m.Country)
+	if m.ASN != "" {
+		asn, _ := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(m.ASN), "AS"), 10, 32)
+		f.ASN = uint(asn)
+	}
+	return nil
+}
+
+func (m *AddressFilterRequest) Validate() error {
+	switch m.Target {
+	case "", TargetIP, TargetASN, TargetCountry, TargetNetwork:
+	default:
+		return errors.New("Param 'target' must be 'ip', 'asn', 'country' or 'network'")
+	}
+	if m.Action != "" && m.Action != "Block" && m.Action != "Allow" {
+		return errors.New("Param 'action' must be either 'Block' or 'Allow'")
+	}
+	if m.Country != "" && !isCountryCode(m.Country) {
+		return errors.New("Param 'country' must be an ISO 3166-1 alpha-2 code")
+	}
+	if m.ASN != "" {
+		if _, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(m.ASN), "AS"), 10, 32); err != nil {
+			return errors.New("Param 'asn' must be an AS number")
+		}
+	}
+	return nil
+}
+
+// EvaluateRequest is the optional metadata policy rules are evaluated
+// against together with checker results.
+type EvaluateRequest struct {
+	Source     string
+	Author     string
+	Comment    string
+	Categories []string
+}
+
+func (m *EvaluateRequest) Bind(c echo.Context, r *PolicyRequest) error {
+	if c.Request().ContentLength != 0 {
+		if err := c.Bind(m); err != nil {
+			return err
+		}
+	}
+	r.Source = m.Source
+	r.Author = m.Author
+	r.Comment = m.Comment
+	r.Categories = m.Categories
+	return nil
+}
+
+// EscalateRequest blocks a network suggested for escalation.
+type EscalateRequest struct {
+	Network string
+	Author  string
+	Comment string
+}
+
+func (m *EscalateRequest) Bind(c echo.Context) error {
+	if err := c.Bind(m); err != nil {
+		return err
+	}
+	if err := m.Validate(); err != nil {
+		return err
+	}
+	_, network, _ := net.ParseCIDR(m.Network)
+	m.Network = network.String()
+	return nil
+}
+
+func (m *EscalateRequest) Validate() error {
+	if _, _, err := net.ParseCIDR(m.Network); err != nil {
+		return errors.New("Field 'Network' must be in CIDR notation")
+	}
+	if strings.TrimSpace(m.Author) == "" {
+		return errors.New("Field 'Author' must not be empty")
+	}
+	if strings.TrimSpace(m.Comment) == "" {
+		return errors.New("Field 'Comment' must not be empty")
+	}
+	return nil
+}
+
+type EndpointStateRequest struct {
+	State string
+}
+
+func (m *EndpointStateRequest) Bind(c echo.Context) error {
+	if err := c.Bind(m); err != nil {
+		return err
+	}
+	return m.Validate()
+}
+
+func (m *EndpointStateRequest) Validate() error {
+	if m.State != "paused" && m.State != "active" {
+		return errors.New("Field 'State' must be either 'paused' or 'active'")
+	}
+	return nil
+}
+
+type WebhookRequest struct {
+	URL    string
+	Events []string
+	Secret string
+}
+
+func (m *WebhookRequest) Bind(c echo.Context, w *Webhook) error {
+	if err := c.Bind(m); err != nil {
+		return err
+	}
+	if err := m.Validate(); err != nil {
+		return err
+	}
+	w.URL = m.URL
+	w.Events = m.Events
+	w.Secret = m.Secret
+	return nil
+}
+
+func (m *WebhookRequest) Validate() error {
+	u, err := url.ParseRequestURI(m.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("Field 'URL' must be an HTTP or HTTPS URL")
+	}
+	if len(m.URL) > 2048 {
+		return errors.New("Field 'URL' must not be longer than 2048 characters")
+	}
+	if err := ValidateEvents(m.Events); err != nil {
+		return err
+	}
+	if len(strings.Join(m.Events, ",")) > 255 {
+		return errors.New("Field 'Events' must not be longer than 255 characters")
+	}
+	if m.Secret != "" && len(m.Secret) < 16 {
+		return errors.New("Field 'Secret' must be at least 16 characters long")
+	}
+	if len(m.Secret) > 255 {
+		return errors.New("Field 'Secret' must not be longer than 255 characters")
+	}
+	return nil
+}
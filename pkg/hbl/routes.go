@@ -22,6 +22,16 @@ func (api *API) GetRoutes() []*Route {
 			Path:   "/health",
 			Func:   api.Handler.HandleHealth,
 		},
+		{
+			Method: "GET",
+			Path:   "/health/live",
+			Func:   api.Handler.HandleHealthLive,
+		},
+		{
+			Method: "GET",
+			Path:   "/health/ready",
+			Func:   api.Handler.HandleHealthReady,
+		},
 		// Addresses
 		{
 			Method: "GET",
@@ -31,6 +41,14 @@ func (api *API) GetRoutes() []*Route {
 				KeyAuthMiddleware,
 			},
 		},
+		{
+			Method: "GET",
+			Path:   "/api/v1/addresses/export",
+			Func:   api.Handler.HandleAddressesExport,
+			Middleware: []echo.MiddlewareFunc{
+				KeyAuthMiddleware,
+			},
+		},
 		{
 			Method: "POST",
 			Path:   "/api/v1/addresses",
@@ -55,6 +73,14 @@ func (api *API) GetRoutes() []*Route {
 				KeyAuthMiddleware,
 			},
 		},
+		{
+			Method: "GET",
+			Path:   "/api/v1/addresses/check/:ip",
+			Func:   api.Handler.HandleAddressesCheckAll,
+			Middleware: []echo.MiddlewareFunc{
+				KeyAuthMiddleware,
+			},
+		},
 		{
 			Method: "GET",
 			Path:   "/api/v1/addresses/check/:name/:ip",
@@ -63,6 +89,14 @@ func (api *API) GetRoutes() []*Route {
 				KeyAuthMiddleware,
 			},
 		},
+		{
+			Method: "GET",
+			Path:   "/api/v1/addresses/check/:name/:ip/history",
+			Func:   api.Handler.HandleAddressesCheckHistory,
+			Middleware: []echo.MiddlewareFunc{
+				KeyAuthMiddleware,
+			},
+		},
 		{
 			Method: "POST",
 			Path:   "/api/v1/addresses/sync",
@@ -79,6 +113,150 @@ func (api *API) GetRoutes() []*Route {
 				KeyAuthMiddleware,
 			},
 		},
+		{
+			Method: "GET",
+			Path:   "/api/v1/events",
+			Func:   api.Handler.HandleEvents,
+			Middleware: []echo.MiddlewareFunc{
+				KeyAuthMiddleware,
+			},
+		},
+		{
+			Method: "GET",
+			Path:   "/api/v1/changes",
+			Func:   api.Handler.HandleChanges,
+			Middleware: []echo.MiddlewareFunc{
+				KeyAuthMiddleware,
+			},
+		},
+		// Policy
+		{
+			Method: "POST",
+			Path:   "/api/v1/evaluate/:ip",
+			Func:   api.Handler.HandleEvaluate,
+			Middleware: []echo.MiddlewareFunc{
+				KeyAuthMiddleware,
+			},
+		},
+		// Escalations
+		{
+			Method: "GET",
+			Path:   "/api/v1/escalations",
+			Func:   api.Handler.HandleEscalationsGetAll,
+			Middleware: []echo.MiddlewareFunc{
+				KeyAuthMiddleware,
+			},
+		},
+		{
+			Method: "POST",
+			Path:   "/api/v1/escalations",
+			Func:   api.Handler.HandleEscalationsPost,
+			Middleware: []echo.MiddlewareFunc{
+				KeyAuthMiddleware,
+			},
+		},
+		// Plugins
+		{
+			Method: "GET",
+			Path:   "/api/v1/endpoints",
+			Func:   api.Handler.HandleEndpointsGetAll,
+			Middleware: []echo.MiddlewareFunc{
+				KeyAuthMiddleware,
+			},
+		},
+		{
+			Method: "PUT",
+			Path:   "/api/v1/endpoints/:name/state",
+			Func:   api.Handler.HandleEndpointsState,
+			Middleware: []echo.MiddlewareFunc{
+				KeyAuthMiddleware,
+			},
+		},
+		{
+			Method: "GET",
+			Path:   "/api/v1/checkers",
+			Func:   api.Handler.HandleCheckersGetAll,
+			Middleware: []echo.MiddlewareFunc{
+				KeyAuthMiddleware,
+			},
+		},
+		{
+			Method: "GET",
+			Path:   "/api/v1/alerters",
+			Func:   api.Handler.HandleAlertersGetAll,
+			Middleware: []echo.MiddlewareFunc{
+				KeyAuthMiddleware,
+			},
+		},
+		// Webhooks
+		{
+			Method: "GET",
+			Path:   "/api/v1/webhooks",
+			Func:   api.Handler.HandleWebhooksGetAll,
+			Middleware: []echo.MiddlewareFunc{
+				KeyAuthMiddleware,
+			},
+		},
+		{
+			Method: "POST",
+			Path:   "/api/v1/webhooks",
+			Func:   api.Handler.HandleWebhooksPost,
+			Middleware: []echo.MiddlewareFunc{
+				KeyAuthMiddleware,
+			},
+		},
+		{
+			Method: "GET",
+			Path:   "/api/v1/webhooks/:id",
+			Func:   api.Handler.HandleWebhooksGetOne,
+			Middleware: []echo.MiddlewareFunc{
+				KeyAuthMiddleware,
+			},
+		},
+		{
+			Method: "DELETE",
+			Path:   "/api/v1/webhooks/:id",
+			Func:   api.Handler.HandleWebhooksDelete,
+			Middleware: []echo.MiddlewareFunc{
+				KeyAuthMiddleware,
+			},
+		},
+		{
+			Method: "GET",
+			Path:   "/api/v1/webhooks/:id/deliveries",
+			Func:   api.Handler.HandleWebhooksDeliveries,
+			Middleware: []echo.MiddlewareFunc{
+				KeyAuthMiddleware,
+			},
+		},
+		{
+			Method: "POST",
+			Path:   "/api/v1/webhooks/:id/deliveries/:delivery/redeliver",
+			Func:   api.Handler.HandleWebhooksRedeliver,
+			Middleware: []echo.MiddlewareFunc{
+				KeyAuthMiddleware,
+			},
+		},
+		// Slack, authenticated by the signature of Slack instead of a key
+		{
+			Method: "POST",
+			Path:   "/api/v1/slack/commands",
+			Func:   api.Handler.HandleSlackCommands,
+		},
+		{
+			Method: "POST",
+			Path:   "/api/v1/slack/actions",
+			Func:   api.Handler.HandleSlackActions,
+		},
+		// Admin
+		{
+			Method: "POST",
+			Path:   "/api/v1/admin/reload",
+			Func:   api.Handler.HandleAdminReload,
+			Middleware: []echo.MiddlewareFunc{
+				KeyAuthMiddleware,
+			},
+		},
 	}
 }
 
@@ -2,16 +2,39 @@ package hbl
 
 import (
 	"context"
+
+	"github.com/hostinger/hbl/pkg/alerters"
+	"github.com/hostinger/hbl/pkg/checkers"
+	"github.com/hostinger/hbl/pkg/endpoints"
 )
 
 type Service interface {
 	Delete(ctx context.Context, ip string) error
-	Check(ctx context.Context, name, ip string) (interface{}, error)
+	Check(ctx context.Context, name, ip string) (*checkers.CheckResult, error)
+	CheckAll(ctx context.Context, ip string) (*checkers.Aggregate, error)
+	Evaluate(ctx context.Context, ip string, request *PolicyRequest) (*Decision, error)
+	CheckHistory(ctx context.Context, name, ip string, limit int) ([]*checkers.CheckResult, error)
 	Block(ctx context.Context, address *Address) error
 	Allow(ctx context.Context, address *Address) error
 	Unblock(ctx context.Context, address *Address) error
 	GetOne(ctx context.Context, ip string) (*Address, error)
-	GetAll(ctx context.Context) ([]*Address, error)
+	GetAll(ctx context.Context, filter *AddressFilter) ([]*Address, error)
+	GetEscalations(ctx context.Context) ([]*Escalation, error)
+	Escalate(ctx context.Context, network, author, comment string) (*Escalation, error)
+	Expire(ctx context.Context) (int, error)
 	SyncOne(ctx context.Context, ip string) error
 	SyncAll(ctx context.Context) error
+	Readiness(ctx context.Context) *HealthReport
+	GetEndpoints(ctx context.Context) []*endpoints.Info
+	GetCheckers(ctx context.Context) []*checkers.Info
+	GetAlerters(ctx context.Context) []*alerters.Info
+	SetEndpointState(ctx context.Context, name, state string) (*endpoints.Info, error)
+	GetWebhooks(ctx context.Context) ([]*Webhook, error)
+	GetWebhook(ctx context.Context, id int64) (*Webhook, error)
+	CreateWebhook(ctx context.Context, webhook *Webhook) (*Webhook, error)
+	DeleteWebhook(ctx context.Context, id int64) error
+	GetDeliveries(ctx context.Context, id int64, status string, limit int) ([]*WebhookDelivery, error)
+	Redeliver(ctx context.Context, id, delivery int64) (*WebhookDelivery, error)
+	Subscribe() *Subscription
+	GetChanges(ctx context.Context, since int64, limit int) (*ChangeFeed, error)
 }
@@ -2,6 +2,11 @@ package hbl
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
 
 	"github.com/hostinger/hbl/pkg/alerters"
 	"github.com/hostinger/hbl/pkg/checkers"
@@ -10,68 +15,499 @@ import (
 	"go.uber.org/zap"
 )
 
+var (
+	ErrProtected         = errors.New("Address belongs to a protected range")
+	ErrRejected          = errors.New("Address is rejected by the policy")
+	ErrNoEscalation      = errors.New("Network is not suggested for escalation")
+	ErrEscalationSkipped = errors.New("Network must not be blocked")
+)
+
+// ServiceConfig holds the dependencies of the default service.
+type ServiceConfig struct {
+	Logger     logger.Logger
+	Repository Repository
+	Protected  *ProtectedRanges
+	Prefixes   *Prefixes
+	Escalation *EscalationPolicy
+	Incidents  *Incidents
+	Webhooks   *Webhooks
+	Stream     *Stream
+	Health     *HealthPolicy
+	Policy     *Policy
+	Endpoints  *endpoints.Registry
+	Checkers   *checkers.Registry
+	Alerters   *alerters.Registry
+}
+
 type service struct {
 	logger     logger.Logger
 	repository Repository
+	protected  *ProtectedRanges
+	prefixes   *Prefixes
+	escalation *EscalationPolicy
+	incidents  *Incidents
+	webhooks   *Webhooks
+	stream     *Stream
+	health     *HealthPolicy
+	policy     *Policy
+	endpoints  *endpoints.Registry
+	checkers   *checkers.Registry
+	alerters   *alerters.Registry
 }
 
-func NewDefaultService(l logger.Logger, r Repository) Service {
+func NewDefaultService(cfg *ServiceConfig) Service {
 	return &service{
-		repository: r,
-		logger:     l,
+		repository: cfg.Repository,
+		logger:     cfg.Logger,
+		protected:  cfg.Protected,
+		prefixes:   cfg.Prefixes,
+		escalation: cfg.Escalation,
+		incidents:  cfg.Incidents,
+		webhooks:   cfg.Webhooks,
+		stream:     cfg.Stream,
+		health:     cfg.Health,
+		policy:     cfg.Policy,
+		endpoints:  cfg.Endpoints,
+		checkers:   cfg.Checkers,
+		alerters:   cfg.Alerters,
 	}
 }
 
 func (s *service) Unblock(ctx context.Context, address *Address) error {
-	if err := endpoints.ExecuteOnAll(ctx, address.IP, "Unblock"); err != nil {
-		return err
+	outcome, err := s.apply(ctx, address, "Unblock")
+	s.alert(ctx, address, "Unblock", outcome, err, false)
+	if err == nil {
+		s.webhooks.Publish(ctx, EventAddressUnblocked, address)
 	}
-	alerters.AlertOnAll(ctx,
-		&alerters.Alert{IP: address.IP,
-			Action: address.Action, Comment: address.Comment},
-	)
-	return nil
+	return err
 }
 
 func (s *service) Block(ctx context.Context, address *Address) error {
+	if s.isProtected(address) {
+		s.incidents.Rejected(ctx, address)
+		return ErrProtected
+	}
+	s.enrich(ctx, address)
+	if address.isIP() {
+		decision := s.decide(ctx, address)
+		if decision.Action == PolicyReject {
+			s.logger.Info("Rejected block by the policy", zap.String("address", address.IP), zap.String("rule", decision.Rule))
+			return ErrRejected
+		}
+		if decision.duration > 0 {
+			expiresAt := time.Now().Add(decision.duration)
+			address.ExpiresAt = &expiresAt
+		}
+	}
 	if err := s.repository.CreateAddress(ctx, address); err != nil {
 		return err
 	}
-	if err := endpoints.ExecuteOnAll(ctx, address.IP, "Block"); err != nil {
+	s.changed()
+	outcome, err := s.apply(ctx, address, "Block")
+	s.alert(ctx, address, "Block", outcome, err, err == nil && address.isIP())
+	if err != nil {
+		s.webhooks.Publish(ctx, EventAddressBlockFailed, address)
 		return err
 	}
-	alerters.AlertOnAll(ctx,
-		&alerters.Alert{IP: address.IP,
-			Action: address.Action, Comment: address.Comment},
-	)
+	s.incidents.Blocked(ctx)
+	if address.isIP() {
+		go s.report(address)
+	}
 	return nil
 }
 
+// changed wakes the stream and the webhooks following the change log after
+// this server changed the list.
+func (s *service) changed() {
+	s.stream.Notify()
+	s.webhooks.Notify()
+}
+
+// alert sends an alert about action on address. With checks, the alert
+// tells what checkers have cached about the address, looked up once it's
+// sent so the action isn't delayed and no quota is spent on it.
+func (s *service) alert(ctx context.Context, address *Address, action string, outcome *endpoints.Outcome, err error, checks bool) {
+	target := address.Target
+	if address.isIP() {
+		target = TargetIP
+	}
+	alert := &alerters.Alert{
+		Severity:     alerters.SeverityInfo,
+		IP:           address.Key(),
+		Target:       target,
+		List:         address.Action,
+		ExpiresAt:    address.ExpiresAt,
+		Action:       action,
+		Author:       address.Author,
+		Comment:      address.Comment,
+		Source:       address.Source,
+		Categories:   address.Categories,
+		Country:      address.Country,
+		ASN:          address.ASN,
+		Organization: address.Organization,
+	}
+	if checks {
+		ip := address.IP
+		alert.WithChecks(func(ctx context.Context) *checkers.Aggregate {
+			return s.checkers.CheckOnAll(checkers.WithCachedOnly(ctx), ip)
+		})
+	}
+	if outcome != nil {
+		alert.Endpoints = append(append([]string{}, outcome.Applied...), outcome.Queued...)
+		switch {
+		case err != nil:
+			alert.Outcome = fmt.Sprintf("Failed: %s", err)
+		case len(outcome.Queued) > 0:
+			alert.Outcome = fmt.Sprintf("Queued on %s", strings.Join(outcome.Queued, ", "))
+		default:
+			alert.Outcome = "Applied"
+		}
+	}
+	s.alerters.AlertOnAll(ctx, alert)
+}
+
+// decide evaluates the policy for a block of address. Checkers only serve
+// what they have cached, so deciding spends no quota.
+func (s *service) decide(ctx context.Context, address *Address) *Decision {
+	if s.policy.Empty() {
+		return &Decision{IP: address.IP, Action: PolicyNone}
+	}
+	return s.policy.Evaluate(&PolicyInput{
+		IP:        address.IP,
+		Aggregate: s.checkers.CheckOnAll(checkers.WithCachedOnly(ctx), address.IP),
+		Enrichment: &checkers.Enrichment{
+			Country:      address.Country,
+			ASN:          address.ASN,
+			Organization: address.Organization,
+		},
+		Request: &PolicyRequest{
+			Source:     address.Source,
+			Author:     address.Author,
+			Comment:    address.Comment,
+			Categories: address.Categories,
+		},
+	})
+}
+
+// isProtected tells whether blocking address would block a protected range.
+// For an ASN this is only known when the prefix dataset lists it.
+func (s *service) isProtected(address *Address) bool {
+	switch address.Target {
+	case TargetASN:
+		for _, prefix := range s.prefixes.ForASN(address.ASN) {
+			if s.protected.Overlaps(prefix) {
+				return true
+			}
+		}
+		return false
+	case TargetCountry:
+		return false
+	case TargetNetwork:
+		return s.protected.Overlaps(address.Network)
+	}
+	return s.protected.Contains(address.IP)
+}
+
+// execute runs action for address on every endpoint. ASNs and countries are
+// blocked natively where supported, otherwise ASNs are expanded into their
+// prefixes. Networks are blocked by endpoints which can block networks.
+func (s *service) execute(ctx context.Context, address *Address, action string) error {
+	_, err := s.apply(ctx, address, action)
+	return err
+}
+
+// apply runs action for address on every endpoint and tells which endpoints
+// it ran on.
+func (s *service) apply(ctx context.Context, address *Address, action string) (*endpoints.Outcome, error) {
+	if address.isIP() {
+		return s.endpoints.Apply(ctx, address.IP, action)
+	}
+	target := &endpoints.Target{Type: address.Target, Value: address.Key()}
+	switch address.Target {
+	case TargetASN:
+		target.Prefixes = s.prefixes.ForASN(address.ASN)
+	case TargetNetwork:
+		target.Prefixes = []string{address.Network}
+	}
+	return s.endpoints.ApplyTarget(ctx, target, action)
+}
+
+// enrich fills in where the address comes from. Enrichment is best effort:
+// failures are logged and never prevent the address from being stored.
+// Entries for a whole ASN or country are never enriched.
+func (s *service) enrich(ctx context.Context, address *Address) {
+	if !address.isIP() {
+		return
+	}
+	enrichment, err := s.checkers.Enrich(ctx, address.IP)
+	if err != nil {
+		s.logger.Error("Failed to execute Enrich", zap.String("address", address.IP), zap.Error(err))
+	}
+	address.Country = enrichment.Country
+	address.ASN = enrichment.ASN
+	address.Organization = enrichment.Organization
+}
+
+// report contributes a blocked address to checkers which accept reports and
+// records the outcome with the address. It runs in the background, so slow
+// third party APIs never delay or fail a block.
+func (s *service) report(address *Address) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	results := s.checkers.ReportOnAll(ctx, &checkers.Report{
+		IP:         address.IP,
+		Source:     address.Source,
+		Comment:    address.Comment,
+		Categories: address.Categories,
+	})
+	if len(results) == 0 {
+		return
+	}
+	for _, result := range results {
+		if result.Status == checkers.ReportFailed {
+			s.logger.Error(
+				"Failed to execute Report",
+				zap.String("checker", result.Reporter),
+				zap.String("address", address.IP),
+				zap.String("error", result.Message),
+			)
+		}
+	}
+	if err := s.repository.SaveReports(ctx, address.IP, results); err != nil {
+		s.logger.Error("Failed to execute SaveReports", zap.String("address", address.IP), zap.Error(err))
+		return
+	}
+	s.changed()
+}
+
 func (s *service) Allow(ctx context.Context, address *Address) error {
+	s.enrich(ctx, address)
 	if err := s.repository.CreateAddress(ctx, address); err != nil {
 		return err
 	}
-	alerters.AlertOnAll(ctx,
-		&alerters.Alert{IP: address.IP,
-			Action: address.Action, Comment: address.Comment},
-	)
+	s.changed()
+	s.alert(ctx, address, "Allow", nil, nil, false)
 	return nil
 }
 
 func (s *service) Delete(ctx context.Context, ip string) error {
-	return s.repository.DeleteAddress(ctx, ip)
+	if _, err := s.repository.GetAddress(ctx, ip); err != nil {
+		return err
+	}
+	if err := s.repository.DeleteAddress(ctx, ip); err != nil {
+		return err
+	}
+	s.changed()
+	return nil
 }
 
 func (s *service) GetOne(ctx context.Context, ip string) (*Address, error) {
 	return s.repository.GetAddress(ctx, ip)
 }
 
-func (s *service) GetAll(ctx context.Context) ([]*Address, error) {
-	return s.repository.GetAddresses(ctx)
+func (s *service) GetAll(ctx context.Context, filter *AddressFilter) ([]*Address, error) {
+	return s.repository.GetAddresses(ctx, filter)
+}
+
+// GetEscalations returns the networks holding enough recently blocked
+// addresses to be blocked as a whole. Networks overlapping a protected
+// range, an allowed entry or an already blocked network are explained in
+// Skipped.
+func (s *service) GetEscalations(ctx context.Context) ([]*Escalation, error) {
+	entries, err := s.repository.GetAddresses(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return s.findEscalations(entries), nil
+}
+
+func (s *service) findEscalations(entries []*Address) []*Escalation {
+	escalations := findEscalations(entries, s.escalation.Get(), time.Now())
+	for _, escalation := range escalations {
+		escalation.Skipped = s.escalationSkipped(escalation.Network, entries)
+	}
+	return escalations
+}
+
+func (s *service) escalationSkipped(network string, entries []*Address) string {
+	_, candidate, err := net.ParseCIDR(network)
+	if err != nil {
+		return err.Error()
+	}
+	if s.protected.Overlaps(network) {
+		return "Overlaps a protected range"
+	}
+	for _, entry := range entries {
+		var networks []string
+		switch entry.Target {
+		case TargetNetwork:
+			networks = []string{entry.Network}
+		case TargetASN:
+			networks = s.prefixes.ForASN(entry.ASN)
+		case TargetCountry:
+			continue
+		default:
+			if entry.Action == "Allow" && candidate.Contains(net.ParseIP(entry.IP)) {
+				return fmt.Sprintf("Holds allowed address %s", entry.IP)
+			}
+			continue
+		}
+		for _, n := range networks {
+			_, other, err := net.ParseCIDR(n)
+			if err != nil || !networksOverlap(candidate, other) {
+				continue
+			}
+			if entry.Action == "Allow" {
+				return fmt.Sprintf("Overlaps allowed %s", entry.Key())
+			}
+			otherOnes, _ := other.Mask.Size()
+			candidateOnes, _ := candidate.Mask.Size()
+			if other.Contains(candidate.IP) && otherOnes <= candidateOnes {
+				return fmt.Sprintf("Already blocked by %s", entry.Key())
+			}
+		}
+	}
+	return ""
+}
+
+// Escalate blocks a suggested network and retires every blocked address it
+// covers, including those blocked before the window: they are removed from
+// the endpoints and deleted.
+func (s *service) Escalate(ctx context.Context, network, author, comment string) (*Escalation, error) {
+	entries, err := s.repository.GetAddresses(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	var escalation *Escalation
+	for _, e := range s.findEscalations(entries) {
+		if e.Network == network {
+			escalation = e
+		}
+	}
+	if escalation == nil {
+		return nil, ErrNoEscalation
+	}
+	if escalation.Skipped != "" {
+		return escalation, ErrEscalationSkipped
+	}
+	address := &Address{
+		Target:  TargetNetwork,
+		Network: escalation.Network,
+		Action:  "Block",
+		Author:  author,
+		Comment: comment,
+		Source:  "escalation",
+	}
+	if err := s.Block(ctx, address); err != nil {
+		return nil, err
+	}
+	_, covering, _ := net.ParseCIDR(escalation.Network)
+	for _, entry := range entries {
+		if !entry.isIP() || entry.Action != "Block" || !covering.Contains(net.ParseIP(entry.IP)) {
+			continue
+		}
+		if err := s.execute(ctx, entry, "Unblock"); err != nil {
+			s.logger.Error("Failed to retire escalated address", zap.String("address", entry.IP), zap.Error(err))
+			continue
+		}
+		if err := s.repository.DeleteAddress(ctx, entry.IP); err != nil {
+			s.logger.Error("Failed to retire escalated address", zap.String("address", entry.IP), zap.Error(err))
+			continue
+		}
+		s.changed()
+		escalation.Retired++
+	}
+	return escalation, nil
+}
+
+// Expire unblocks and deletes every address whose block has expired, and
+// returns how many were.
+func (s *service) Expire(ctx context.Context) (int, error) {
+	entries, err := s.repository.GetAddresses(ctx, &AddressFilter{Target: TargetIP, Action: "Block", ExpiresBefore: time.Now()})
+	if err != nil {
+		return 0, err
+	}
+	expired := 0
+	for _, entry := range entries {
+		if err := s.execute(ctx, entry, "Unblock"); err != nil {
+			s.logger.Error("Failed to expire address", zap.String("address", entry.IP), zap.Error(err))
+			continue
+		}
+		if err := s.repository.DeleteAddress(ctx, entry.IP); err != nil {
+			s.logger.Error("Failed to expire address", zap.String("address", entry.IP), zap.Error(err))
+			continue
+		}
+		s.changed()
+		expired++
+	}
+	return expired, nil
+}
+
+func (s *service) Check(ctx context.Context, name, ip string) (*checkers.CheckResult, error) {
+	return s.checkers.CheckOnOne(ctx, ip, name)
 }
 
-func (s *service) Check(ctx context.Context, name, ip string) (interface{}, error) {
-	return checkers.CheckOnOne(ctx, ip, name)
+func (s *service) CheckAll(ctx context.Context, ip string) (*checkers.Aggregate, error) {
+	return s.checkers.CheckOnAll(ctx, ip), nil
+}
+
+// Evaluate runs every checker on ip and decides what to do with it
+// according to the policy, explaining which rule matched.
+func (s *service) Evaluate(ctx context.Context, ip string, request *PolicyRequest) (*Decision, error) {
+	aggregate := s.checkers.CheckOnAll(ctx, ip)
+	enrichment, err := s.checkers.Enrich(ctx, ip)
+	if err != nil {
+		s.logger.Error("Failed to execute Enrich", zap.String("address", ip), zap.Error(err))
+	}
+	return s.policy.Evaluate(&PolicyInput{
+		IP:         ip,
+		Aggregate:  aggregate,
+		Enrichment: enrichment,
+		Request:    request,
+	}), nil
+}
+
+func (s *service) CheckHistory(ctx context.Context, name, ip string, limit int) ([]*checkers.CheckResult, error) {
+	return s.checkers.History(ctx, ip, name, limit)
+}
+
+func (s *service) Readiness(ctx context.Context) *HealthReport {
+	checks := []healthCheck{
+		{
+			name: "database",
+			check: func(ctx context.Context) (bool, error) {
+				return true, s.repository.Ping(ctx)
+			},
+		},
+	}
+	for _, endpoint := range s.endpoints.List() {
+		name := endpoint.Name()
+		checks = append(checks, healthCheck{
+			name: "endpoints/" + name,
+			check: func(ctx context.Context) (bool, error) {
+				return s.endpoints.HealthCheck(ctx, name)
+			},
+		})
+	}
+	for _, checker := range s.checkers.List() {
+		name := checker.Name()
+		checks = append(checks, healthCheck{
+			name: "checkers/" + name,
+			check: func(ctx context.Context) (bool, error) {
+				return s.checkers.HealthCheck(ctx, name)
+			},
+		})
+	}
+	for _, alerter := range s.alerters.List() {
+		name := alerter.Name()
+		checks = append(checks, healthCheck{
+			name: "alerters/" + name,
+			check: func(ctx context.Context) (bool, error) {
+				return s.alerters.HealthCheck(ctx, name)
+			},
+		})
+	}
+	return runHealthChecks(ctx, s.health, checks)
 }
 
 func (s *service) SyncOne(ctx context.Context, ip string) error {
@@ -79,23 +515,171 @@ func (s *service) SyncOne(ctx context.Context, ip string) error {
 	if err != nil {
 		return err
 	}
-	if err := endpoints.ExecuteOnAll(ctx, address.IP, "Sync"); err != nil {
+	if err := s.execute(ctx, address, "Sync"); err != nil {
 		return err
 	}
-	s.logger.Info("Synced address with all endpoints", zap.String("address", address.IP))
+	s.logger.Info("Synced address with all endpoints", zap.String("address", address.Key()))
 	return nil
 }
 
+// SyncAll syncs every address with all endpoints. A failure raises an
+// incident, resolved by the next successful sync.
 func (s *service) SyncAll(ctx context.Context) error {
-	addresses, err := s.repository.GetAddresses(ctx)
+	err := s.syncAll(ctx)
+	s.incidents.Synced(ctx, err)
+	return err
+}
+
+func (s *service) syncAll(ctx context.Context) error {
+	addresses, err := s.repository.GetAddresses(ctx, nil)
 	if err != nil {
 		return err
 	}
+	if err := s.syncAggregated(ctx, addresses); err != nil {
+		return err
+	}
 	for _, address := range addresses {
-		if err := endpoints.ExecuteOnAll(ctx, address.IP, "Sync"); err != nil {
+		if err := s.execute(ctx, address, "Sync"); err != nil {
 			return err
 		}
-		s.logger.Info("Synced address with all endpoints", zap.String("address", address.IP))
+		s.logger.Info("Synced address with all endpoints", zap.String("address", address.Key()))
+	}
+	return nil
+}
+
+// syncAggregated pushes the blocked addresses and networks to endpoints
+// which aggregate them, before they are skipped by the per address sync.
+// Cached checker scores decide what's kept on endpoints running out of
+// capacity.
+func (s *service) syncAggregated(ctx context.Context, addresses []*Address) error {
+	scores, err := s.checkers.Scores(ctx)
+	if err != nil {
+		s.logger.Error("Failed to execute Scores", zap.Error(err))
+	}
+	var entries []*endpoints.Entry
+	for _, address := range addresses {
+		if address.Action != "Block" || !(address.isIP() || address.Target == TargetNetwork) {
+			continue
+		}
+		entries = append(entries, &endpoints.Entry{
+			Network:   address.Key(),
+			Score:     scores[address.Key()],
+			CreatedAt: address.CreatedAt,
+		})
+	}
+	results, err := s.endpoints.SyncAggregated(ctx, entries)
+	if err != nil {
+		return err
+	}
+	for name, result := range results {
+		if result.Truncated > 0 {
+			s.logger.Error(
+				"Endpoint capacity exceeded, truncated aggregated networks",
+				zap.String("endpoint", name),
+				zap.Int("networks", result.Networks),
+				zap.Int("truncated", result.Truncated),
+			)
+			continue
+		}
+		s.logger.Info(
+			"Synced aggregated networks with endpoint",
+			zap.String("endpoint", name),
+			zap.Int("entries", result.Entries),
+			zap.Int("networks", result.Networks),
+		)
 	}
 	return nil
 }
+
+func (s *service) GetEndpoints(ctx context.Context) []*endpoints.Info {
+	return s.endpoints.Info()
+}
+
+func (s *service) GetCheckers(ctx context.Context) []*checkers.Info {
+	return s.checkers.Info()
+}
+
+func (s *service) GetAlerters(ctx context.Context) []*alerters.Info {
+	return s.alerters.Info()
+}
+
+func (s *service) SetEndpointState(ctx context.Context, name, state string) (*endpoints.Info, error) {
+	switch state {
+	case "paused":
+		if err := s.endpoints.Pause(name); err != nil {
+			return nil, err
+		}
+		s.logger.Info("Paused endpoint", zap.String("endpoint", name))
+	case "active":
+		if err := s.endpoints.Resume(ctx, name); err != nil {
+			return nil, err
+		}
+		s.logger.Info("Resumed endpoint", zap.String("endpoint", name))
+	}
+	return s.endpoints.InfoOne(name)
+}
+
+func (s *service) GetWebhooks(ctx context.Context) ([]*Webhook, error) {
+	webhooks, err := s.repository.GetWebhooks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, webhook := range webhooks {
+		webhook.Secret = ""
+	}
+	return webhooks, nil
+}
+
+func (s *service) GetWebhook(ctx context.Context, id int64) (*Webhook, error) {
+	webhook, err := s.repository.GetWebhook(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	webhook.Secret = ""
+	return webhook, nil
+}
+
+// CreateWebhook subscribes a webhook, generating its secret unless given.
+// The secret is returned only now.
+func (s *service) CreateWebhook(ctx context.Context, webhook *Webhook) (*Webhook, error) {
+	if webhook.Secret == "" {
+		webhook.Secret = randomHex(32)
+	}
+	if err := s.repository.CreateWebhook(ctx, webhook); err != nil {
+		return nil, err
+	}
+	created, err := s.repository.GetWebhook(ctx, webhook.ID)
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func (s *service) DeleteWebhook(ctx context.Context, id int64) error {
+	if _, err := s.repository.GetWebhook(ctx, id); err != nil {
+		return err
+	}
+	return s.repository.DeleteWebhook(ctx, id)
+}
+
+func (s *service) GetDeliveries(ctx context.Context, id int64, status string, limit int) ([]*WebhookDelivery, error) {
+	if _, err := s.repository.GetWebhook(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.repository.GetDeliveries(ctx, &DeliveryFilter{WebhookID: id, Status: status, Limit: limit})
+}
+
+func (s *service) Redeliver(ctx context.Context, id, delivery int64) (*WebhookDelivery, error) {
+	return s.webhooks.Redeliver(ctx, id, delivery)
+}
+
+// Subscribe tells when the change log grows.
+func (s *service) Subscribe() *Subscription {
+	return s.stream.Subscribe()
+}
+
+// GetChanges returns at most limit changes of the list following the cursor
+// since, or a reset when they are no longer kept.
+func (s *service) GetChanges(ctx context.Context, since int64, limit int) (*ChangeFeed, error) {
+	return s.repository.GetChanges(ctx, since, limit)
+}
@@ -0,0 +1,349 @@
+package hbl
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hostinger/hbl/pkg/alerters"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/slack-go/slack"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+// Permissions a Slack user can be granted. Pressing the Unblock button of an
+// alert requires SlackDelete, like '/hbl delete'.
+const (
+	SlackBlock  = "block"
+	SlackAllow  = "allow"
+	SlackDelete = "delete"
+	SlackLookup = "lookup"
+)
+
+var slackPermissions = []string{SlackBlock, SlackAllow, SlackDelete, SlackLookup}
+
+const slackUsage = "Usage: `/hbl block <ip> <reason>`, `/hbl allow <ip> <reason>`, `/hbl delete <ip>` or `/hbl lookup <ip>`. " +
+	"Instead of an IP address, an AS number, a country code or a network can be given."
+
+// SlackConfig lets operators manage addresses from Slack through the '/hbl'
+// slash command and the Unblock button of alerts.
+type SlackConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	// SigningSecret is the signing secret of the Slack app, used to verify
+	// requests come from Slack.
+	SigningSecret string `mapstructure:"signing_secret"`
+
+	// Users lists who may use the integration. Anyone else is refused.
+	Users []SlackUser `mapstructure:"users"`
+}
+
+// SlackUser maps a Slack user to the author recorded on the addresses they
+// change, and what they may do.
+type SlackUser struct {
+	// ID is the Slack user ID, e.g. 'U024BE7LH', not the display name which
+	// users can change.
+	ID          string   `mapstructure:"id"`
+	Author      string   `mapstructure:"author"`
+	Permissions []string `mapstructure:"permissions"`
+}
+
+func (c *SlackConfig) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	var err error
+	if strings.TrimSpace(c.SigningSecret) == "" {
+		err = multierr.Append(err, errors.New("Field 'signing_secret' must not be empty"))
+	}
+	seen := map[string]bool{}
+	for i, user := range c.Users {
+		if strings.TrimSpace(user.ID) == "" {
+			err = multierr.Append(err, errors.Errorf("Field 'users[%d].id' must not be empty", i))
+		} else if seen[user.ID] {
+			err = multierr.Append(err, errors.Errorf("Field 'users[%d].id' must be unique, got '%s' twice", i, user.ID))
+		}
+		seen[user.ID] = true
+		if strings.TrimSpace(user.Author) == "" {
+			err = multierr.Append(err, errors.Errorf("Field 'users[%d].author' must not be empty", i))
+		}
+		for _, permission := range user.Permissions {
+			if !isSlackPermission(permission) {
+				err = multierr.Append(err, errors.Errorf("Field 'users[%d].permissions' must only hold %s, got '%s'",
+					i, strings.Join(slackPermissions, ", "), permission))
+			}
+		}
+	}
+	return err
+}
+
+func isSlackPermission(permission string) bool {
+	for _, p := range slackPermissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// user returns the user with the Slack ID id, if any.
+func (c *SlackConfig) user(id string) (*SlackUser, bool) {
+	for i := range c.Users {
+		if c.Users[i].ID == id {
+			return &c.Users[i], true
+		}
+	}
+	return nil, false
+}
+
+func (u *SlackUser) can(permission string) bool {
+	for _, p := range u.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// SlackPolicy holds the Slack settings. It is safe for concurrent use and
+// can be replaced at runtime.
+type SlackPolicy struct {
+	mu  sync.RWMutex
+	cfg SlackConfig
+}
+
+func NewSlackPolicy(cfg *SlackConfig) *SlackPolicy {
+	p := &SlackPolicy{}
+	p.Set(cfg)
+	return p
+}
+
+func (p *SlackPolicy) Set(cfg *SlackConfig) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cfg = *cfg
+}
+
+// Get returns the current settings. A nil policy is disabled.
+func (p *SlackPolicy) Get() SlackConfig {
+	if p == nil {
+		return SlackConfig{}
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.cfg
+}
+
+// slackRequest reads the body of a request from Slack once its signature is
+// verified, and puts it back for parsing.
+func slackRequest(c echo.Context, cfg *SlackConfig) error {
+	if !cfg.Enabled {
+		return echo.NewHTTPError(404, "Slack integration is disabled")
+	}
+	r := c.Request()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return echo.NewHTTPError(400, fmt.Sprintf("Failed to read request body: %s", err))
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	verifier, err := slack.NewSecretsVerifier(r.Header, cfg.SigningSecret)
+	if err == nil {
+		_, err = verifier.Write(body)
+	}
+	if err == nil {
+		err = verifier.Ensure()
+	}
+	if err != nil {
+		return echo.NewHTTPError(401, fmt.Sprintf("Failed to verify Slack signature: %s", err))
+	}
+	return nil
+}
+
+// slackCommand is a parsed '/hbl' command.
+type slackCommand struct {
+	name    string
+	address *Address
+	reason  string
+}
+
+// parseSlackCommand parses the text of a '/hbl' command such as 'block
+// 192.0.2.1 Brute force'.
+func parseSlackCommand(text string) (*slackCommand, error) {
+	args := strings.Fields(text)
+	if len(args) < 2 {
+		return nil, errors.New(slackUsage)
+	}
+	cmd := &slackCommand{name: strings.ToLower(args[0]), reason: strings.Join(args[2:], " ")}
+	address, err := ParseKey(args[1])
+	if err != nil {
+		msg := err.Error()
+		return nil, errors.Errorf("'%s' %s%s", args[1], strings.ToLower(msg[:1]), msg[1:])
+	}
+	cmd.address = address
+	switch cmd.name {
+	case SlackBlock, SlackAllow:
+		if cmd.reason == "" {
+			return nil, errors.Errorf("A reason is required to %s %s", cmd.name, address.Key())
+		}
+	case SlackDelete, SlackLookup:
+	default:
+		return nil, errors.New(slackUsage)
+	}
+	return cmd, nil
+}
+
+// slackReply is a message posted to the response URL of a command or an
+// action. It never replaces the original message, so alerts keep their
+// details once unblocked.
+type slackReply struct {
+	ResponseType    string `json:"response_type"`
+	ReplaceOriginal bool   `json:"replace_original"`
+	Text            string `json:"text"`
+}
+
+func ephemeral(text string) *slackReply {
+	return &slackReply{ResponseType: slack.ResponseTypeEphemeral, Text: text}
+}
+
+func inChannel(text string) *slackReply {
+	return &slackReply{ResponseType: slack.ResponseTypeInChannel, Text: text}
+}
+
+// slackTimeout bounds the work done after Slack got its acknowledgement,
+// which it expects within 3 seconds.
+const slackTimeout = time.Minute
+
+// respond runs f in the background and posts its reply to responseURL, as
+// blocking or unblocking may take longer than Slack waits for.
+func (h *handler) respond(responseURL string, f func(ctx context.Context) *slackReply) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), slackTimeout)
+		defer cancel()
+		reply := f(ctx)
+		b, err := json.Marshal(reply)
+		if err == nil {
+			err = postSlackReply(ctx, h.client, responseURL, b)
+		}
+		if err != nil {
+			h.l.Error("Failed to reply to Slack", zap.Error(err))
+		}
+	}()
+}
+
+func postSlackReply(ctx context.Context, client *http.Client, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "Failed to create request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "Failed to send request")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return errors.Errorf("Unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// runSlackCommand executes cmd on behalf of user.
+func (h *handler) runSlackCommand(ctx context.Context, user *SlackUser, slackID string, cmd *slackCommand) *slackReply {
+	key := cmd.address.Key()
+	switch cmd.name {
+	case SlackLookup:
+		return ephemeral(h.slackLookup(ctx, cmd.address))
+	case SlackDelete:
+		if err := h.slackDelete(ctx, key, user.Author); err != nil {
+			return ephemeral(fmt.Sprintf("Failed to delete %s: %s", key, err))
+		}
+		return inChannel(fmt.Sprintf("<@%s> deleted %s", slackID, key))
+	}
+	existing, err := h.service.GetOne(ctx, key)
+	if err != nil && err != sql.ErrNoRows {
+		return ephemeral(fmt.Sprintf("Failed to %s %s: %s", cmd.name, key, err))
+	}
+	if existing != nil {
+		return ephemeral(fmt.Sprintf("%s is already listed, delete it before other actions", key))
+	}
+	address := *cmd.address
+	address.Author = user.Author
+	address.Comment = cmd.reason
+	address.Source = "slack"
+	if cmd.name == SlackBlock {
+		address.Action = "Block"
+		err = h.service.Block(ctx, &address)
+	} else {
+		address.Action = "Allow"
+		err = h.service.Allow(ctx, &address)
+	}
+	if err != nil {
+		return ephemeral(fmt.Sprintf("Failed to %s %s: %s", cmd.name, key, err))
+	}
+	return inChannel(fmt.Sprintf("<@%s> %sed %s: %s", slackID, cmd.name, key, cmd.reason))
+}
+
+// slackDelete unblocks the entry key if it's blocked, and deletes it.
+func (h *handler) slackDelete(ctx context.Context, key, author string) error {
+	address, err := h.service.GetOne(ctx, key)
+	if err == sql.ErrNoRows {
+		return errors.New("it isn't listed")
+	}
+	if err != nil {
+		return err
+	}
+	if address.Action == "Block" {
+		address.Author = author
+		if err := h.service.Unblock(ctx, address); err != nil {
+			return err
+		}
+	}
+	return h.service.Delete(ctx, key)
+}
+
+// slackLookup describes the entry of address and, for IP addresses, what
+// checkers think of it.
+func (h *handler) slackLookup(ctx context.Context, address *Address) string {
+	key := address.Key()
+	var lines []string
+	existing, err := h.service.GetOne(ctx, key)
+	switch {
+	case err == sql.ErrNoRows:
+		lines = append(lines, fmt.Sprintf("%s isn't listed.", key))
+	case err != nil:
+		return fmt.Sprintf("Failed to look up %s: %s", key, err)
+	default:
+		lines = append(lines, fmt.Sprintf("%s is %sed by %s since %s: %s",
+			key, strings.ToLower(existing.Action), existing.Author,
+			existing.CreatedAt.UTC().Format(time.RFC3339), existing.Comment))
+	}
+	if net.ParseIP(key) != nil {
+		aggregate, err := h.service.CheckAll(ctx, key)
+		if err != nil {
+			lines = append(lines, fmt.Sprintf("Failed to check %s: %s", key, err))
+		} else {
+			lines = append(lines, fmt.Sprintf("Score %d, verdict %s.", aggregate.Score, aggregate.Verdict))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// unblockAction returns the Unblock button pressed in callback, if any.
+func unblockAction(callback *slack.InteractionCallback) (*slack.BlockAction, bool) {
+	for _, action := range callback.ActionCallback.BlockActions {
+		if action.ActionID == alerters.SlackUnblockAction {
+			return action, true
+		}
+	}
+	return nil, false
+}
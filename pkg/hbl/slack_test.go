@@ -0,0 +1,182 @@
+package hbl
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hostinger/hbl/pkg/alerters"
+	"github.com/hostinger/hbl/pkg/checkers"
+	"github.com/hostinger/hbl/pkg/endpoints"
+	"github.com/hostinger/hbl/pkg/logger"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSigningSecret = "8f742231b10e8888abcd99yyyzzz85a5"
+
+// newSlackHandler returns a handler with the Slack integration enabled, and
+// the response URL replies are posted to.
+func newSlackHandler(t *testing.T) (*handler, Repository, string, chan *slackReply) {
+	replies := make(chan *slackReply, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reply slackReply
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&reply))
+		replies <- &reply
+	}))
+	t.Cleanup(server.Close)
+
+	repository := NewMockRepository()
+	return &handler{
+		l: logger.NewLogger("test"),
+		service: &service{
+			repository: repository,
+			endpoints:  endpoints.NewRegistry(),
+			checkers:   checkers.NewRegistry(),
+			alerters:   alerters.NewRegistry(),
+		},
+		slack: NewSlackPolicy(&SlackConfig{
+			Enabled:       true,
+			SigningSecret: testSigningSecret,
+			Users: []SlackUser{
+				{ID: "UOPS", Author: "ops", Permissions: []string{SlackBlock, SlackDelete}},
+				{ID: "UVIEW", Author: "viewer", Permissions: []string{SlackLookup}},
+			},
+		}),
+		client: server.Client(),
+	}, repository, server.URL, replies
+}
+
+// slackContext signs form as Slack would, timestamp seconds ago.
+func slackContext(form url.Values, secret string, age time.Duration) (echo.Context, *httptest.ResponseRecorder) {
+	body := form.Encode()
+	timestamp := strconv.FormatInt(time.Now().Add(-age).Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":" + body)) // nolint
+	req := httptest.NewRequest("POST", "/api/v1/slack/commands", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	req.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	rec := httptest.NewRecorder()
+	return echo.New().NewContext(req, rec), rec
+}
+
+func receive(t *testing.T, replies chan *slackReply) *slackReply {
+	select {
+	case reply := <-replies:
+		return reply
+	case <-time.After(5 * time.Second):
+		t.Fatal("No reply posted to the response URL")
+		return nil
+	}
+}
+
+func Test_handler_HandleSlackCommands(t *testing.T) {
+	h, repository, responseURL, replies := newSlackHandler(t)
+
+	t.Run("Rejects bad signatures", func(t *testing.T) {
+		ctx, _ := slackContext(url.Values{"text": {"block 192.0.2.1 Test"}}, "wrong", 0)
+		err := h.HandleSlackCommands(ctx)
+		assert.Equal(t, 401, err.(*echo.HTTPError).Code)
+
+		ctx, _ = slackContext(url.Values{"text": {"block 192.0.2.1 Test"}}, testSigningSecret, 10*time.Minute)
+		err = h.HandleSlackCommands(ctx)
+		assert.Equal(t, 401, err.(*echo.HTTPError).Code)
+	})
+
+	t.Run("Refuses users without permission", func(t *testing.T) {
+		ctx, rec := slackContext(url.Values{"user_id": {"UVIEW"}, "text": {"block 192.0.2.1 Test"}}, testSigningSecret, 0)
+		if assert.NoError(t, h.HandleSlackCommands(ctx)) {
+			assert.Contains(t, rec.Body.String(), "You aren't allowed to block addresses")
+		}
+		_, err := repository.GetAddress(context.Background(), "192.0.2.1")
+		assert.Error(t, err)
+	})
+
+	t.Run("Blocks as the mapped author", func(t *testing.T) {
+		form := url.Values{
+			"user_id":      {"UOPS"},
+			"text":         {"block 192.0.2.1 Brute force"},
+			"response_url": {responseURL},
+		}
+		ctx, rec := slackContext(form, testSigningSecret, 0)
+		if assert.NoError(t, h.HandleSlackCommands(ctx)) {
+			assert.Contains(t, rec.Body.String(), "Running 'block 192.0.2.1'")
+		}
+		reply := receive(t, replies)
+		assert.Equal(t, "in_channel", reply.ResponseType)
+		assert.Equal(t, "<@UOPS> blocked 192.0.2.1: Brute force", reply.Text)
+
+		address, err := repository.GetAddress(context.Background(), "192.0.2.1")
+		if assert.NoError(t, err) {
+			assert.Equal(t, "ops", address.Author)
+			assert.Equal(t, "Block", address.Action)
+			assert.Equal(t, "slack", address.Source)
+		}
+	})
+}
+
+func Test_handler_HandleSlackActions(t *testing.T) {
+	h, repository, responseURL, replies := newSlackHandler(t)
+	repository.CreateAddress(context.Background(), &Address{IP: "192.0.2.1", Target: TargetIP, Author: "Test", Comment: "Test", Action: "Allow"}) // nolint
+
+	payload := func(user string) url.Values {
+		callback := map[string]interface{}{
+			"type":         "block_actions",
+			"user":         map[string]string{"id": user},
+			"response_url": responseURL,
+			"actions":      []map[string]string{{"block_id": "hbl_actions", "action_id": alerters.SlackUnblockAction, "value": "192.0.2.1"}},
+		}
+		b, _ := json.Marshal(callback)
+		return url.Values{"payload": {string(b)}}
+	}
+
+	ctx, _ := slackContext(payload("UVIEW"), testSigningSecret, 0)
+	assert.NoError(t, h.HandleSlackActions(ctx))
+	assert.Equal(t, "You aren't allowed to unblock addresses", receive(t, replies).Text)
+
+	ctx, _ = slackContext(payload("UOPS"), testSigningSecret, 0)
+	assert.NoError(t, h.HandleSlackActions(ctx))
+	assert.Equal(t, "<@UOPS> unblocked 192.0.2.1", receive(t, replies).Text)
+	_, err := repository.GetAddress(context.Background(), "192.0.2.1")
+	assert.Error(t, err)
+}
+
+func Test_parseSlackCommand(t *testing.T) {
+	cmd, err := parseSlackCommand("allow as64496 Our monitoring")
+	if assert.NoError(t, err) {
+		assert.Equal(t, SlackAllow, cmd.name)
+		assert.Equal(t, "AS64496", cmd.address.Key())
+		assert.Equal(t, "Our monitoring", cmd.reason)
+	}
+
+	_, err = parseSlackCommand("block 192.0.2.1")
+	assert.EqualError(t, err, "A reason is required to block 192.0.2.1")
+
+	_, err = parseSlackCommand("unban 192.0.2.1")
+	assert.EqualError(t, err, slackUsage)
+
+	_, err = parseSlackCommand("lookup example.com")
+	assert.Contains(t, err.Error(), "'example.com' must be an IP address")
+}
+
+func TestSlackConfig_Validate(t *testing.T) {
+	cfg := &SlackConfig{
+		Enabled: true,
+		Users:   []SlackUser{{ID: "UOPS", Author: "ops", Permissions: []string{"unblock"}}, {ID: "UOPS"}},
+	}
+	errs := cfg.Validate().Error()
+	assert.Contains(t, errs, "Field 'signing_secret' must not be empty")
+	assert.Contains(t, errs, "Field 'users[0].permissions' must only hold block, allow, delete, lookup, got 'unblock'")
+	assert.Contains(t, errs, "Field 'users[1].id' must be unique")
+	assert.Contains(t, errs, "Field 'users[1].author' must not be empty")
+}
@@ -0,0 +1,216 @@
+package hbl
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/hostinger/hbl/pkg/logger"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+// Types of changes recorded in the change log.
+const (
+	ChangeAdd    = "add"
+	ChangeUpdate = "update"
+	ChangeRemove = "remove"
+
+	// ChangeReset tells a client it has no cursor or one the change log no
+	// longer follows: it must fetch the whole list again, then apply the
+	// changes following the sequence of the reset.
+	ChangeReset = "reset"
+)
+
+// Change is a change of the list. Sequence is its ID in the change log and
+// grows with every change, across servers and restarts.
+type Change struct {
+	Sequence int64
+	Type     string
+	Address  *Address `json:",omitempty"`
+	At       time.Time
+}
+
+// StreamConfig tunes the stream of list changes served by /api/v1/events.
+type StreamConfig struct {
+	// Poll is how often the change log is read for changes made by other
+	// servers. Changes made by this server are streamed right away.
+	Poll time.Duration `mapstructure:"poll"`
+
+	// Heartbeat is how often a comment is sent to idle clients so proxies
+	// keep their connection open.
+	Heartbeat time.Duration `mapstructure:"heartbeat"`
+}
+
+func (c *StreamConfig) Validate() error {
+	var err error
+	if c.Poll <= 0 {
+		err = multierr.Append(err, errors.New("Field 'poll' must be positive"))
+	}
+	if c.Heartbeat <= 0 {
+		err = multierr.Append(err, errors.New("Field 'heartbeat' must be positive"))
+	}
+	return err
+}
+
+// Subscription tells a client following the change log when to read it
+// again.
+type Subscription struct {
+	Heartbeat time.Duration
+
+	stream *Stream
+	done   chan struct{}
+}
+
+// Changed is closed once the change log holds a change following last.
+func (s *Subscription) Changed(last int64) <-chan struct{} {
+	return s.stream.changedAfter(last)
+}
+
+// Done is closed once the stream stops, so the API can shut down.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Stream tails the change log and wakes the clients following it whenever
+// it grows. Clients read the changes themselves from the change log, so
+// they see the changes of every server and resume from any sequence it
+// still holds. It is safe for concurrent use.
+type Stream struct {
+	l          logger.Logger
+	repository Repository
+
+	mu      sync.Mutex
+	cfg     StreamConfig
+	head    int64
+	changed chan struct{}
+
+	notify chan struct{}
+	done   chan struct{}
+	stop   sync.Once
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewStream(l logger.Logger, r Repository, cfg *StreamConfig) *Stream {
+	s := &Stream{
+		l:          l,
+		repository: r,
+		changed:    make(chan struct{}),
+		notify:     make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+	s.Set(cfg)
+	return s
+}
+
+func (s *Stream) Set(cfg *StreamConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cfg = *cfg
+}
+
+func (s *Stream) config() StreamConfig {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cfg
+}
+
+// Start tails the change log in the background until Stop is called.
+func (s *Stream) Start() {
+	var ctx context.Context
+	ctx, s.cancel = context.WithCancel(context.Background())
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			s.poll(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.notify:
+			case <-time.After(s.config().Poll):
+			}
+		}
+	}()
+}
+
+// Stop stops tailing the change log and ends every subscription.
+func (s *Stream) Stop() {
+	if s == nil {
+		return
+	}
+	s.stop.Do(func() {
+		close(s.done)
+		if s.cancel != nil {
+			s.cancel()
+		}
+	})
+	s.wg.Wait()
+}
+
+// Notify reads the change log right away, after this server changed the
+// list.
+func (s *Stream) Notify() {
+	if s == nil {
+		return
+	}
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// poll moves the head to the last change of the change log, waking the
+// clients waiting for it.
+func (s *Stream) poll(ctx context.Context) {
+	s.mu.Lock()
+	head := s.head
+	s.mu.Unlock()
+	for {
+		feed, err := s.repository.GetChanges(ctx, head, 1000)
+		if err != nil {
+			if ctx.Err() == nil {
+				s.l.Error("Failed to read changes", zap.Error(err))
+			}
+			return
+		}
+		head = feed.Next
+		if !feed.More {
+			break
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if head != s.head {
+		s.head = head
+		close(s.changed)
+		s.changed = make(chan struct{})
+	}
+}
+
+func (s *Stream) changedAfter(last int64) <-chan struct{} {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.head > last {
+		closed := make(chan struct{})
+		close(closed)
+		return closed
+	}
+	return s.changed
+}
+
+// Subscribe returns a subscription to the changes of the list. Without a
+// stream, it's done right away.
+func (s *Stream) Subscribe() *Subscription {
+	if s == nil {
+		done := make(chan struct{})
+		close(done)
+		return &Subscription{Heartbeat: time.Minute, done: done}
+	}
+	return &Subscription{Heartbeat: s.config().Heartbeat, stream: s, done: s.done}
+}
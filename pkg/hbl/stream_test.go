@@ -0,0 +1,40 @@
+package hbl
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hostinger/hbl/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStream_Subscribe(t *testing.T) {
+	ctx := context.Background()
+	r := NewMockRepository()
+	stream := NewStream(logger.NewLogger("test"), r, &StreamConfig{Poll: 10 * time.Millisecond, Heartbeat: time.Second})
+	stream.Start()
+
+	sub := stream.Subscribe()
+	assert.NoError(t, r.CreateAddress(ctx, &Address{IP: "192.0.2.1", Action: "Block"}))
+	feed, _ := r.GetChanges(ctx, 0, 10)
+
+	// Changes made by another server are found by polling the change log.
+	select {
+	case <-sub.Changed(feed.Next - 1):
+	case <-time.After(time.Second):
+		t.Fatal("Change not streamed")
+	}
+	select {
+	case <-sub.Changed(feed.Next):
+		t.Fatal("Change streamed twice")
+	default:
+	}
+
+	stream.Stop()
+	select {
+	case <-sub.Done():
+	default:
+		t.Fatal("Subscription not done")
+	}
+}
@@ -0,0 +1,618 @@
+package hbl
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hostinger/hbl/pkg/logger"
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+// Events delivered to webhooks.
+const (
+	EventAddressBlocked   = "address.blocked"
+	EventAddressAllowed   = "address.allowed"
+	EventAddressUnblocked = "address.unblocked"
+	EventAddressDeleted   = "address.deleted"
+
+	// EventAddressBlockFailed follows address.blocked when the endpoints
+	// failed to block the address added to the list.
+	EventAddressBlockFailed = "address.block_failed"
+)
+
+var Events = []string{EventAddressBlocked, EventAddressAllowed, EventAddressUnblocked, EventAddressDeleted, EventAddressBlockFailed}
+
+// Statuses of a webhook delivery.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// Headers sent with every delivery. The signature is 'sha256=' followed by
+// the hex HMAC-SHA256 of the timestamp, a dot and the body, keyed with the
+// secret of the webhook.
+const (
+	HeaderWebhookEvent     = "X-HBL-Event"
+	HeaderWebhookDelivery  = "X-HBL-Delivery"
+	HeaderWebhookTimestamp = "X-HBL-Timestamp"
+	HeaderWebhookSignature = "X-HBL-Signature"
+)
+
+var (
+	ErrWebhooksDisabled = errors.New("Webhooks are not delivered by this server")
+	ErrCursorMoved      = errors.New("Webhook cursor was moved by another server")
+)
+
+// Webhook subscribes a URL to events. Events holds event types or patterns
+// such as 'address.*', and an empty list subscribes to every event.
+type Webhook struct {
+	ID     int64
+	URL    string
+	Events []string
+
+	// Secret signs deliveries. It's only returned when the webhook is
+	// created.
+	Secret string `json:",omitempty"`
+
+	CreatedAt time.Time
+}
+
+func (w *Webhook) Matches(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, pattern := range w.Events {
+		if ok, _ := path.Match(pattern, event); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateEvents checks every pattern matches at least one event.
+func ValidateEvents(patterns []string) error {
+	var err error
+	for _, pattern := range patterns {
+		var matched bool
+		for _, event := range Events {
+			if ok, _ := path.Match(pattern, event); ok {
+				matched = true
+			}
+		}
+		if !matched {
+			err = multierr.Append(err, fmt.Errorf("Field 'Events' must only match %s, got '%s'", strings.Join(Events, ", "), pattern))
+		}
+	}
+	return err
+}
+
+// Event is the JSON body of a delivery.
+type Event struct {
+	ID      string
+	Type    string
+	Address *Address
+	At      time.Time
+}
+
+// WebhookDelivery records sending an event to a webhook. Redeliveries are
+// new deliveries of the same event ID.
+type WebhookDelivery struct {
+	ID        int64
+	WebhookID int64
+	EventID   string
+	Event     string
+	Payload   json.RawMessage
+	Status    string
+	Attempts  int
+
+	// StatusCode and Error describe the last attempt.
+	StatusCode int    `json:",omitempty"`
+	Error      string `json:",omitempty"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// DeliveryFilter narrows down a listing of deliveries. Empty fields match
+// every delivery.
+type DeliveryFilter struct {
+	WebhookID int64
+	Status    string
+	Limit     int
+}
+
+// WebhooksConfig tunes the delivery of events to webhooks. Webhooks
+// themselves are managed through the API.
+type WebhooksConfig struct {
+	// Poll is how often the change log is read for changes made by other
+	// servers. Changes made by this server are published right away.
+	Poll time.Duration `mapstructure:"poll"`
+
+	// QueueSize is how many deliveries may wait for a worker. Deliveries
+	// beyond it stay pending until redelivered or the server restarts.
+	QueueSize int `mapstructure:"queue_size"`
+	Workers   int `mapstructure:"workers"`
+
+	// Timeout bounds every attempt. Failed attempts are retried Retries
+	// times, waiting Backoff before the first retry and twice as long before
+	// each next one, up to MaxBackoff.
+	Timeout    time.Duration `mapstructure:"timeout"`
+	Retries    int           `mapstructure:"retries"`
+	Backoff    time.Duration `mapstructure:"backoff"`
+	MaxBackoff time.Duration `mapstructure:"max_backoff"`
+
+	// Retention is how long deliveries are kept in the delivery log. Zero
+	// keeps them forever.
+	Retention time.Duration `mapstructure:"retention"`
+}
+
+func (c *WebhooksConfig) Validate() error {
+	var err error
+	if c.Poll <= 0 {
+		err = multierr.Append(err, errors.New("Field 'poll' must be positive"))
+	}
+	if c.QueueSize <= 0 {
+		err = multierr.Append(err, errors.New("Field 'queue_size' must be positive"))
+	}
+	if c.Workers <= 0 {
+		err = multierr.Append(err, errors.New("Field 'workers' must be positive"))
+	}
+	if c.Timeout <= 0 {
+		err = multierr.Append(err, errors.New("Field 'timeout' must be positive"))
+	}
+	if c.Retries < 0 {
+		err = multierr.Append(err, errors.New("Field 'retries' must not be negative"))
+	}
+	if c.Backoff <= 0 {
+		err = multierr.Append(err, errors.New("Field 'backoff' must be positive"))
+	}
+	if c.MaxBackoff < c.Backoff {
+		err = multierr.Append(err, errors.New("Field 'max_backoff' must not be less than 'backoff'"))
+	}
+	if c.Retention < 0 {
+		err = multierr.Append(err, errors.New("Field 'retention' must not be negative"))
+	}
+	return err
+}
+
+// SignWebhook returns the signature of body sent at timestamp.
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body) // nolint
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// randomHex returns n random bytes, hex encoded.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// Webhooks delivers events to the webhooks subscribed to them, recording
+// every delivery. It is safe for concurrent use, and a nil Webhooks ignores
+// events.
+type Webhooks struct {
+	l          logger.Logger
+	repository Repository
+	client     *http.Client
+	now        func() time.Time
+
+	mu  sync.RWMutex
+	cfg WebhooksConfig
+
+	queue  chan *WebhookDelivery
+	notify chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewWebhooks(l logger.Logger, r Repository, cfg *WebhooksConfig) *Webhooks {
+	w := &Webhooks{
+		l:          l,
+		repository: r,
+		client:     &http.Client{},
+		now:        time.Now,
+		notify:     make(chan struct{}, 1),
+	}
+	w.Set(cfg)
+	return w
+}
+
+func (w *Webhooks) Set(cfg *WebhooksConfig) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.cfg = *cfg
+}
+
+func (w *Webhooks) config() WebhooksConfig {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.cfg
+}
+
+// Start publishes the changes of the list and delivers events in the
+// background until Stop is called. Deliveries left pending by a previous run
+// are sent again, and the delivery log is pruned hourly.
+func (w *Webhooks) Start() {
+	cfg := w.config()
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+	w.queue = make(chan *WebhookDelivery, cfg.QueueSize)
+	for i := 0; i < cfg.Workers; i++ {
+		w.wg.Add(1)
+		go w.work()
+	}
+	w.resume(w.ctx)
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		for {
+			w.publishChanges(w.ctx)
+			select {
+			case <-w.ctx.Done():
+				return
+			case <-w.notify:
+			case <-time.After(w.config().Poll):
+			}
+		}
+	}()
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			w.prune(w.ctx)
+			select {
+			case <-w.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop abandons the current attempts, which stay pending and are sent again
+// on the next start.
+func (w *Webhooks) Stop() {
+	if w == nil || w.cancel == nil {
+		return
+	}
+	w.cancel()
+	w.wg.Wait()
+}
+
+// Notify reads the change log right away, after this server changed the
+// list.
+func (w *Webhooks) Notify() {
+	if w == nil {
+		return
+	}
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Publish delivers an event of type event about address, which isn't a
+// change of the list, to every webhook subscribed to it. Failures are
+// logged, they never fail the action. Changes of the list are published
+// from the change log instead, see publishChanges.
+func (w *Webhooks) Publish(ctx context.Context, event string, address *Address) {
+	if w == nil {
+		return
+	}
+	webhooks, err := w.repository.GetWebhooks(ctx)
+	if err != nil {
+		w.l.Error("Failed to publish event", zap.String("event", event), zap.Error(err))
+		return
+	}
+	e := &Event{ID: randomHex(16), Type: event, Address: address, At: w.now().UTC()}
+	deliveries, err := newDeliveries(webhooks, e)
+	if err != nil {
+		w.l.Error("Failed to publish event", zap.String("event", event), zap.Error(err))
+		return
+	}
+	for _, delivery := range deliveries {
+		if err := w.repository.CreateDelivery(ctx, delivery); err != nil {
+			w.l.Error("Failed to publish event", zap.String("event", event), zap.Int64("webhook", delivery.WebhookID), zap.Error(err))
+			continue
+		}
+		w.enqueue(delivery)
+	}
+}
+
+// publishChanges turns the changes of the list following the webhook cursor
+// into deliveries. The deliveries are saved together with the moved cursor,
+// so every change is published once, by a single server, even when one
+// stops right after changing the list.
+func (w *Webhooks) publishChanges(ctx context.Context) {
+	for {
+		cursor, err := w.repository.GetWebhookCursor(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				w.l.Error("Failed to publish changes", zap.Error(err))
+			}
+			return
+		}
+		feed, err := w.repository.GetChanges(ctx, cursor, 100)
+		if err != nil {
+			if ctx.Err() == nil {
+				w.l.Error("Failed to publish changes", zap.Error(err))
+			}
+			return
+		}
+		if feed.Reset {
+			w.l.Error("Changes were pruned before being published", zap.Int64("from", cursor), zap.Int64("to", feed.Next))
+		}
+		if feed.Next == cursor {
+			return
+		}
+		webhooks, err := w.repository.GetWebhooks(ctx)
+		if err != nil {
+			w.l.Error("Failed to publish changes", zap.Error(err))
+			return
+		}
+		var deliveries []*WebhookDelivery
+		for _, change := range feed.Changes {
+			event := changeEvent(change)
+			if event == "" {
+				continue
+			}
+			e := &Event{ID: fmt.Sprintf("change-%d", change.Sequence), Type: event, Address: change.Address, At: change.At.UTC()}
+			published, err := newDeliveries(webhooks, e)
+			if err != nil {
+				w.l.Error("Failed to publish changes", zap.Int64("sequence", change.Sequence), zap.Error(err))
+				return
+			}
+			deliveries = append(deliveries, published...)
+		}
+		err = w.repository.CreateDeliveries(ctx, cursor, feed.Next, deliveries)
+		if err == ErrCursorMoved {
+			// Another server published these changes.
+			continue
+		}
+		if err != nil {
+			w.l.Error("Failed to publish changes", zap.Error(err))
+			return
+		}
+		for _, delivery := range deliveries {
+			w.enqueue(delivery)
+		}
+		if !feed.More {
+			return
+		}
+	}
+}
+
+// changeEvent returns the event published for change, or nothing for
+// changes which aren't published, such as saved reports.
+func changeEvent(change *Change) string {
+	switch {
+	case change.Type == ChangeAdd && change.Address.Action == "Allow":
+		return EventAddressAllowed
+	case change.Type == ChangeAdd:
+		return EventAddressBlocked
+	case change.Type == ChangeRemove:
+		return EventAddressDeleted
+	}
+	return ""
+}
+
+// newDeliveries returns a pending delivery of e for every webhook subscribed
+// to it. The reports of the address aren't delivered.
+func newDeliveries(webhooks []*Webhook, e *Event) ([]*WebhookDelivery, error) {
+	var deliveries []*WebhookDelivery
+	var payload []byte
+	for _, webhook := range webhooks {
+		if !webhook.Matches(e.Type) {
+			continue
+		}
+		if payload == nil {
+			copied := *e
+			address := *e.Address
+			address.Reports = nil
+			copied.Address = &address
+			var err error
+			if payload, err = json.Marshal(&copied); err != nil {
+				return nil, errors.Wrap(err, "Failed to marshal event into JSON")
+			}
+		}
+		deliveries = append(deliveries, &WebhookDelivery{
+			WebhookID: webhook.ID,
+			EventID:   e.ID,
+			Event:     e.Type,
+			Payload:   payload,
+			Status:    DeliveryPending,
+		})
+	}
+	return deliveries, nil
+}
+
+// Redeliver sends the event of a past delivery again, as a new delivery.
+func (w *Webhooks) Redeliver(ctx context.Context, webhookID, deliveryID int64) (*WebhookDelivery, error) {
+	if w == nil {
+		return nil, ErrWebhooksDisabled
+	}
+	past, err := w.repository.GetDelivery(ctx, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if past.WebhookID != webhookID {
+		return nil, sql.ErrNoRows
+	}
+	delivery := &WebhookDelivery{
+		WebhookID: past.WebhookID,
+		EventID:   past.EventID,
+		Event:     past.Event,
+		Payload:   past.Payload,
+		Status:    DeliveryPending,
+	}
+	if err := w.repository.CreateDelivery(ctx, delivery); err != nil {
+		return nil, err
+	}
+	w.enqueue(delivery)
+	return delivery, nil
+}
+
+// enqueue hands delivery to the workers, or leaves it pending when the
+// queue is full or the workers aren't started.
+func (w *Webhooks) enqueue(delivery *WebhookDelivery) {
+	if w.queue == nil {
+		return
+	}
+	select {
+	case w.queue <- delivery:
+	default:
+		w.l.Error("Webhook queue is full, left delivery pending", zap.Int64("webhook", delivery.WebhookID), zap.Int64("delivery", delivery.ID))
+	}
+}
+
+func (w *Webhooks) work() {
+	defer w.wg.Done()
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case delivery := <-w.queue:
+			w.deliver(w.ctx, delivery)
+		}
+	}
+}
+
+// resume enqueues the deliveries left pending.
+func (w *Webhooks) resume(ctx context.Context) {
+	deliveries, err := w.repository.GetDeliveries(ctx, &DeliveryFilter{Status: DeliveryPending})
+	if err != nil {
+		w.l.Error("Failed to resume pending deliveries", zap.Error(err))
+		return
+	}
+	// Deliveries are listed newest first.
+	for i := len(deliveries) - 1; i >= 0; i-- {
+		w.enqueue(deliveries[i])
+	}
+}
+
+func (w *Webhooks) prune(ctx context.Context) {
+	retention := w.config().Retention
+	if retention <= 0 {
+		return
+	}
+	n, err := w.repository.DeleteDeliveries(ctx, w.now().Add(-retention))
+	if err != nil {
+		w.l.Error("Failed to prune deliveries", zap.Error(err))
+		return
+	}
+	if n > 0 {
+		w.l.Info("Pruned deliveries", zap.Int64("deliveries", n))
+	}
+}
+
+// deliver sends delivery, retrying with backoff, and records every attempt.
+func (w *Webhooks) deliver(ctx context.Context, delivery *WebhookDelivery) {
+	cfg := w.config()
+	backoff := cfg.Backoff
+	for attempt := 0; ; attempt++ {
+		webhook, err := w.repository.GetWebhook(ctx, delivery.WebhookID)
+		if err == sql.ErrNoRows {
+			delivery.Status, delivery.Error = DeliveryFailed, "Webhook was deleted"
+			w.update(delivery)
+			return
+		}
+		if err == nil {
+			delivery.StatusCode, err = w.send(ctx, webhook, delivery, cfg.Timeout)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		delivery.Attempts++
+		delivery.Error = ""
+		switch {
+		case err == nil:
+			delivery.Status = DeliveryDelivered
+		case attempt >= cfg.Retries:
+			delivery.Status, delivery.Error = DeliveryFailed, err.Error()
+			w.l.Error(
+				"Failed to deliver event",
+				zap.Int64("webhook", delivery.WebhookID),
+				zap.Int64("delivery", delivery.ID),
+				zap.Int("attempts", delivery.Attempts),
+				zap.Error(err),
+			)
+		default:
+			delivery.Error = err.Error()
+		}
+		w.update(delivery)
+		if delivery.Status != DeliveryPending {
+			return
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		if backoff *= 2; backoff > cfg.MaxBackoff {
+			backoff = cfg.MaxBackoff
+		}
+	}
+}
+
+func (w *Webhooks) update(delivery *WebhookDelivery) {
+	if err := w.repository.UpdateDelivery(context.Background(), delivery); err != nil {
+		w.l.Error("Failed to record delivery", zap.Int64("delivery", delivery.ID), zap.Error(err))
+	}
+}
+
+// send posts the payload of delivery to webhook, signed with its secret.
+func (w *Webhooks) send(ctx context.Context, webhook *Webhook, delivery *WebhookDelivery, timeout time.Duration) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, errors.Wrap(err, "Failed to create request")
+	}
+	timestamp := w.now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "hbl-webhooks")
+	req.Header.Set(HeaderWebhookEvent, delivery.Event)
+	req.Header.Set(HeaderWebhookDelivery, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(HeaderWebhookTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderWebhookSignature, SignWebhook(webhook.Secret, timestamp, delivery.Payload))
+	resp, err := w.client.Do(req)
+	if err != nil {
+		// Errors embed the URL, which may hold credentials.
+		if e, ok := err.(*url.Error); ok {
+			err = e.Err
+		}
+		return 0, errors.Wrap(err, "Failed to send request")
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64<<10)) // nolint
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, errors.Errorf("Unexpected status code %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
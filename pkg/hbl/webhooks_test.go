@@ -0,0 +1,151 @@
+package hbl
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hostinger/hbl/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhook_Matches(t *testing.T) {
+	webhook := &Webhook{Events: []string{"address.blocked", "address.del*"}}
+	assert.True(t, webhook.Matches(EventAddressBlocked))
+	assert.True(t, webhook.Matches(EventAddressDeleted))
+	assert.False(t, webhook.Matches(EventAddressAllowed))
+	assert.True(t, (&Webhook{}).Matches(EventAddressAllowed))
+
+	assert.NoError(t, ValidateEvents([]string{"address.*"}))
+	assert.EqualError(t, ValidateEvents([]string{"address.expired"}),
+		"Field 'Events' must only match address.blocked, address.allowed, address.unblocked, address.deleted, address.block_failed, got 'address.expired'")
+}
+
+// waitDelivery waits until delivery id is no longer pending.
+func waitDelivery(t *testing.T, r Repository, id int64) *WebhookDelivery {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		delivery, err := r.GetDelivery(context.Background(), id)
+		if err == nil && delivery.Status != DeliveryPending {
+			return delivery
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Delivery %d is still pending", id)
+	return nil
+}
+
+func TestWebhooks_Publish(t *testing.T) {
+	var calls int
+	received := make(chan *Event, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(503)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(HeaderWebhookTimestamp), 10, 64)
+		assert.Equal(t, SignWebhook("0123456789abcdef", timestamp, body), r.Header.Get(HeaderWebhookSignature))
+		assert.Equal(t, EventAddressBlocked, r.Header.Get(HeaderWebhookEvent))
+		var event Event
+		assert.NoError(t, json.Unmarshal(body, &event))
+		received <- &event
+	}))
+	defer server.Close()
+
+	r := NewMockRepository()
+	ctx := context.Background()
+	r.CreateWebhook(ctx, &Webhook{URL: server.URL, Events: []string{"address.blocked"}, Secret: "0123456789abcdef"}) // nolint
+	r.CreateWebhook(ctx, &Webhook{URL: server.URL, Events: []string{"address.allowed"}, Secret: "0123456789abcdef"}) // nolint
+
+	w := NewWebhooks(logger.NewLogger("test"), r, &WebhooksConfig{
+		Poll:       time.Minute,
+		QueueSize:  10,
+		Workers:    1,
+		Timeout:    time.Second,
+		Retries:    1,
+		Backoff:    time.Millisecond,
+		MaxBackoff: time.Millisecond,
+	})
+	w.Start()
+	defer w.Stop()
+
+	r.CreateAddress(ctx, &Address{IP: "192.0.2.1", Target: TargetIP, Action: "Block", Author: "ops"}) // nolint
+	w.Notify()
+
+	event := <-received
+	assert.Equal(t, "change-2", event.ID)
+	assert.Equal(t, EventAddressBlocked, event.Type)
+	assert.Equal(t, "192.0.2.1", event.Address.IP)
+
+	deliveries, _ := r.GetDeliveries(ctx, &DeliveryFilter{})
+	if assert.Len(t, deliveries, 1) {
+		delivery := waitDelivery(t, r, deliveries[0].ID)
+		assert.Equal(t, DeliveryDelivered, delivery.Status)
+		assert.Equal(t, 2, delivery.Attempts)
+		assert.Equal(t, 200, delivery.StatusCode)
+
+		redelivery, err := w.Redeliver(ctx, delivery.WebhookID, delivery.ID)
+		if assert.NoError(t, err) {
+			assert.Equal(t, event.ID, (<-received).ID)
+			assert.Equal(t, delivery.EventID, redelivery.EventID)
+			assert.Equal(t, DeliveryDelivered, waitDelivery(t, r, redelivery.ID).Status)
+		}
+	}
+}
+
+func TestWebhooks_deliverFails(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(500)
+	}))
+	defer server.Close()
+
+	r := NewMockRepository()
+	ctx := context.Background()
+	webhook := &Webhook{URL: server.URL, Secret: "0123456789abcdef"}
+	r.CreateWebhook(ctx, webhook) // nolint
+	delivery := &WebhookDelivery{WebhookID: webhook.ID, EventID: "1", Event: EventAddressDeleted, Payload: []byte("{}"), Status: DeliveryPending}
+	r.CreateDelivery(ctx, delivery) // nolint
+
+	w := NewWebhooks(logger.NewLogger("test"), r, &WebhooksConfig{Timeout: time.Second, Retries: 2, Backoff: time.Millisecond, MaxBackoff: time.Millisecond})
+	w.deliver(ctx, delivery)
+
+	recorded, _ := r.GetDelivery(ctx, delivery.ID)
+	assert.Equal(t, DeliveryFailed, recorded.Status)
+	assert.Equal(t, 3, recorded.Attempts)
+	assert.Equal(t, 500, recorded.StatusCode)
+	assert.Equal(t, "Unexpected status code 500", recorded.Error)
+}
+
+func TestWebhooks_publishChanges(t *testing.T) {
+	r := NewMockRepository()
+	ctx := context.Background()
+	r.CreateWebhook(ctx, &Webhook{Secret: "0123456789abcdef"}) // nolint
+
+	r.CreateAddress(ctx, &Address{IP: "192.0.2.1", Target: TargetIP, Action: "Allow"}) // nolint
+	r.SaveReports(ctx, "192.0.2.1", nil)                                               // nolint
+	r.DeleteAddress(ctx, "192.0.2.1")                                                  // nolint
+
+	w := NewWebhooks(logger.NewLogger("test"), r, &WebhooksConfig{})
+	w.publishChanges(ctx)
+	w.publishChanges(ctx)
+
+	deliveries, _ := r.GetDeliveries(ctx, &DeliveryFilter{})
+	if assert.Len(t, deliveries, 2) {
+		assert.Equal(t, EventAddressDeleted, deliveries[0].Event)
+		assert.Equal(t, "change-4", deliveries[0].EventID)
+		assert.Equal(t, EventAddressAllowed, deliveries[1].Event)
+		assert.Equal(t, "change-2", deliveries[1].EventID)
+	}
+	cursor, _ := r.GetWebhookCursor(ctx)
+	assert.Equal(t, int64(4), cursor)
+
+	// Another server published the changes first.
+	assert.Equal(t, ErrCursorMoved, r.CreateDeliveries(ctx, 1, 4, deliveries))
+}
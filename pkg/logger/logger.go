@@ -4,6 +4,7 @@ import (
 	"os"
 
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 type Logger interface {
@@ -11,30 +12,47 @@ type Logger interface {
 	Debug(msg string, fields ...zap.Field)
 	Error(msg string, fields ...zap.Field)
 	Fatal(msg string, fields ...zap.Field)
+	SetLevel(level string) error
 }
 
 type logger struct {
 	logger *zap.Logger
+	level  zap.AtomicLevel
 }
 
 func NewLoggerFromEnv() Logger {
-	switch os.Getenv("LOG_CHANNEL") {
+	return NewLogger(os.Getenv("LOG_CHANNEL"))
+}
+
+func NewLogger(channel string) Logger {
+	var cfg zap.Config
+	switch channel {
 	case "ZAP_PRODUCTION":
-		l, _ := zap.NewProduction() // nolint
-		return &logger{
-			logger: l,
-		}
+		cfg = zap.NewProductionConfig()
 	case "ZAP_DEVELOPMENT":
-		l, _ := zap.NewDevelopment() // nolint
-		return &logger{
-			logger: l,
-		}
+		cfg = zap.NewDevelopmentConfig()
 	default:
-		l, _ := zap.NewDevelopment() // nolint
-		return &logger{
-			logger: l,
-		}
+		cfg = zap.NewDevelopmentConfig()
+	}
+	l, _ := cfg.Build() // nolint
+	return &logger{
+		logger: l,
+		level:  cfg.Level,
+	}
+}
+
+// SetLevel changes the minimum enabled level at runtime. An empty level
+// leaves the channel default in place.
+func (l *logger) SetLevel(level string) error {
+	if level == "" {
+		return nil
+	}
+	var lvl zapcore.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return err
 	}
+	l.level.SetLevel(lvl)
+	return nil
 }
 
 func (l *logger) Info(msg string, fields ...zap.Field) {
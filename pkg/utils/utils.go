@@ -3,6 +3,8 @@ package utils
 import (
 	"net"
 	"strings"
+
+	"github.com/pkg/errors"
 )
 
 func ReverseAddress(slice []string) string {
@@ -16,3 +18,37 @@ func ReverseAddress(slice []string) string {
 	}
 	return ip.String()
 }
+
+// Redact hides a secret value while still telling whether it was set.
+func Redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "******"
+}
+
+// ParseRanges parses CIDR notation or single IP addresses into networks.
+func ParseRanges(ranges []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(ranges))
+	for _, r := range ranges {
+		r = strings.TrimSpace(r)
+		if !strings.Contains(r, "/") {
+			ip := net.ParseIP(r)
+			if ip == nil {
+				return nil, errors.Errorf("Range '%s' must be a valid IP address or CIDR", r)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(r)
+		if err != nil {
+			return nil, errors.Errorf("Range '%s' must be a valid IP address or CIDR", r)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
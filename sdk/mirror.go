@@ -0,0 +1,130 @@
+package sdk
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Mirror keeps a local copy of the list up to date from the change feed of
+// the server, e.g. to apply it to a local firewall. It is safe for
+// concurrent use.
+type Mirror struct {
+	client Client
+
+	// syncing serializes syncs, mu guards the copy.
+	syncing sync.Mutex
+	mu      sync.RWMutex
+	entries map[string]*Address
+	cursor  int64
+}
+
+func NewMirror(client Client) *Mirror {
+	return &Mirror{
+		client:  client,
+		entries: make(map[string]*Address),
+	}
+}
+
+// Sync brings the mirror up to date and returns the changes applied, oldest
+// first. The whole list is fetched on the first sync and whenever the server
+// no longer holds the changes following the cursor: the changes then start
+// with a reset, after which entries should be read again with List rather
+// than updated from changes.
+func (m *Mirror) Sync(ctx context.Context) ([]*Change, error) {
+	m.syncing.Lock()
+	defer m.syncing.Unlock()
+	var applied []*Change
+	for {
+		feed, err := m.client.GetChanges(ctx, m.Cursor(), 0)
+		if err != nil {
+			return applied, err
+		}
+		if feed.Reset {
+			// The cursor is read before the list, so changes following it
+			// which the list already holds are applied again, to the same
+			// effect.
+			addresses, err := m.client.GetAll(ctx)
+			if err != nil {
+				return applied, err
+			}
+			entries := make(map[string]*Address, len(addresses))
+			for _, address := range addresses {
+				entries[address.Key()] = address
+			}
+			m.mu.Lock()
+			m.entries, m.cursor = entries, feed.Next
+			m.mu.Unlock()
+			applied = []*Change{{Sequence: feed.Next, Type: ChangeReset, At: time.Now()}}
+			continue
+		}
+		m.mu.Lock()
+		for _, change := range feed.Changes {
+			switch change.Type {
+			case ChangeAdd, ChangeUpdate:
+				m.entries[change.Address.Key()] = change.Address
+			case ChangeRemove:
+				delete(m.entries, change.Address.Key())
+			}
+		}
+		m.cursor = feed.Next
+		m.mu.Unlock()
+		applied = append(applied, feed.Changes...)
+		if !feed.More {
+			return applied, nil
+		}
+	}
+}
+
+// Run syncs the mirror every interval until ctx is done, passing the
+// outcome of every sync to fn unless it's nil. Failed syncs are retried on
+// the next tick.
+func (m *Mirror) Run(ctx context.Context, interval time.Duration, fn func([]*Change, error)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		changes, err := m.Sync(ctx)
+		if fn != nil && (len(changes) > 0 || err != nil) {
+			fn(changes, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Get returns the entry identified by key, see Address.Key.
+func (m *Mirror) Get(key string) (*Address, bool) {
+	if parsed, err := ParseKey(key); err == nil {
+		key = parsed.Key()
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	address, ok := m.entries[key]
+	return address, ok
+}
+
+// List returns every entry, ordered by key.
+func (m *Mirror) List() []*Address {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	addresses := make([]*Address, 0, len(m.entries))
+	for _, address := range m.entries {
+		addresses = append(addresses, address)
+	}
+	sort.Slice(addresses, func(i, j int) bool {
+		return addresses[i].Key() < addresses[j].Key()
+	})
+	return addresses
+}
+
+// Cursor returns the cursor of the last change applied, zero before the
+// first sync.
+func (m *Mirror) Cursor() int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.cursor
+}
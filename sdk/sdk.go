@@ -1,41 +1,307 @@
 package sdk
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 )
 
+// Targets an address entry can apply to.
+const (
+	TargetIP      = "ip"
+	TargetASN     = "asn"
+	TargetCountry = "country"
+	TargetNetwork = "network"
+)
+
+// Address is an entry for an IP address or, when Target is 'asn', 'country'
+// or 'network', for a whole autonomous system, country or network identified
+// by ASN, Country or Network instead of IP.
 type Address struct {
+	IP         string
+	Target     string `json:",omitempty"`
+	Network    string `json:",omitempty"`
+	Action     string
+	Author     string
+	Comment    string
+	Source     string   `json:",omitempty"`
+	Categories []string `json:",omitempty"`
+
+	Country      string `json:",omitempty"`
+	ASN          uint   `json:",omitempty"`
+	Organization string `json:",omitempty"`
+
+	CreatedAt time.Time
+	Reports   []*Report `json:",omitempty"`
+}
+
+// Key identifies the entry in GetOne, Delete and SyncOne: its IP address,
+// its AS number such as 'AS64496', its country code such as 'RU' or its
+// network such as '192.0.2.0/24'.
+func (a *Address) Key() string {
+	switch a.Target {
+	case TargetNetwork:
+		return a.Network
+	case TargetASN:
+		return fmt.Sprintf("AS%d", a.ASN)
+	case TargetCountry:
+		return a.Country
+	}
+	return a.IP
+}
+
+// ParseKey returns an entry with only its target filled in from key, which
+// is an IP address, an AS number such as 'AS64496', a country code or a
+// network in CIDR notation.
+func ParseKey(key string) (*Address, error) {
+	if net.ParseIP(key) != nil {
+		return &Address{IP: key, Target: TargetIP}, nil
+	}
+	if _, network, err := net.ParseCIDR(key); err == nil {
+		return &Address{Target: TargetNetwork, Network: network.String()}, nil
+	}
+	upper := strings.ToUpper(key)
+	if strings.HasPrefix(upper, "AS") {
+		if asn, err := strconv.ParseUint(upper[2:], 10, 32); err == nil && asn != 0 {
+			return &Address{Target: TargetASN, ASN: uint(asn)}, nil
+		}
+	}
+	if len(upper) == 2 && strings.Trim(upper, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") == "" {
+		return &Address{Target: TargetCountry, Country: upper}, nil
+	}
+	return nil, errors.Errorf("Argument '%s' must be an IP address, an AS number, a country code or a network", key)
+}
+
+// Decision is what the server's policy decides for an address. Rule is the
+// rule which matched, if any, and Rules every rule evaluated up to it.
+type Decision struct {
+	IP       string
+	Action   string
+	Duration string
+	Rule     string
+	Rules    []*RuleEvaluation
+}
+
+type RuleEvaluation struct {
+	Name    string
+	When    string
+	Matched bool
+	Error   string
+}
+
+// AddressFilter narrows down List and Export. Empty fields match every
+// address.
+type AddressFilter struct {
+	Target  string
+	Action  string
+	Country string
+	ASN     uint
+}
+
+func (f *AddressFilter) query() string {
+	if f == nil {
+		return ""
+	}
+	q := url.Values{}
+	if f.Target != "" {
+		q.Set("target", f.Target)
+	}
+	if f.Action != "" {
+		q.Set("action", f.Action)
+	}
+	if f.Country != "" {
+		q.Set("country", f.Country)
+	}
+	if f.ASN != 0 {
+		q.Set("asn", fmt.Sprintf("%d", f.ASN))
+	}
+	if len(q) == 0 {
+		return ""
+	}
+	return "?" + q.Encode()
+}
+
+// Report is the outcome of contributing a blocked address to a checker
+// such as AbuseIPDB.
+type Report struct {
+	Reporter string
+	Status   string
+	Message  string
+	At       time.Time
+}
+
+// PluginResult is the outcome of the last operation or health check run on
+// an endpoint, checker or alerter.
+type PluginResult struct {
+	Operation string
 	IP        string
-	Action    string
-	Author    string
-	Comment   string
+	Error     string
+	At        time.Time
+}
+
+// Plugin describes an endpoint, checker or alerter registered on the server.
+// State, Queued and Aggregation are only reported for endpoints, and Queue
+// for alerters.
+type Plugin struct {
+	Name          string
+	Enabled       bool
+	State         string
+	Config        map[string]string
+	Queued        int
+	LastOperation *PluginResult
+	LastHealth    *PluginResult
+	Aggregation   *AggregationResult `json:",omitempty"`
+	Queue         *QueueStats        `json:",omitempty"`
+}
+
+// QueueStats counts what happened to the alerts of an alerter since the
+// server started.
+type QueueStats struct {
+	Queued    int
+	Delivered int
+	Retried   int
+	Failed    int
+	Dropped   int
+	Digests   int
+}
+
+// AggregationResult is the outcome of the last sync of an endpoint holding
+// the blocked set collapsed into covering networks.
+type AggregationResult struct {
+	Entries   int
+	Networks  int
+	Truncated int
+	At        time.Time
+}
+
+// Escalation is a network holding enough blocked addresses to be blocked
+// as a whole. Skipped explains why it must not be, and Retired is how many
+// addresses were deleted once it was.
+type Escalation struct {
+	Network        string
+	Count          int
+	Addresses      []string
+	FirstBlockedAt time.Time
+	LastBlockedAt  time.Time
+	Skipped        string `json:",omitempty"`
+	Retired        int    `json:",omitempty"`
+}
+
+// Webhook subscribes a URL to address changes. Events holds event types
+// such as 'address.blocked' or patterns such as 'address.*', and is empty to
+// subscribe to every event. Secret is only returned on creation.
+type Webhook struct {
+	ID        int64
+	URL       string
+	Events    []string
+	Secret    string `json:",omitempty"`
 	CreatedAt time.Time
 }
 
+// WebhookDelivery records sending an event to a webhook. StatusCode and
+// Error describe its last attempt.
+type WebhookDelivery struct {
+	ID         int64
+	WebhookID  int64
+	EventID    string
+	Event      string
+	Payload    json.RawMessage
+	Status     string
+	Attempts   int
+	StatusCode int    `json:",omitempty"`
+	Error      string `json:",omitempty"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// Event is the body of a webhook delivery.
+type Event struct {
+	ID      string
+	Type    string
+	Address *Address
+	At      time.Time
+}
+
+// Types of changes streamed by Watch.
+const (
+	ChangeAdd    = "add"
+	ChangeUpdate = "update"
+	ChangeRemove = "remove"
+
+	// ChangeReset means there is no cursor to resume from: the whole list
+	// must be fetched again before applying the next changes.
+	ChangeReset = "reset"
+)
+
+// Change is a change of the list. Sequence is the cursor of the change log
+// following the change, and Address is missing on resets.
+type Change struct {
+	Sequence int64
+	Type     string
+	Address  *Address `json:",omitempty"`
+	At       time.Time
+}
+
+// ChangeFeed is a page of changes returned by GetChanges. Next is the
+// cursor to ask for the following changes, and More tells whether there are
+// some already. Reset means the changes following the cursor asked for are
+// no longer kept, or no cursor was given: the whole list must be fetched,
+// then the changes following Next applied to it.
+type ChangeFeed struct {
+	Changes []*Change
+	Next    int64
+	More    bool
+	Reset   bool
+}
+
 type Client interface {
 	Allow(ctx context.Context, ip, author, comment string) error
 	Block(ctx context.Context, ip, author, comment string) error
+	BlockAddress(ctx context.Context, address *Address) error
 	GetOne(ctx context.Context, ip string) (*Address, error)
 	GetAll(ctx context.Context) ([]*Address, error)
+	List(ctx context.Context, filter *AddressFilter) ([]*Address, error)
+	Export(ctx context.Context, filter *AddressFilter) ([]byte, error)
+	Evaluate(ctx context.Context, ip string, address *Address) (*Decision, error)
 	Delete(ctx context.Context, ip string) error
 	SyncOne(ctx context.Context, ip string) error
 	SyncAll(ctx context.Context) error
+	GetEscalations(ctx context.Context) ([]*Escalation, error)
+	Escalate(ctx context.Context, network, author, comment string) (*Escalation, error)
+	GetEndpoints(ctx context.Context) ([]*Plugin, error)
+	GetCheckers(ctx context.Context) ([]*Plugin, error)
+	GetAlerters(ctx context.Context) ([]*Plugin, error)
+	PauseEndpoint(ctx context.Context, name string) (*Plugin, error)
+	ResumeEndpoint(ctx context.Context, name string) (*Plugin, error)
+	GetWebhooks(ctx context.Context) ([]*Webhook, error)
+	CreateWebhook(ctx context.Context, webhook *Webhook) (*Webhook, error)
+	DeleteWebhook(ctx context.Context, id int64) error
+	GetDeliveries(ctx context.Context, id int64, status string, limit int) ([]*WebhookDelivery, error)
+	Redeliver(ctx context.Context, id, delivery int64) (*WebhookDelivery, error)
+	Watch(ctx context.Context, since int64, fn func(*Change) error) error
+	GetChanges(ctx context.Context, since int64, limit int) (*ChangeFeed, error)
 }
 
 type client struct {
-	http *http.Client
-	url  string
-	key  string
+	http   *http.Client
+	stream *http.Client
+	url    string
+	key    string
 }
 
 func NewClient(key, url string) Client {
@@ -43,8 +309,9 @@ func NewClient(key, url string) Client {
 		http: &http.Client{
 			Timeout: time.Second * 5,
 		},
-		url: url,
-		key: key,
+		stream: &http.Client{},
+		url:    url,
+		key:    key,
 	}
 }
 
@@ -81,12 +348,15 @@ func (c *client) ExecuteAction(ctx context.Context, ip, action, author, comment
 			Text: ip,
 		}
 	}
-	b := &Address{
+	return c.Post(ctx, &Address{
 		IP:      ip,
 		Action:  action,
 		Author:  author,
 		Comment: comment,
-	}
+	})
+}
+
+func (c *client) Post(ctx context.Context, b *Address) error {
 	body, err := json.Marshal(b)
 	if err != nil {
 		return errors.Wrap(err, "Failed to marshal request into JSON")
@@ -106,28 +376,54 @@ func (c *client) Block(ctx context.Context, ip, author, comment string) error {
 	return c.ExecuteAction(ctx, ip, "Block", author, comment)
 }
 
-func (c *client) Delete(ctx context.Context, ip string) error {
-	if net.ParseIP(ip) == nil {
-		return &net.ParseError{
-			Type: "IPv4 Address",
-			Text: ip,
+// BlockAddress blocks an address together with its source and categories,
+// which decide whether it's reported to AbuseIPDB. Set Target to block a
+// whole ASN, country or network.
+func (c *client) BlockAddress(ctx context.Context, address *Address) error {
+	switch address.Target {
+	case TargetASN:
+		if address.ASN == 0 {
+			return errors.New("Field 'ASN' must be an AS number")
+		}
+	case TargetCountry:
+		if key, err := ParseKey(address.Country); err != nil || key.Target != TargetCountry {
+			return errors.New("Field 'Country' must be an ISO 3166-1 alpha-2 code")
+		}
+	case TargetNetwork:
+		if _, _, err := net.ParseCIDR(address.Network); err != nil {
+			return errors.New("Field 'Network' must be a network in CIDR notation")
+		}
+	default:
+		if net.ParseIP(address.IP) == nil {
+			return &net.ParseError{
+				Type: "IPv4 Address",
+				Text: address.IP,
+			}
 		}
 	}
-	_, err := c.Call(ctx, "DELETE", fmt.Sprintf("addresses/%s", ip), nil)
+	b := *address
+	b.Action = "Block"
+	return c.Post(ctx, &b)
+}
+
+// Delete removes the entry identified by key, see Address.Key.
+func (c *client) Delete(ctx context.Context, ip string) error {
+	if _, err := ParseKey(ip); err != nil {
+		return err
+	}
+	_, err := c.Call(ctx, "DELETE", fmt.Sprintf("addresses/%s", url.PathEscape(ip)), nil)
 	if err != nil {
 		return errors.Wrap(err, "Failed to execute DELETE request")
 	}
 	return nil
 }
 
+// GetOne fetches the entry identified by key, see Address.Key.
 func (c *client) GetOne(ctx context.Context, ip string) (*Address, error) {
-	if net.ParseIP(ip) == nil {
-		return nil, &net.ParseError{
-			Type: "IPv4 Address",
-			Text: ip,
-		}
+	if _, err := ParseKey(ip); err != nil {
+		return nil, err
 	}
-	result, err := c.Call(ctx, "GET", fmt.Sprintf("addresses/%s", ip), nil)
+	result, err := c.Call(ctx, "GET", fmt.Sprintf("addresses/%s", url.PathEscape(ip)), nil)
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to execute GET request")
 	}
@@ -139,7 +435,11 @@ func (c *client) GetOne(ctx context.Context, ip string) (*Address, error) {
 }
 
 func (c *client) GetAll(ctx context.Context) ([]*Address, error) {
-	result, err := c.Call(ctx, "GET", "addresses", nil)
+	return c.List(ctx, nil)
+}
+
+func (c *client) List(ctx context.Context, filter *AddressFilter) ([]*Address, error) {
+	result, err := c.Call(ctx, "GET", "addresses"+filter.query(), nil)
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to execute GET request")
 	}
@@ -150,6 +450,15 @@ func (c *client) GetAll(ctx context.Context) ([]*Address, error) {
 	return addresses, nil
 }
 
+// Export returns the addresses matching filter as CSV.
+func (c *client) Export(ctx context.Context, filter *AddressFilter) ([]byte, error) {
+	result, err := c.Call(ctx, "GET", "addresses/export"+filter.query(), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to execute GET request")
+	}
+	return result, nil
+}
+
 func (c *client) SyncAll(ctx context.Context) error {
 	_, err := c.Call(ctx, "POST", "addresses/sync", nil)
 	if err != nil {
@@ -159,9 +468,337 @@ func (c *client) SyncAll(ctx context.Context) error {
 }
 
 func (c *client) SyncOne(ctx context.Context, ip string) error {
-	_, err := c.Call(ctx, "POST", fmt.Sprintf("addresses/sync/%s", ip), nil)
+	_, err := c.Call(ctx, "POST", fmt.Sprintf("addresses/sync/%s", url.PathEscape(ip)), nil)
 	if err != nil {
 		return errors.Wrap(err, "Failed to execute POST request")
 	}
 	return nil
 }
+
+// GetEscalations lists the networks suggested for blocking as a whole.
+func (c *client) GetEscalations(ctx context.Context) ([]*Escalation, error) {
+	result, err := c.Call(ctx, "GET", "escalations", nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to execute GET request")
+	}
+	var escalations []*Escalation
+	if err := json.Unmarshal(result, &escalations); err != nil {
+		return nil, errors.Wrap(err, "Failed to unmarshal response from JSON")
+	}
+	return escalations, nil
+}
+
+// Escalate blocks a suggested network and deletes the blocked addresses it
+// covers.
+func (c *client) Escalate(ctx context.Context, network, author, comment string) (*Escalation, error) {
+	if _, _, err := net.ParseCIDR(network); err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(map[string]string{"Network": network, "Author": author, "Comment": comment})
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to marshal request into JSON")
+	}
+	result, err := c.Call(ctx, "POST", "escalations", bytes.NewBuffer(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to execute POST request")
+	}
+	var escalation Escalation
+	if err := json.Unmarshal(result, &escalation); err != nil {
+		return nil, errors.Wrap(err, "Failed to unmarshal response from JSON")
+	}
+	return &escalation, nil
+}
+
+func (c *client) getPlugins(ctx context.Context, kind string) ([]*Plugin, error) {
+	result, err := c.Call(ctx, "GET", kind, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to execute GET request")
+	}
+	var plugins []*Plugin
+	if err := json.Unmarshal(result, &plugins); err != nil {
+		return nil, errors.Wrap(err, "Failed to unmarshal response from JSON")
+	}
+	return plugins, nil
+}
+
+func (c *client) GetEndpoints(ctx context.Context) ([]*Plugin, error) {
+	return c.getPlugins(ctx, "endpoints")
+}
+
+func (c *client) GetCheckers(ctx context.Context) ([]*Plugin, error) {
+	return c.getPlugins(ctx, "checkers")
+}
+
+func (c *client) GetAlerters(ctx context.Context) ([]*Plugin, error) {
+	return c.getPlugins(ctx, "alerters")
+}
+
+func (c *client) setEndpointState(ctx context.Context, name, state string) (*Plugin, error) {
+	body, err := json.Marshal(map[string]string{"State": state})
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to marshal request into JSON")
+	}
+	result, err := c.Call(ctx, "PUT", fmt.Sprintf("endpoints/%s/state", url.PathEscape(name)), bytes.NewBuffer(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to execute PUT request")
+	}
+	var plugin Plugin
+	if err := json.Unmarshal(result, &plugin); err != nil {
+		return nil, errors.Wrap(err, "Failed to unmarshal response from JSON")
+	}
+	return &plugin, nil
+}
+
+// Evaluate asks the server what its policy decides for ip. The source,
+// author, comment and categories of address, if given, are evaluated too.
+func (c *client) Evaluate(ctx context.Context, ip string, address *Address) (*Decision, error) {
+	if net.ParseIP(ip) == nil {
+		return nil, &net.ParseError{
+			Type: "IPv4 Address",
+			Text: ip,
+		}
+	}
+	if address == nil {
+		address = &Address{}
+	}
+	body, err := json.Marshal(address)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to marshal request into JSON")
+	}
+	result, err := c.Call(ctx, "POST", fmt.Sprintf("evaluate/%s", ip), bytes.NewBuffer(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to execute POST request")
+	}
+	var decision Decision
+	if err := json.Unmarshal(result, &decision); err != nil {
+		return nil, errors.Wrap(err, "Failed to unmarshal response from JSON")
+	}
+	return &decision, nil
+}
+
+func (c *client) PauseEndpoint(ctx context.Context, name string) (*Plugin, error) {
+	return c.setEndpointState(ctx, name, "paused")
+}
+
+func (c *client) ResumeEndpoint(ctx context.Context, name string) (*Plugin, error) {
+	return c.setEndpointState(ctx, name, "active")
+}
+
+// GetWebhooks lists the webhooks, without their secrets.
+func (c *client) GetWebhooks(ctx context.Context) ([]*Webhook, error) {
+	result, err := c.Call(ctx, "GET", "webhooks", nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to execute GET request")
+	}
+	var webhooks []*Webhook
+	if err := json.Unmarshal(result, &webhooks); err != nil {
+		return nil, errors.Wrap(err, "Failed to unmarshal response from JSON")
+	}
+	return webhooks, nil
+}
+
+// CreateWebhook subscribes webhook. The server generates a secret unless
+// one is given, and returns it only now.
+func (c *client) CreateWebhook(ctx context.Context, webhook *Webhook) (*Webhook, error) {
+	body, err := json.Marshal(map[string]interface{}{"URL": webhook.URL, "Events": webhook.Events, "Secret": webhook.Secret})
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to marshal request into JSON")
+	}
+	result, err := c.Call(ctx, "POST", "webhooks", bytes.NewBuffer(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to execute POST request")
+	}
+	var created Webhook
+	if err := json.Unmarshal(result, &created); err != nil {
+		return nil, errors.Wrap(err, "Failed to unmarshal response from JSON")
+	}
+	return &created, nil
+}
+
+// DeleteWebhook unsubscribes a webhook and deletes its deliveries.
+func (c *client) DeleteWebhook(ctx context.Context, id int64) error {
+	_, err := c.Call(ctx, "DELETE", fmt.Sprintf("webhooks/%d", id), nil)
+	if err != nil {
+		return errors.Wrap(err, "Failed to execute DELETE request")
+	}
+	return nil
+}
+
+// GetDeliveries lists the latest deliveries of a webhook, newest first,
+// only those with status unless it's empty.
+func (c *client) GetDeliveries(ctx context.Context, id int64, status string, limit int) ([]*WebhookDelivery, error) {
+	q := url.Values{}
+	if status != "" {
+		q.Set("status", status)
+	}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	path := fmt.Sprintf("webhooks/%d/deliveries", id)
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	result, err := c.Call(ctx, "GET", path, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to execute GET request")
+	}
+	var deliveries []*WebhookDelivery
+	if err := json.Unmarshal(result, &deliveries); err != nil {
+		return nil, errors.Wrap(err, "Failed to unmarshal response from JSON")
+	}
+	return deliveries, nil
+}
+
+// Redeliver sends the event of a past delivery again, as a new delivery.
+func (c *client) Redeliver(ctx context.Context, id, delivery int64) (*WebhookDelivery, error) {
+	result, err := c.Call(ctx, "POST", fmt.Sprintf("webhooks/%d/deliveries/%d/redeliver", id, delivery), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to execute POST request")
+	}
+	var redelivery WebhookDelivery
+	if err := json.Unmarshal(result, &redelivery); err != nil {
+		return nil, errors.Wrap(err, "Failed to unmarshal response from JSON")
+	}
+	return &redelivery, nil
+}
+
+// GetChanges returns at most limit changes following the cursor since, the
+// server's default when limit is zero. A zero since asks for the cursor to
+// start from.
+func (c *client) GetChanges(ctx context.Context, since int64, limit int) (*ChangeFeed, error) {
+	q := url.Values{}
+	if since != 0 {
+		q.Set("since", strconv.FormatInt(since, 10))
+	}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	path := "changes"
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	result, err := c.Call(ctx, "GET", path, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to execute GET request")
+	}
+	var feed ChangeFeed
+	if err := json.Unmarshal(result, &feed); err != nil {
+		return nil, errors.Wrap(err, "Failed to unmarshal response from JSON")
+	}
+	return &feed, nil
+}
+
+// stopWatching wraps the errors Watch returns instead of reconnecting.
+type stopWatching struct {
+	error
+}
+
+// Watch streams the changes of the list following the cursor since to fn
+// until ctx is done or fn fails. It reconnects whenever the stream breaks and
+// resumes after the last change received, so no change is missed. A change
+// of type 'reset' comes first when since is zero or the server no longer
+// holds the changes to resume from: the whole list must be fetched again
+// before applying the changes which follow.
+func (c *client) Watch(ctx context.Context, since int64, fn func(*Change) error) error {
+	backoff := time.Second
+	for {
+		last := since
+		err := c.watch(ctx, &since, fn)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if stop, ok := err.(stopWatching); ok {
+			return stop.error
+		}
+		if since != last {
+			backoff = time.Second
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > 30*time.Second {
+			backoff = 30 * time.Second
+		}
+	}
+}
+
+// watch reads the stream once, moving since past every change fn accepts.
+func (c *client) watch(ctx context.Context, since *int64, fn func(*Change) error) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/events", c.url), nil)
+	if err != nil {
+		return stopWatching{errors.Wrap(err, "Failed creating new request object")}
+	}
+	req.Header.Add("X-API-Key", c.key)
+	req.Header.Add("Accept", "text/event-stream")
+	if *since != 0 {
+		req.Header.Add("Last-Event-ID", strconv.FormatInt(*since, 10))
+	}
+
+	resp, err := c.stream.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "Failed executing request")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		err := errors.Errorf("Unknown response from API: %s", string(body))
+		if resp.StatusCode < 500 {
+			return stopWatching{err}
+		}
+		return err
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "data:") {
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+			continue
+		}
+		if line != "" || len(data) == 0 {
+			continue
+		}
+		var change Change
+		if err := json.Unmarshal([]byte(strings.Join(data, "\n")), &change); err != nil {
+			return errors.Wrap(err, "Failed to unmarshal change from JSON")
+		}
+		data = data[:0]
+		if err := fn(&change); err != nil {
+			return stopWatching{err}
+		}
+		*since = change.Sequence
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrap(err, "Failed to read stream")
+	}
+	return errors.New("Stream closed by the API")
+}
+
+// VerifyWebhook checks a delivery received by a webhook was signed with
+// secret no longer than tolerance ago, and returns its event.
+func VerifyWebhook(secret string, header http.Header, body []byte, tolerance time.Duration) (*Event, error) {
+	timestamp, err := strconv.ParseInt(header.Get("X-HBL-Timestamp"), 10, 64)
+	if err != nil {
+		return nil, errors.New("Header X-HBL-Timestamp must be a Unix timestamp")
+	}
+	if age := time.Since(time.Unix(timestamp, 0)); age > tolerance || age < -tolerance {
+		return nil, errors.New("Header X-HBL-Timestamp is too old")
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body) // nolint
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(header.Get("X-HBL-Signature"))) {
+		return nil, errors.New("Header X-HBL-Signature doesn't match")
+	}
+	var event Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, errors.Wrap(err, "Failed to unmarshal event from JSON")
+	}
+	return &event, nil
+}